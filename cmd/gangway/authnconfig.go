@@ -0,0 +1,45 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"io"
+
+	"github.com/heptiolabs/gangway/pkg/server"
+)
+
+// authnConfigCommand implements `gangway authn-config`, which writes a
+// structured AuthenticationConfiguration for the API server that matches the
+// given config to out.
+func authnConfigCommand(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("authn-config", flag.ContinueOnError)
+	var cfgFiles configFiles
+	fs.Var(&cfgFiles, "config", "The config file to generate the authentication config for. May be repeated.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	c, err := server.LoadConfig(cfgFiles...)
+	if err != nil {
+		return err
+	}
+	data, err := server.AuthenticationConfig(c)
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(data)
+	return err
+}
@@ -0,0 +1,172 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/heptiolabs/gangway/pkg/server"
+	log "github.com/sirupsen/logrus"
+)
+
+// embeddedDexStartTimeout is how long Dex gets to start serving its
+// discovery document.
+const embeddedDexStartTimeout = 30 * time.Second
+
+// embeddedDexUser is the static user Dex signs in, with the password
+// "password". The hash is the one from Dex's own example configs.
+const embeddedDexUser = "admin@example.com"
+const embeddedDexPasswordHash = "$2a$10$2b2cU8CPhOTaGrs1HRQuAueS7JTT5ZHsHSzYiFPm1leZck7Mc8T4W"
+
+// embeddedDex is a throwaway Dex for local development. It keeps everything
+// in memory and trusts gangway as its only client.
+type embeddedDex struct {
+	issuer string
+	cmd    *exec.Cmd
+	dir    string
+}
+
+// startEmbeddedDex runs the dex binary with a generated config on a free
+// local port and points c at it, filling in the client credentials, issuer
+// and redirect URL. It also sets the settings validation requires but that
+// don't matter locally, if they are missing.
+func startEmbeddedDex(c *server.Config, binary string) (*embeddedDex, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	if c.RedirectURL == "" {
+		c.RedirectURL = fmt.Sprintf("http://127.0.0.1:%d/callback", c.Port)
+	}
+	if len(c.SessionSecurityKey) == 0 {
+		c.SessionSecurityKey = server.SessionKeys{randomString()}
+	}
+	if c.APIServerURL == "" {
+		c.APIServerURL = "https://127.0.0.1:6443"
+	}
+	c.ClientID = "gangway"
+	c.ClientSecret = randomString()
+	c.IssuerURL = "http://" + addr + "/dex"
+	// discovered from the issuer
+	c.AuthorizeURL, c.TokenURL, c.JWKSURL = "", "", ""
+	// a throwaway setup, where /dev/clock helps to try out token expiry
+	c.DevMode = true
+	if c.Provider == "" {
+		c.Provider = "dex"
+	}
+	if c.UsernameClaim == "nickname" {
+		// the default, which Dex doesn't issue
+		c.UsernameClaim = "email"
+	}
+
+	dir, err := ioutil.TempDir("", "gangway-dex")
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, "config.yaml")
+	if err := ioutil.WriteFile(path, embeddedDexConfig(c, addr), 0600); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	d := &embeddedDex{issuer: c.IssuerURL, dir: dir}
+	d.cmd = exec.Command(binary, "serve", path)
+	d.cmd.Stdout, d.cmd.Stderr = os.Stderr, os.Stderr
+	if err := d.cmd.Start(); err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("starting %s: %v; install Dex from https://github.com/dexidp/dex or point -dex-binary at it", binary, err)
+	}
+	if err := d.waitReady(embeddedDexStartTimeout); err != nil {
+		d.stop()
+		return nil, err
+	}
+	log.Infof("Embedded Dex is serving %s; sign in as %s with the password \"password\", or with the example connector", d.issuer, embeddedDexUser)
+	return d, nil
+}
+
+// waitReady waits until Dex serves its discovery document, which gangway
+// reads at startup.
+func (d *embeddedDex) waitReady(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		resp, err := http.Get(d.issuer + "/.well-known/openid-configuration")
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return nil
+			}
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("embedded Dex did not start serving %s within %s", d.issuer, timeout)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// stop ends Dex and removes its config.
+func (d *embeddedDex) stop() {
+	if d.cmd.Process != nil {
+		d.cmd.Process.Kill()
+		d.cmd.Wait()
+	}
+	os.RemoveAll(d.dir)
+}
+
+// embeddedDexConfig returns the Dex config for serving c's issuer on addr.
+// Strings are quoted as JSON, which YAML accepts.
+func embeddedDexConfig(c *server.Config, addr string) []byte {
+	return []byte(fmt.Sprintf(`issuer: %q
+storage:
+  type: memory
+web:
+  http: %q
+oauth2:
+  skipApprovalScreen: true
+staticClients:
+- id: %q
+  name: gangway
+  secret: %q
+  redirectURIs:
+  - %q
+enablePasswordDB: true
+staticPasswords:
+- email: %q
+  hash: %q
+  username: admin
+  userID: 08a8684b-db88-4b73-90a9-3cd1661f5466
+connectors:
+- type: mockCallback
+  id: mock
+  name: Example
+`, c.IssuerURL, addr, c.ClientID, c.ClientSecret, c.RedirectURL, embeddedDexUser, embeddedDexPasswordHash))
+}
+
+func randomString() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,63 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/heptiolabs/gangway/pkg/server"
+	"gopkg.in/yaml.v2"
+)
+
+func TestEmbeddedDexConfig(t *testing.T) {
+	c := &server.Config{
+		ClientID:     "gangway",
+		ClientSecret: `se"cret`,
+		IssuerURL:    "http://127.0.0.1:5556/dex",
+		RedirectURL:  "http://127.0.0.1:8080/callback",
+	}
+	var dex struct {
+		Issuer        string `yaml:"issuer"`
+		StaticClients []struct {
+			ID           string   `yaml:"id"`
+			Secret       string   `yaml:"secret"`
+			RedirectURIs []string `yaml:"redirectURIs"`
+		} `yaml:"staticClients"`
+		StaticPasswords []struct {
+			Email string `yaml:"email"`
+		} `yaml:"staticPasswords"`
+	}
+	if err := yaml.Unmarshal(embeddedDexConfig(c, "127.0.0.1:5556"), &dex); err != nil {
+		t.Fatal(err)
+	}
+	if dex.Issuer != c.IssuerURL {
+		t.Errorf("got issuer %q, want %q", dex.Issuer, c.IssuerURL)
+	}
+	if len(dex.StaticClients) != 1 || dex.StaticClients[0].ID != "gangway" || dex.StaticClients[0].Secret != c.ClientSecret ||
+		strings.Join(dex.StaticClients[0].RedirectURIs, ",") != c.RedirectURL {
+		t.Errorf("Dex does not trust gangway as a client: %+v", dex.StaticClients)
+	}
+	if len(dex.StaticPasswords) != 1 || dex.StaticPasswords[0].Email != embeddedDexUser {
+		t.Errorf("got static users %+v", dex.StaticPasswords)
+	}
+}
+
+func TestEmbeddedDexMissingBinary(t *testing.T) {
+	c := &server.Config{Port: 8080}
+	if _, err := startEmbeddedDex(c, "/nonexistent/dex"); err == nil || !strings.Contains(err.Error(), "-dex-binary") {
+		t.Errorf("got error %v, want one pointing at -dex-binary", err)
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/heptiolabs/gangway/pkg/server"
+	log "github.com/sirupsen/logrus"
+)
+
+// listenFdsStart is the first file descriptor passed by systemd socket
+// activation. See sd_listen_fds(3). Graceful restarts pass listeners the same
+// way.
+const listenFdsStart = 3
+
+// inheritFdsEnv tells a process started by a graceful restart how many
+// listeners it inherited from its parent.
+const inheritFdsEnv = "GANGWAY_LISTEN_FDS"
+
+// inheritAPIFdsEnv tells it how many of them, at the end, are API listeners.
+const inheritAPIFdsEnv = "GANGWAY_API_LISTEN_FDS"
+
+// apiFdName is the FileDescriptorName of sockets for the API listeners in
+// dual listener mode.
+const apiFdName = "api"
+
+// listenerSet holds the listeners for the UI and, in dual listener mode, for
+// the API.
+type listenerSet struct {
+	ui  []net.Listener
+	api []net.Listener
+}
+
+// all returns the UI listeners followed by the API listeners.
+func (s listenerSet) all() []net.Listener {
+	return append(append([]net.Listener{}, s.ui...), s.api...)
+}
+
+func (s listenerSet) close() {
+	for _, l := range s.all() {
+		l.Close()
+	}
+}
+
+// listen returns the listeners gangway should serve on. Sockets passed in by
+// systemd socket activation or inherited from a graceful restart take
+// precedence; otherwise a TCP listener is opened for every configured bind
+// address.
+func listen(c *server.Config) (listenerSet, error) {
+	listeners, err := activatedListeners()
+	if err != nil || len(listeners.ui)+len(listeners.api) > 0 {
+		return listeners, err
+	}
+
+	listeners, err = inheritedListeners()
+	if err != nil || len(listeners.ui)+len(listeners.api) > 0 {
+		return listeners, err
+	}
+
+	listeners.ui, err = listenTCP(c.BindAddresses())
+	if err != nil {
+		return listeners, err
+	}
+	listeners.api, err = listenTCP(c.APIListenAddresses)
+	if err != nil {
+		listeners.close()
+		return listenerSet{}, err
+	}
+	return listeners, nil
+}
+
+// listenTCP opens a TCP listener on every address in addrs.
+func listenTCP(addrs []string) ([]net.Listener, error) {
+	var listeners []net.Listener
+	for _, addr := range addrs {
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			for _, opened := range listeners {
+				opened.Close()
+			}
+			return nil, err
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
+
+// activatedListeners returns the listeners passed to this process through
+// LISTEN_FDS, or none when it wasn't started by socket activation. Sockets
+// named "api" in LISTEN_FDNAMES are API listeners.
+func activatedListeners() (listenerSet, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return listenerSet{}, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return listenerSet{}, nil
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	// don't pass the sockets on to anything we start
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	listeners, err := fileListeners(n)
+	if err != nil {
+		return listenerSet{}, err
+	}
+	var set listenerSet
+	for i, l := range listeners {
+		if i < len(names) && names[i] == apiFdName {
+			set.api = append(set.api, l)
+		} else {
+			set.ui = append(set.ui, l)
+		}
+	}
+	return set, nil
+}
+
+// inheritedListeners returns the listeners handed over by a parent gangway
+// process during a graceful restart.
+func inheritedListeners() (listenerSet, error) {
+	n, err := strconv.Atoi(os.Getenv(inheritFdsEnv))
+	if err != nil || n <= 0 {
+		return listenerSet{}, nil
+	}
+	api, _ := strconv.Atoi(os.Getenv(inheritAPIFdsEnv))
+	os.Unsetenv(inheritFdsEnv)
+	os.Unsetenv(inheritAPIFdsEnv)
+	if api < 0 || api > n {
+		return listenerSet{}, fmt.Errorf("%s=%d is out of range", inheritAPIFdsEnv, api)
+	}
+
+	listeners, err := fileListeners(n)
+	if err != nil {
+		return listenerSet{}, err
+	}
+	return listenerSet{ui: listeners[:n-api], api: listeners[n-api:]}, nil
+}
+
+// fileListeners wraps the n listening sockets starting at listenFdsStart.
+func fileListeners(n int) ([]net.Listener, error) {
+	var listeners []net.Listener
+	for fd := listenFdsStart; fd < listenFdsStart+n; fd++ {
+		f := os.NewFile(uintptr(fd), fmt.Sprintf("LISTEN_FD_%d", fd))
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("inherited fd %d: %v", fd, err)
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
+
+// serve runs srv on l until the server is shut down. It exits the process if
+// the listener fails for any other reason. It serves TLS if srv has a
+// TLSConfig, which provides the certificate.
+func serve(srv *http.Server, l net.Listener) {
+	log.Infof("Listening on %s", l.Addr())
+
+	var err error
+	if srv.TLSConfig != nil {
+		err = srv.ServeTLS(l, "", "")
+	} else {
+		err = srv.Serve(l)
+	}
+	if err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+}
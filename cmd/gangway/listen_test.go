@@ -0,0 +1,91 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/heptiolabs/gangway/pkg/server"
+)
+
+func TestBindAddresses(t *testing.T) {
+	c := &server.Config{Host: "::1", Port: 8080}
+	if addrs := c.BindAddresses(); !reflect.DeepEqual(addrs, []string{"[::1]:8080"}) {
+		t.Errorf("Expected host and port to be joined, got %v", addrs)
+	}
+
+	c.ListenAddresses = []string{"127.0.0.1:8080", "[::1]:8080"}
+	if addrs := c.BindAddresses(); !reflect.DeepEqual(addrs, c.ListenAddresses) {
+		t.Errorf("Expected listenAddresses to replace host and port, got %v", addrs)
+	}
+}
+
+func TestListenMultipleAddresses(t *testing.T) {
+	c := &server.Config{ListenAddresses: []string{"127.0.0.1:0", "127.0.0.1:0"}}
+	listeners, err := listen(c)
+	if err != nil {
+		t.Fatalf("Failed to listen: %s", err)
+	}
+	defer listeners.close()
+
+	if len(listeners.ui) != 2 || len(listeners.api) != 0 {
+		t.Errorf("Expected 2 UI listeners, got %d UI and %d API listeners", len(listeners.ui), len(listeners.api))
+	}
+}
+
+func TestListenAPIAddresses(t *testing.T) {
+	c := &server.Config{ListenAddresses: []string{"127.0.0.1:0"}, APIListenAddresses: []string{"127.0.0.1:0"}}
+	listeners, err := listen(c)
+	if err != nil {
+		t.Fatalf("Failed to listen: %s", err)
+	}
+	defer listeners.close()
+
+	if len(listeners.ui) != 1 || len(listeners.api) != 1 {
+		t.Errorf("Expected 1 UI and 1 API listener, got %d and %d", len(listeners.ui), len(listeners.api))
+	}
+}
+
+func TestActivatedListenersOtherProcess(t *testing.T) {
+	os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()+1))
+	os.Setenv("LISTEN_FDS", "1")
+	defer os.Unsetenv("LISTEN_PID")
+	defer os.Unsetenv("LISTEN_FDS")
+
+	listeners, err := activatedListeners()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listeners.all()) != 0 {
+		t.Errorf("Expected sockets meant for another process to be ignored")
+	}
+}
+
+func TestRestartEnv(t *testing.T) {
+	env := restartEnv([]string{"HOME=/root", "LISTEN_FDS=1", "LISTEN_PID=42", "GANGWAY_LISTEN_FDS=1"}, 2, 0)
+	expected := []string{"HOME=/root", "GANGWAY_LISTEN_FDS=2"}
+	if !reflect.DeepEqual(env, expected) {
+		t.Errorf("Expected restart env %v, got %v", expected, env)
+	}
+
+	env = restartEnv([]string{"HOME=/root", "GANGWAY_API_LISTEN_FDS=2"}, 3, 1)
+	expected = []string{"HOME=/root", "GANGWAY_LISTEN_FDS=3", "GANGWAY_API_LISTEN_FDS=1"}
+	if !reflect.DeepEqual(env, expected) {
+		t.Errorf("Expected restart env %v, got %v", expected, env)
+	}
+}
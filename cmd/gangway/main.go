@@ -24,114 +24,243 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
-	"github.com/gorilla/sessions"
-	"github.com/justinas/alice"
+	"github.com/heptiolabs/gangway/pkg/server"
 	log "github.com/sirupsen/logrus"
-	"golang.org/x/oauth2"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
-var cfg *Config
-var oauth2Cfg *oauth2.Config
-var sessionStore *sessions.CookieStore
-var httpClient *http.Client
+// newAPIServer returns the HTTP server for the API listeners. If the config
+// sets a client CA, API clients must present a certificate it signed.
+func newAPIServer(srv *server.Server, writeTimeout time.Duration) (*http.Server, error) {
+	c := srv.Config()
+	apiServer := &http.Server{
+		Handler:      srv.API(),
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: writeTimeout,
+	}
+	if !c.APIServeTLS {
+		return apiServer, nil
+	}
 
-// wrapper function for http logging
-func httpLogger(fn http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		defer log.Printf("%s %s %s", r.Method, r.URL, r.RemoteAddr)
-		fn(w, r)
+	apiServer.TLSConfig = &tls.Config{GetCertificate: srv.GetCertificate(true)}
+	if _, err := apiServer.TLSConfig.GetCertificate(nil); err != nil {
+		return nil, err
+	}
+	if c.APIClientCAPath != "" {
+		pem, err := ioutil.ReadFile(c.APIClientCAPath)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", c.APIClientCAPath)
+		}
+		apiServer.TLSConfig.ClientCAs = pool
+		apiServer.TLSConfig.ClientAuth = tls.RequireAndVerifyClientCert
 	}
+	if err := http2.ConfigureServer(apiServer, &http2.Server{}); err != nil {
+		return nil, err
+	}
+	return apiServer, nil
 }
 
-func main() {
+// configFiles is a flag.Value that collects every -config flag given.
+type configFiles []string
 
-	cfgFile := flag.String("config", "", "The config file to use.")
-	flag.Parse()
+func (f *configFiles) String() string {
+	return strings.Join(*f, ",")
+}
 
-	var err error
-	cfg, err = NewConfig(*cfgFile)
-	if err != nil {
-		log.Errorf("Could not parse config file: %s", err)
-		os.Exit(1)
+func (f *configFiles) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+func main() {
+
+	if len(os.Args) > 1 && os.Args[1] == "manifests" {
+		if err := manifestsCommand(os.Args[2:], os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
 
-	oauth2Cfg = &oauth2.Config{
-		ClientID:     cfg.ClientID,
-		ClientSecret: cfg.ClientSecret,
-		RedirectURL:  cfg.RedirectURL,
-		Scopes:       cfg.Scopes,
-		Endpoint: oauth2.Endpoint{
-			AuthURL:  cfg.AuthorizeURL,
-			TokenURL: cfg.TokenURL,
-		},
+	if len(os.Args) > 1 && os.Args[1] == "authn-config" {
+		if err := authnConfigCommand(os.Args[2:], os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
 
-	rootCAs, _ := x509.SystemCertPool()
-	if rootCAs == nil {
-		rootCAs = x509.NewCertPool()
+	if len(os.Args) > 1 && os.Args[1] == "smoke" {
+		if err := smokeCommand(os.Args[2:], os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
 
-	if cfg.TrustedCAPath != "" {
-		// Read in the cert file
-		certs, err := ioutil.ReadFile(cfg.TrustedCAPath)
-		if err != nil {
-			log.Fatalf("Failed to append %q to RootCAs: %v", cfg.TrustedCAPath, err)
+	if len(os.Args) > 1 && os.Args[1] == "verify-config" {
+		if err := verifyConfigCommand(os.Args[2:], os.Stdout); err != nil {
+			log.Fatal(err)
 		}
+		return
+	}
 
-		// Append our cert to the system pool
-		if ok := rootCAs.AppendCertsFromPEM(certs); !ok {
-			log.Println("No certs appended, using system certs only")
+	if len(os.Args) > 1 && os.Args[1] == "verify-audit" {
+		if err := verifyAuditCommand(os.Args[2:], os.Stdin, os.Stdout); err != nil {
+			log.Fatal(err)
 		}
+		return
 	}
 
-	// Trust the augmented cert pool in our client
-	config := &tls.Config{
-		RootCAs: rootCAs,
+	var cfgFiles configFiles
+	flag.Var(&cfgFiles, "config", "The config file to use. May also be an http(s):// URL or configmap://namespace/name/key. "+
+		"Repeat to merge several files in order, later files overriding earlier ones.")
+	cfgRefresh := flag.Duration("config-refresh", 0, "How often to re-read the config source and apply changes. Disabled when 0.")
+	withDex := flag.Bool("with-embedded-dex", false, "For development: run a throwaway Dex with a static user and sign in with it. "+
+		"Overrides the identity provider settings of the config.")
+	dexBinary := flag.String("dex-binary", "dex", "The Dex binary run by -with-embedded-dex.")
+	flag.Parse()
+
+	var c *server.Config
+	var err error
+	if *withDex {
+		c, err = server.LoadConfig(cfgFiles...)
+		if err == nil {
+			var dex *embeddedDex
+			if dex, err = startEmbeddedDex(c, *dexBinary); err != nil {
+				log.Fatal(err)
+			}
+			if err = server.ValidateConfig(c); err != nil {
+				dex.stop()
+			} else {
+				defer dex.stop()
+			}
+		}
+	} else {
+		c, err = server.NewConfig(cfgFiles...)
+	}
+	if err != nil {
+		log.Errorf("Could not parse config file: %s", err)
+		os.Exit(1)
 	}
-	tr := &http.Transport{TLSClientConfig: config}
-	httpClient = &http.Client{Transport: tr}
 
-	initSessionStore()
+	srv, err := server.New(c)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	loginRequiredHandlers := alice.New(loginRequired)
+	reloadChan := make(chan os.Signal, 1)
+	if *withDex {
+		// reloads would drop the settings pointing at the embedded Dex
+		if *cfgRefresh > 0 {
+			log.Warnf("Not refreshing the config with -with-embedded-dex")
+		}
+	} else {
+		if len(reloadSignals) > 0 {
+			signal.Notify(reloadChan, reloadSignals...)
+		}
+		go server.WatchConfig(cfgFiles, c, *cfgRefresh, reloadChan, srv.ApplyConfig)
+	}
 
-	http.HandleFunc("/", httpLogger(homeHandler))
-	http.HandleFunc("/login", httpLogger(loginHandler))
-	http.HandleFunc("/callback", httpLogger(callbackHandler))
+	// create http server with timeouts. Each route enforces its own deadline,
+	// so the write timeout only needs to outlast the longest of them.
+	writeTimeout := c.RequestTimeout
+	if c.CallbackTimeout > writeTimeout {
+		writeTimeout = c.CallbackTimeout
+	}
 
-	// middleware'd routes
-	http.Handle("/logout", loginRequiredHandlers.ThenFunc(logoutHandler))
-	http.Handle("/commandline", loginRequiredHandlers.ThenFunc(commandlineHandler))
+	var handler http.Handler = srv.UI()
+	h2Server := &http2.Server{}
+	if c.EnableH2C {
+		// serve HTTP/2 over cleartext for proxies that speak h2c upstream
+		handler = h2c.NewHandler(handler, h2Server)
+	}
 
-	bindAddr := fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)
-	// create http server with timeouts
 	httpServer := &http.Server{
-		Addr:         bindAddr,
+		Handler:      handler,
 		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 10 * time.Second,
+		WriteTimeout: writeTimeout + 5*time.Second,
+		// for the device flow, which streams for longer
+		ConnContext: server.ConnContext,
+	}
+	if c.ServeTLS {
+		httpServer.TLSConfig = &tls.Config{GetCertificate: srv.GetCertificate(false)}
+		if _, err := httpServer.TLSConfig.GetCertificate(nil); err != nil {
+			log.Fatalf("Failed to load the serving certificate: %s", err)
+		}
+		if err := http2.ConfigureServer(httpServer, h2Server); err != nil {
+			log.Fatalf("Failed to enable HTTP/2: %s", err)
+		}
 	}
 
-	// start up the http server
-	go func() {
-		// exit with FATAL logging why we could not start
-		// example: FATA[0000] listen tcp 0.0.0.0:8080: bind: address already in use
-		if cfg.ServeTLS == true {
-			log.Fatal(httpServer.ListenAndServeTLS(cfg.CertFile, cfg.KeyFile))
-		} else {
-			log.Fatal(httpServer.ListenAndServe())
+	// start up the http server on every address. Exit with FATAL logging why
+	// we could not start
+	// example: FATA[0000] listen tcp 0.0.0.0:8080: bind: address already in use
+	listeners, err := listen(c)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, l := range listeners.ui {
+		go serve(httpServer, l)
+	}
+
+	// in dual listener mode the API has listeners and TLS settings of its own
+	var apiServer *http.Server
+	if len(listeners.api) > 0 {
+		apiServer, err = newAPIServer(srv, writeTimeout+5*time.Second)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, l := range listeners.api {
+			go serve(apiServer, l)
 		}
-	}()
+	}
+
+	go srv.WarmUp()
+	go srv.Janitor(c.SessionCleanupInterval)
+	go srv.WatchCertificates(time.Hour)
 
 	// create channel listening for signals so we can have graceful shutdowns
 	signalChan := make(chan os.Signal, 1)
 	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
-	<-signalChan
+	restartChan := make(chan os.Signal, 1)
+	if len(restartSignals) > 0 {
+		signal.Notify(restartChan, restartSignals...)
+	}
+
+wait:
+	for {
+		select {
+		case <-restartChan:
+			if err := restart(listeners); err != nil {
+				log.Errorf("Graceful restart failed: %s", err)
+				continue
+			}
+			log.Println("Started replacement process, draining connections.")
+			break wait
+		case sig := <-signalChan:
+			log.Println("Shutdown signal received, exiting.")
+			if delay := srv.Config().ShutdownDelay; sig == syscall.SIGTERM && delay > 0 {
+				// keep serving while load balancers notice the failing
+				// readiness probe and deregister us
+				srv.Drain()
+				log.Printf("Failing readiness for %s before draining connections.", delay)
+				time.Sleep(delay)
+			}
+			break wait
+		}
+	}
 
-	log.Println("Shutdown signal received, exiting.")
-	// close the HTTP server
+	// close the HTTP servers
+	if apiServer != nil {
+		go apiServer.Shutdown(context.Background())
+	}
 	httpServer.Shutdown(context.Background())
 
 }
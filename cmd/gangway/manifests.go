@@ -0,0 +1,322 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/heptiolabs/gangway/pkg/server"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	// manifestTLSDir is where the serving certificate secret is mounted in
+	// the generated Deployment.
+	manifestTLSDir = "/etc/gangway/tls"
+	// manifestConfigDir is where the generated ConfigMap is mounted.
+	manifestConfigDir = "/gangway"
+	// manifestSecretsDir is where the generated gangway-secrets secret is
+	// mounted.
+	manifestSecretsDir = "/etc/gangway/secrets"
+)
+
+// manifestOptions are the settings for `gangway manifests` that describe the
+// deployment rather than gangway itself.
+type manifestOptions struct {
+	Namespace     string
+	Image         string
+	Replicas      int
+	IngressClass  string
+	ClusterIssuer string
+}
+
+type manifestData struct {
+	manifestOptions
+
+	Host        string
+	Port        string
+	ServeTLS    bool
+	ConfigDir   string
+	TLSDir      string
+	SecretsDir  string
+	ConfigYAML  string
+	SecretsYAML string
+}
+
+// manifestsCommand implements `gangway manifests`, which writes Kubernetes
+// manifests for running gangway with the given config to out.
+func manifestsCommand(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("manifests", flag.ContinueOnError)
+	var cfgFiles configFiles
+	fs.Var(&cfgFiles, "config", "The config file to generate manifests for. May be repeated.")
+	opts := manifestOptions{}
+	fs.StringVar(&opts.Namespace, "namespace", "gangway", "The namespace to deploy gangway into.")
+	fs.StringVar(&opts.Image, "image", "gcr.io/heptio-images/gangway:v2.0.0", "The gangway container image.")
+	fs.IntVar(&opts.Replicas, "replicas", 1, "The number of gangway replicas.")
+	fs.StringVar(&opts.IngressClass, "ingress-class", "", "The ingressClassName to set on the Ingress.")
+	fs.StringVar(&opts.ClusterIssuer, "cluster-issuer", "", "A cert-manager ClusterIssuer. When set, a Certificate for the ingress host is generated.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	// Secrets are usually not available where manifests are generated, so
+	// secret files aren't read and the config is not validated here.
+	c, err := server.LoadConfigWithoutSecretFiles(cfgFiles...)
+	if err != nil {
+		return err
+	}
+	return writeManifests(out, c, opts)
+}
+
+// writeManifests renders the manifests for c. No secret is written to the
+// ConfigMap: the session security key is read from the gangway-key secret,
+// and the other secrets set in c go into a gangway-secrets secret that the
+// config reads through the *File options.
+func writeManifests(out io.Writer, c *server.Config, opts manifestOptions) error {
+	redirectURL, err := url.Parse(c.RedirectURL)
+	if err != nil || redirectURL.Hostname() == "" {
+		return fmt.Errorf("redirectURL must be set to an absolute URL to generate manifests")
+	}
+
+	_, port, err := net.SplitHostPort(c.BindAddresses()[0])
+	if err != nil {
+		return err
+	}
+
+	skeleton := *c
+	skeleton.SessionSecurityKey = nil
+	secrets := skeleton.MoveSecretsToFiles(manifestSecretsDir)
+	skeleton.Host = "0.0.0.0"
+	skeleton.Port, _ = strconv.Atoi(port)
+	skeleton.ListenAddresses = nil
+	if skeleton.ServeTLS {
+		skeleton.CertFile = manifestTLSDir + "/tls.crt"
+		skeleton.KeyFile = manifestTLSDir + "/tls.key"
+	}
+	configYAML, err := yaml.Marshal(&skeleton)
+	if err != nil {
+		return err
+	}
+	var secretsYAML []byte
+	if len(secrets) > 0 {
+		if secretsYAML, err = yaml.Marshal(secrets); err != nil {
+			return err
+		}
+	}
+
+	data := manifestData{
+		manifestOptions: opts,
+		Host:            redirectURL.Hostname(),
+		Port:            port,
+		ServeTLS:        c.ServeTLS,
+		ConfigDir:       manifestConfigDir,
+		TLSDir:          manifestTLSDir,
+		SecretsDir:      manifestSecretsDir,
+		ConfigYAML:      indent(string(configYAML), "    "),
+		SecretsYAML:     indent(string(secretsYAML), "  "),
+	}
+	return manifestsTemplate.Execute(out, data)
+}
+
+func indent(s, prefix string) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = prefix + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+var manifestsTemplate = template.Must(template.New("manifests").Parse(`apiVersion: v1
+kind: Namespace
+metadata:
+  name: {{ .Namespace }}
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: gangway
+  namespace: {{ .Namespace }}
+data:
+  gangway.yaml: |
+{{ .ConfigYAML }}
+---
+{{- if .SecretsYAML }}
+apiVersion: v1
+kind: Secret
+metadata:
+  name: gangway-secrets
+  namespace: {{ .Namespace }}
+type: Opaque
+stringData:
+{{ .SecretsYAML }}
+---
+{{- end }}
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: gangway
+  namespace: {{ .Namespace }}
+  labels:
+    app: gangway
+spec:
+  replicas: {{ .Replicas }}
+  selector:
+    matchLabels:
+      app: gangway
+  template:
+    metadata:
+      labels:
+        app: gangway
+    spec:
+      containers:
+        - name: gangway
+          image: {{ .Image }}
+          command: ["gangway", "-config", "{{ .ConfigDir }}/gangway.yaml"]
+          env:
+            - name: GANGWAY_SESSION_SECURITY_KEY
+              valueFrom:
+                secretKeyRef:
+                  name: gangway-key
+                  key: sesssionkey
+          ports:
+            - name: http
+              containerPort: {{ .Port }}
+              protocol: TCP
+          resources:
+            requests:
+              cpu: "100m"
+              memory: "128Mi"
+            limits:
+              cpu: "200m"
+              memory: "512Mi"
+          volumeMounts:
+            - name: gangway
+              mountPath: {{ .ConfigDir }}/
+{{- if .SecretsYAML }}
+            - name: gangway-secrets
+              mountPath: {{ .SecretsDir }}/
+              readOnly: true
+{{- end }}
+{{- if .ServeTLS }}
+            - name: gangway-tls
+              mountPath: {{ .TLSDir }}/
+              readOnly: true
+{{- end }}
+          livenessProbe:
+            httpGet:
+              path: /healthz
+              port: {{ .Port }}
+{{- if .ServeTLS }}
+              scheme: HTTPS
+{{- end }}
+            initialDelaySeconds: 20
+            timeoutSeconds: 1
+            periodSeconds: 60
+            failureThreshold: 3
+          readinessProbe:
+            httpGet:
+              path: /readyz
+              port: {{ .Port }}
+{{- if .ServeTLS }}
+              scheme: HTTPS
+{{- end }}
+            timeoutSeconds: 1
+            periodSeconds: 10
+            failureThreshold: 3
+      volumes:
+        - name: gangway
+          configMap:
+            name: gangway
+{{- if .SecretsYAML }}
+        - name: gangway-secrets
+          secret:
+            secretName: gangway-secrets
+{{- end }}
+{{- if .ServeTLS }}
+        - name: gangway-tls
+          secret:
+            secretName: gangway-tls
+{{- end }}
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: gangway
+  namespace: {{ .Namespace }}
+  labels:
+    app: gangway
+spec:
+  type: ClusterIP
+  ports:
+    - name: http
+      protocol: TCP
+      port: 80
+      targetPort: http
+  selector:
+    app: gangway
+---
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: gangway
+  namespace: {{ .Namespace }}
+{{- if .ServeTLS }}
+  annotations:
+    nginx.ingress.kubernetes.io/backend-protocol: HTTPS
+{{- end }}
+spec:
+{{- if .IngressClass }}
+  ingressClassName: {{ .IngressClass }}
+{{- end }}
+  tls:
+    - secretName: gangway
+      hosts:
+        - {{ .Host }}
+  rules:
+    - host: {{ .Host }}
+      http:
+        paths:
+          - path: /
+            pathType: Prefix
+            backend:
+              service:
+                name: gangway
+                port:
+                  name: http
+{{- if .ClusterIssuer }}
+---
+apiVersion: cert-manager.io/v1
+kind: Certificate
+metadata:
+  name: gangway
+  namespace: {{ .Namespace }}
+spec:
+  secretName: gangway
+  dnsNames:
+    - {{ .Host }}
+  issuerRef:
+    name: {{ .ClusterIssuer }}
+    kind: ClusterIssuer
+{{- end }}
+`))
@@ -0,0 +1,141 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/heptiolabs/gangway/pkg/server"
+)
+
+func TestWriteManifests(t *testing.T) {
+	c := &server.Config{
+		Host:               "0.0.0.0",
+		Port:               8443,
+		ServeTLS:           true,
+		ClusterName:        "prod",
+		RedirectURL:        "https://gangway.example.com/callback",
+		SessionSecurityKey: server.SessionKeys{"supersecret"},
+	}
+
+	tests := []struct {
+		name            string
+		opts            manifestOptions
+		wantCertificate bool
+	}{
+		{"no issuer", manifestOptions{Namespace: "auth", Image: "gangway:dev", Replicas: 2}, false},
+		{"with issuer", manifestOptions{Namespace: "auth", Image: "gangway:dev", Replicas: 2, ClusterIssuer: "letsencrypt-prod"}, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := writeManifests(&out, c, tc.opts); err != nil {
+				t.Fatalf("writeManifests: %v", err)
+			}
+			manifests := out.String()
+
+			for _, want := range []string{
+				"kind: Deployment",
+				"kind: Service",
+				"kind: Ingress",
+				"namespace: auth",
+				"image: gangway:dev",
+				"replicas: 2",
+				"containerPort: 8443",
+				"scheme: HTTPS",
+				"- host: gangway.example.com",
+				"clusterName: prod",
+				"certFile: /etc/gangway/tls/tls.crt",
+			} {
+				if !strings.Contains(manifests, want) {
+					t.Errorf("expected manifests to contain %q", want)
+				}
+			}
+			if strings.Contains(manifests, "supersecret") {
+				t.Errorf("session security key leaked into manifests")
+			}
+			if got := strings.Contains(manifests, "kind: Certificate"); got != tc.wantCertificate {
+				t.Errorf("expected Certificate: %v, got %v", tc.wantCertificate, got)
+			}
+		})
+	}
+}
+
+func TestWriteManifestsRequiresRedirectURL(t *testing.T) {
+	c := &server.Config{Host: "0.0.0.0", Port: 8080}
+	if err := writeManifests(&bytes.Buffer{}, c, manifestOptions{}); err == nil {
+		t.Errorf("expected an error without a redirectURL")
+	}
+}
+
+func TestWriteManifestsKeepsSecretsOutOfConfigMap(t *testing.T) {
+	c := &server.Config{
+		Host:                 "0.0.0.0",
+		Port:                 8080,
+		RedirectURL:          "https://gangway.example.com/callback",
+		SessionSecurityKey:   server.SessionKeys{"secret-session-key"},
+		ClientSecret:         "secret-client",
+		AdminToken:           "secret-admin",
+		DeprovisionToken:     "secret-deprovision",
+		CaptchaSecretKey:     "secret-captcha",
+		SessionSQLDSN:        "postgres://gangway:secret-dsn@db/gangway",
+		SessionRedisPassword: "secret-redis",
+		AuditSASLPassword:    "secret-sasl",
+		AuditSigningKey:      "secret-signing",
+	}
+	var out bytes.Buffer
+	if err := writeManifests(&out, c, manifestOptions{Namespace: "auth", Image: "gangway:dev", Replicas: 1}); err != nil {
+		t.Fatalf("writeManifests: %v", err)
+	}
+
+	docs := map[string]string{}
+	for _, doc := range strings.Split(out.String(), "\n---\n") {
+		for _, line := range strings.Split(doc, "\n") {
+			if strings.HasPrefix(line, "kind: ") {
+				docs[strings.TrimPrefix(line, "kind: ")] = doc
+				break
+			}
+		}
+	}
+	configMap, secret := docs["ConfigMap"], docs["Secret"]
+	if configMap == "" || secret == "" {
+		t.Fatalf("expected a ConfigMap and a Secret, got:\n%s", out.String())
+	}
+
+	for _, value := range []string{"secret-client", "secret-admin", "secret-deprovision", "secret-captcha", "secret-dsn", "secret-redis", "secret-sasl", "secret-signing"} {
+		if strings.Contains(configMap, value) {
+			t.Errorf("%q leaked into the ConfigMap", value)
+		}
+		if !strings.Contains(secret, value) {
+			t.Errorf("expected %q in the gangway-secrets secret", value)
+		}
+	}
+	if strings.Contains(out.String(), "secret-session-key") {
+		t.Errorf("session security key leaked into manifests")
+	}
+	for _, want := range []string{
+		"clientSecretFile: /etc/gangway/secrets/clientSecret",
+		"auditSigningKeyFile: /etc/gangway/secrets/auditSigningKey",
+	} {
+		if !strings.Contains(configMap, want) {
+			t.Errorf("expected ConfigMap to contain %q", want)
+		}
+	}
+	if !strings.Contains(out.String(), "secretName: gangway-secrets") {
+		t.Errorf("expected the Deployment to mount gangway-secrets")
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// restart starts a new copy of the running binary that inherits the given
+// listeners, so the binary can be replaced without refusing connections. The
+// caller should then drain in-flight requests and exit.
+func restart(set listenerSet) error {
+	listeners := set.all()
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	files := []*os.File{os.Stdin, os.Stdout, os.Stderr}
+	defer func() {
+		for _, f := range files[3:] {
+			f.Close()
+		}
+	}()
+	for _, l := range listeners {
+		fl, ok := l.(interface {
+			File() (*os.File, error)
+		})
+		if !ok {
+			return fmt.Errorf("cannot hand over listener on %s", l.Addr())
+		}
+		f, err := fl.File()
+		if err != nil {
+			return err
+		}
+		files = append(files, f)
+	}
+
+	_, err = os.StartProcess(exe, os.Args, &os.ProcAttr{
+		Env:   restartEnv(os.Environ(), len(listeners), len(set.api)),
+		Files: files,
+	})
+	return err
+}
+
+// restartEnv returns env for a restarted process that inherits n listeners,
+// the last api of which are API listeners.
+func restartEnv(env []string, n, api int) []string {
+	out := make([]string, 0, len(env)+2)
+	for _, kv := range env {
+		if strings.HasPrefix(kv, "LISTEN_") || strings.HasPrefix(kv, inheritFdsEnv+"=") || strings.HasPrefix(kv, inheritAPIFdsEnv+"=") {
+			continue
+		}
+		out = append(out, kv)
+	}
+	out = append(out, fmt.Sprintf("%s=%d", inheritFdsEnv, n))
+	if api > 0 {
+		out = append(out, fmt.Sprintf("%s=%d", inheritAPIFdsEnv, api))
+	}
+	return out
+}
@@ -0,0 +1,255 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// smokeCheck is one check `gangway smoke` makes against a running gangway.
+type smokeCheck struct {
+	name string
+	run  func(s *smokeTest) error
+}
+
+// smokeTest is a run of `gangway smoke` against the gangway at baseURL.
+type smokeTest struct {
+	baseURL      string
+	timeout      time.Duration
+	dexConnector string
+}
+
+// smokeResult collects the outcomes of one check over every run.
+type smokeResult struct {
+	mu        sync.Mutex
+	durations []time.Duration
+	failed    int
+	firstErr  error
+}
+
+func (r *smokeResult) record(d time.Duration, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.durations = append(r.durations, d)
+	if err != nil {
+		r.failed++
+		if r.firstErr == nil {
+			r.firstErr = err
+		}
+	}
+}
+
+// percentile returns the duration below which p of the checks completed.
+func (r *smokeResult) percentile(p float64) time.Duration {
+	if len(r.durations) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration(nil), r.durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[int(p*float64(len(sorted)-1))]
+}
+
+// smokeCommand implements `gangway smoke`, which checks a running gangway
+// from the outside, as a gate after a deployment. Repeated with -requests
+// and -concurrency it doubles as a light load generator.
+func smokeCommand(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("smoke", flag.ContinueOnError)
+	baseURL := fs.String("url", "", "The URL gangway is served at, e.g. https://gangway.example.com.")
+	codeFlow := fs.Bool("code-flow", false, "Also sign in through the identity provider. It must sign in without a login form, "+
+		"as the embedded Dex of -with-embedded-dex does with -dex-connector=mock.")
+	dexConnector := fs.String("dex-connector", "", "The Dex connector to sign in with in the code flow, skipping Dex's choice of connectors.")
+	requests := fs.Int("requests", 1, "How many times to run the checks.")
+	concurrency := fs.Int("concurrency", 1, "How many runs to make at once.")
+	timeout := fs.Duration("timeout", 10*time.Second, "The timeout of each check.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *baseURL == "" {
+		return errors.New("-url is required")
+	}
+	if *requests < 1 || *concurrency < 1 {
+		return errors.New("-requests and -concurrency must be positive")
+	}
+
+	checks := []smokeCheck{
+		{"healthz", (*smokeTest).checkHealthz},
+		{"readyz", (*smokeTest).checkReadyz},
+		{"home", (*smokeTest).checkHome},
+		{"login redirect", (*smokeTest).checkLoginRedirect},
+	}
+	if *codeFlow {
+		checks = append(checks, smokeCheck{"code flow", (*smokeTest).checkCodeFlow})
+	}
+	s := &smokeTest{baseURL: strings.TrimSuffix(*baseURL, "/"), timeout: *timeout, dexConnector: *dexConnector}
+	results := s.run(checks, *requests, *concurrency)
+
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "CHECK\tOK\tFAILED\tP50\tP95\tMAX")
+	failed := 0
+	for i, check := range checks {
+		r := results[i]
+		failed += r.failed
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s\t%s\n", check.name, len(r.durations)-r.failed, r.failed,
+			r.percentile(.5).Round(time.Millisecond), r.percentile(.95).Round(time.Millisecond), r.percentile(1).Round(time.Millisecond))
+	}
+	w.Flush()
+	for i, check := range checks {
+		if err := results[i].firstErr; err != nil {
+			fmt.Fprintf(out, "%s: %s\n", check.name, err)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(checks)**requests)
+	}
+	return nil
+}
+
+// run runs every check requests times, concurrency runs at a time.
+func (s *smokeTest) run(checks []smokeCheck, requests, concurrency int) []*smokeResult {
+	results := make([]*smokeResult, len(checks))
+	for i := range results {
+		results[i] = &smokeResult{}
+	}
+	runs := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range runs {
+				for j, check := range checks {
+					start := time.Now()
+					err := check.run(s)
+					results[j].record(time.Since(start), err)
+				}
+			}
+		}()
+	}
+	for i := 0; i < requests; i++ {
+		runs <- struct{}{}
+	}
+	close(runs)
+	wg.Wait()
+	return results
+}
+
+// client returns a client for one check. It has a cookie jar of its own and
+// follows redirects if follow is set.
+func (s *smokeTest) client(follow bool) *http.Client {
+	jar, _ := cookiejar.New(nil)
+	c := &http.Client{Jar: jar, Timeout: s.timeout}
+	if !follow {
+		c.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	}
+	return c
+}
+
+// get requests path on gangway and checks the status of the response, unless
+// status is 0.
+func (s *smokeTest) get(client *http.Client, path string, status int) (*http.Response, error) {
+	resp, err := client.Get(s.baseURL + path)
+	if err != nil {
+		return nil, err
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	if status != 0 && resp.StatusCode != status {
+		return resp, fmt.Errorf("GET %s: got %s, want %d", resp.Request.URL, resp.Status, status)
+	}
+	return resp, nil
+}
+
+func (s *smokeTest) checkHealthz() error {
+	_, err := s.get(s.client(false), "/healthz", http.StatusOK)
+	return err
+}
+
+func (s *smokeTest) checkReadyz() error {
+	_, err := s.get(s.client(false), "/readyz", http.StatusOK)
+	return err
+}
+
+func (s *smokeTest) checkHome() error {
+	resp, err := s.get(s.client(false), "/", http.StatusOK)
+	if err != nil {
+		return err
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		return fmt.Errorf("GET /: got Content-Type %q, want text/html", ct)
+	}
+	return nil
+}
+
+// checkLoginRedirect checks that /login sends users to the identity provider
+// with the parameters of an authorization code request.
+func (s *smokeTest) checkLoginRedirect() error {
+	resp, err := s.get(s.client(false), "/login", 0)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 300 || resp.StatusCode > 399 {
+		return fmt.Errorf("GET /login: got %s, want a redirect", resp.Status)
+	}
+	authorize, err := resp.Location()
+	if err != nil {
+		return fmt.Errorf("GET /login: %v", err)
+	}
+	q := authorize.Query()
+	if q.Get("response_type") != "code" {
+		return fmt.Errorf("GET /login: redirected with response_type %q, want code", q.Get("response_type"))
+	}
+	for _, param := range []string{"client_id", "redirect_uri", "state"} {
+		if q.Get(param) == "" {
+			return fmt.Errorf("GET /login: redirected without %s", param)
+		}
+	}
+	return nil
+}
+
+// checkCodeFlow signs in through the identity provider and checks that it
+// ends on the commandline page.
+func (s *smokeTest) checkCodeFlow() error {
+	client := s.client(true)
+	if s.dexConnector != "" {
+		// go straight to the connector, past Dex's choice of connectors
+		client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			if len(via) == 1 && strings.HasSuffix(req.URL.Path, "/auth") {
+				req.URL.Path += "/" + url.PathEscape(s.dexConnector)
+			}
+			return nil
+		}
+	}
+	resp, err := s.get(client, "/login", http.StatusOK)
+	if err != nil {
+		return err
+	}
+	if end := resp.Request.URL; !strings.HasSuffix(end.Path, "/commandline") {
+		return fmt.Errorf("sign in ended at %s://%s%s rather than the commandline page; "+
+			"the identity provider may have asked for credentials", end.Scheme, end.Host, end.Path)
+	}
+	return nil
+}
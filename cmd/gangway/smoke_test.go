@@ -0,0 +1,52 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/heptiolabs/gangway/pkg/server"
+	"github.com/heptiolabs/gangway/pkg/server/servertest"
+)
+
+func TestSmoke(t *testing.T) {
+	c, err := server.LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.APIServerURL = "https://k8s.example.com"
+	h := servertest.New(t, c)
+	defer h.Close()
+	h.IdP.SetClaims(map[string]interface{}{"nickname": "jane", "email": "jane@example.com"})
+
+	// not warmed up yet
+	var out bytes.Buffer
+	if err := smokeCommand([]string{"-url", h.HTTP.URL}, &out); err == nil {
+		t.Errorf("expected the readyz check to fail before warm-up:\n%s", out.String())
+	}
+
+	h.Server.WarmUp()
+	out.Reset()
+	if err := smokeCommand([]string{"-url", h.HTTP.URL + "/", "-code-flow", "-requests", "4", "-concurrency", "2"}, &out); err != nil {
+		t.Fatalf("smoke test failed: %v\n%s", err, out.String())
+	}
+	for _, check := range []string{"healthz", "readyz", "home", "login redirect", "code flow"} {
+		if !strings.Contains(out.String(), check+" ") {
+			t.Errorf("output doesn't report the %s check:\n%s", check, out.String())
+		}
+	}
+}
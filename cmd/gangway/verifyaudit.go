@@ -0,0 +1,59 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/heptiolabs/gangway/pkg/server"
+)
+
+// verifyAuditCommand implements `gangway verify-audit`, which checks the
+// signatures and chains of audit events exported one JSON event per line,
+// read from the files given or from in.
+func verifyAuditCommand(args []string, in io.Reader, out io.Writer) error {
+	fs := flag.NewFlagSet("verify-audit", flag.ContinueOnError)
+	var cfgFiles configFiles
+	fs.Var(&cfgFiles, "config", "The config file with the auditSigningKey the events were signed with. May be repeated.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	c, err := server.LoadConfig(cfgFiles...)
+	if err != nil {
+		return err
+	}
+	readers := []io.Reader{in}
+	if fs.NArg() > 0 {
+		readers = nil
+		for _, name := range fs.Args() {
+			f, err := os.Open(name)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			readers = append(readers, f)
+		}
+	}
+	n, err := server.VerifyAuditLog(c, io.MultiReader(readers...))
+	if err != nil {
+		return fmt.Errorf("verified %d events before: %v", n, err)
+	}
+	fmt.Fprintf(out, "%d events verified\n", n)
+	return nil
+}
@@ -0,0 +1,50 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/heptiolabs/gangway/pkg/server"
+)
+
+// verifyConfigCommand implements `gangway verify-config`, which checks the
+// given config as a CI job or deployment hook would before a rollout, and
+// writes every problem found to out.
+func verifyConfigCommand(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("verify-config", flag.ContinueOnError)
+	var cfgFiles configFiles
+	fs.Var(&cfgFiles, "config", "The config file to verify. May be repeated.")
+	offline := fs.Bool("offline", false, "Skip the checks that contact the identity provider.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	c, err := server.LoadConfig(cfgFiles...)
+	if err != nil {
+		return err
+	}
+	problems := server.VerifyConfig(c, *offline)
+	for _, problem := range problems {
+		fmt.Fprintf(out, "FAIL: %s\n", problem)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%d problems found", len(problems))
+	}
+	fmt.Fprintln(out, "Config OK")
+	return nil
+}
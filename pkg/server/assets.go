@@ -0,0 +1,83 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"crypto/sha512"
+	"encoding/base64"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+const (
+	staticBase = "/static"
+)
+
+// Static assets are embedded alongside the templates. Their Subresource
+// Integrity hashes are computed on first use.
+var (
+	assetIntegrityLock sync.Mutex
+	assetIntegrity     = map[string]string{}
+)
+
+// templateFuncs are available to every template.
+var templateFuncs = template.FuncMap{
+	"integrity": integrity,
+	"join":      strings.Join,
+	"base64":    func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) },
+}
+
+// integrity returns the Subresource Integrity value for an embedded static
+// asset, for use in the integrity attribute of script and link tags.
+func integrity(asset string) (string, error) {
+	assetIntegrityLock.Lock()
+	defer assetIntegrityLock.Unlock()
+
+	if sri, ok := assetIntegrity[asset]; ok {
+		return sri, nil
+	}
+
+	data, err := FSByte(false, path.Join(staticBase, asset))
+	if err != nil {
+		return "", err
+	}
+	sum := sha512.Sum384(data)
+	sri := "sha384-" + base64.StdEncoding.EncodeToString(sum[:])
+	assetIntegrity[asset] = sri
+	return sri, nil
+}
+
+// staticHandler serves the embedded static assets under /static/.
+func staticHandler(w http.ResponseWriter, r *http.Request) {
+	name := path.Clean("/" + strings.TrimPrefix(r.URL.Path, staticBase+"/"))
+	f, err := FS(false).Open(staticBase + name)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil || fi.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	http.ServeContent(w, r, fi.Name(), fi.ModTime(), f)
+}
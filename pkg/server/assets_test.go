@@ -0,0 +1,73 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"crypto/sha512"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestStaticHandler(t *testing.T) {
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{"/static/js/init.js", http.StatusOK},
+		{"/static/js/", http.StatusNotFound},
+		{"/static/js/missing.js", http.StatusNotFound},
+		{"/static/../templates/home.tmpl", http.StatusNotFound},
+	}
+	for _, tc := range tests {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/", nil)
+		req.URL.Path = tc.path
+		staticHandler(rr, req)
+		if rr.Code != tc.status {
+			t.Errorf("GET %s: got status %d, want %d", tc.path, rr.Code, tc.status)
+		}
+	}
+}
+
+func TestIntegrityMatchesServedAsset(t *testing.T) {
+	rr := httptest.NewRecorder()
+	staticHandler(rr, httptest.NewRequest("GET", "/static/js/init.js", nil))
+	sum := sha512.Sum384(rr.Body.Bytes())
+	want := "sha384-" + base64.StdEncoding.EncodeToString(sum[:])
+
+	got, err := integrity("js/init.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("integrity(js/init.js) = %q, want %q", got, want)
+	}
+
+	a := newTestApp(t)
+	rr = httptest.NewRecorder()
+	a.homeHandler(rr, httptest.NewRequest("GET", "/", nil))
+	if !strings.Contains(rr.Body.String(), `integrity="`+want+`"`) {
+		t.Errorf("home page does not carry the integrity hash of init.js")
+	}
+	for _, tag := range regexp.MustCompile(`<script [^>]*>`).FindAllString(rr.Body.String(), -1) {
+		if !strings.Contains(tag, `integrity="`) {
+			t.Errorf("home page loads a script without integrity: %s", tag)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	auditSinkKafka  = "kafka"
+	auditSinkNATS   = "nats"
+	auditSinkSQLite = "sqlite"
+)
+
+// auditQueueSize is how many audit events may wait to be published before
+// further ones are dropped, so that a slow event backbone can't hold up
+// logins.
+const auditQueueSize = 1024
+
+// Audit event types.
+const (
+	auditLogin       = "login"
+	auditLoginFailed = "login_failed"
+	auditLogout      = "logout"
+	auditRefresh     = "refresh"
+)
+
+// auditEvent records something gangway did for a user, such as issuing
+// credentials.
+type auditEvent struct {
+	Time      time.Time `json:"time"`
+	Type      string    `json:"type"`
+	RequestID string    `json:"requestID"`
+	Cluster   string    `json:"cluster"`
+	User      string    `json:"user,omitempty"`
+	ClientIP  string    `json:"clientIP"`
+	UserAgent string    `json:"userAgent,omitempty"`
+	// Reason says why a login failed.
+	Reason string `json:"reason,omitempty"`
+
+	// Chain, Seq, Prev and Signature are set when events are signed; see
+	// auditSigner.
+	Chain     string `json:"chain,omitempty"`
+	Seq       int64  `json:"seq,omitempty"`
+	Prev      string `json:"prev,omitempty"`
+	Signature string `json:"signature,omitempty"`
+}
+
+// auditPublisher sends encoded audit events to an event backbone.
+type auditPublisher interface {
+	// publish sends one event. user is the event's user, which backbones
+	// that partition by key use to keep a user's events in order.
+	publish(user string, data []byte) error
+	close() error
+}
+
+// auditSink publishes audit events in the background.
+type auditSink struct {
+	publisher auditPublisher
+	// id identifies the publisher settings, so that a config reload can
+	// tell whether the sink can be kept.
+	id string
+	// signer signs the events, if they are signed.
+	signer *auditSigner
+
+	events  chan *auditEvent
+	done    chan struct{}
+	dropped int64
+}
+
+func startAuditSink(publisher auditPublisher, id string, signer *auditSigner) *auditSink {
+	s := &auditSink{
+		publisher: publisher,
+		id:        id,
+		signer:    signer,
+		events:    make(chan *auditEvent, auditQueueSize),
+		done:      make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+func (s *auditSink) run() {
+	defer close(s.done)
+	for e := range s.events {
+		var err error
+		if s.signer != nil {
+			err = s.signer.sign(e)
+		}
+		var data []byte
+		if err == nil {
+			data, err = json.Marshal(e)
+		}
+		if err == nil {
+			err = s.publisher.publish(e.User, data)
+		}
+		if err != nil {
+			log.Errorf("Failed to publish %s audit event %s: %s", e.Type, e.RequestID, err)
+		}
+	}
+}
+
+// send queues e for publishing, or drops it if the queue is full.
+func (s *auditSink) send(e *auditEvent) {
+	select {
+	case s.events <- e:
+	default:
+		if atomic.AddInt64(&s.dropped, 1)%100 == 1 {
+			log.Errorf("Audit queue is full, dropped %d events so far", atomic.LoadInt64(&s.dropped))
+		}
+	}
+}
+
+// close publishes the queued events and closes the publisher.
+func (s *auditSink) close() error {
+	close(s.events)
+	<-s.done
+	return s.publisher.close()
+}
+
+// newAuditSink returns the audit sink for c, or nil if audit events aren't
+// published. The sink of previous is kept if c didn't change its settings.
+func newAuditSink(c *Config, previous *auditSink) (*auditSink, error) {
+	if c.AuditSink == "" {
+		return nil, nil
+	}
+	id := auditSinkID(c)
+	if previous != nil && previous.id == id {
+		return previous, nil
+	}
+
+	tlsConfig, err := c.auditTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	var publisher auditPublisher
+	switch c.AuditSink {
+	case auditSinkKafka:
+		publisher, err = newKafkaPublisher(c, tlsConfig)
+	case auditSinkNATS:
+		publisher, err = newNATSPublisher(c, tlsConfig)
+	case auditSinkSQLite:
+		publisher, err = newSQLiteAuditStore(c.AuditSQLitePath)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("connecting to the %s audit sink: %v", c.AuditSink, err)
+	}
+	return startAuditSink(publisher, id, newAuditSigner(c.AuditSigningKey)), nil
+}
+
+// auditSinkID identifies the audit sink settings of c.
+func auditSinkID(c *Config) string {
+	return strings.Join([]string{c.AuditSink, strings.Join(c.AuditKafkaBrokers, ","), c.AuditKafkaTopic,
+		c.AuditNATSURL, c.AuditNATSSubject, fmt.Sprint(c.AuditTLS), c.AuditTLSCAFile, c.AuditTLSCertFile,
+		c.AuditTLSKeyFile, c.AuditSASLUser, c.AuditSASLPassword, c.AuditSQLitePath, c.AuditSigningKey}, "|")
+}
+
+// releaseAuditSink closes old unless current still uses it.
+func releaseAuditSink(old, current *auditSink) {
+	if old != nil && old != current {
+		if err := old.close(); err != nil {
+			log.Errorf("Failed to close audit sink: %s", err)
+		}
+	}
+}
+
+// auditTLSConfig returns the TLS settings for the audit sink, or nil if it
+// doesn't use TLS.
+func (c *Config) auditTLSConfig() (*tls.Config, error) {
+	if !c.AuditTLS {
+		return nil, nil
+	}
+	config := &tls.Config{}
+	if c.AuditTLSCAFile != "" {
+		pem, err := ioutil.ReadFile(c.AuditTLSCAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", c.AuditTLSCAFile)
+		}
+	}
+	if c.AuditTLSCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.AuditTLSCertFile, c.AuditTLSKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// audit records an event of type typ about user for r.
+func (a *app) audit(r *http.Request, typ, user, reason string) {
+	if a.auditSink == nil {
+		return
+	}
+	a.auditSink.send(&auditEvent{
+		Time:      time.Now().UTC(),
+		Type:      typ,
+		RequestID: requestID(r),
+		Cluster:   a.cfg.ClusterName,
+		User:      user,
+		ClientIP:  clientAddr(r),
+		UserAgent: r.UserAgent(),
+		Reason:    reason,
+	})
+}
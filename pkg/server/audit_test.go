@@ -0,0 +1,75 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// fakePublisher records what it is asked to publish.
+type fakePublisher struct {
+	published [][]byte
+	closed    bool
+}
+
+func (f *fakePublisher) publish(user string, data []byte) error {
+	f.published = append(f.published, data)
+	return nil
+}
+
+func (f *fakePublisher) close() error {
+	f.closed = true
+	return nil
+}
+
+func TestAuditLoginFailed(t *testing.T) {
+	a := newTestApp(t)
+	a.cfg.ClusterName = "prod"
+	publisher := &fakePublisher{}
+	a.auditSink = startAuditSink(publisher, "fake", nil)
+
+	req := httptest.NewRequest("GET", "/callback?error=access_denied", nil)
+	a.withRequestID(http.HandlerFunc(a.callbackHandler)).ServeHTTP(httptest.NewRecorder(), req)
+	releaseAuditSink(a.auditSink, nil)
+
+	if !publisher.closed || len(publisher.published) != 1 {
+		t.Fatalf("got %d events, closed: %v", len(publisher.published), publisher.closed)
+	}
+	var e auditEvent
+	if err := json.Unmarshal(publisher.published[0], &e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Type != auditLoginFailed || e.Reason != "access_denied" || e.Cluster != "prod" || e.RequestID == "" {
+		t.Errorf("got event %+v", e)
+	}
+}
+
+func TestNewAuditSinkReusesPublisher(t *testing.T) {
+	c := &Config{}
+	if s, err := newAuditSink(c, nil); s != nil || err != nil {
+		t.Errorf("got sink %v, error %v without auditSink", s, err)
+	}
+
+	c = &Config{AuditSink: auditSinkNATS, AuditNATSURL: "nats://nats:4222", AuditNATSSubject: "gangway.audit"}
+	previous := startAuditSink(&fakePublisher{}, auditSinkID(c), nil)
+	defer previous.close()
+	s, err := newAuditSink(c, previous)
+	if err != nil || s != previous {
+		t.Errorf("unchanged settings got a new sink: %v", err)
+	}
+}
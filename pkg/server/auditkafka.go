@@ -0,0 +1,63 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"crypto/tls"
+
+	"github.com/Shopify/sarama"
+)
+
+// kafkaPublisher publishes audit events to a Kafka topic, keyed by user.
+type kafkaPublisher struct {
+	producer sarama.SyncProducer
+	topic    string
+}
+
+func newKafkaPublisher(c *Config, tlsConfig *tls.Config) (*kafkaPublisher, error) {
+	config := sarama.NewConfig()
+	config.ClientID = "gangway"
+	// audit events must not be lost when the partition leader fails
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	config.Producer.Return.Successes = true
+	if tlsConfig != nil {
+		config.Net.TLS.Enable = true
+		config.Net.TLS.Config = tlsConfig
+	}
+	if c.AuditSASLUser != "" {
+		config.Net.SASL.Enable = true
+		config.Net.SASL.User = c.AuditSASLUser
+		config.Net.SASL.Password = c.AuditSASLPassword
+	}
+
+	producer, err := sarama.NewSyncProducer(c.AuditKafkaBrokers, config)
+	if err != nil {
+		return nil, err
+	}
+	return &kafkaPublisher{producer: producer, topic: c.AuditKafkaTopic}, nil
+}
+
+func (k *kafkaPublisher) publish(user string, data []byte) error {
+	_, _, err := k.producer.SendMessage(&sarama.ProducerMessage{
+		Topic: k.topic,
+		Key:   sarama.StringEncoder(user),
+		Value: sarama.ByteEncoder(data),
+	})
+	return err
+}
+
+func (k *kafkaPublisher) close() error {
+	return k.producer.Close()
+}
@@ -0,0 +1,55 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"crypto/tls"
+
+	"github.com/nats-io/go-nats"
+)
+
+// natsPublisher publishes audit events to a NATS subject.
+type natsPublisher struct {
+	conn    *nats.Conn
+	subject string
+}
+
+func newNATSPublisher(c *Config, tlsConfig *tls.Config) (*natsPublisher, error) {
+	// keep reconnecting rather than giving up on the sink for good
+	options := []nats.Option{nats.Name("gangway"), nats.MaxReconnects(-1)}
+	if tlsConfig != nil {
+		options = append(options, nats.Secure(tlsConfig))
+	}
+	if c.AuditSASLUser != "" {
+		options = append(options, nats.UserInfo(c.AuditSASLUser, c.AuditSASLPassword))
+	}
+
+	conn, err := nats.Connect(c.AuditNATSURL, options...)
+	if err != nil {
+		return nil, err
+	}
+	return &natsPublisher{conn: conn, subject: c.AuditNATSSubject}, nil
+}
+
+func (n *natsPublisher) publish(user string, data []byte) error {
+	return n.conn.Publish(n.subject, data)
+}
+
+// close flushes what is buffered in the client before closing.
+func (n *natsPublisher) close() error {
+	err := n.conn.Flush()
+	n.conn.Close()
+	return err
+}
@@ -0,0 +1,77 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuditSigning(t *testing.T) {
+	c := &Config{AuditSigningKey: "audit-key"}
+	publisher := &fakePublisher{}
+	sink := startAuditSink(publisher, "fake", newAuditSigner(c.AuditSigningKey))
+	for _, user := range []string{"jane", "joe", "jane"} {
+		sink.send(&auditEvent{Time: time.Now().UTC(), Type: auditLogin, User: user})
+	}
+	// a second process has a chain of its own
+	other := &fakePublisher{}
+	otherSink := startAuditSink(other, "fake", newAuditSigner(c.AuditSigningKey))
+	otherSink.send(&auditEvent{Time: time.Now().UTC(), Type: auditLogout, User: "joe"})
+	sink.close()
+	otherSink.close()
+
+	log := func(events ...[]byte) *bytes.Reader {
+		return bytes.NewReader(append(bytes.Join(events, []byte("\n")), '\n'))
+	}
+	p := publisher.published
+	if n, err := VerifyAuditLog(c, log(p[0], other.published[0], p[1], p[2])); err != nil || n != 4 {
+		t.Fatalf("verified %d events: %v", n, err)
+	}
+	// the order within a chain comes from the events themselves
+	if n, err := VerifyAuditLog(c, log(p[2], p[1], p[0])); err != nil || n != 3 {
+		t.Errorf("verified %d events latest first: %v", n, err)
+	}
+
+	var e auditEvent
+	if err := json.Unmarshal(p[1], &e); err != nil {
+		t.Fatal(err)
+	}
+	e.User = "mallory"
+	altered, _ := json.Marshal(&e)
+
+	tests := []struct {
+		name   string
+		events [][]byte
+		want   string
+	}{
+		{"altered", [][]byte{p[0], altered, p[2]}, "signature does not match"},
+		{"removed", [][]byte{p[0], p[2]}, "missing or duplicated"},
+		{"duplicated", [][]byte{p[0], p[1], p[1], p[2]}, "missing or duplicated"},
+		{"unsigned", [][]byte{[]byte(`{"type":"login"}`)}, "not signed"},
+	}
+	for _, tc := range tests {
+		if _, err := VerifyAuditLog(c, log(tc.events...)); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: got error %v, want %q", tc.name, err, tc.want)
+		}
+	}
+
+	if _, err := VerifyAuditLog(&Config{AuditSigningKey: "other-key"}, log(p...)); err == nil {
+		t.Errorf("expected events signed with another key to fail")
+	}
+}
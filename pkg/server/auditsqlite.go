@@ -0,0 +1,238 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3" // registers the sqlite3 driver
+)
+
+// Limits on how many events a query of the audit API returns.
+const (
+	defaultAuditQueryLimit = 100
+	maxAuditQueryLimit     = 1000
+)
+
+// sqliteAuditMigrations are applied in order on startup. Never edit an
+// existing entry; append a new one instead.
+var sqliteAuditMigrations = []string{
+	`CREATE TABLE IF NOT EXISTS gangway_audit (
+		time INTEGER NOT NULL,
+		type TEXT NOT NULL,
+		user TEXT NOT NULL,
+		data TEXT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS gangway_audit_time ON gangway_audit (time)`,
+	`CREATE INDEX IF NOT EXISTS gangway_audit_user_time ON gangway_audit (user, time)`,
+}
+
+// sqliteAuditStore keeps audit events in a SQLite file, for single node
+// installs that want a searchable history without running an event backbone.
+type sqliteAuditStore struct {
+	db *sql.DB
+}
+
+func newSQLiteAuditStore(path string) (*sqliteAuditStore, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows one writer at a time
+	db.SetMaxOpenConns(1)
+
+	s := &sqliteAuditStore{db: db}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrating audit database %s: %v", path, err)
+	}
+	return s, nil
+}
+
+// migrate applies the migrations the database hasn't seen yet.
+func (s *sqliteAuditStore) migrate() error {
+	var version int
+	if err := s.db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return err
+	}
+	for ; version < len(sqliteAuditMigrations); version++ {
+		if _, err := s.db.Exec(sqliteAuditMigrations[version]); err != nil {
+			return err
+		}
+		if _, err := s.db.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, version+1)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// publish stores an encoded event, keeping the fields it can be searched by
+// in columns of their own.
+func (s *sqliteAuditStore) publish(user string, data []byte) error {
+	var e auditEvent
+	if err := json.Unmarshal(data, &e); err != nil {
+		return err
+	}
+	_, err := s.db.Exec(`INSERT INTO gangway_audit (time, type, user, data) VALUES (?, ?, ?, ?)`,
+		e.Time.UnixNano(), e.Type, user, string(data))
+	return err
+}
+
+func (s *sqliteAuditStore) close() error {
+	return s.db.Close()
+}
+
+// auditQuery selects audit events. Zero fields don't restrict the result.
+type auditQuery struct {
+	User  string
+	Type  string
+	Since time.Time
+	Until time.Time
+	Limit int
+
+	// Failed selects failed logins if true and everything else if false,
+	// when set.
+	Failed *bool
+}
+
+// where returns the WHERE clause selecting q's events, and its arguments.
+func (q *auditQuery) where() (string, []interface{}) {
+	var conds []string
+	var args []interface{}
+	if q.User != "" {
+		conds = append(conds, "user = ?")
+		args = append(args, q.User)
+	}
+	if q.Type != "" {
+		conds = append(conds, "type = ?")
+		args = append(args, q.Type)
+	}
+	if q.Failed != nil {
+		if *q.Failed {
+			conds = append(conds, "type = ?")
+		} else {
+			conds = append(conds, "type <> ?")
+		}
+		args = append(args, auditLoginFailed)
+	}
+	if !q.Since.IsZero() {
+		conds = append(conds, "time >= ?")
+		args = append(args, q.Since.UnixNano())
+	}
+	if !q.Until.IsZero() {
+		conds = append(conds, "time < ?")
+		args = append(args, q.Until.UnixNano())
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+// query returns the events q selects, latest first.
+func (s *sqliteAuditStore) query(q *auditQuery) ([]json.RawMessage, error) {
+	where, args := q.where()
+	rows, err := s.db.Query(`SELECT data FROM gangway_audit`+where+` ORDER BY time DESC LIMIT ?`, append(args, q.Limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	events := []json.RawMessage{}
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		events = append(events, json.RawMessage(data))
+	}
+	return events, rows.Err()
+}
+
+// parseAuditQuery reads an audit query from the parameters user, type,
+// result (success or failure), since and until (RFC 3339) and limit.
+func parseAuditQuery(values url.Values) (*auditQuery, error) {
+	q := &auditQuery{User: values.Get("user"), Type: values.Get("type"), Limit: defaultAuditQueryLimit}
+	switch result := values.Get("result"); result {
+	case "":
+	case "success", "failure":
+		failed := result == "failure"
+		q.Failed = &failed
+	default:
+		return nil, errors.New("result must be success or failure")
+	}
+	for key, t := range map[string]*time.Time{"since": &q.Since, "until": &q.Until} {
+		if v := values.Get(key); v != "" {
+			parsed, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return nil, fmt.Errorf("%s must be an RFC 3339 time", key)
+			}
+			*t = parsed
+		}
+	}
+	if v := values.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 || limit > maxAuditQueryLimit {
+			return nil, fmt.Errorf("limit must be between 1 and %d", maxAuditQueryLimit)
+		}
+		q.Limit = limit
+	}
+	return q, nil
+}
+
+// auditStore returns the store audit events are kept in, or nil if they are
+// only published elsewhere.
+func (a *app) auditStore() *sqliteAuditStore {
+	if a.auditSink == nil {
+		return nil
+	}
+	s, _ := a.auditSink.publisher.(*sqliteAuditStore)
+	return s
+}
+
+// auditHandler serves the stored audit events matching the query
+// parameters, for /api/v1/audit.
+func (a *app) auditHandler(w http.ResponseWriter, r *http.Request) {
+	store := a.auditStore()
+	if store == nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	q, err := parseAuditQuery(r.URL.Query())
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error":             "invalid_request",
+			"error_description": err.Error(),
+		})
+		return
+	}
+	events, err := store.query(q)
+	if err != nil {
+		requestLog(r).Errorf("Could not query audit events: %s", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "server_error"})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"events": events})
+}
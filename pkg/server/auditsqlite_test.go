@@ -0,0 +1,130 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseAuditQuery(t *testing.T) {
+	since := time.Date(2018, 6, 1, 0, 0, 0, 0, time.UTC)
+	q, err := parseAuditQuery(url.Values{
+		"user":   {"jane"},
+		"result": {"failure"},
+		"since":  {since.Format(time.RFC3339)},
+		"limit":  {"10"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	where, args := q.where()
+	if want := " WHERE user = ? AND type = ? AND time >= ?"; where != want {
+		t.Errorf("got %q, want %q", where, want)
+	}
+	if want := []interface{}{"jane", auditLoginFailed, since.UnixNano()}; !reflect.DeepEqual(args, want) {
+		t.Errorf("got arguments %v, want %v", args, want)
+	}
+	if q.Limit != 10 {
+		t.Errorf("got limit %d", q.Limit)
+	}
+
+	if q, _ := parseAuditQuery(url.Values{}); q.Limit != defaultAuditQueryLimit {
+		t.Errorf("got limit %d without one, want %d", q.Limit, defaultAuditQueryLimit)
+	}
+	for _, bad := range []url.Values{
+		{"result": {"maybe"}},
+		{"since": {"yesterday"}},
+		{"limit": {"0"}},
+		{"limit": {"100000"}},
+	} {
+		if _, err := parseAuditQuery(bad); err == nil {
+			t.Errorf("accepted %v", bad)
+		}
+	}
+}
+
+func TestAuditHandlerWithoutStore(t *testing.T) {
+	a := newTestApp(t)
+	rr := httptest.NewRecorder()
+	a.auditHandler(rr, httptest.NewRequest("GET", "/api/v1/audit", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("got status %d without a sqlite audit sink, want %d", rr.Code, http.StatusNotFound)
+	}
+}
+
+func TestSQLiteAuditStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gangway")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := newSQLiteAuditStore(filepath.Join(dir, "audit.db"))
+	if err != nil && strings.Contains(err.Error(), "requires cgo") {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := newTestApp(t)
+	a.auditSink = startAuditSink(store, "sqlite", nil)
+	start := time.Now()
+	for _, e := range []struct{ typ, user string }{
+		{auditLogin, "jane"},
+		{auditLoginFailed, "jane"},
+		{auditLogin, "joe"},
+	} {
+		a.audit(httptest.NewRequest("GET", "/callback", nil), e.typ, e.user, "")
+	}
+	// wait for the sink to write them
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if events, _ := store.query(&auditQuery{Limit: 10}); len(events) == 3 {
+			break
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	a.auditHandler(rr, httptest.NewRequest("GET", "/api/v1/audit?user=jane&result=success&since="+url.QueryEscape(start.Add(-time.Second).Format(time.RFC3339)), nil))
+	var resp struct {
+		Events []auditEvent `json:"events"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Events) != 1 || resp.Events[0].User != "jane" || resp.Events[0].Type != auditLogin {
+		t.Errorf("got events %+v, want jane's login", resp.Events)
+	}
+	releaseAuditSink(a.auditSink, nil)
+
+	// events are kept across restarts
+	store, err = newSQLiteAuditStore(filepath.Join(dir, "audit.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.close()
+	if events, err := store.query(&auditQuery{Limit: 10}); err != nil || len(events) != 3 {
+		t.Errorf("got %d events after reopening, %v", len(events), err)
+	}
+}
@@ -0,0 +1,257 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+
+	"github.com/dgrijalva/jwt-go"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/oauth2"
+	"gopkg.in/yaml.v2"
+)
+
+// API servers from Kubernetes 1.29 on may be configured with a structured
+// AuthenticationConfiguration instead of the --oidc-* flags. Gangway can
+// generate one that matches its config, and, given the API server's, checks
+// logins against its claim validation rules and previews the username and
+// groups that its claim mappings produce. CEL expressions are only
+// understood in their simplest forms, claims.name and "prefix" + claims.name.
+
+const (
+	authenticationConfigAPIVersion = "apiserver.config.k8s.io/v1beta1"
+	authenticationConfigKind       = "AuthenticationConfiguration"
+)
+
+type authenticationConfiguration struct {
+	APIVersion string             `yaml:"apiVersion"`
+	Kind       string             `yaml:"kind"`
+	JWT        []jwtAuthenticator `yaml:"jwt"`
+}
+
+type jwtAuthenticator struct {
+	Issuer               jwtIssuer             `yaml:"issuer"`
+	ClaimValidationRules []claimValidationRule `yaml:"claimValidationRules,omitempty"`
+	ClaimMappings        claimMappings         `yaml:"claimMappings"`
+}
+
+type jwtIssuer struct {
+	URL       string   `yaml:"url"`
+	Audiences []string `yaml:"audiences"`
+}
+
+type claimValidationRule struct {
+	Claim         string `yaml:"claim,omitempty"`
+	RequiredValue string `yaml:"requiredValue,omitempty"`
+	Expression    string `yaml:"expression,omitempty"`
+	Message       string `yaml:"message,omitempty"`
+}
+
+type claimMappings struct {
+	Username prefixedClaimOrExpression `yaml:"username"`
+	Groups   prefixedClaimOrExpression `yaml:"groups,omitempty"`
+}
+
+// prefixedClaimOrExpression maps a claim to the username or groups. The
+// username prefix must be set whenever the claim is, if only to "", hence
+// the pointer.
+type prefixedClaimOrExpression struct {
+	Claim      string  `yaml:"claim,omitempty"`
+	Prefix     *string `yaml:"prefix,omitempty"`
+	Expression string  `yaml:"expression,omitempty"`
+}
+
+// AuthenticationConfig returns an AuthenticationConfiguration for the API
+// server that trusts the ID tokens gangway hands out, with the same claims
+// and prefixes that gangway shows users.
+func AuthenticationConfig(c *Config) ([]byte, error) {
+	if c.IssuerURL == "" || c.ClientID == "" {
+		return nil, fmt.Errorf("issuerURL and clientID are required to generate an authentication config")
+	}
+	usernamePrefix := c.OIDCUsernamePrefix
+	switch {
+	case usernamePrefix == noOIDCPrefix:
+		usernamePrefix = ""
+	case usernamePrefix == "" && c.UsernameClaim != "email":
+		// what the API server would default --oidc-username-prefix to
+		usernamePrefix = c.IssuerURL + "#"
+	}
+	groupsPrefix := c.OIDCGroupsPrefix
+
+	return yaml.Marshal(&authenticationConfiguration{
+		APIVersion: authenticationConfigAPIVersion,
+		Kind:       authenticationConfigKind,
+		JWT: []jwtAuthenticator{{
+			Issuer: jwtIssuer{URL: c.IssuerURL, Audiences: []string{c.ClientID}},
+			ClaimMappings: claimMappings{
+				Username: prefixedClaimOrExpression{Claim: c.UsernameClaim, Prefix: &usernamePrefix},
+				Groups:   prefixedClaimOrExpression{Claim: c.groupsClaim(), Prefix: &groupsPrefix},
+			},
+		}},
+	})
+}
+
+// loadJWTAuthenticator reads the API server's authentication config at path
+// and returns its authenticator for c's issuer, which must accept c's client
+// ID.
+func loadJWTAuthenticator(path string, c *Config) (*jwtAuthenticator, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config authenticationConfiguration
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if config.Kind != authenticationConfigKind {
+		return nil, fmt.Errorf("%s: kind is %q, not %s", path, config.Kind, authenticationConfigKind)
+	}
+
+	for i := range config.JWT {
+		authn := &config.JWT[i]
+		if c.IssuerURL != "" && authn.Issuer.URL != c.IssuerURL {
+			continue
+		}
+		if !containsString(authn.Issuer.Audiences, c.ClientID) {
+			return nil, fmt.Errorf("%s: the authenticator for %s doesn't accept clientID %q as an audience", path, authn.Issuer.URL, c.ClientID)
+		}
+		for _, rule := range authn.ClaimValidationRules {
+			if rule.Expression != "" {
+				log.Warnf("%s: gangway doesn't check claim validation expressions such as %q; logins it lets through may still be rejected by the API server", path, rule.Expression)
+			}
+		}
+		return authn, nil
+	}
+	return nil, fmt.Errorf("%s has no JWT authenticator for issuer %q", path, c.IssuerURL)
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// checkClaims returns the message of the first claim validation rule claims
+// break, or "" if they pass them all.
+func (authn *jwtAuthenticator) checkClaims(claims jwt.MapClaims) string {
+	for _, rule := range authn.ClaimValidationRules {
+		if rule.Claim == "" {
+			continue
+		}
+		if value, _ := claims[rule.Claim].(string); value != rule.RequiredValue {
+			if rule.Message != "" {
+				return rule.Message
+			}
+			return fmt.Sprintf("the %s claim must be %q", rule.Claim, rule.RequiredValue)
+		}
+	}
+	return ""
+}
+
+var (
+	claimExpressionPattern         = regexp.MustCompile(`^claims\.([A-Za-z_][A-Za-z0-9_]*)$`)
+	prefixedClaimExpressionPattern = regexp.MustCompile(`^(?:"([^"\\]*)"|'([^'\\]*)')\s*\+\s*claims\.([A-Za-z_][A-Za-z0-9_]*)$`)
+)
+
+// claimAndPrefix returns the claim and prefix m maps, or false if it is an
+// expression gangway can't evaluate.
+func (m prefixedClaimOrExpression) claimAndPrefix() (claim, prefix string, ok bool) {
+	if m.Expression == "" {
+		if m.Prefix != nil {
+			prefix = *m.Prefix
+		}
+		return m.Claim, prefix, true
+	}
+	if match := claimExpressionPattern.FindStringSubmatch(m.Expression); match != nil {
+		return match[1], "", true
+	}
+	if match := prefixedClaimExpressionPattern.FindStringSubmatch(m.Expression); match != nil {
+		return match[3], match[1] + match[2], true
+	}
+	return "", "", false
+}
+
+// mapIdentity returns the username and groups the API server derives from
+// claims. ok is false if the mappings can't be evaluated by gangway.
+func (authn *jwtAuthenticator) mapIdentity(claims jwt.MapClaims) (username string, groups []string, ok bool) {
+	claim, prefix, ok := authn.ClaimMappings.Username.claimAndPrefix()
+	if !ok {
+		return "", nil, false
+	}
+	if value, _ := claims[claim].(string); value != "" {
+		username = prefix + value
+	}
+
+	m := authn.ClaimMappings.Groups
+	if m.Claim == "" && m.Expression == "" {
+		return username, nil, true
+	}
+	claim, prefix, ok = m.claimAndPrefix()
+	if !ok {
+		return "", nil, false
+	}
+	for _, group := range claimStrings(claims, claim) {
+		groups = append(groups, prefix+group)
+	}
+	return username, groups, true
+}
+
+// identityMapping returns the claims and prefixes of authn's claim mappings,
+// or nil if they can't be evaluated by gangway.
+func (authn *jwtAuthenticator) identityMapping() *identityMapping {
+	m := &identityMapping{Source: "the API server's authentication config"}
+	var ok bool
+	if m.UsernameClaim, m.UsernamePrefix, ok = authn.ClaimMappings.Username.claimAndPrefix(); !ok {
+		return nil
+	}
+	if groups := authn.ClaimMappings.Groups; groups.Claim != "" || groups.Expression != "" {
+		if m.GroupsClaim, m.GroupsPrefix, ok = groups.claimAndPrefix(); !ok {
+			return nil
+		}
+	}
+	return m
+}
+
+// checkClaimRules returns why the API server's claim validation rules would
+// reject token's ID token, or "" if they wouldn't or aren't known.
+func (a *app) checkClaimRules(token *oauth2.Token) string {
+	if a.authn == nil {
+		return ""
+	}
+	idToken, _ := token.Extra("id_token").(string)
+	claims := a.idTokenClaims(idToken)
+	if claims == nil {
+		return ""
+	}
+	return a.authn.checkClaims(claims)
+}
+
+// kubernetesIdentity returns the username and groups the API server sees for
+// a user with the given claims and groups. With the API server's
+// authentication config they come from its claim mappings, and the username
+// is empty if those can't be evaluated; otherwise from the configured
+// prefixes.
+func (a *app) kubernetesIdentity(claims jwt.MapClaims, username string, groups []string) (string, []string) {
+	if a.authn != nil {
+		username, groups, _ := a.authn.mapIdentity(claims)
+		return username, groups
+	}
+	return a.cfg.kubernetesUsername(username), a.cfg.kubernetesGroups(groups)
+}
@@ -0,0 +1,157 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"gopkg.in/yaml.v2"
+)
+
+func TestAuthenticationConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gangway")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "authn.yaml")
+
+	tests := []struct {
+		usernameClaim  string
+		usernamePrefix string
+		wantPrefix     string
+	}{
+		// the API server's default for claims other than email
+		{"sub", "", "https://idp.example.com#"},
+		{"email", "", ""},
+		{"sub", noOIDCPrefix, ""},
+		{"sub", "oidc:", "oidc:"},
+	}
+	for _, tt := range tests {
+		c := &Config{IssuerURL: "https://idp.example.com", ClientID: "gangway", UsernameClaim: tt.usernameClaim,
+			OIDCUsernamePrefix: tt.usernamePrefix, OIDCGroupsPrefix: "oidc:"}
+		data, err := AuthenticationConfig(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var config authenticationConfiguration
+		if err := yaml.Unmarshal(data, &config); err != nil {
+			t.Fatal(err)
+		}
+		if config.Kind != authenticationConfigKind || len(config.JWT) != 1 {
+			t.Fatalf("got:\n%s", data)
+		}
+		m := config.JWT[0].ClaimMappings
+		if m.Username.Prefix == nil || *m.Username.Prefix != tt.wantPrefix {
+			t.Errorf("claim %s, prefix %q: got username prefix %v, want %q", tt.usernameClaim, tt.usernamePrefix, m.Username.Prefix, tt.wantPrefix)
+		}
+
+		// what gangway generates, it accepts
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		authn, err := loadJWTAuthenticator(path, c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		username, groups, ok := authn.mapIdentity(jwt.MapClaims{tt.usernameClaim: "jane", "groups": []interface{}{"dev"}})
+		if !ok || username != tt.wantPrefix+"jane" || !reflect.DeepEqual(groups, []string{"oidc:dev"}) {
+			t.Errorf("claim %s, prefix %q: got username %q and groups %v", tt.usernameClaim, tt.usernamePrefix, username, groups)
+		}
+	}
+}
+
+func TestLoadJWTAuthenticator(t *testing.T) {
+	config := `apiVersion: apiserver.config.k8s.io/v1beta1
+kind: AuthenticationConfiguration
+jwt:
+- issuer:
+    url: https://other.example.com
+    audiences: [other]
+  claimMappings:
+    username:
+      claim: sub
+      prefix: ""
+- issuer:
+    url: https://idp.example.com
+    audiences: [kubernetes, gangway]
+  claimValidationRules:
+  - claim: hd
+    requiredValue: example.com
+  - expression: claims.email_verified == true
+  claimMappings:
+    username:
+      expression: '"oidc:" + claims.email'
+    groups:
+      claim: roles
+      prefix: ""
+`
+	dir, err := ioutil.TempDir("", "gangway")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "authn.yaml")
+	if err := ioutil.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	authn, err := loadJWTAuthenticator(path, &Config{IssuerURL: "https://idp.example.com", ClientID: "gangway"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reason := authn.checkClaims(jwt.MapClaims{"hd": "example.com"}); reason != "" {
+		t.Errorf("valid claims were rejected: %s", reason)
+	}
+	if reason := authn.checkClaims(jwt.MapClaims{"hd": "gmail.com"}); !strings.Contains(reason, "hd") {
+		t.Errorf("got reason %q for the wrong hd claim", reason)
+	}
+	username, groups, ok := authn.mapIdentity(jwt.MapClaims{"email": "jane@example.com", "roles": "admin"})
+	if !ok || username != "oidc:jane@example.com" || !reflect.DeepEqual(groups, []string{"admin"}) {
+		t.Errorf("got username %q and groups %v (%v)", username, groups, ok)
+	}
+
+	if _, err := loadJWTAuthenticator(path, &Config{IssuerURL: "https://idp.example.com", ClientID: "dashboard"}); err == nil {
+		t.Error("an authenticator that doesn't accept the client ID was accepted")
+	}
+	if _, err := loadJWTAuthenticator(path, &Config{IssuerURL: "https://idp.example.com/", ClientID: "gangway"}); err == nil {
+		t.Error("an authenticator for another issuer was accepted")
+	}
+}
+
+func TestMapIdentityExpressions(t *testing.T) {
+	tests := []struct {
+		expression string
+		username   string
+		ok         bool
+	}{
+		{"claims.email", "jane@example.com", true},
+		{`'oidc:' + claims.email`, "oidc:jane@example.com", true},
+		{`claims.email.split("@")[0]`, "", false},
+	}
+	for _, tt := range tests {
+		authn := &jwtAuthenticator{ClaimMappings: claimMappings{Username: prefixedClaimOrExpression{Expression: tt.expression}}}
+		username, _, ok := authn.mapIdentity(jwt.MapClaims{"email": "jane@example.com"})
+		if username != tt.username || ok != tt.ok {
+			t.Errorf("%s: got %q (%v), want %q (%v)", tt.expression, username, ok, tt.username, tt.ok)
+		}
+	}
+}
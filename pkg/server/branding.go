@@ -0,0 +1,68 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"regexp"
+	"strings"
+)
+
+const defaultBannerColor = "red"
+
+// bannerColorPattern matches materialize color classes such as "red" or
+// "amber darken-2".
+var bannerColorPattern = regexp.MustCompile(`^[a-z]+(-[a-z]+)?( (lighten|darken|accent)-[1-4])?$`)
+
+// clusterBranding describes a cluster to users, so that they can tell it
+// apart from others before they use the credentials gangway gives them.
+type clusterBranding struct {
+	Description string
+	Environment string
+	Contact     string
+	DocsURL     string
+
+	// Banner is shown prominently on pages that hand out credentials.
+	Banner      string
+	BannerColor string
+}
+
+func brandingFor(c *Config) clusterBranding {
+	bannerColor := c.ClusterBannerColor
+	if bannerColor == "" {
+		bannerColor = defaultBannerColor
+	}
+	return clusterBranding{
+		Description: c.ClusterDescription,
+		Environment: c.ClusterEnvironment,
+		Contact:     c.ClusterContact,
+		DocsURL:     c.ClusterDocsURL,
+		Banner:      c.ClusterBanner,
+		BannerColor: bannerColor,
+	}
+}
+
+// EnvironmentColor returns the materialize color class for the environment
+// badge. Production stands out the most.
+func (b clusterBranding) EnvironmentColor() string {
+	switch env := strings.ToLower(b.Environment); {
+	case strings.HasPrefix(env, "prod"):
+		return "red"
+	case strings.HasPrefix(env, "stag"):
+		return "orange"
+	case strings.HasPrefix(env, "dev"), strings.HasPrefix(env, "test"):
+		return "green"
+	}
+	return "grey"
+}
@@ -0,0 +1,216 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"golang.org/x/oauth2"
+)
+
+// maxClockSkew is how far the ID token's timestamps may be off from gangway's
+// clock before a login is rejected as clock skew.
+const maxClockSkew = 5 * time.Minute
+
+// callbackError is a classified login failure, with guidance for the user
+// and the operator.
+type callbackError struct {
+	// kind identifies the failure in logs
+	kind    string
+	status  int
+	message string
+	hint    string
+}
+
+var (
+	errCookieMissing = &callbackError{
+		kind:    "cookie_missing",
+		status:  http.StatusForbidden,
+		message: "Your browser did not send back the cookie gangway set when you started to sign in.",
+		hint:    "Make sure cookies are allowed for this site, and open gangway directly in your browser rather than from inside another application. Private browsing modes and strict tracking protection can also block it.",
+	}
+	errSessionInvalid = &callbackError{
+		kind:    "session_invalid",
+		status:  http.StatusBadRequest,
+		message: "gangway could not read the cookie your browser sent back.",
+		hint:    "Start over. If this keeps happening, clear the cookies for this site.",
+	}
+	errStateMismatch = &callbackError{
+		kind:    "state_mismatch",
+		status:  http.StatusForbidden,
+		message: "This sign in response doesn't belong to your current sign in.",
+		hint:    "This happens when you start signing in from several tabs at once, or use the browser's back button during sign in. Close the other tabs and start over.",
+	}
+	errLoginExpired = &callbackError{
+		kind:    "login_expired",
+		status:  http.StatusForbidden,
+		message: "Your sign in took too long and expired.",
+		hint:    "Start over and finish signing in with your identity provider within a few minutes.",
+	}
+	errClockSkew = &callbackError{
+		kind:    "clock_skew",
+		status:  http.StatusBadGateway,
+		message: "The identity provider's clock and gangway's clock disagree, so the issued token can't be used.",
+		hint:    "Please contact your administrator. The clocks of gangway and the identity provider need to be synchronized, e.g. with NTP.",
+	}
+	errIDTokenInvalid = &callbackError{
+		kind:    "id_token_invalid",
+		status:  http.StatusBadGateway,
+		message: "The token the identity provider issued could not be verified, so gangway did not sign you in.",
+		hint:    "Start over. If this keeps happening, contact your administrator. gangway's log says what is wrong with the token; often the jwksURL or clientID in gangway's config doesn't match the identity provider.",
+	}
+	errBadClientSecret = &callbackError{
+		kind:    "invalid_client",
+		status:  http.StatusBadGateway,
+		message: "The identity provider did not accept gangway's client credentials.",
+		hint:    "Please contact your administrator. The clientID and clientSecret in gangway's config must match the client registered with the identity provider.",
+	}
+	errRedirectMismatch = &callbackError{
+		kind:    "redirect_mismatch",
+		status:  http.StatusBadGateway,
+		message: "The identity provider did not accept gangway's redirect URL.",
+		hint:    "Please contact your administrator. The redirectURL in gangway's config must be registered exactly, including the scheme and any trailing slash, as a callback URL with the identity provider.",
+	}
+	errAccessDenied = &callbackError{
+		kind:    "access_denied",
+		status:  http.StatusForbidden,
+		message: "The identity provider did not let you sign in to gangway.",
+		hint:    "If you cancelled signing in, start over. Otherwise ask your administrator to give you access to this application with the identity provider.",
+	}
+	errExchangeFailed = &callbackError{
+		kind:    "exchange_failed",
+		status:  http.StatusBadGateway,
+		message: "gangway could not get your token from the identity provider.",
+		hint:    "Please try again. If this keeps happening, contact your administrator.",
+	}
+)
+
+// classifyAuthError classifies an error returned to the callback by the
+// identity provider, per RFC 6749 section 4.1.2.1.
+func classifyAuthError(code, description string) *callbackError {
+	switch {
+	case code == "access_denied":
+		return errAccessDenied
+	case strings.Contains(code, "redirect") || strings.Contains(strings.ToLower(description), "redirect"):
+		return errRedirectMismatch
+	case code == "unauthorized_client" || code == "invalid_client":
+		return errBadClientSecret
+	}
+	return errExchangeFailed
+}
+
+// classifyExchangeError classifies an error from exchanging the code for
+// tokens.
+func classifyExchangeError(err error) *callbackError {
+	re, ok := err.(*oauth2.RetrieveError)
+	if !ok {
+		return errExchangeFailed
+	}
+	var body struct {
+		Error       string `json:"error"`
+		Description string `json:"error_description"`
+	}
+	json.Unmarshal(re.Body, &body)
+	if body.Error == "invalid_client" || body.Error == "unauthorized_client" ||
+		(body.Error == "" && re.Response != nil && re.Response.StatusCode == http.StatusUnauthorized) {
+		return errBadClientSecret
+	}
+	if strings.Contains(strings.ToLower(body.Description), "redirect") {
+		return errRedirectMismatch
+	}
+	return errExchangeFailed
+}
+
+// checkClockSkew returns errClockSkew if the ID token in token was issued in
+// the future or has already expired, as far as gangway's clock is concerned.
+func (a *app) checkClockSkew(token *oauth2.Token, now time.Time) *callbackError {
+	idToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil
+	}
+	jwtToken, _ := a.parseToken(idToken)
+	if jwtToken == nil {
+		return nil
+	}
+	claims, ok := jwtToken.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil
+	}
+	if !claims.VerifyIssuedAt(now.Add(maxClockSkew).Unix(), false) || !claims.VerifyExpiresAt(now.Add(-maxClockSkew).Unix(), false) {
+		return errClockSkew
+	}
+	return nil
+}
+
+// serveCallbackError logs a classified login failure and explains it to the
+// user.
+func (a *app) serveCallbackError(w http.ResponseWriter, r *http.Request, e *callbackError, cause error) {
+	if cause != nil {
+		requestLog(r).Warnf("Login failed (%s): %s", e.kind, cause)
+	} else {
+		requestLog(r).Warnf("Login failed (%s)", e.kind)
+	}
+	a.audit(r, auditLoginFailed, "", e.kind)
+	if e == errCookieMissing {
+		a.serveCookiesBlocked(w, r, e)
+		return
+	}
+	a.serveErrorPage(w, r, e.status, e.message, e.hint)
+}
+
+type cookiesBlockedInfo struct {
+	BasePath  string
+	PublicURL string
+	Embedded  bool
+	RequestID string
+}
+
+// serveCookiesBlocked explains that the browser didn't send back the session
+// cookie. Signing in again wouldn't help, so rather than sending users round
+// the loop again it offers to open gangway in a regular browser.
+func (a *app) serveCookiesBlocked(w http.ResponseWriter, r *http.Request, e *callbackError) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(e.status)
+	serveTemplate("cookies.tmpl", &cookiesBlockedInfo{
+		BasePath:  a.basePath(r),
+		PublicURL: a.cfg.publicURL(),
+		Embedded:  embeddedBrowser(r),
+		RequestID: requestID(r),
+	}, w)
+}
+
+// embeddedBrowserMarkers are found in the user agents of in-app browsers,
+// which often don't keep cookies across the redirect to the identity
+// provider.
+var embeddedBrowserMarkers = []string{"; wv)", "FBAN/", "FBAV/", "Instagram", "Line/", "Slack", "MicroMessenger"}
+
+// embeddedBrowser reports whether r looks like it came from an in-app browser
+// or a frame.
+func embeddedBrowser(r *http.Request) bool {
+	if dest := r.Header.Get("Sec-Fetch-Dest"); dest == "iframe" || dest == "frame" {
+		return true
+	}
+	ua := r.UserAgent()
+	for _, marker := range embeddedBrowserMarkers {
+		if strings.Contains(ua, marker) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,151 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"golang.org/x/oauth2"
+)
+
+func TestClassifyCallbackErrors(t *testing.T) {
+	authErrors := []struct {
+		code, description string
+		want              *callbackError
+	}{
+		{"access_denied", "", errAccessDenied},
+		{"invalid_request", "The redirect_uri does not match", errRedirectMismatch},
+		{"redirect_uri_mismatch", "", errRedirectMismatch},
+		{"unauthorized_client", "", errBadClientSecret},
+		{"server_error", "", errExchangeFailed},
+	}
+	for _, tc := range authErrors {
+		if got := classifyAuthError(tc.code, tc.description); got != tc.want {
+			t.Errorf("%s: classified as %s, want %s", tc.code, got.kind, tc.want.kind)
+		}
+	}
+
+	exchangeErrors := []struct {
+		status int
+		body   string
+		want   *callbackError
+	}{
+		{http.StatusUnauthorized, `{"error":"invalid_client"}`, errBadClientSecret},
+		{http.StatusUnauthorized, `Unauthorized`, errBadClientSecret},
+		{http.StatusBadRequest, `{"error":"invalid_grant","error_description":"Invalid redirect_uri"}`, errRedirectMismatch},
+		{http.StatusBadRequest, `{"error":"invalid_grant"}`, errExchangeFailed},
+	}
+	for _, tc := range exchangeErrors {
+		err := &oauth2.RetrieveError{Response: &http.Response{StatusCode: tc.status}, Body: []byte(tc.body)}
+		if got := classifyExchangeError(err); got != tc.want {
+			t.Errorf("%d %s: classified as %s, want %s", tc.status, tc.body, got.kind, tc.want.kind)
+		}
+	}
+	if got := classifyExchangeError(errors.New("connection refused")); got != errExchangeFailed {
+		t.Errorf("network error classified as %s", got.kind)
+	}
+}
+
+func TestCallbackErrorPages(t *testing.T) {
+	a := newTestApp(t)
+
+	// a login started in this browser
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/login", nil)
+	session, _ := a.sessionStore.Get(req, "gangway")
+	session.Values["state"] = "xyz"
+	a.loginStates.save(session, "xyz", a.newLoginState(""))
+	session.Save(req, rr)
+	cookies := rr.Result().Cookies()
+
+	tests := []struct {
+		url     string
+		cookies bool
+		status  int
+		want    string
+	}{
+		{"/callback?state=xyz&code=abc", false, http.StatusForbidden, "Your browser didn't keep gangway's cookie"},
+		{"/callback?state=abc&code=abc", true, http.StatusForbidden, template.HTMLEscapeString(errStateMismatch.message)},
+		{"/callback?error=access_denied&state=xyz", true, http.StatusForbidden, template.HTMLEscapeString(errAccessDenied.message)},
+	}
+	for _, tc := range tests {
+		req := httptest.NewRequest("GET", tc.url, nil)
+		if tc.cookies {
+			for _, c := range cookies {
+				req.AddCookie(c)
+			}
+		}
+		rr := httptest.NewRecorder()
+		a.callbackHandler(rr, req)
+		if rr.Code != tc.status || !strings.Contains(rr.Body.String(), tc.want) {
+			t.Errorf("%s: got status %d and page:\n%s\nwant %d and %q", tc.url, rr.Code, rr.Body.String(), tc.status, tc.want)
+		}
+	}
+}
+
+func TestCookiesBlockedPage(t *testing.T) {
+	a := newTestApp(t)
+	a.cfg.RedirectURL = "https://gangway.example.com/k8s/callback"
+
+	req := httptest.NewRequest("GET", "/callback?state=xyz&code=abc", nil)
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Linux; Android 9; wv) AppleWebKit/537.36 Slack/20.01")
+	rr := httptest.NewRecorder()
+	a.callbackHandler(rr, req)
+	body := rr.Body.String()
+	for _, want := range []string{`href="https://gangway.example.com/k8s/" target="_blank"`, "inside another application or page"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("cookies page does not contain %q", want)
+		}
+	}
+
+	req = httptest.NewRequest("GET", "/callback?state=xyz&code=abc", nil)
+	if embeddedBrowser(req) {
+		t.Errorf("a plain request was taken for an embedded browser")
+	}
+}
+
+func TestCheckClockSkew(t *testing.T) {
+	a := newTestApp(t)
+	now := time.Now()
+	tests := []struct {
+		iat, exp time.Time
+		skewed   bool
+	}{
+		{now, now.Add(time.Hour), false},
+		{now.Add(time.Minute), now.Add(time.Hour), false},
+		{now.Add(time.Hour), now.Add(2 * time.Hour), true},
+		{now.Add(-2 * time.Hour), now.Add(-time.Hour), true},
+	}
+	for i, tc := range tests {
+		idToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"iat": tc.iat.Unix(),
+			"exp": tc.exp.Unix(),
+		}).SignedString([]byte("secret"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		token := (&oauth2.Token{}).WithExtra(map[string]interface{}{"id_token": idToken})
+		if skewed := a.checkClockSkew(token, now) != nil; skewed != tc.skewed {
+			t.Errorf("case %d: skewed %v, want %v", i, skewed, tc.skewed)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// captchaProvider describes a CAPTCHA service's widget and verification API.
+type captchaProvider struct {
+	scriptURL   string
+	widgetClass string
+	// responseField is the form field the widget fills with its token
+	responseField string
+	verifyURL     string
+}
+
+var captchaProviders = map[string]captchaProvider{
+	"recaptcha": {
+		scriptURL:     "https://www.google.com/recaptcha/api.js",
+		widgetClass:   "g-recaptcha",
+		responseField: "g-recaptcha-response",
+		verifyURL:     "https://www.google.com/recaptcha/api/siteverify",
+	},
+	"turnstile": {
+		scriptURL:     "https://challenges.cloudflare.com/turnstile/v0/api.js",
+		widgetClass:   "cf-turnstile",
+		responseField: "cf-turnstile-response",
+		verifyURL:     "https://challenges.cloudflare.com/turnstile/v0/siteverify",
+	},
+}
+
+// captchaNames returns the names accepted for Config.Captcha, sorted.
+func captchaNames() []string {
+	names := make([]string, 0, len(captchaProviders))
+	for name := range captchaProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type captchaInfo struct {
+	BasePath    string
+	Action      string
+	ScriptURL   string
+	WidgetClass string
+	SiteKey     string
+}
+
+// serveCaptcha shows the challenge that has to be solved before signing in.
+// The form posts back to /login with the same query, so where to return to
+// after signing in is kept.
+func (a *app) serveCaptcha(w http.ResponseWriter, r *http.Request) {
+	p := captchaProviders[a.cfg.Captcha]
+	action := a.appURL(r, "/login")
+	if r.URL.RawQuery != "" {
+		action += "?" + r.URL.RawQuery
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	serveTemplate("captcha.tmpl", &captchaInfo{
+		BasePath:    a.basePath(r),
+		Action:      action,
+		ScriptURL:   p.scriptURL,
+		WidgetClass: p.widgetClass,
+		SiteKey:     a.cfg.CaptchaSiteKey,
+	}, w)
+}
+
+// verifyCaptcha checks the token the widget posted with the CAPTCHA service.
+// It returns false if the challenge wasn't solved, and an error if the
+// service couldn't be asked.
+func (a *app) verifyCaptcha(r *http.Request) (bool, error) {
+	p := captchaProviders[a.cfg.Captcha]
+	response := r.PostFormValue(p.responseField)
+	if response == "" {
+		return false, nil
+	}
+
+	resp, err := a.httpClient.PostForm(p.verifyURL, url.Values{
+		"secret":   {a.cfg.CaptchaSecretKey},
+		"response": {response},
+		"remoteip": {clientAddr(r)},
+	})
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("%s returned %s", p.verifyURL, resp.Status)
+	}
+
+	var result struct {
+		Success    bool     `json:"success"`
+		ErrorCodes []string `json:"error-codes"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return false, fmt.Errorf("decoding %s response: %v", p.verifyURL, err)
+	}
+	for _, code := range result.ErrorCodes {
+		// these mean gangway is misconfigured rather than the user failed
+		if strings.HasPrefix(code, "missing-input-secret") || strings.HasPrefix(code, "invalid-input-secret") {
+			return false, fmt.Errorf("%s rejected captchaSecretKey: %s", p.verifyURL, code)
+		}
+	}
+	return result.Success, nil
+}
+
+// captchaPassed serves the challenge or an error and returns false unless r
+// is a form post with a solved challenge. It always returns true when no
+// CAPTCHA is configured.
+func (a *app) captchaPassed(w http.ResponseWriter, r *http.Request) bool {
+	if a.cfg.Captcha == "" {
+		return true
+	}
+	if r.Method != http.MethodPost {
+		a.serveCaptcha(w, r)
+		return false
+	}
+	ok, err := a.verifyCaptcha(r)
+	if err != nil {
+		requestLog(r).Errorf("Could not verify CAPTCHA: %s", err)
+		a.serveErrorPage(w, r, http.StatusBadGateway, "gangway could not check that you are not a robot.", "Please try again. If this keeps happening, contact your administrator.")
+		return false
+	}
+	if !ok {
+		requestLog(r).Warnf("CAPTCHA failed for %s", clientAddr(r))
+		a.serveErrorPage(w, r, http.StatusForbidden, "The challenge was not solved.", "Start over and complete the challenge before signing in.")
+		return false
+	}
+	return true
+}
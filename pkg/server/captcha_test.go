@@ -0,0 +1,78 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestLoginCaptcha(t *testing.T) {
+	verifier := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.PostFormValue("secret") != "secret-key":
+			fmt.Fprint(w, `{"success": false, "error-codes": ["invalid-input-secret"]}`)
+		case r.PostFormValue("response") == "solved":
+			fmt.Fprint(w, `{"success": true}`)
+		default:
+			fmt.Fprint(w, `{"success": false, "error-codes": ["invalid-input-response"]}`)
+		}
+	}))
+	defer verifier.Close()
+	saved := captchaProviders["turnstile"]
+	defer func() { captchaProviders["turnstile"] = saved }()
+	p := saved
+	p.verifyURL = verifier.URL
+	captchaProviders["turnstile"] = p
+
+	a := newTestApp(t)
+	a.cfg.Captcha = "turnstile"
+	a.cfg.CaptchaSiteKey = "site-key"
+	a.cfg.CaptchaSecretKey = "secret-key"
+
+	rr := httptest.NewRecorder()
+	a.loginHandler(rr, httptest.NewRequest("GET", "/login?return_to=/commandline", nil))
+	body := rr.Body.String()
+	for _, want := range []string{`class="cf-turnstile" data-sitekey="site-key"`, `action="/login?return_to=/commandline"`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("challenge page does not contain %q", want)
+		}
+	}
+
+	tests := []struct {
+		response string
+		secret   string
+		status   int
+	}{
+		{"solved", "secret-key", http.StatusTemporaryRedirect},
+		{"wrong", "secret-key", http.StatusForbidden},
+		{"", "secret-key", http.StatusForbidden},
+		{"solved", "stale-key", http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		a.cfg.CaptchaSecretKey = tt.secret
+		req := httptest.NewRequest("POST", "/login", strings.NewReader(url.Values{"cf-turnstile-response": {tt.response}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+		a.loginHandler(rr, req)
+		if rr.Code != tt.status {
+			t.Errorf("response %q with secret %q: got status %d, want %d", tt.response, tt.secret, rr.Code, tt.status)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultCertExpiryWarning is how long before a serving certificate expires
+// that warnings start, unless Config.CertExpiryWarning says otherwise.
+const defaultCertExpiryWarning = 14 * 24 * time.Hour
+
+// servingCert is a certificate gangway serves, with the listeners it is
+// served on.
+type servingCert struct {
+	listener string
+	path     string
+}
+
+// servingCerts returns the certificates c serves.
+func (c *Config) servingCerts() []servingCert {
+	var certs []servingCert
+	if c.ServeTLS {
+		certs = append(certs, servingCert{listener: "ui", path: c.CertFile})
+	}
+	if c.APIServeTLS && len(c.APIListenAddresses) > 0 {
+		certs = append(certs, servingCert{listener: "api", path: c.APICertFile})
+	}
+	return certs
+}
+
+// certificateExpiry returns when the first certificate in the PEM file at
+// path expires.
+func certificateExpiry(path string) (time.Time, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return time.Time{}, errors.New("no certificate in " + path)
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("%s: %v", path, err)
+		}
+		return cert.NotAfter, nil
+	}
+}
+
+// WatchCertificates checks the serving certificates every interval, logging a
+// warning while one is within Config.CertExpiryWarning of expiring and an
+// error once it has expired.
+func (s *Server) WatchCertificates(interval time.Duration) {
+	s.checkCertificates(time.Now())
+	for range time.Tick(interval) {
+		s.checkCertificates(time.Now())
+	}
+}
+
+// checkCertificates logs about the serving certificates that are expiring or
+// can't be read, and returns how many it logged about.
+func (s *Server) checkCertificates(now time.Time) int {
+	c := s.Config()
+	logged := 0
+	for _, cert := range c.servingCerts() {
+		notAfter, err := certificateExpiry(cert.path)
+		switch {
+		case err != nil:
+			log.Errorf("Failed to check the expiry of the %s certificate: %s", cert.listener, err)
+		case !now.Before(notAfter):
+			log.Errorf("The %s certificate %s expired at %s", cert.listener, cert.path, notAfter.Format(time.RFC3339))
+		case c.CertExpiryWarning > 0 && notAfter.Sub(now) < c.CertExpiryWarning:
+			log.Warnf("The %s certificate %s expires in %s, at %s", cert.listener, cert.path,
+				notAfter.Sub(now).Round(time.Minute), notAfter.Format(time.RFC3339))
+		default:
+			continue
+		}
+		logged++
+	}
+	return logged
+}
@@ -0,0 +1,82 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckCertificates(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name    string
+		expires time.Duration
+		logged  int
+	}{
+		{"valid", 90 * 24 * time.Hour, 0},
+		{"expiring", 3 * 24 * time.Hour, 1},
+		{"expired", -time.Hour, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeTestCert(t, now.Add(tt.expires))
+			defer os.Remove(path)
+
+			s := newTestServer(t)
+			cfg := s.Config()
+			cfg.ServeTLS = true
+			cfg.CertFile = path
+			cfg.CertExpiryWarning = defaultCertExpiryWarning
+			if logged := s.checkCertificates(now); logged != tt.logged {
+				t.Errorf("logged about %d certificates, want %d", logged, tt.logged)
+			}
+		})
+	}
+
+	s := newTestServer(t)
+	s.Config().ServeTLS = true
+	s.Config().CertFile = "/nonexistent/cert.pem"
+	if logged := s.checkCertificates(now); logged != 1 {
+		t.Errorf("logged about %d certificates for a missing one, want 1", logged)
+	}
+}
+
+func TestCertificateExpiryMetric(t *testing.T) {
+	notAfter := time.Now().Add(30 * 24 * time.Hour).Truncate(time.Second)
+	path := writeTestCert(t, notAfter)
+	defer os.Remove(path)
+
+	s := newTestServer(t)
+	rr := httptest.NewRecorder()
+	s.ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	if strings.Contains(rr.Body.String(), "gangway_serving_certificate_expiry_timestamp_seconds{") {
+		t.Errorf("certificate expiry reported without TLS:\n%s", rr.Body)
+	}
+
+	cfg := s.Config()
+	cfg.ServeTLS = true
+	cfg.CertFile = path
+	rr = httptest.NewRecorder()
+	s.ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	want := fmt.Sprintf("gangway_serving_certificate_expiry_timestamp_seconds{listener=\"ui\"} %v\n", float64(notAfter.Unix()))
+	if !strings.Contains(rr.Body.String(), want) {
+		t.Errorf("metrics don't contain %q:\n%s", want, rr.Body)
+	}
+}
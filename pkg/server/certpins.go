@@ -0,0 +1,107 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// certPins checks the certificates of the identity provider's TLS
+// connections against Config.PinnedCertSHA256, so that a certificate
+// replaced without the operators knowing, such as by an intercepting proxy,
+// is noticed. Connections to other hosts, such as a CAPTCHA service, aren't
+// checked.
+type certPins struct {
+	fingerprints map[[sha256.Size]byte]bool
+	hosts        map[string]bool
+}
+
+// newCertPins returns the pins of c, or nil if it pins no certificates.
+func newCertPins(c *Config) (*certPins, error) {
+	if len(c.PinnedCertSHA256) == 0 {
+		return nil, nil
+	}
+	p := &certPins{fingerprints: map[[sha256.Size]byte]bool{}, hosts: map[string]bool{}}
+	for _, s := range c.PinnedCertSHA256 {
+		fingerprint, err := parseFingerprint(s)
+		if err != nil {
+			return nil, err
+		}
+		p.fingerprints[fingerprint] = true
+	}
+	if err := p.addHosts(c); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// parseFingerprint parses a SHA-256 fingerprint in hex, with or without the
+// colons of `openssl x509 -fingerprint -sha256`.
+func parseFingerprint(s string) ([sha256.Size]byte, error) {
+	var fingerprint [sha256.Size]byte
+	b, err := hex.DecodeString(strings.Replace(s, ":", "", -1))
+	if err != nil || len(b) != sha256.Size {
+		return fingerprint, fmt.Errorf("%q is not a SHA-256 fingerprint in hex", s)
+	}
+	copy(fingerprint[:], b)
+	return fingerprint, nil
+}
+
+// addHosts adds the hosts of c's identity provider endpoints to those whose
+// certificates are checked. It has to be called again once endpoints have
+// been discovered, before the pins are in use by more than discovery. Hosts
+// are told apart by the TLS server name, so endpoints must not be given by
+// IP address.
+func (p *certPins) addHosts(c *Config) error {
+	for _, endpoint := range []string{c.IssuerURL, c.AuthorizeURL, c.TokenURL, c.JWKSURL, c.DeviceAuthorizationURL} {
+		u, err := url.Parse(endpoint)
+		if err != nil || u.Hostname() == "" {
+			continue
+		}
+		if net.ParseIP(u.Hostname()) != nil {
+			return fmt.Errorf("pinnedCertSHA256 needs a host name rather than an IP address in %s", endpoint)
+		}
+		p.hosts[u.Hostname()] = true
+	}
+	return nil
+}
+
+// verifyConnection is the tls.Config.VerifyConnection of gangway's HTTP
+// client. The chain has been verified by then.
+func (p *certPins) verifyConnection(cs tls.ConnectionState) error {
+	if !p.hosts[cs.ServerName] {
+		return nil
+	}
+	for _, cert := range cs.PeerCertificates {
+		if p.fingerprints[sha256.Sum256(cert.Raw)] {
+			return nil
+		}
+	}
+	var leaf string
+	if len(cs.PeerCertificates) > 0 {
+		sum := sha256.Sum256(cs.PeerCertificates[0].Raw)
+		leaf = hex.EncodeToString(sum[:])
+	}
+	log.Errorf("TLS certificate of %s (SHA-256 %s) matches none of pinnedCertSHA256", cs.ServerName, leaf)
+	return fmt.Errorf("certificate of %s is not pinned", cs.ServerName)
+}
@@ -0,0 +1,102 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// pinnedTestClient returns a client that connects to ts for any host,
+// trusts it and checks the pins of c.
+func pinnedTestClient(t *testing.T, ts *httptest.Server, c *Config) *http.Client {
+	pins, err := newCertPins(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ts.Certificate())
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, ts.Listener.Addr().String())
+		},
+		TLSClientConfig: &tls.Config{
+			RootCAs:          roots,
+			VerifyConnection: pins.verifyConnection,
+		},
+	}}
+}
+
+func TestCertPins(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+	sum := sha256.Sum256(ts.Certificate().Raw)
+	fingerprint := hex.EncodeToString(sum[:])
+	other := strings.Repeat("ab", sha256.Size)
+
+	tests := []struct {
+		name      string
+		issuerURL string
+		pins      []string
+		ok        bool
+	}{
+		{"pinned", "https://example.com", []string{other, fingerprint}, true},
+		{"openssl format", "https://example.com", []string{strings.ToUpper(strings.Join(splitPairs(fingerprint), ":"))}, true},
+		{"not pinned", "https://example.com", []string{other}, false},
+		{"other host", "https://idp.example.com", []string{other}, true},
+	}
+	for _, tc := range tests {
+		client := pinnedTestClient(t, ts, &Config{IssuerURL: tc.issuerURL, PinnedCertSHA256: tc.pins})
+		// the test server's certificate is for example.com
+		resp, err := client.Get("https://example.com/")
+		if err == nil {
+			resp.Body.Close()
+		}
+		if (err == nil) != tc.ok {
+			t.Errorf("%s: got error %v", tc.name, err)
+		}
+	}
+}
+
+func TestCertPinsNeedHostNames(t *testing.T) {
+	if _, err := newCertPins(&Config{IssuerURL: "https://10.0.0.1/dex", PinnedCertSHA256: []string{strings.Repeat("ab", sha256.Size)}}); err == nil {
+		t.Errorf("certificates pinned for an issuer given by IP address")
+	}
+}
+
+func TestParseFingerprint(t *testing.T) {
+	for _, s := range []string{"", "abcd", strings.Repeat("zz", sha256.Size), strings.Repeat("ab", sha256.Size+1)} {
+		if _, err := parseFingerprint(s); err == nil {
+			t.Errorf("%q parsed as a fingerprint", s)
+		}
+	}
+}
+
+// splitPairs splits s into pairs of characters.
+func splitPairs(s string) []string {
+	var pairs []string
+	for i := 0; i+2 <= len(s); i += 2 {
+		pairs = append(pairs, s[i:i+2])
+	}
+	return pairs
+}
@@ -0,0 +1,218 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errInjectedFailure is the error of token endpoint requests failed by
+// /dev/idp-chaos as if the connection had been refused.
+var errInjectedFailure = errors.New("connection failure injected by /dev/idp-chaos")
+
+// idpChaos is the latency and errors injected into requests to the identity
+// provider's token endpoints with Config.DevMode, set at /dev/idp-chaos, to
+// try out failover, the error pages and refreshes before a real outage.
+type idpChaos struct {
+	mu        sync.Mutex
+	latency   time.Duration
+	errorRate float64
+	// status is the HTTP status of injected errors, or 0 to fail the
+	// connection instead.
+	status int
+}
+
+func newIdPChaos() *idpChaos {
+	return &idpChaos{status: http.StatusServiceUnavailable}
+}
+
+// draw returns how long to delay a request and whether to fail it, and how.
+func (c *idpChaos) draw() (delay time.Duration, fail bool, status int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.latency, c.errorRate > 0 && rand.Float64() < c.errorRate, c.status
+}
+
+// reset stops injecting anything.
+func (c *idpChaos) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.latency = 0
+	c.errorRate = 0
+	c.status = http.StatusServiceUnavailable
+}
+
+type chaosReport struct {
+	Latency   string  `json:"latency"`
+	ErrorRate float64 `json:"errorRate"`
+	Error     string  `json:"error"`
+}
+
+func (c *idpChaos) report() *chaosReport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r := &chaosReport{Latency: c.latency.String(), ErrorRate: c.errorRate, Error: "connection"}
+	if c.status != 0 {
+		r.Error = strconv.Itoa(c.status)
+	}
+	return r
+}
+
+// chaosTransport injects the faults of chaos into the requests to tokenURLs.
+// Other requests to the identity provider, such as discovery and fetching
+// its keys, are passed through.
+type chaosTransport struct {
+	next      http.RoundTripper
+	chaos     *idpChaos
+	tokenURLs []string
+}
+
+func (ct *chaosTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !ct.isTokenEndpoint(req.URL) {
+		return ct.next.RoundTrip(req)
+	}
+	delay, fail, status := ct.chaos.draw()
+	if delay > 0 {
+		t := time.NewTimer(delay)
+		select {
+		case <-t.C:
+		case <-req.Context().Done():
+			t.Stop()
+			closeBody(req)
+			return nil, req.Context().Err()
+		}
+	}
+	if !fail {
+		return ct.next.RoundTrip(req)
+	}
+	closeBody(req)
+	if status == 0 {
+		return nil, errInjectedFailure
+	}
+	body := `{"error":"temporarily_unavailable","error_description":"injected by /dev/idp-chaos"}`
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		Body:          ioutil.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// isTokenEndpoint reports whether u is one of the token endpoints, whatever
+// its query.
+func (ct *chaosTransport) isTokenEndpoint(u *url.URL) bool {
+	for _, tokenURL := range ct.tokenURLs {
+		t, err := url.Parse(tokenURL)
+		if err == nil && tokenURL != "" && t.Scheme == u.Scheme && t.Host == u.Host && t.Path == u.Path {
+			return true
+		}
+	}
+	return false
+}
+
+// closeBody closes the body of a request that won't be sent, as a
+// RoundTripper must.
+func closeBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
+
+// devIdPChaosHandler reports the faults injected into token endpoint
+// requests, and with a POST sets them from the form values: latency, a
+// duration such as 2s added to every request; error_rate, the fraction of
+// requests that fail; and error, the HTTP status they fail with, 503 by
+// default, or connection to fail as if the connection had been refused.
+// reset=true stops injecting anything. It only exists with Config.DevMode.
+func (a *app) devIdPChaosHandler(w http.ResponseWriter, r *http.Request) {
+	if !a.cfg.DevMode {
+		http.NotFound(w, r)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		if err := a.setIdPChaos(r); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		report := a.chaos.report()
+		requestLog(r).Warnf("Injecting %s of latency and a %g error rate (%s) into token endpoint requests", report.Latency, report.ErrorRate, report.Error)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(a.chaos.report())
+}
+
+// setIdPChaos applies the form values of a POST to /dev/idp-chaos. Nothing
+// is changed unless they are all valid.
+func (a *app) setIdPChaos(r *http.Request) error {
+	c := a.chaos
+	c.mu.Lock()
+	latency, errorRate, status := c.latency, c.errorRate, c.status
+	c.mu.Unlock()
+	if r.PostFormValue("reset") == "true" {
+		latency, errorRate, status = 0, 0, http.StatusServiceUnavailable
+	}
+
+	if s := r.PostFormValue("latency"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d < 0 {
+			return errors.New("latency must be a duration such as 2s")
+		}
+		latency = d
+	}
+	if s := r.PostFormValue("error_rate"); s != "" {
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil || f < 0 || f > 1 {
+			return errors.New("error_rate must be between 0 and 1")
+		}
+		errorRate = f
+	}
+	switch s := r.PostFormValue("error"); s {
+	case "":
+	case "connection":
+		status = 0
+	default:
+		code, err := strconv.Atoi(s)
+		if err != nil || code < 400 || code > 599 {
+			return errors.New("error must be an HTTP status from 400 to 599, or connection")
+		}
+		status = code
+	}
+
+	c.mu.Lock()
+	c.latency, c.errorRate, c.status = latency, errorRate, status
+	c.mu.Unlock()
+	return nil
+}
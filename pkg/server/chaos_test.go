@@ -0,0 +1,118 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func postIdPChaos(a *app, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/dev/idp-chaos", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	a.devIdPChaosHandler(rr, req)
+	return rr
+}
+
+func TestIdPChaos(t *testing.T) {
+	var requests int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			atomic.AddInt64(&requests, 1)
+		}
+	}))
+	defer ts.Close()
+
+	s, err := New(&Config{SessionSecurityKey: SessionKeys{"test"}, TokenURL: ts.URL + "/token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rr := postIdPChaos(s.current(), url.Values{"error_rate": {"1"}}); rr.Code != http.StatusNotFound {
+		t.Errorf("without dev mode: got status %d, want 404", rr.Code)
+	}
+
+	if err := s.ApplyConfig(&Config{SessionSecurityKey: SessionKeys{"test"}, TokenURL: ts.URL + "/token", DevMode: true}); err != nil {
+		t.Fatal(err)
+	}
+	a := s.current()
+	if rr := postIdPChaos(a, url.Values{"error_rate": {"1"}, "error": {"502"}}); rr.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rr.Code, rr.Body.String())
+	}
+	resp, err := a.httpClient.PostForm(ts.URL+"/token?x=y", url.Values{"grant_type": {"authorization_code"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("token endpoint returned %d, want 502", resp.StatusCode)
+	}
+	if n := atomic.LoadInt64(&requests); n != 0 {
+		t.Errorf("%d requests reached the token endpoint", n)
+	}
+
+	// other requests to the identity provider are left alone
+	resp, err = a.httpClient.Get(ts.URL + "/keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("keys returned %d, want 200", resp.StatusCode)
+	}
+
+	postIdPChaos(a, url.Values{"error": {"connection"}})
+	if _, err := a.httpClient.Get(ts.URL + "/token"); err == nil || !strings.Contains(err.Error(), errInjectedFailure.Error()) {
+		t.Errorf("got error %v, want the injected connection failure", err)
+	}
+
+	postIdPChaos(a, url.Values{"reset": {"true"}, "latency": {"50ms"}})
+	start := time.Now()
+	resp, err = a.httpClient.Get(ts.URL + "/token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("token endpoint answered after %s, want at least 50ms", elapsed)
+	}
+	if n := atomic.LoadInt64(&requests); n != 1 {
+		t.Errorf("%d requests reached the token endpoint, want 1", n)
+	}
+
+	for _, form := range []url.Values{
+		{"latency": {"-1s"}},
+		{"error_rate": {"1.5"}},
+		{"error": {"200"}},
+		{"error": {"refused"}},
+	} {
+		if rr := postIdPChaos(a, form); rr.Code != http.StatusBadRequest {
+			t.Errorf("%v: got status %d, want 400", form, rr.Code)
+		}
+	}
+
+	// turning dev mode off stops the chaos
+	if err := s.ApplyConfig(&Config{SessionSecurityKey: SessionKeys{"test"}}); err != nil {
+		t.Fatal(err)
+	}
+	if delay, _, _ := s.chaos.draw(); delay != 0 {
+		t.Errorf("still injecting %s of latency without dev mode", delay)
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// clock tells gangway how old the tokens of a signed in user are. It is the
+// wall clock unless Config.DevMode let someone fast-forward it through
+// /dev/clock, to try out what happens once an ID token expires without
+// waiting for it. Tokens just received from the identity provider are still
+// checked against the wall clock, as the provider issued them by that.
+type clock struct {
+	// offset is how far the clock is ahead, in nanoseconds.
+	offset int64
+}
+
+// Now returns the clock's time.
+func (c *clock) Now() time.Time {
+	return time.Now().Add(c.Offset())
+}
+
+// Offset returns how far the clock is ahead of the wall clock.
+func (c *clock) Offset() time.Duration {
+	return time.Duration(atomic.LoadInt64(&c.offset))
+}
+
+// advance fast-forwards the clock by d.
+func (c *clock) advance(d time.Duration) {
+	atomic.AddInt64(&c.offset, int64(d))
+}
+
+// reset sets the clock back to the wall clock.
+func (c *clock) reset() {
+	atomic.StoreInt64(&c.offset, 0)
+}
+
+type clockReport struct {
+	Now    time.Time `json:"now"`
+	Offset string    `json:"offset"`
+}
+
+// devClockHandler reports the clock, and with a POST fast-forwards it by the
+// advance form value, a duration such as 55m, or with reset=true sets it back
+// to the wall clock. It only exists with Config.DevMode.
+func (a *app) devClockHandler(w http.ResponseWriter, r *http.Request) {
+	if !a.cfg.DevMode {
+		http.NotFound(w, r)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		if r.PostFormValue("reset") == "true" {
+			a.clock.reset()
+		}
+		if s := r.PostFormValue("advance"); s != "" {
+			d, err := time.ParseDuration(s)
+			if err != nil || d < 0 {
+				http.Error(w, "advance must be a positive duration such as 55m", http.StatusBadRequest)
+				return
+			}
+			a.clock.advance(d)
+		}
+		requestLog(r).Warnf("Clock is now %s ahead of the wall clock", a.clock.Offset())
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&clockReport{Now: a.clock.Now().UTC(), Offset: a.clock.Offset().String()})
+}
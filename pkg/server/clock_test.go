@@ -0,0 +1,104 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func postDevClock(a *app, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/dev/clock", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	a.devClockHandler(rr, req)
+	return rr
+}
+
+func TestDevClock(t *testing.T) {
+	s := newTestServer(t)
+	if rr := postDevClock(s.current(), url.Values{"advance": {"1h"}}); rr.Code != http.StatusNotFound {
+		t.Errorf("without dev mode: got status %d, want 404", rr.Code)
+	}
+
+	s.current().cfg.DevMode = true
+	rr := postDevClock(s.current(), url.Values{"advance": {"55m"}})
+	rr = postDevClock(s.current(), url.Values{"advance": {"5m"}})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rr.Code, rr.Body.String())
+	}
+	var report clockReport
+	if err := json.NewDecoder(rr.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Offset != "1h0m0s" {
+		t.Errorf("got offset %q, want 1h0m0s", report.Offset)
+	}
+	if ahead := time.Until(report.Now); ahead < 59*time.Minute {
+		t.Errorf("clock is only %s ahead", ahead)
+	}
+
+	for _, advance := range []string{"soon", "-1h"} {
+		if rr := postDevClock(s.current(), url.Values{"advance": {advance}}); rr.Code != http.StatusBadRequest {
+			t.Errorf("advance %q: got status %d, want 400", advance, rr.Code)
+		}
+	}
+
+	postDevClock(s.current(), url.Values{"reset": {"true"}})
+	if offset := s.clock.Offset(); offset != 0 {
+		t.Errorf("clock still %s ahead after a reset", offset)
+	}
+
+	// turning dev mode off sets the clock back
+	s.clock.advance(time.Hour)
+	if err := s.ApplyConfig(&Config{SessionSecurityKey: SessionKeys{"test"}}); err != nil {
+		t.Fatal(err)
+	}
+	if offset := s.clock.Offset(); offset != 0 {
+		t.Errorf("clock still %s ahead without dev mode", offset)
+	}
+}
+
+func TestCommandlineTokenExpiry(t *testing.T) {
+	expires := time.Date(2018, 6, 1, 12, 30, 0, 0, time.UTC)
+	tests := []struct {
+		info *userInfo
+		want string
+	}{
+		{&userInfo{}, ""},
+		{&userInfo{IDTokenExpires: expires}, "Your ID token expires at 2018-06-01 12:30:00 UTC."},
+		{&userInfo{IDTokenExpires: expires, IDTokenExpired: true}, "Sign in again for fresh credentials."},
+		{&userInfo{IDTokenExpires: expires, IDTokenExpired: true, RefreshToken: "refresh"}, "Your ID token expired at 2018-06-01 12:30:00 UTC."},
+	}
+	for _, tc := range tests {
+		rr := httptest.NewRecorder()
+		serveTemplate("commandline.tmpl", tc.info, rr)
+		body := rr.Body.String()
+		if tc.want == "" {
+			if strings.Contains(body, `id="token-expiry"`) {
+				t.Errorf("expiry shown for a token without one")
+			}
+			continue
+		}
+		if !strings.Contains(body, tc.want) {
+			t.Errorf("commandline page does not contain %q", tc.want)
+		}
+	}
+}
@@ -0,0 +1,725 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+	"gopkg.in/yaml.v2"
+)
+
+// Config the configuration field for gangway
+type Config struct {
+	Host string `yaml:"host"`
+	Port int    `yaml:"port"`
+
+	// ListenAddresses, when set, replaces Host and Port with a list of
+	// host:port pairs to listen on, e.g. separate IPv4 and IPv6 addresses.
+	ListenAddresses []string `yaml:"listenAddresses" envconfig:"listen_addresses"`
+
+	// APIListenAddresses, when set, moves the API (everything under /api/)
+	// off the UI listeners onto listeners of its own, with their own TLS
+	// settings. APIClientCAPath makes API clients authenticate with a
+	// certificate signed by that CA.
+	APIListenAddresses []string `yaml:"apiListenAddresses" envconfig:"api_listen_addresses"`
+	APIServeTLS        bool     `yaml:"apiServeTLS" envconfig:"api_serve_tls"`
+	APICertFile        string   `yaml:"apiCertFile" envconfig:"api_cert_file"`
+	APIKeyFile         string   `yaml:"apiKeyFile" envconfig:"api_key_file"`
+	APIClientCAPath    string   `yaml:"apiClientCAPath" envconfig:"api_client_ca_path"`
+
+	ClusterName   string   `yaml:"clusterName" envconfig:"cluster_name"`
+	AuthorizeURL  string   `yaml:"authorizeURL" envconfig:"authorize_url"`
+	TokenURL      string   `yaml:"tokenURL" envconfig:"token_url"`
+	ClientID      string   `yaml:"clientID" envconfig:"client_id"`
+	ClientSecret  string   `yaml:"clientSecret" envconfig:"client_secret"`
+	Audience      string   `yaml:"audience"`
+	RedirectURL   string   `yaml:"redirectURL" envconfig:"redirect_url"`
+	Scopes        []string `yaml:"scopes"`
+	UsernameClaim string   `yaml:"usernameClaim" envconfig:"username_claim"`
+	EmailClaim    string   `yaml:"emailClaim" envconfig:"email_claim"`
+	ServeTLS      bool     `yaml:"serveTLS" envconfig:"serve_tls"`
+	EnableH2C     bool     `yaml:"enableH2C" envconfig:"enable_h2c"`
+	CertFile      string   `yaml:"certFile" envconfig:"cert_file"`
+	KeyFile       string   `yaml:"keyFile" envconfig:"key_file"`
+	APIServerURL  string   `yaml:"apiServerURL" envconfig:"apiserver_url"`
+	ClusterCAPath string   `yaml:"clusterCAPath" envconfig:"cluster_ca_path"`
+	ClusterCA     string   `yaml:"clusterCA" envconfig:"cluster_ca"`
+	TrustedCAPath string   `yaml:"trustedCAPath" envconfig:"trusted_ca_path"`
+	BasePath      string   `yaml:"basePath" envconfig:"base_path"`
+	// HTTPPath is the path prefix gangway serves every route under, for
+	// proxies that forward requests with the prefix intact. BasePath is for
+	// proxies that strip it.
+	HTTPPath string `yaml:"httpPath" envconfig:"http_path"`
+
+	// AllowedEmailDomains, RequireEmailVerified and AllowedGroups restrict
+	// who gets credentials among the users the identity provider signs in.
+	// Groups are matched as in the groups claim, without OIDCGroupsPrefix.
+	AllowedEmailDomains  []string `yaml:"allowedEmailDomains" envconfig:"allowed_email_domains"`
+	RequireEmailVerified bool     `yaml:"requireEmailVerified" envconfig:"require_email_verified"`
+	AllowedGroups        []string `yaml:"allowedGroups" envconfig:"allowed_groups"`
+
+	// OptionalClaims lists the email and groups claims if users may get
+	// credentials without them. They are then warned about the missing
+	// claim instead of being turned away, and AllowedGroups doesn't apply
+	// to users without groups.
+	OptionalClaims []string `yaml:"optionalClaims" envconfig:"optional_claims"`
+
+	// CredentialPlugin, if kubelogin, makes the commands and kubeconfig set
+	// up kubectl to get tokens from the kubelogin exec credential plugin
+	// instead of the deprecated oidc auth provider. It needs IssuerURL.
+	CredentialPlugin string `yaml:"credentialPlugin" envconfig:"credential_plugin"`
+
+	// PinnedKeyIDs, when set, are the only IDs of the identity provider's
+	// signing keys that ID tokens are accepted from. Other keys showing up
+	// at JWKSURL are logged as errors.
+	PinnedKeyIDs []string `yaml:"pinnedKeyIDs" envconfig:"pinned_key_ids"`
+	// PinnedCertSHA256, when set, are the SHA-256 fingerprints of the
+	// certificates the identity provider's TLS connections must present one
+	// of, anywhere in the chain. Other certificates fail the connection and
+	// are logged as errors.
+	PinnedCertSHA256 []string `yaml:"pinnedCertSHA256" envconfig:"pinned_cert_sha256"`
+
+	// OIDCUsernamePrefix and OIDCGroupsPrefix are the API server's
+	// --oidc-username-prefix and --oidc-groups-prefix, so that the identity
+	// shown and the RBAC snippets match what the API server sees. "-" turns
+	// off the username prefix, as with the flag.
+	OIDCUsernamePrefix string `yaml:"oidcUsernamePrefix" envconfig:"oidc_username_prefix"`
+	OIDCGroupsPrefix   string `yaml:"oidcGroupsPrefix" envconfig:"oidc_groups_prefix"`
+
+	// AuthenticationConfigPath is the API server's structured authentication
+	// config. Logins are checked against the claim validation rules of its
+	// authenticator for IssuerURL, and its claim mappings take the place of
+	// the OIDC prefixes.
+	AuthenticationConfigPath string `yaml:"authenticationConfigPath" envconfig:"authentication_config_path"`
+
+	// StandbyAuthorizeURL and StandbyTokenURL are a standby identity
+	// provider that logins go to while the one at TokenURL is down. It has
+	// to accept the same client and issue tokens the API server trusts.
+	StandbyAuthorizeURL string `yaml:"standbyAuthorizeURL" envconfig:"standby_authorize_url"`
+	StandbyTokenURL     string `yaml:"standbyTokenURL" envconfig:"standby_token_url"`
+
+	// KubeconfigTemplatePath is a Go template file that replaces the
+	// generated kubeconfig, the kubectl commands or both; see
+	// loadKubeconfigTemplate.
+	KubeconfigTemplatePath string `yaml:"kubeconfigTemplatePath" envconfig:"kubeconfig_template_path"`
+
+	AllowedRedirects []string `yaml:"allowedRedirects" envconfig:"allowed_redirects"`
+
+	// OnboardingInstructions are the instructions onboarding links can
+	// select, by variant name, e.g. for different teams or operating
+	// systems. They are shown as plain text.
+	OnboardingInstructions JSONMap `yaml:"onboardingInstructions" envconfig:"onboarding_instructions"`
+
+	// Redirects maps paths on gangway, such as /docs, to the http(s) URLs
+	// they redirect to, so the portal can be the one bookmark users need.
+	Redirects JSONMap `yaml:"redirects"`
+
+	// Provider selects the default scopes and authorization parameters for
+	// a type of identity provider, such as okta or google. Scopes and
+	// ExtraAuthParams override them.
+	Provider        string            `yaml:"provider"`
+	ExtraAuthParams map[string]string `yaml:"extraAuthParams" envconfig:"extra_auth_params"`
+
+	// IssuerURL is the issuer the API server trusts, as set with its
+	// --oidc-issuer-url flag. When set, logins with ID tokens from any other
+	// issuer are rejected with an explanation, and AuthorizeURL and TokenURL
+	// may be left unset to discover them from the issuer's metadata.
+	IssuerURL string `yaml:"issuerURL" envconfig:"issuer_url"`
+
+	// JWKSURL is where the identity provider publishes its signing keys,
+	// which ID tokens are verified with. It is discovered along with the
+	// endpoints when those are left unset. Without it only ID tokens signed
+	// with the client secret are accepted.
+	JWKSURL string `yaml:"jwksURL" envconfig:"jwks_url"`
+
+	// GroupsClaim is the ID token claim that holds the user's groups.
+	GroupsClaim string `yaml:"groupsClaim" envconfig:"groups_claim"`
+
+	// LogoutURL is the identity provider's logout endpoint. When set, or
+	// known for the provider, logging out of gangway also signs users out
+	// of the provider.
+	LogoutURL string `yaml:"logoutURL" envconfig:"logout_url"`
+
+	// EndSessionEndpoint is the identity provider's OpenID end_session_endpoint,
+	// discovered along with the other endpoints. Without a LogoutURL, logging
+	// out of gangway sends users there with their ID token as a hint, to end
+	// their session with the provider too.
+	EndSessionEndpoint string `yaml:"endSessionEndpoint" envconfig:"end_session_endpoint"`
+
+	// DeviceFlow lets users sign in from a terminal at /device with the OAuth
+	// device authorization grant, for when their browser can't be sent back
+	// to gangway, such as on a jump host. The identity provider has to allow
+	// the grant for gangway's client.
+	DeviceFlow bool `yaml:"deviceFlow" envconfig:"device_flow"`
+	// DeviceAuthorizationURL is the identity provider's device authorization
+	// endpoint, discovered from IssuerURL when unset.
+	DeviceAuthorizationURL string `yaml:"deviceAuthorizationURL" envconfig:"device_authorization_url"`
+
+	// Connection names the upstream identity provider to sign in with, for
+	// providers such as Auth0 that federate several.
+	Connection string `yaml:"connection"`
+
+	// RefreshTokenRotation is set when the provider replaces the refresh
+	// token each time it is used. Gangway then stops handing out its refresh
+	// token once the ID token has expired, as kubectl may have used it by
+	// then and presenting it again would revoke the user's tokens.
+	RefreshTokenRotation bool `yaml:"refreshTokenRotation" envconfig:"refresh_token_rotation"`
+
+	// PKCE protects the authorization code with a per-login code challenge
+	// (RFC 7636). With it, ClientSecret may be left empty to run gangway as
+	// a public client.
+	PKCE bool `yaml:"pkce" envconfig:"pkce"`
+
+	// Captcha, recaptcha or turnstile, makes users solve a challenge before
+	// they are sent to the identity provider, to keep bots from using
+	// gangway to try credentials against it.
+	Captcha          string `yaml:"captcha"`
+	CaptchaSiteKey   string `yaml:"captchaSiteKey" envconfig:"captcha_site_key"`
+	CaptchaSecretKey string `yaml:"captchaSecretKey" envconfig:"captcha_secret_key"`
+
+	// ClusterInfo enables a public page at /cluster-info that shows the
+	// cluster name, API server URL and branding before sign in.
+	ClusterInfo bool `yaml:"clusterInfo" envconfig:"cluster_info"`
+
+	// AdminToken is the bearer token for gangway's admin API, such as
+	// /api/v1/stats. The admin API is off without it.
+	AdminToken string `yaml:"adminToken" envconfig:"admin_token"`
+
+	// DeprovisionToken is the bearer token for the deprovisioning webhook
+	// at /api/v1/deprovision. DeprovisionClientNames lets API clients with
+	// a certificate for one of these names call it instead; that needs
+	// APIClientCAPath. The webhook is off without either.
+	DeprovisionToken       string   `yaml:"deprovisionToken" envconfig:"deprovision_token"`
+	DeprovisionClientNames []string `yaml:"deprovisionClientNames" envconfig:"deprovision_client_names"`
+
+	// Branding shown with the cluster, so users can tell clusters apart.
+	ClusterDescription string `yaml:"clusterDescription" envconfig:"cluster_description"`
+	ClusterEnvironment string `yaml:"clusterEnvironment" envconfig:"cluster_environment"`
+	ClusterContact     string `yaml:"clusterContact" envconfig:"cluster_contact"`
+	ClusterDocsURL     string `yaml:"clusterDocsURL" envconfig:"cluster_docs_url"`
+	ClusterBanner      string `yaml:"clusterBanner" envconfig:"cluster_banner"`
+	ClusterBannerColor string `yaml:"clusterBannerColor" envconfig:"cluster_banner_color"`
+
+	RequestTimeout  time.Duration `yaml:"requestTimeout" envconfig:"request_timeout"`
+	CallbackTimeout time.Duration `yaml:"callbackTimeout" envconfig:"callback_timeout"`
+
+	MaxInFlightRequests int           `yaml:"maxInFlightRequests" envconfig:"max_in_flight_requests"`
+	RetryAfter          time.Duration `yaml:"retryAfter" envconfig:"retry_after"`
+
+	ShutdownDelay time.Duration `yaml:"shutdownDelay" envconfig:"shutdown_delay"`
+
+	// CertExpiryWarning is how long before a serving certificate expires
+	// that gangway starts logging warnings about it. 0 turns them off.
+	CertExpiryWarning time.Duration `yaml:"certExpiryWarning" envconfig:"cert_expiry_warning"`
+
+	// Middleware lists the middleware every request passes through, the
+	// first one outermost.
+	Middleware         []string `yaml:"middleware"`
+	RateLimit          float64  `yaml:"rateLimit" envconfig:"rate_limit"`
+	RateLimitBurst     int      `yaml:"rateLimitBurst" envconfig:"rate_limit_burst"`
+	AllowedClientCIDRs []string `yaml:"allowedClientCIDRs" envconfig:"allowed_client_cidrs"`
+
+	// TrustedProxies are the networks of the reverse proxies whose
+	// X-Forwarded-* headers gangway believes. ProxyHeaders lists which of
+	// those headers, all of X-Forwarded-Proto, X-Forwarded-Prefix and
+	// X-Forwarded-For if empty.
+	TrustedProxies []string `yaml:"trustedProxies" envconfig:"trusted_proxies"`
+	ProxyHeaders   []string `yaml:"proxyHeaders" envconfig:"proxy_headers"`
+
+	LoginStateStore string        `yaml:"loginStateStore" envconfig:"login_state_store"`
+	LoginStateTTL   time.Duration `yaml:"loginStateTTL" envconfig:"login_state_ttl"`
+
+	SessionCleanupInterval time.Duration `yaml:"sessionCleanupInterval" envconfig:"session_cleanup_interval"`
+
+	// SilentRenewInterval is how often the commandline page renews the
+	// session with a prompt=none login in a hidden frame, while the user's
+	// single sign on session with the identity provider lasts. 0 turns it
+	// off.
+	SilentRenewInterval time.Duration `yaml:"silentRenewInterval" envconfig:"silent_renew_interval"`
+
+	TokenDisplayTTL    time.Duration `yaml:"tokenDisplayTTL" envconfig:"token_display_ttl"`
+	StrictTokenDisplay bool          `yaml:"strictTokenDisplay" envconfig:"strict_token_display"`
+
+	// SessionSecurityKey is one key or a list of them. The first signs and
+	// encrypts new sessions; all of them are accepted, so the key can be
+	// rotated without signing everyone out.
+	SessionSecurityKey SessionKeys `yaml:"sessionSecurityKey" envconfig:"SESSION_SECURITY_KEY"`
+
+	// The *File options read a secret from a file instead of the config,
+	// such as a mounted Kubernetes Secret. Setting both a secret and its
+	// file is an error.
+	ClientSecretFile         string `yaml:"clientSecretFile" envconfig:"client_secret_file"`
+	SessionSecurityKeyFile   string `yaml:"sessionSecurityKeyFile" envconfig:"session_security_key_file"`
+	AdminTokenFile           string `yaml:"adminTokenFile" envconfig:"admin_token_file"`
+	DeprovisionTokenFile     string `yaml:"deprovisionTokenFile" envconfig:"deprovision_token_file"`
+	CaptchaSecretKeyFile     string `yaml:"captchaSecretKeyFile" envconfig:"captcha_secret_key_file"`
+	SessionSQLDSNFile        string `yaml:"sessionSQLDSNFile" envconfig:"session_sql_dsn_file"`
+	SessionRedisPasswordFile string `yaml:"sessionRedisPasswordFile" envconfig:"session_redis_password_file"`
+	AuditSASLPasswordFile    string `yaml:"auditSASLPasswordFile" envconfig:"audit_sasl_password_file"`
+	AuditSigningKeyFile      string `yaml:"auditSigningKeyFile" envconfig:"audit_signing_key_file"`
+
+	// The session cookie. SessionLifetime is how long sessions last, 30
+	// days at most and by default. CookieSameSite is lax, strict or none; none needs
+	// CookieSecure. CookieDomain shares the cookie with subdomains.
+	SessionCookieName string        `yaml:"sessionCookieName" envconfig:"session_cookie_name"`
+	SessionLifetime   time.Duration `yaml:"sessionLifetime" envconfig:"session_lifetime"`
+	CookieDomain      string        `yaml:"cookieDomain" envconfig:"cookie_domain"`
+	CookieSecure      bool          `yaml:"cookieSecure" envconfig:"cookie_secure"`
+	CookieSameSite    string        `yaml:"cookieSameSite" envconfig:"cookie_same_site"`
+
+	SessionStore     string `yaml:"sessionStore" envconfig:"session_store"`
+	SessionSQLDriver string `yaml:"sessionSQLDriver" envconfig:"session_sql_driver"`
+	SessionSQLDSN    string `yaml:"sessionSQLDSN" envconfig:"session_sql_dsn"`
+
+	SessionMemcachedServers []string `yaml:"sessionMemcachedServers" envconfig:"session_memcached_servers"`
+
+	// The Redis session store keeps sessions under SessionRedisKeyPrefix,
+	// so that several gangways can share one Redis.
+	SessionRedisAddress   string `yaml:"sessionRedisAddress" envconfig:"session_redis_address"`
+	SessionRedisPassword  string `yaml:"sessionRedisPassword" envconfig:"session_redis_password"`
+	SessionRedisTLS       bool   `yaml:"sessionRedisTLS" envconfig:"session_redis_tls"`
+	SessionRedisKeyPrefix string `yaml:"sessionRedisKeyPrefix" envconfig:"session_redis_key_prefix"`
+
+	// SessionCacheTTL, if set, keeps recently used sessions of the sql,
+	// memcached and redis stores in memory for that long, to save a round
+	// trip on every page load.
+	SessionCacheTTL time.Duration `yaml:"sessionCacheTTL" envconfig:"session_cache_ttl"`
+
+	// LoginHistory is how many of their recent logins users are shown, so
+	// they can spot logins that weren't theirs. It needs a server-side
+	// session store, where the history is kept.
+	LoginHistory int `yaml:"loginHistory" envconfig:"login_history"`
+
+	// AuditSink, kafka, nats or sqlite, is where audit events such as logins
+	// are published as JSON.
+	AuditSink         string   `yaml:"auditSink" envconfig:"audit_sink"`
+	AuditKafkaBrokers []string `yaml:"auditKafkaBrokers" envconfig:"audit_kafka_brokers"`
+	AuditKafkaTopic   string   `yaml:"auditKafkaTopic" envconfig:"audit_kafka_topic"`
+	AuditNATSURL      string   `yaml:"auditNATSURL" envconfig:"audit_nats_url"`
+	AuditNATSSubject  string   `yaml:"auditNATSSubject" envconfig:"audit_nats_subject"`
+	AuditTLS          bool     `yaml:"auditTLS" envconfig:"audit_tls"`
+	AuditTLSCAFile    string   `yaml:"auditTLSCAFile" envconfig:"audit_tls_ca_file"`
+	AuditTLSCertFile  string   `yaml:"auditTLSCertFile" envconfig:"audit_tls_cert_file"`
+	AuditTLSKeyFile   string   `yaml:"auditTLSKeyFile" envconfig:"audit_tls_key_file"`
+	// AuditSASLUser and AuditSASLPassword authenticate to the audit sink,
+	// with SASL/PLAIN for Kafka and as user and password for NATS.
+	AuditSASLUser     string `yaml:"auditSASLUser" envconfig:"audit_sasl_user"`
+	AuditSASLPassword string `yaml:"auditSASLPassword" envconfig:"audit_sasl_password"`
+	// AuditSQLitePath is the database file of the sqlite audit sink, which
+	// keeps events on this node and serves them at /api/v1/audit.
+	AuditSQLitePath string `yaml:"auditSQLitePath" envconfig:"audit_sqlite_path"`
+	// AuditSigningKey, if set, chains and signs audit events so that
+	// exported logs can be checked with `gangway verify-audit`.
+	AuditSigningKey string `yaml:"auditSigningKey" envconfig:"audit_signing_key"`
+
+	// DebugTranscripts records a sanitized transcript of every login, with
+	// the requests made to the identity provider, their timing and status,
+	// served to admins by request ID at /api/v1/transcripts/<id>.
+	DebugTranscripts bool `yaml:"debugTranscripts" envconfig:"debug_transcripts"`
+
+	// DevMode enables aids for developing and demoing gangway that must not
+	// be used in production, such as fast-forwarding its clock at /dev/clock
+	// and injecting identity provider failures at /dev/idp-chaos.
+	DevMode bool `yaml:"devMode" envconfig:"dev_mode"`
+}
+
+// JSONMap is a map in the config that is set from the environment as a JSON
+// object, e.g. GANGWAY_REDIRECTS='{"/docs": "https://wiki.example.com"}',
+// because its values may contain the commas and colons that separate the
+// entries of other maps.
+type JSONMap map[string]string
+
+// Decode implements envconfig.Decoder.
+func (m *JSONMap) Decode(value string) error {
+	if strings.TrimSpace(value) == "" {
+		*m = nil
+		return nil
+	}
+	var decoded map[string]string
+	if err := json.Unmarshal([]byte(value), &decoded); err != nil {
+		return fmt.Errorf("expected a JSON object of strings: %v", err)
+	}
+	*m = decoded
+	return nil
+}
+
+// NewConfig returns a Config struct from serialized config files. Each config
+// file may also be an https:// URL or a configmap://namespace/name/key
+// reference. Files are applied in order, so fields set in a later file
+// override those from earlier ones.
+func NewConfig(configFiles ...string) (*Config, error) {
+	cfg, err := LoadConfig(configFiles...)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validateConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// LoadConfig applies the defaults, config files and environment to a Config,
+// and reads the secrets of the *File options, without validating the result.
+func LoadConfig(configFiles ...string) (*Config, error) {
+	cfg, err := LoadConfigWithoutSecretFiles(configFiles...)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.loadSecretFiles(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// LoadConfigWithoutSecretFiles is LoadConfig for tools that run where the
+// secrets aren't mounted, such as `gangway manifests`. The *File options are
+// left unread.
+func LoadConfigWithoutSecretFiles(configFiles ...string) (*Config, error) {
+	cfg := &Config{
+		Host:          "0.0.0.0",
+		Port:          8080,
+		UsernameClaim: "nickname",
+		EmailClaim:    "email",
+		ServeTLS:      false,
+		PKCE:          true,
+		CertFile:      "/etc/gangway/tls/tls.crt",
+		KeyFile:       "/etc/gangway/tls/tls.key",
+		ClusterCAPath: "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt",
+
+		RequestTimeout:  10 * time.Second,
+		CallbackTimeout: 30 * time.Second,
+		RetryAfter:      10 * time.Second,
+
+		Middleware:     []string{middlewareLogging},
+		RateLimit:      5,
+		RateLimitBurst: 20,
+
+		LoginStateStore: loginStateStoreSession,
+		LoginStateTTL:   defaultLoginStateTTL,
+
+		SessionCleanupInterval: time.Minute,
+		CertExpiryWarning:      defaultCertExpiryWarning,
+
+		SessionStore:          sessionStoreCookie,
+		SessionRedisKeyPrefix: "gangway_session_",
+		LoginHistory:          5,
+
+		AuditKafkaTopic:  "gangway-audit",
+		AuditNATSSubject: "gangway.audit",
+
+		ClusterBannerColor: defaultBannerColor,
+	}
+
+	for _, configFile := range configFiles {
+		if configFile == "" {
+			continue
+		}
+
+		data, err := readConfigSource(configFile)
+		if err != nil {
+			return nil, err
+		}
+
+		err = yaml.Unmarshal([]byte(data), cfg)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", configFile, err)
+		}
+	}
+
+	err := envconfig.Process("gangway", cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// ValidateConfig checks a Config loaded with LoadConfig, after the caller has
+// filled in what it provides itself. NewConfig does this already.
+func ValidateConfig(cfg *Config) error {
+	return validateConfig(cfg)
+}
+
+func validateConfig(cfg *Config) error {
+	checks := []struct {
+		bad    bool
+		errMsg string
+	}{
+		{cfg.AuthorizeURL == "" && cfg.IssuerURL == "", "no authorizeURL or issuerURL specified"},
+		{cfg.TokenURL == "" && cfg.IssuerURL == "", "no tokenURL or issuerURL specified"},
+		{cfg.ClientID == "", "no clientID specified"},
+		{cfg.ClientSecret == "" && !cfg.PKCE, "no clientSecret specified; only clients using pkce may do without"},
+		{cfg.RedirectURL == "", "no redirectURL specified"},
+		{cfg.SessionSecurityKey.current() == "", "no SessionSecurityKey specified"},
+		{containsString(cfg.SessionSecurityKey, ""), "sessionSecurityKey may not list an empty key"},
+		{cfg.APIServerURL == "", "no apiServerURL specified"},
+		{cfg.ClusterCA != "" && !hasPEMCertificate(cfg.ClusterCA), "clusterCA must hold a PEM encoded certificate"},
+		{cfg.RequestTimeout <= 0, "requestTimeout must be positive"},
+		{cfg.CallbackTimeout <= 0, "callbackTimeout must be positive"},
+		{cfg.MaxInFlightRequests < 0, "maxInFlightRequests must not be negative"},
+		{cfg.ShutdownDelay < 0, "shutdownDelay must not be negative"},
+		{cfg.CertExpiryWarning < 0, "certExpiryWarning must not be negative"},
+		{cfg.LoginStateStore != loginStateStoreSession && cfg.LoginStateStore != loginStateStoreMemory, "loginStateStore must be session or memory"},
+		{cfg.LoginStateTTL <= 0, "loginStateTTL must be positive"},
+		{cfg.SessionCleanupInterval <= 0, "sessionCleanupInterval must be positive"},
+		{!cookieNamePattern.MatchString(cfg.sessionCookieName()), "sessionCookieName may only contain letters, digits, - and _"},
+		// ended sessions are remembered for no longer than the default
+		{cfg.SessionLifetime < 0 || (cfg.SessionLifetime > 0 && cfg.SessionLifetime < time.Minute) || cfg.SessionLifetime > defaultSessionLifetime, "sessionLifetime must be between 1m and 720h"},
+		{cfg.CookieSameSite != "" && cfg.CookieSameSite != "lax" && cfg.CookieSameSite != "strict" && cfg.CookieSameSite != "none", "cookieSameSite must be lax, strict or none"},
+		{cfg.CookieSameSite == "none" && !cfg.CookieSecure, "cookieSameSite none needs cookieSecure"},
+		{cfg.SessionStore != sessionStoreCookie && cfg.SessionStore != sessionStoreSQL && cfg.SessionStore != sessionStoreMemcached && cfg.SessionStore != sessionStoreMemory && cfg.SessionStore != sessionStoreRedis, "sessionStore must be cookie, sql, memcached, memory or redis"},
+		{cfg.SessionStore == sessionStoreSQL && cfg.SessionSQLDriver != "postgres" && cfg.SessionSQLDriver != "mysql", "sessionSQLDriver must be postgres or mysql"},
+		{cfg.SessionStore == sessionStoreSQL && cfg.SessionSQLDSN == "", "no sessionSQLDSN specified"},
+		{cfg.SessionStore == sessionStoreMemcached && len(cfg.SessionMemcachedServers) == 0, "no sessionMemcachedServers specified"},
+		{cfg.SessionCacheTTL < 0, "sessionCacheTTL must not be negative"},
+		{cfg.SessionCacheTTL > 0 && cfg.SessionStore != sessionStoreSQL && cfg.SessionStore != sessionStoreMemcached && cfg.SessionStore != sessionStoreRedis, "sessionCacheTTL needs the sql, memcached or redis session store"},
+		{cfg.SessionStore == sessionStoreRedis && cfg.SessionRedisAddress == "", "no sessionRedisAddress specified"},
+		{cfg.TokenDisplayTTL < 0, "tokenDisplayTTL must not be negative"},
+		{cfg.SilentRenewInterval < 0, "silentRenewInterval must not be negative"},
+		{cfg.LoginHistory < 0, "loginHistory must not be negative"},
+		{cfg.CredentialPlugin != "" && cfg.CredentialPlugin != credentialPluginKubelogin, "credentialPlugin must be kubelogin"},
+		{cfg.CredentialPlugin != "" && cfg.IssuerURL == "", "credentialPlugin needs issuerURL"},
+		{cfg.DeviceFlow && cfg.DeviceAuthorizationURL == "" && cfg.IssuerURL == "", "deviceFlow needs deviceAuthorizationURL or issuerURL"},
+		{cfg.AuditSink != "" && cfg.AuditSink != auditSinkKafka && cfg.AuditSink != auditSinkNATS && cfg.AuditSink != auditSinkSQLite, "auditSink must be kafka, nats or sqlite"},
+		{cfg.AuditSink == auditSinkKafka && (len(cfg.AuditKafkaBrokers) == 0 || cfg.AuditKafkaTopic == ""), "auditKafkaBrokers and auditKafkaTopic are required for the kafka audit sink"},
+		{cfg.AuditSink == auditSinkNATS && (cfg.AuditNATSURL == "" || cfg.AuditNATSSubject == ""), "auditNATSURL and auditNATSSubject are required for the nats audit sink"},
+		{cfg.AuditSink == auditSinkSQLite && cfg.AuditSQLitePath == "", "auditSQLitePath is required for the sqlite audit sink"},
+		{cfg.AuditSigningKey != "" && cfg.AuditSink == "", "auditSigningKey needs auditSink"},
+		{(cfg.AuditTLSCertFile == "") != (cfg.AuditTLSKeyFile == ""), "auditTLSCertFile and auditTLSKeyFile must be set together"},
+		{cfg.EnableH2C && cfg.ServeTLS, "enableH2C cannot be used with serveTLS"},
+		{cfg.APIServeTLS && (cfg.APICertFile == "" || cfg.APIKeyFile == ""), "apiCertFile and apiKeyFile are required with apiServeTLS"},
+		{cfg.APIClientCAPath != "" && !cfg.APIServeTLS, "apiClientCAPath needs apiServeTLS"},
+		{len(cfg.DeprovisionClientNames) > 0 && cfg.APIClientCAPath == "", "deprovisionClientNames needs apiClientCAPath"},
+		{!basePathPattern.MatchString(cfg.BasePath), "basePath may only contain letters, digits and /._~-"},
+		{!basePathPattern.MatchString(cfg.HTTPPath), "httpPath may only contain letters, digits and /._~-"},
+		{cfg.HTTPPath != "" && cfg.BasePath != "", "httpPath and basePath cannot be used together"},
+		{cfg.HTTPPath != "" && !cfg.servesPath(cfg.RedirectURL), "redirectURL must be under httpPath"},
+		{!bannerColorPattern.MatchString(cfg.ClusterBannerColor), "clusterBannerColor must be a materialize color, such as red or amber darken-2"},
+	}
+
+	for _, check := range checks {
+		if check.bad {
+			return fmt.Errorf("invalid config: %s", check.errMsg)
+		}
+	}
+
+	if _, ok := providerPresets[cfg.Provider]; !ok {
+		return fmt.Errorf("invalid config: provider must be one of %s", strings.Join(providerNames(), ", "))
+	}
+
+	if cfg.Captcha != "" {
+		if _, ok := captchaProviders[cfg.Captcha]; !ok {
+			return fmt.Errorf("invalid config: captcha must be one of %s", strings.Join(captchaNames(), ", "))
+		}
+		if cfg.CaptchaSiteKey == "" || cfg.CaptchaSecretKey == "" {
+			return fmt.Errorf("invalid config: captchaSiteKey and captchaSecretKey are required with captcha")
+		}
+	}
+
+	if cfg.ClusterDocsURL != "" {
+		u, err := url.Parse(cfg.ClusterDocsURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid config: clusterDocsURL must be an http(s) URL")
+		}
+	}
+	if cfg.LogoutURL != "" {
+		u, err := url.Parse(cfg.LogoutURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid config: logoutURL must be an http(s) URL")
+		}
+	}
+	if cfg.EndSessionEndpoint != "" {
+		u, err := url.Parse(cfg.EndSessionEndpoint)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid config: endSessionEndpoint must be an http(s) URL")
+		}
+	}
+	for _, claim := range cfg.OptionalClaims {
+		if claim != cfg.EmailClaim && claim != cfg.groupsClaim() {
+			return fmt.Errorf("invalid config: optionalClaims may only list emailClaim %q and groupsClaim %q, not %q", cfg.EmailClaim, cfg.groupsClaim(), claim)
+		}
+	}
+	if (cfg.StandbyAuthorizeURL == "") != (cfg.StandbyTokenURL == "") {
+		return fmt.Errorf("invalid config: standbyAuthorizeURL and standbyTokenURL must be set together")
+	}
+	for name, standby := range map[string]string{"standbyAuthorizeURL": cfg.StandbyAuthorizeURL, "standbyTokenURL": cfg.StandbyTokenURL} {
+		if standby == "" {
+			continue
+		}
+		u, err := url.Parse(standby)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid config: %s must be an http(s) URL", name)
+		}
+	}
+	for path, target := range cfg.Redirects {
+		if !strings.HasPrefix(path, "/") || strings.HasSuffix(path, "/") || strings.ContainsAny(path, "?#") {
+			return fmt.Errorf("invalid config: redirects: %q must be a path starting, but not ending, with /", path)
+		}
+		u, err := url.Parse(target)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid config: redirects: %s must redirect to an http(s) URL", path)
+		}
+	}
+	if cfg.DeviceAuthorizationURL != "" {
+		u, err := url.Parse(cfg.DeviceAuthorizationURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid config: deviceAuthorizationURL must be an http(s) URL")
+		}
+	}
+
+	for _, fingerprint := range cfg.PinnedCertSHA256 {
+		if _, err := parseFingerprint(fingerprint); err != nil {
+			return fmt.Errorf("invalid config: pinnedCertSHA256: %v", err)
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, name := range cfg.Middleware {
+		if _, ok := middlewares[name]; !ok {
+			return fmt.Errorf("invalid config: unknown middleware %q", name)
+		}
+		if seen[name] {
+			return fmt.Errorf("invalid config: middleware %q is listed twice", name)
+		}
+		seen[name] = true
+	}
+	if seen[middlewareRateLimit] && (cfg.RateLimit <= 0 || cfg.RateLimitBurst < 1) {
+		return fmt.Errorf("invalid config: rateLimit and rateLimitBurst must be positive")
+	}
+	if seen[middlewareIPFilter] && len(cfg.AllowedClientCIDRs) == 0 {
+		return fmt.Errorf("invalid config: no allowedClientCIDRs specified for the ipFilter middleware")
+	}
+	if _, err := parseCIDRs(cfg.AllowedClientCIDRs); err != nil {
+		return fmt.Errorf("invalid config: allowedClientCIDRs: %v", err)
+	}
+	if _, err := parseCIDRs(cfg.TrustedProxies); err != nil {
+		return fmt.Errorf("invalid config: trustedProxies: %v", err)
+	}
+	if len(cfg.ProxyHeaders) > 0 && len(cfg.TrustedProxies) == 0 {
+		return fmt.Errorf("invalid config: proxyHeaders needs trustedProxies")
+	}
+	for _, header := range cfg.ProxyHeaders {
+		if !knownProxyHeader(header) {
+			return fmt.Errorf("invalid config: unknown proxy header %q; proxyHeaders may list %s", header, strings.Join(proxyHeaders, ", "))
+		}
+	}
+
+	for _, addr := range append(append([]string{}, cfg.ListenAddresses...), cfg.APIListenAddresses...) {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return fmt.Errorf("invalid config: bad listen address %q: %v", addr, err)
+		}
+	}
+
+	for _, allowed := range cfg.AllowedRedirects {
+		if strings.Contains(allowed, "://") || strings.HasPrefix(allowed, "/") {
+			return fmt.Errorf("invalid config: allowedRedirects entry %q must be a host or host/path", allowed)
+		}
+	}
+	return nil
+}
+
+// publicURL returns the absolute URL of gangway's home page as users reach
+// it, derived from the redirect URL.
+func (c *Config) publicURL() string {
+	redirect, err := url.Parse(c.RedirectURL)
+	if err != nil || redirect.Host == "" {
+		return ""
+	}
+	return redirect.ResolveReference(&url.URL{Path: "./"}).String()
+}
+
+// cookiePath returns the path gangway's cookies are scoped to, so that
+// instances for several clusters can share a host under different base
+// paths, each with its own client registration, without one's session
+// cookie replacing another's.
+func (c *Config) cookiePath() string {
+	return c.pathPrefix() + "/"
+}
+
+// pathPrefix returns the path prefix of gangway's routes in the browser, from
+// httpPath or basePath.
+func (c *Config) pathPrefix() string {
+	if c.HTTPPath != "" {
+		return cleanBasePath(c.HTTPPath)
+	}
+	return cleanBasePath(c.BasePath)
+}
+
+// servesPath reports whether the path of rawURL is under httpPath.
+func (c *Config) servesPath(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	_, ok := c.routePath(u.Path)
+	return ok
+}
+
+// routePath returns the route requested by a request for path, with httpPath
+// removed, or false if path isn't under httpPath.
+func (c *Config) routePath(path string) (string, bool) {
+	prefix := cleanBasePath(c.HTTPPath)
+	if prefix == "" {
+		return path, true
+	}
+	if !strings.HasPrefix(path, prefix+"/") {
+		return "", false
+	}
+	return strings.TrimPrefix(path, prefix), true
+}
+
+// BindAddresses returns the addresses gangway should listen on.
+func (c *Config) BindAddresses() []string {
+	if len(c.ListenAddresses) > 0 {
+		return c.ListenAddresses
+	}
+	return []string{net.JoinHostPort(c.Host, strconv.Itoa(c.Port))}
+}
+
+// clusterCA returns the API server's CA bundle, inline from clusterCA or
+// read from clusterCAPath.
+func (c *Config) clusterCA() ([]byte, error) {
+	if c.ClusterCA != "" {
+		return []byte(c.ClusterCA), nil
+	}
+	return ioutil.ReadFile(c.ClusterCAPath)
+}
+
+// hasPEMCertificate reports whether bundle holds at least one PEM encoded
+// certificate.
+func hasPEMCertificate(bundle string) bool {
+	for rest := []byte(bundle); ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			return false
+		}
+		if block.Type == "CERTIFICATE" {
+			return true
+		}
+	}
+}
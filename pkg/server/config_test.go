@@ -0,0 +1,477 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestConfigNotFound(t *testing.T) {
+	_, err := NewConfig("nonexistentfile")
+	if err == nil {
+		t.Errorf("Expected config file parsing to file for non-existent config file")
+	}
+}
+
+func TestEnvionmentOverrides(t *testing.T) {
+	os.Setenv("GANGWAY_AUTHORIZE_URL", "https://foo.bar/authorize")
+	os.Setenv("GANGWAY_APISERVER_URL", "https://k8s-api.foo.baz")
+	os.Setenv("GANGWAY_CLIENT_ID", "foo")
+	os.Setenv("GANGWAY_CLIENT_SECRET", "bar")
+	os.Setenv("GANGWAY_PORT", "1234")
+	os.Setenv("GANGWAY_REDIRECT_URL", "https://foo.baz/callback")
+	os.Setenv("GANGWAY_CLUSTER_CA_PATH", "/etc/ssl/certs/ca-certificates.crt")
+	os.Setenv("GANGWAY_SESSION_SECURITY_KEY", "testing")
+	os.Setenv("GANGWAY_TOKEN_URL", "https://foo.bar/token")
+	cfg, err := NewConfig("")
+	if err != nil {
+		t.Errorf("Failed to test config overrides with error: %s", err)
+	}
+
+	if cfg.Port != 1234 {
+		t.Errorf("Failed to override config with environment")
+	}
+}
+
+// TestEveryFieldHasEnvVar makes sure every field can be overridden from the
+// environment by a GANGWAY_ variable named after its words, rather than one
+// envconfig makes up by upper-casing the field name.
+func TestEveryFieldHasEnvVar(t *testing.T) {
+	typ := reflect.TypeOf(Config{})
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		name := f.Tag.Get("yaml")
+		if name == "" || name == "-" {
+			continue
+		}
+		if strings.ToLower(name) != name && f.Tag.Get("envconfig") == "" {
+			t.Errorf("%s has no envconfig tag", f.Name)
+		}
+	}
+}
+
+func TestMapEnvironmentOverrides(t *testing.T) {
+	os.Setenv("GANGWAY_REDIRECTS", `{"/docs": "https://wiki.example.com/kubernetes?from=gangway,portal"}`)
+	os.Setenv("GANGWAY_ONBOARDING_INSTRUCTIONS", `{"macos": "brew install kubectl\nkubectl version"}`)
+	defer os.Unsetenv("GANGWAY_REDIRECTS")
+	defer os.Unsetenv("GANGWAY_ONBOARDING_INSTRUCTIONS")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.Redirects["/docs"]; got != "https://wiki.example.com/kubernetes?from=gangway,portal" {
+		t.Errorf("got redirect %q", got)
+	}
+	if got := cfg.OnboardingInstructions["macos"]; got != "brew install kubectl\nkubectl version" {
+		t.Errorf("got instructions %q", got)
+	}
+
+	os.Setenv("GANGWAY_REDIRECTS", "/docs:https://wiki.example.com")
+	if _, err := LoadConfig(); err == nil {
+		t.Error("expected an error for a map that isn't JSON")
+	}
+}
+
+func TestConfigFromURL(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("clusterName: remote-cluster\n"))
+	}))
+	defer ts.Close()
+	defer func(c *http.Client) { configSourceClient = c }(configSourceClient)
+	configSourceClient = ts.Client()
+
+	if _, err := NewConfig("http" + strings.TrimPrefix(ts.URL, "https")); err == nil {
+		t.Errorf("Loaded the config over plain http")
+	}
+
+	cfg, err := NewConfig(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to load config from URL: %s", err)
+	}
+
+	if cfg.ClusterName != "remote-cluster" {
+		t.Errorf("Expected cluster name %q from remote config, got %q", "remote-cluster", cfg.ClusterName)
+	}
+}
+
+func TestParseConfigMapRef(t *testing.T) {
+	namespace, name, key, err := parseConfigMapRef("configmap://gangway/gangway/gangway.yaml")
+	if err != nil {
+		t.Fatalf("Failed to parse configmap reference: %s", err)
+	}
+	if namespace != "gangway" || name != "gangway" || key != "gangway.yaml" {
+		t.Errorf("Unexpected configmap reference parts: %s/%s/%s", namespace, name, key)
+	}
+
+	for _, ref := range []string{"configmap://gangway", "configmap://gangway/gangway", "configmap://gangway//key"} {
+		if _, _, _, err := parseConfigMapRef(ref); err == nil {
+			t.Errorf("Expected an error parsing %q", ref)
+		}
+	}
+}
+
+func TestConfigOverlay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gangway")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	base := filepath.Join(dir, "base.yaml")
+	overlay := filepath.Join(dir, "overlay.yaml")
+	if err := ioutil.WriteFile(base, []byte("clusterName: base\nemailClaim: mail\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(overlay, []byte("clusterName: overlay\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := NewConfig(base, overlay)
+	if err != nil {
+		t.Fatalf("Failed to load merged config: %s", err)
+	}
+
+	if cfg.ClusterName != "overlay" {
+		t.Errorf("Expected overlay to override cluster name, got %q", cfg.ClusterName)
+	}
+	if cfg.EmailClaim != "mail" {
+		t.Errorf("Expected base email claim to be kept, got %q", cfg.EmailClaim)
+	}
+}
+
+func TestWatchConfigReloadsOnSignal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gangway")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "gangway.yaml")
+	if err := ioutil.WriteFile(file, []byte("clusterName: before\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	current, err := NewConfig(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reload := make(chan os.Signal)
+	applied := make(chan *Config)
+	go WatchConfig([]string{file}, current, 0, reload, func(c *Config) error {
+		applied <- c
+		return nil
+	})
+
+	if err := ioutil.WriteFile(file, []byte("clusterName: after\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	reload <- syscall.SIGHUP
+	select {
+	case c := <-applied:
+		if c.ClusterName != "after" {
+			t.Errorf("applied cluster name %q, want after", c.ClusterName)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("config not reloaded on signal")
+	}
+}
+
+func TestMiddlewareConfig(t *testing.T) {
+	tests := []struct {
+		middleware []string
+		cidrs      []string
+		valid      bool
+	}{
+		{[]string{"logging", "securityHeaders", "compression"}, nil, true},
+		{[]string{}, nil, true},
+		{[]string{"logging", "gzip"}, nil, false},
+		{[]string{"logging", "logging"}, nil, false},
+		{[]string{"ipFilter"}, nil, false},
+		{[]string{"ipFilter"}, []string{"10.0.0.0/8", "fd00::/8"}, true},
+		{[]string{"ipFilter"}, []string{"10.0.0.0"}, false},
+	}
+	for _, tc := range tests {
+		c, err := LoadConfig()
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.AuthorizeURL = "https://foo.bar/authorize"
+		c.TokenURL = "https://foo.bar/token"
+		c.ClientID = "foo"
+		c.ClientSecret = "bar"
+		c.RedirectURL = "https://foo.baz/callback"
+		c.SessionSecurityKey = SessionKeys{"testing"}
+		c.APIServerURL = "https://k8s-api.foo.baz"
+		c.Middleware = tc.middleware
+		c.AllowedClientCIDRs = tc.cidrs
+
+		err = validateConfig(c)
+		if tc.valid && err != nil {
+			t.Errorf("middleware %v, CIDRs %v: unexpected error: %s", tc.middleware, tc.cidrs, err)
+		}
+		if !tc.valid && err == nil {
+			t.Errorf("middleware %v, CIDRs %v: expected an error", tc.middleware, tc.cidrs)
+		}
+	}
+}
+
+func TestPublicClientConfig(t *testing.T) {
+	for _, pkce := range []bool{true, false} {
+		c, err := LoadConfig()
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.AuthorizeURL = "https://foo.bar/authorize"
+		c.TokenURL = "https://foo.bar/token"
+		c.ClientID = "foo"
+		c.ClientSecret = ""
+		c.RedirectURL = "https://foo.baz/callback"
+		c.SessionSecurityKey = SessionKeys{"testing"}
+		c.APIServerURL = "https://k8s-api.foo.baz"
+		c.PKCE = pkce
+
+		// only a client using PKCE may do without a secret
+		if err := validateConfig(c); (err == nil) != pkce {
+			t.Errorf("pkce %v without a client secret: got error %v", pkce, err)
+		}
+	}
+}
+
+func TestDeviceFlowConfig(t *testing.T) {
+	tests := []struct {
+		issuerURL, deviceAuthorizationURL string
+		valid                             bool
+	}{
+		{"", "", false},
+		{"https://foo.bar", "", true},
+		{"", "https://foo.bar/device/code", true},
+		{"", "foo.bar/device/code", false},
+	}
+	for _, tc := range tests {
+		c, err := LoadConfig()
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.AuthorizeURL = "https://foo.bar/authorize"
+		c.TokenURL = "https://foo.bar/token"
+		c.ClientID = "foo"
+		c.ClientSecret = "bar"
+		c.RedirectURL = "https://foo.baz/callback"
+		c.SessionSecurityKey = SessionKeys{"testing"}
+		c.APIServerURL = "https://k8s-api.foo.baz"
+		c.DeviceFlow = true
+		c.IssuerURL = tc.issuerURL
+		c.DeviceAuthorizationURL = tc.deviceAuthorizationURL
+
+		if err := validateConfig(c); (err == nil) != tc.valid {
+			t.Errorf("issuerURL %q, deviceAuthorizationURL %q: got error %v, want valid %v", tc.issuerURL, tc.deviceAuthorizationURL, err, tc.valid)
+		}
+	}
+}
+
+func TestCredentialPluginConfig(t *testing.T) {
+	tests := []struct {
+		credentialPlugin, issuerURL string
+		valid                       bool
+	}{
+		{"", "", true},
+		{"kubelogin", "https://foo.bar", true},
+		{"kubelogin", "", false},
+		{"oidc-helper", "https://foo.bar", false},
+	}
+	for _, tc := range tests {
+		c, err := LoadConfig()
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.AuthorizeURL = "https://foo.bar/authorize"
+		c.TokenURL = "https://foo.bar/token"
+		c.ClientID = "foo"
+		c.ClientSecret = "bar"
+		c.RedirectURL = "https://foo.baz/callback"
+		c.SessionSecurityKey = SessionKeys{"testing"}
+		c.APIServerURL = "https://k8s-api.foo.baz"
+		c.CredentialPlugin = tc.credentialPlugin
+		c.IssuerURL = tc.issuerURL
+
+		if err := validateConfig(c); (err == nil) != tc.valid {
+			t.Errorf("credentialPlugin %q, issuerURL %q: got error %v, want valid %v", tc.credentialPlugin, tc.issuerURL, err, tc.valid)
+		}
+	}
+}
+
+func TestClusterCA(t *testing.T) {
+	ts := httptest.NewTLSServer(http.NotFoundHandler())
+	ts.Close()
+	ca := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw}))
+
+	tests := []struct {
+		clusterCA string
+		valid     bool
+	}{
+		{"", true},
+		{ca, true},
+		{"ca.crt", false},
+		{string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte("key")})), false},
+	}
+	for _, tc := range tests {
+		c, err := LoadConfig()
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.AuthorizeURL = "https://foo.bar/authorize"
+		c.TokenURL = "https://foo.bar/token"
+		c.ClientID = "foo"
+		c.ClientSecret = "bar"
+		c.RedirectURL = "https://foo.baz/callback"
+		c.SessionSecurityKey = SessionKeys{"testing"}
+		c.APIServerURL = "https://k8s-api.foo.baz"
+		c.ClusterCA = tc.clusterCA
+
+		if err := validateConfig(c); (err == nil) != tc.valid {
+			t.Errorf("clusterCA %q: got error %v, want valid %v", tc.clusterCA, err, tc.valid)
+		}
+	}
+
+	// the inline CA takes precedence over the file
+	c := &Config{ClusterCA: ca, ClusterCAPath: "/nonexistent/ca.crt"}
+	if got, err := c.clusterCA(); err != nil || string(got) != ca {
+		t.Errorf("clusterCA() = %q, %v, want the inline CA", got, err)
+	}
+	c.ClusterCA = ""
+	if _, err := c.clusterCA(); err == nil {
+		t.Errorf("clusterCA() read a nonexistent clusterCAPath")
+	}
+}
+
+func TestSessionCookieConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		lifetime time.Duration
+		sameSite string
+		secure   bool
+		valid    bool
+	}{
+		{"", 0, "", false, true},
+		{"k8s_session", 8 * time.Hour, "lax", false, true},
+		{"", 0, "none", true, true},
+		{"", 0, "none", false, false},
+		{"", 0, "relaxed", false, false},
+		{"k8s session", 0, "", false, false},
+		{"", 30 * time.Second, "", false, false},
+		{"", 90 * 24 * time.Hour, "", false, false},
+	}
+	for _, tc := range tests {
+		c, err := LoadConfig()
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.AuthorizeURL = "https://foo.bar/authorize"
+		c.TokenURL = "https://foo.bar/token"
+		c.ClientID = "foo"
+		c.ClientSecret = "bar"
+		c.RedirectURL = "https://foo.baz/callback"
+		c.SessionSecurityKey = SessionKeys{"testing"}
+		c.APIServerURL = "https://k8s-api.foo.baz"
+		c.SessionCookieName = tc.name
+		c.SessionLifetime = tc.lifetime
+		c.CookieSameSite = tc.sameSite
+		c.CookieSecure = tc.secure
+
+		if err := validateConfig(c); (err == nil) != tc.valid {
+			t.Errorf("%+v: got error %v, want valid %v", tc, err, tc.valid)
+		}
+	}
+}
+
+func TestHTTPPathConfig(t *testing.T) {
+	tests := []struct {
+		httpPath, basePath, redirectURL string
+		valid                           bool
+	}{
+		{"", "", "https://foo.baz/callback", true},
+		{"/gangway", "", "https://foo.baz/gangway/callback", true},
+		{"/gangway/", "", "https://foo.baz/gangway/callback", true},
+		{"/gangway", "", "https://foo.baz/callback", false},
+		{"/gangway", "", "https://foo.baz/gangwayx/callback", false},
+		{"/gangway", "/gangway", "https://foo.baz/gangway/callback", false},
+		{`/"><script>`, "", "https://foo.baz/callback", false},
+	}
+	for _, tc := range tests {
+		c, err := LoadConfig()
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.AuthorizeURL = "https://foo.bar/authorize"
+		c.TokenURL = "https://foo.bar/token"
+		c.ClientID = "foo"
+		c.ClientSecret = "bar"
+		c.RedirectURL = tc.redirectURL
+		c.SessionSecurityKey = SessionKeys{"testing"}
+		c.APIServerURL = "https://k8s-api.foo.baz"
+		c.HTTPPath = tc.httpPath
+		c.BasePath = tc.basePath
+
+		if err := validateConfig(c); (err == nil) != tc.valid {
+			t.Errorf("%+v: got error %v, want valid %v", tc, err, tc.valid)
+		}
+	}
+}
+
+func TestTrustedProxiesConfig(t *testing.T) {
+	tests := []struct {
+		trustedProxies, proxyHeaders []string
+		valid                        bool
+	}{
+		{nil, nil, true},
+		{[]string{"10.0.0.0/8"}, nil, true},
+		{[]string{"10.0.0.0/8"}, []string{"x-forwarded-proto", "X-Forwarded-For"}, true},
+		{[]string{"10.0.0.1"}, nil, false},
+		{nil, []string{"X-Forwarded-For"}, false},
+		{[]string{"10.0.0.0/8"}, []string{"X-Real-IP"}, false},
+		{[]string{"10.0.0.0/8"}, []string{"X-Forwarded-Prefix"}, true},
+		{[]string{"10.0.0.0/8"}, []string{"X-Forwarded-Host"}, false},
+	}
+	for _, tc := range tests {
+		c, err := LoadConfig()
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.AuthorizeURL = "https://foo.bar/authorize"
+		c.TokenURL = "https://foo.bar/token"
+		c.ClientID = "foo"
+		c.ClientSecret = "bar"
+		c.RedirectURL = "https://foo.baz/callback"
+		c.SessionSecurityKey = SessionKeys{"testing"}
+		c.APIServerURL = "https://k8s-api.foo.baz"
+		c.TrustedProxies = tc.trustedProxies
+		c.ProxyHeaders = tc.proxyHeaders
+
+		if err := validateConfig(c); (err == nil) != tc.valid {
+			t.Errorf("%+v: got error %v, want valid %v", tc, err, tc.valid)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	configMapScheme = "configmap://"
+
+	serviceAccountTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	serviceAccountCAPath    = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+)
+
+// configSourceClient is used to fetch remote config sources. The config is
+// not loaded yet at that point, so only the system roots are trusted.
+var configSourceClient = &http.Client{Timeout: 10 * time.Second}
+
+// readConfigSource returns the raw contents of a config source. A source may
+// be a local file path, an https:// URL, or a reference to a key in a
+// Kubernetes ConfigMap in the form configmap://namespace/name/key. Plain
+// http:// URLs are refused, as the config holds the client secret and the
+// session keys.
+func readConfigSource(source string) ([]byte, error) {
+	switch {
+	case strings.HasPrefix(source, "https://"):
+		return fetchConfigURL(source)
+	case strings.HasPrefix(source, "http://"):
+		return nil, fmt.Errorf("config source %s is not https; the config holds secrets, so it may only be fetched over https", source)
+	case strings.HasPrefix(source, configMapScheme):
+		return fetchConfigMap(source)
+	default:
+		return ioutil.ReadFile(source)
+	}
+}
+
+func fetchConfigURL(source string) ([]byte, error) {
+	resp, err := configSourceClient.Get(source)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching config from %s: unexpected status %s", source, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// parseConfigMapRef splits a configmap://namespace/name/key reference into
+// its parts.
+func parseConfigMapRef(source string) (namespace, name, key string, err error) {
+	parts := strings.Split(strings.TrimPrefix(source, configMapScheme), "/")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return "", "", "", fmt.Errorf("invalid config source %q: expected configmap://namespace/name/key", source)
+	}
+	return parts[0], parts[1], parts[2], nil
+}
+
+// fetchConfigMap reads a single key out of a ConfigMap using the in-cluster
+// service account credentials.
+func fetchConfigMap(source string) ([]byte, error) {
+	namespace, name, key, err := parseConfigMapRef(source)
+	if err != nil {
+		return nil, err
+	}
+
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("cannot read %s: not running inside a Kubernetes cluster", source)
+	}
+
+	token, err := ioutil.ReadFile(serviceAccountTokenPath)
+	if err != nil {
+		return nil, err
+	}
+	caData, err := ioutil.ReadFile(serviceAccountCAPath)
+	if err != nil {
+		return nil, err
+	}
+	rootCAs := x509.NewCertPool()
+	if ok := rootCAs.AppendCertsFromPEM(caData); !ok {
+		return nil, fmt.Errorf("no certificates found in %s", serviceAccountCAPath)
+	}
+
+	client := &http.Client{
+		Timeout:   configSourceClient.Timeout,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: rootCAs}},
+	}
+	url := fmt.Sprintf("https://%s/api/v1/namespaces/%s/configmaps/%s", net.JoinHostPort(host, port), namespace, name)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching configmap %s/%s: unexpected status %s", namespace, name, resp.Status)
+	}
+
+	var configMap struct {
+		Data map[string]string `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&configMap); err != nil {
+		return nil, err
+	}
+	data, ok := configMap.Data[key]
+	if !ok {
+		return nil, fmt.Errorf("configmap %s/%s has no key %q", namespace, name, key)
+	}
+	return []byte(data), nil
+}
+
+// WatchConfig re-reads the config sources every interval, if it is positive,
+// and whenever reload receives a signal, and calls apply with the new config
+// whenever it differs from the one in effect. Invalid configs are logged and
+// the previous config stays in effect.
+func WatchConfig(sources []string, current *Config, interval time.Duration, reload <-chan os.Signal, apply func(*Config) error) {
+	source := strings.Join(sources, ", ")
+	if source == "" {
+		source = "the environment"
+	}
+	// a nil channel never fires
+	var tick <-chan time.Time
+	if interval > 0 {
+		tick = time.Tick(interval)
+	}
+	for {
+		select {
+		case <-tick:
+		case sig := <-reload:
+			log.Infof("Received %s, reloading config from %s", sig, source)
+		}
+
+		c, err := NewConfig(sources...)
+		if err != nil {
+			log.Errorf("Failed to refresh config from %s: %s", source, err)
+			continue
+		}
+		if reflect.DeepEqual(c, current) {
+			continue
+		}
+
+		if err := apply(c); err != nil {
+			log.Errorf("Failed to apply updated config from %s: %s", source, err)
+			continue
+		}
+		current = c
+		log.Infof("Reloaded config from %s", source)
+	}
+}
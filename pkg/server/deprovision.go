@@ -0,0 +1,104 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Deprovisioning closes the gap between a user being offboarded and their
+// gangway sessions ending. The identity management system, e.g. on an HR
+// offboarding event, tells gangway that a user is gone, and every session
+// of theirs issued until then is turned away like one logged out at the
+// identity provider.
+
+// deprovisionEvent is the body of a deprovisioning request.
+type deprovisionEvent struct {
+	// User is the deprovisioned user, as in the username claim, or the
+	// subject if the ID token has no such claim.
+	User string `json:"user"`
+}
+
+// deprovisionAuth lets through requests with Config.DeprovisionToken as
+// their bearer token, or a verified client certificate for one of
+// Config.DeprovisionClientNames. Without either the webhook doesn't exist.
+func (a *app) deprovisionAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.cfg.DeprovisionToken == "" && len(a.cfg.DeprovisionClientNames) == 0 {
+			http.NotFound(w, r)
+			return
+		}
+		if a.deprovisionClientAllowed(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		auth := r.Header.Get("Authorization")
+		if a.cfg.DeprovisionToken == "" || !strings.HasPrefix(auth, "Bearer ") ||
+			subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(a.cfg.DeprovisionToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="gangway"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// deprovisionClientAllowed reports whether r came with a verified client
+// certificate whose common name or DNS names include one of
+// Config.DeprovisionClientNames.
+func (a *app) deprovisionClientAllowed(r *http.Request) bool {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return false
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+	names := append([]string{cert.Subject.CommonName}, cert.DNSNames...)
+	for _, allowed := range a.cfg.DeprovisionClientNames {
+		for _, name := range names {
+			if name == allowed {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// deprovisionHandler ends every session of the user in the posted event.
+// Sessions started after it are unaffected, so a user who is reinstated can
+// sign in again.
+func (a *app) deprovisionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	var event deprovisionEvent
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&event); err != nil || event.User == "" {
+		http.Error(w, "the body must be a JSON object with the user to deprovision", http.StatusBadRequest)
+		return
+	}
+
+	if err := a.revokeSession(revocationKey("", "user", event.User), time.Now()); err != nil {
+		requestLog(r).Errorf("Could not deprovision %s: %s", event.User, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	requestLog(r).Infof("Deprovisioned %s", event.User)
+	a.audit(r, auditLogout, event.User, "deprovisioned")
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,95 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestDeprovision(t *testing.T) {
+	s := newLogoutTestServer(t)
+	a := s.current()
+	a.cfg.UsernameClaim = "email"
+	now := time.Now()
+	jane := signedInCookie(t, a, jwt.MapClaims{"sub": "1234", "email": "jane@example.com", "iat": now.Add(-time.Minute).Unix()})
+
+	tests := []struct {
+		token  string
+		auth   string
+		body   string
+		status int
+	}{
+		{"", "Bearer s3cret", `{"user":"jane@example.com"}`, http.StatusNotFound},
+		{"s3cret", "", `{"user":"jane@example.com"}`, http.StatusUnauthorized},
+		{"s3cret", "Bearer wrong", `{"user":"jane@example.com"}`, http.StatusUnauthorized},
+		{"s3cret", "Bearer s3cret", `{}`, http.StatusBadRequest},
+		{"s3cret", "Bearer s3cret", `{"user":"jane@example.com"}`, http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		if !signedIn(a, jane) {
+			t.Fatalf("token %q, authorization %q: the user was deprovisioned too early", tt.token, tt.auth)
+		}
+		a.cfg.DeprovisionToken = tt.token
+		req := httptest.NewRequest("POST", "/api/v1/deprovision", strings.NewReader(tt.body))
+		if tt.auth != "" {
+			req.Header.Set("Authorization", tt.auth)
+		}
+		rr := httptest.NewRecorder()
+		s.ServeHTTP(rr, req)
+		if rr.Code != tt.status {
+			t.Errorf("token %q, authorization %q, body %s: got status %d, want %d", tt.token, tt.auth, tt.body, rr.Code, tt.status)
+		}
+	}
+
+	if signedIn(a, jane) {
+		t.Error("the deprovisioned user is still signed in")
+	}
+	again := signedInCookie(t, a, jwt.MapClaims{"sub": "1234", "email": "jane@example.com", "iat": now.Add(time.Minute).Unix()})
+	if !signedIn(a, again) {
+		t.Error("a session started after deprovisioning is turned away")
+	}
+}
+
+func TestDeprovisionClientAllowed(t *testing.T) {
+	a := newTestApp(t)
+	a.cfg.DeprovisionClientNames = []string{"scim-bridge"}
+
+	withCert := func(cert *x509.Certificate) *http.Request {
+		req := httptest.NewRequest("POST", "/api/v1/deprovision", nil)
+		req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+		return req
+	}
+	if !a.deprovisionClientAllowed(withCert(&x509.Certificate{Subject: pkix.Name{CommonName: "scim-bridge"}})) {
+		t.Error("a client with an allowed common name was turned away")
+	}
+	if !a.deprovisionClientAllowed(withCert(&x509.Certificate{DNSNames: []string{"other", "scim-bridge"}})) {
+		t.Error("a client with an allowed DNS name was turned away")
+	}
+	if a.deprovisionClientAllowed(withCert(&x509.Certificate{Subject: pkix.Name{CommonName: "dashboard"}})) {
+		t.Error("a client with another name was let through")
+	}
+	if a.deprovisionClientAllowed(httptest.NewRequest("POST", "/api/v1/deprovision", nil)) {
+		t.Error("a client without a certificate was let through")
+	}
+}
@@ -0,0 +1,322 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// The device flow signs in users who only have a terminal, such as on a jump
+// host, with the OAuth device authorization grant (RFC 8628). They run
+//
+//	curl -N https://gangway.example.com/device
+//
+// and are told where to enter a code in a browser on another device. gangway
+// meanwhile polls the identity provider, and prints the usual commands once
+// the user has approved the sign in. The response is streamed, so it isn't
+// bound by Config.RequestTimeout but by how long the code is valid. The app
+// isn't held while polling; if the config is replaced meanwhile, the user is
+// asked to start over.
+
+const (
+	// deviceCodeGrantType is the grant_type of device access token requests.
+	deviceCodeGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+	// defaultDevicePollInterval is how often the token endpoint is polled
+	// when the provider doesn't say.
+	defaultDevicePollInterval = 5 * time.Second
+	// defaultDeviceCodeLifetime is how long a device code is polled for when
+	// the provider doesn't say.
+	defaultDeviceCodeLifetime = 10 * time.Minute
+)
+
+type connKey struct{}
+
+// ConnContext is meant for http.Server.ConnContext. It keeps the connection
+// in the context of its requests, so that the device flow can lift the
+// server's WriteTimeout where the HTTP server can't do that per response.
+func ConnContext(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, connKey{}, c)
+}
+
+// setWriteDeadline moves the write deadline of the response w to r, set by
+// the http.Server's WriteTimeout. Like http.ResponseController, it looks
+// through the middleware's writers for one that can; failing that, it sets
+// the deadline of the HTTP/1 connection kept by ConnContext.
+func setWriteDeadline(w http.ResponseWriter, r *http.Request, deadline time.Time) error {
+	for {
+		switch rw := w.(type) {
+		case interface{ SetWriteDeadline(time.Time) error }:
+			return rw.SetWriteDeadline(deadline)
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = rw.Unwrap()
+		default:
+			if c, ok := r.Context().Value(connKey{}).(net.Conn); ok && r.ProtoMajor == 1 {
+				return c.SetWriteDeadline(deadline)
+			}
+			return errors.New("the response's write deadline can't be changed")
+		}
+	}
+}
+
+// deviceAuthorization is the provider's response to a device authorization
+// request.
+type deviceAuthorization struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// deviceError is an OAuth error the provider answered a device flow request
+// with.
+type deviceError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+func (e *deviceError) Error() string {
+	if e.Description != "" {
+		return e.Code + ": " + e.Description
+	}
+	return e.Code
+}
+
+// postDeviceForm posts form, with gangway's client credentials, to endpoint
+// and decodes a successful JSON response into v. OAuth errors are returned as
+// *deviceError.
+func (a *app) postDeviceForm(ctx context.Context, endpoint string, form url.Values, v interface{}) error {
+	form.Set("client_id", a.cfg.ClientID)
+	if a.cfg.ClientSecret != "" {
+		form.Set("client_secret", a.cfg.ClientSecret)
+	}
+	req, err := http.NewRequest("POST", endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	resp, err := a.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var e deviceError
+		if json.Unmarshal(body, &e) == nil && e.Code != "" {
+			return &e
+		}
+		return fmt.Errorf("%s returned %s", endpoint, resp.Status)
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("decoding %s response: %v", endpoint, err)
+	}
+	return nil
+}
+
+// authorizeDevice starts a device flow with the provider.
+func (a *app) authorizeDevice(ctx context.Context) (*deviceAuthorization, error) {
+	var da deviceAuthorization
+	form := url.Values{"scope": {strings.Join(a.cfg.scopes(), " ")}}
+	if err := a.postDeviceForm(ctx, a.cfg.DeviceAuthorizationURL, form, &da); err != nil {
+		return nil, err
+	}
+	if da.DeviceCode == "" || da.UserCode == "" || da.VerificationURI == "" {
+		return nil, fmt.Errorf("%s returned an incomplete device authorization", a.cfg.DeviceAuthorizationURL)
+	}
+	return &da, nil
+}
+
+// pollDeviceToken polls the token endpoint until the user has approved or
+// denied the device flow da, or ctx is done.
+func (a *app) pollDeviceToken(ctx context.Context, da *deviceAuthorization) (*oauth2.Token, error) {
+	interval := time.Duration(da.Interval) * time.Second
+	if interval <= 0 {
+		interval = defaultDevicePollInterval
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(interval):
+		}
+
+		var resp struct {
+			AccessToken  string `json:"access_token"`
+			TokenType    string `json:"token_type"`
+			RefreshToken string `json:"refresh_token"`
+			ExpiresIn    int    `json:"expires_in"`
+			IDToken      string `json:"id_token"`
+		}
+		err := a.postDeviceForm(ctx, a.cfg.TokenURL, url.Values{
+			"grant_type":  {deviceCodeGrantType},
+			"device_code": {da.DeviceCode},
+		}, &resp)
+		if e, ok := err.(*deviceError); ok {
+			switch e.Code {
+			case "authorization_pending":
+				continue
+			case "slow_down":
+				interval += 5 * time.Second
+				continue
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		token := &oauth2.Token{
+			AccessToken:  resp.AccessToken,
+			TokenType:    resp.TokenType,
+			RefreshToken: resp.RefreshToken,
+		}
+		if resp.ExpiresIn > 0 {
+			token.Expiry = time.Now().Add(time.Duration(resp.ExpiresIn) * time.Second)
+		}
+		return token.WithExtra(map[string]interface{}{"id_token": resp.IDToken}), nil
+	}
+}
+
+// deviceHandler signs a user in with the device flow, see above.
+func (a *app) deviceHandler(w http.ResponseWriter, r *http.Request) {
+	if !a.cfg.DeviceFlow {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	authorizeCtx, cancel := context.WithTimeout(r.Context(), a.cfg.RequestTimeout)
+	da, err := a.authorizeDevice(authorizeCtx)
+	cancel()
+	if err != nil {
+		requestLog(r).Errorf("Could not start a device flow: %s", err)
+		http.Error(w, "The identity provider could not start a sign in. Please try again; if this keeps happening, contact your administrator.", http.StatusBadGateway)
+		return
+	}
+
+	fmt.Fprintf(w, "To sign in to %s, open\n\n    %s\n\nin a browser and enter the code\n\n    %s\n\n", a.cfg.ClusterName, da.VerificationURI, da.UserCode)
+	if da.VerificationURIComplete != "" {
+		fmt.Fprintf(w, "or open %s, which fills in the code for you.\n\n", da.VerificationURIComplete)
+	}
+	fmt.Fprintf(w, "Waiting for you to sign in...\n\n")
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+
+	lifetime := time.Duration(da.ExpiresIn) * time.Second
+	if lifetime <= 0 {
+		lifetime = defaultDeviceCodeLifetime
+	}
+	// the server's WriteTimeout only allows for the other routes' timeouts;
+	// leave time for the checks that follow a sign in at the last moment
+	if err := setWriteDeadline(w, r, time.Now().Add(lifetime+a.cfg.RequestTimeout)); err != nil {
+		requestLog(r).Warnf("Could not extend the write deadline of a device flow, which may be cut off by the server's write timeout: %s", err)
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), lifetime)
+	defer cancel()
+	var token *oauth2.Token
+	current := a.unlocked(func() {
+		token, err = a.pollDeviceToken(ctx, da)
+	})
+	if !current {
+		if r.Context().Err() == nil {
+			fmt.Fprintln(w, "gangway's configuration changed while you were signing in. Run this again to sign in with the new one.")
+		}
+		return
+	}
+	if err != nil {
+		var reason, message string
+		switch e, _ := err.(*deviceError); {
+		case err == context.DeadlineExceeded, e != nil && e.Code == "expired_token":
+			reason, message = "device_code_expired", "The code expired before you signed in. Run this again for a new one."
+		case e != nil && e.Code == "access_denied":
+			reason, message = "access_denied", "The sign in was denied."
+		default:
+			requestLog(r).Errorf("Device flow failed: %s", err)
+			reason, message = "device_flow_failed", "The identity provider could not complete the sign in. Please try again; if this keeps happening, contact your administrator."
+		}
+		if r.Context().Err() == nil {
+			a.audit(r, auditLoginFailed, "", reason)
+			fmt.Fprintln(w, message)
+		}
+		return
+	}
+
+	// the same checks as for a login through the browser
+	if err := a.verifyIDToken(token, "", time.Now()); err != nil {
+		requestLog(r).Warnf("Device flow returned an invalid ID token: %s", err)
+		a.audit(r, auditLoginFailed, "", "id_token_invalid")
+		fmt.Fprintln(w, "The identity provider returned an invalid token. Please contact your administrator.")
+		return
+	}
+	if iss, mismatch := a.checkIssuer(token); mismatch != "" {
+		requestLog(r).Errorf("ID token issuer %q does not match issuerURL %q: %s", iss, a.cfg.IssuerURL, mismatch)
+		a.audit(r, auditLoginFailed, a.tokenUser(token), "issuer_mismatch")
+		fmt.Fprintf(w, "The identity provider issued a token for %q, but this cluster trusts %q: %s. Please contact your administrator.\n", iss, a.cfg.IssuerURL, mismatch)
+		return
+	}
+	if reason := a.checkClaimRules(token); reason != "" {
+		requestLog(r).Warnf("ID token breaks the API server's claim validation rules: %s", reason)
+		a.audit(r, auditLoginFailed, a.tokenUser(token), "claim_validation")
+		fmt.Fprintf(w, "This cluster would not accept your token: %s. Please contact your administrator.\n", reason)
+		return
+	}
+
+	groups, groupsErr := a.fetchGroups(ctx, token)
+	if groupsErr != nil {
+		requestLog(r).Warnf("%s", groupsErr)
+	}
+	if reason := a.checkLoginPolicy(token, groups, groupsErr); reason != "" {
+		requestLog(r).Warnf("Login refused by policy: %s", reason)
+		a.audit(r, auditLoginFailed, a.tokenUser(token), "policy")
+		fmt.Fprintf(w, "You may not get credentials for this cluster: %s. Please contact your administrator.\n", reason)
+		return
+	}
+
+	idToken, _ := token.Extra("id_token").(string)
+	info := a.tokenInfo(w, r, idToken, token.RefreshToken, groups)
+	if info == nil {
+		return
+	}
+	tmpl, err := loadTemplate("commandline.tmpl")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	user, now := a.tokenUser(token), time.Now()
+	a.stats.recordLogin(user, a.cfg.ClusterName, now)
+	a.stats.recordRefreshToken(token.RefreshToken != "")
+	a.recordLogin(r, user, now)
+	a.audit(r, auditLogin, user, "")
+	fmt.Fprintf(w, "Signed in as %s. Run these commands to configure kubectl:\n\n", info.Username)
+	tmpl.ExecuteTemplate(w, "commands", info)
+}
@@ -0,0 +1,183 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// discoveryTimeout bounds fetching the provider metadata.
+const discoveryTimeout = 10 * time.Second
+
+// discoveryMaxAge is how long fetched provider metadata is used as is. Older
+// metadata is still used, while it is fetched again in the background.
+const discoveryMaxAge = time.Hour
+
+// providerMetadata is the part of an OpenID provider's metadata, as served
+// at /.well-known/openid-configuration, that gangway uses.
+type providerMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+	EndSessionEndpoint    string `json:"end_session_endpoint"`
+
+	DeviceAuthorizationEndpoint string `json:"device_authorization_endpoint"`
+}
+
+// discoveryURL returns where the provider metadata of issuer is served.
+func discoveryURL(issuer string) string {
+	return strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration"
+}
+
+// discoverProvider fetches the metadata of the provider at issuer.
+func discoverProvider(client *http.Client, issuer string) (*providerMetadata, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), discoveryTimeout)
+	defer cancel()
+	req, err := http.NewRequest("GET", discoveryURL(issuer), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("fetching provider metadata: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching provider metadata from %s: unexpected status %s", req.URL, resp.Status)
+	}
+
+	var m providerMetadata
+	if err := json.NewDecoder(resp.Body).Decode(&m); err != nil {
+		return nil, fmt.Errorf("decoding provider metadata from %s: %v", req.URL, err)
+	}
+	// a provider that names another issuer would have its ID tokens
+	// rejected by the API server anyway
+	if mismatch := issuerMismatch(issuer, m.Issuer); mismatch != "" {
+		return nil, fmt.Errorf("provider metadata from %s is for issuer %q, not issuerURL: %s", req.URL, m.Issuer, mismatch)
+	}
+	if m.AuthorizationEndpoint == "" || m.TokenEndpoint == "" {
+		return nil, fmt.Errorf("provider metadata from %s lacks the authorization or token endpoint", req.URL)
+	}
+	return &m, nil
+}
+
+// discoveryCache keeps the provider metadata of each issuer across config
+// changes, so that applying a config doesn't fail because the provider didn't
+// answer in time. Stale metadata is served while it is revalidated in the
+// background, and kept if that fails; endpoints that changed are picked up
+// by the next config applied.
+type discoveryCache struct {
+	mu      sync.Mutex
+	entries map[string]*discoveryEntry
+}
+
+type discoveryEntry struct {
+	metadata     *providerMetadata
+	fetched      time.Time
+	revalidating bool
+}
+
+func newDiscoveryCache() *discoveryCache {
+	return &discoveryCache{entries: map[string]*discoveryEntry{}}
+}
+
+// get returns the metadata of the provider at issuer, fetching it with client
+// unless it is cached.
+func (d *discoveryCache) get(client *http.Client, issuer string) (*providerMetadata, error) {
+	d.mu.Lock()
+	e, ok := d.entries[issuer]
+	if ok {
+		if time.Since(e.fetched) > discoveryMaxAge && !e.revalidating {
+			e.revalidating = true
+			go d.revalidate(client, issuer, e)
+		}
+		m := e.metadata
+		d.mu.Unlock()
+		return m, nil
+	}
+	d.mu.Unlock()
+
+	m, err := discoverProvider(client, issuer)
+	if err != nil {
+		return nil, err
+	}
+	d.mu.Lock()
+	d.entries[issuer] = &discoveryEntry{metadata: m, fetched: time.Now()}
+	d.mu.Unlock()
+	return m, nil
+}
+
+// fetched returns when the metadata of the provider at issuer was last
+// fetched, or false if it hasn't been.
+func (d *discoveryCache) fetched(issuer string) (time.Time, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	e, ok := d.entries[issuer]
+	if !ok {
+		return time.Time{}, false
+	}
+	return e.fetched, true
+}
+
+// revalidate fetches the metadata of e again.
+func (d *discoveryCache) revalidate(client *http.Client, issuer string, e *discoveryEntry) {
+	m, err := discoverProvider(client, issuer)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	e.revalidating = false
+	if err != nil {
+		log.Warnf("Could not revalidate the provider metadata of %s, keeping the metadata from %s: %s", issuer, e.fetched.UTC().Format(time.RFC3339), err)
+		return
+	}
+	e.metadata, e.fetched = m, time.Now()
+}
+
+// needsDiscovery reports whether c leaves endpoints to be discovered from
+// Config.IssuerURL.
+func (c *Config) needsDiscovery() bool {
+	return c.IssuerURL != "" && (c.AuthorizeURL == "" || c.TokenURL == "" ||
+		c.DeviceFlow && c.DeviceAuthorizationURL == "")
+}
+
+// withDiscovery returns a copy of c with the endpoints it doesn't set taken
+// from m.
+func (c *Config) withDiscovery(m *providerMetadata) *Config {
+	discovered := *c
+	if discovered.AuthorizeURL == "" {
+		discovered.AuthorizeURL = m.AuthorizationEndpoint
+	}
+	if discovered.TokenURL == "" {
+		discovered.TokenURL = m.TokenEndpoint
+	}
+	if discovered.JWKSURL == "" {
+		discovered.JWKSURL = m.JWKSURI
+	}
+	if discovered.EndSessionEndpoint == "" {
+		discovered.EndSessionEndpoint = m.EndSessionEndpoint
+	}
+	if discovered.DeviceAuthorizationURL == "" {
+		discovered.DeviceAuthorizationURL = m.DeviceAuthorizationEndpoint
+	}
+	return &discovered
+}
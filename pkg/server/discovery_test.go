@@ -0,0 +1,187 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newDiscoveryTestServer serves provider metadata for its own URL, or for
+// issuer if set.
+func newDiscoveryTestServer(issuer string) *httptest.Server {
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/.well-known/openid-configuration" {
+			http.NotFound(w, r)
+			return
+		}
+		iss := issuer
+		if iss == "" {
+			iss = ts.URL
+		}
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 iss,
+			"authorization_endpoint": ts.URL + "/authorize",
+			"token_endpoint":         ts.URL + "/token",
+			"jwks_uri":               ts.URL + "/keys",
+			"end_session_endpoint":   ts.URL + "/logout",
+
+			"device_authorization_endpoint": ts.URL + "/device/code",
+		})
+	}))
+	return ts
+}
+
+func TestDiscovery(t *testing.T) {
+	ts := newDiscoveryTestServer("")
+	defer ts.Close()
+
+	s, err := New(&Config{SessionSecurityKey: SessionKeys{"test"}, RequestTimeout: time.Second, IssuerURL: ts.URL, TokenURL: "https://idp.example.com/token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := s.Config()
+	if c.AuthorizeURL != ts.URL+"/authorize" || c.JWKSURL != ts.URL+"/keys" {
+		t.Errorf("got authorizeURL %q and jwksURL %q, want the discovered ones", c.AuthorizeURL, c.JWKSURL)
+	}
+	if c.EndSessionEndpoint != ts.URL+"/logout" {
+		t.Errorf("got endSessionEndpoint %q, want the discovered one", c.EndSessionEndpoint)
+	}
+	if c.TokenURL != "https://idp.example.com/token" {
+		t.Errorf("got tokenURL %q, the configured one must win", c.TokenURL)
+	}
+	if got := s.current().oauth2Cfg.Endpoint.AuthURL; got != c.AuthorizeURL {
+		t.Errorf("logins go to %q, want %q", got, c.AuthorizeURL)
+	}
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	ts := newDiscoveryTestServer("https://idp.example.com")
+	defer ts.Close()
+
+	_, err := New(&Config{SessionSecurityKey: SessionKeys{"test"}, IssuerURL: ts.URL})
+	if err == nil || !strings.Contains(err.Error(), "https://idp.example.com") {
+		t.Errorf("got error %v, want the issuer mismatch", err)
+	}
+}
+
+func TestNoDiscoveryWithEndpoints(t *testing.T) {
+	// the issuer is only checked against ID tokens
+	s, err := New(&Config{SessionSecurityKey: SessionKeys{"test"}, IssuerURL: "https://idp.invalid", AuthorizeURL: "https://idp.invalid/authorize", TokenURL: "https://idp.invalid/token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Config().JWKSURL != "" {
+		t.Errorf("got jwksURL %q without discovery", s.Config().JWKSURL)
+	}
+}
+
+func TestDiscoveryDeviceFlow(t *testing.T) {
+	ts := newDiscoveryTestServer("")
+	defer ts.Close()
+
+	// discovered even with both endpoints configured
+	c := &Config{SessionSecurityKey: SessionKeys{"test"}, IssuerURL: ts.URL, AuthorizeURL: ts.URL + "/authorize", TokenURL: ts.URL + "/token", DeviceFlow: true}
+	s, err := New(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Config().DeviceAuthorizationURL; got != ts.URL+"/device/code" {
+		t.Errorf("got deviceAuthorizationURL %q, want the discovered one", got)
+	}
+}
+
+func TestDiscoveryCache(t *testing.T) {
+	var fetches, failing int32
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		if atomic.LoadInt32(&failing) != 0 {
+			http.Error(w, "down for maintenance", http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(&providerMetadata{
+			Issuer:                ts.URL,
+			AuthorizationEndpoint: ts.URL + "/authorize",
+			TokenEndpoint:         ts.URL + "/token",
+		})
+	}))
+	defer ts.Close()
+	issuer := ts.URL
+
+	d := newDiscoveryCache()
+	get := func() (*providerMetadata, error) {
+		return d.get(ts.Client(), issuer)
+	}
+
+	if _, err := get(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := get(); err != nil || atomic.LoadInt32(&fetches) != 1 {
+		t.Errorf("fresh metadata was fetched again: %d fetches, %v", fetches, err)
+	}
+
+	// stale metadata is served while the provider is down
+	atomic.StoreInt32(&failing, 1)
+	d.entries[issuer].fetched = time.Now().Add(-2 * discoveryMaxAge)
+	m, err := get()
+	if err != nil || m.TokenEndpoint != issuer+"/token" {
+		t.Fatalf("got %v, %v while the provider is down", m, err)
+	}
+	waitForDiscovery(t, d, issuer)
+	if n := atomic.LoadInt32(&fetches); n != 2 {
+		t.Errorf("stale metadata was revalidated with %d fetches, want 2", n)
+	}
+
+	// and replaced once it answers again
+	atomic.StoreInt32(&failing, 0)
+	if _, err := get(); err != nil {
+		t.Fatal(err)
+	}
+	waitForDiscovery(t, d, issuer)
+	d.mu.Lock()
+	age := time.Since(d.entries[issuer].fetched)
+	d.mu.Unlock()
+	if age > time.Minute {
+		t.Errorf("metadata was not revalidated, it is %s old", age)
+	}
+
+	// without metadata to fall back on, the failure is returned
+	atomic.StoreInt32(&failing, 1)
+	delete(d.entries, issuer)
+	if _, err := get(); err == nil {
+		t.Errorf("no error without cached metadata")
+	}
+}
+
+// waitForDiscovery waits for a background revalidation of issuer to finish.
+func waitForDiscovery(t *testing.T, d *discoveryCache, issuer string) {
+	for i := 0; i < 100; i++ {
+		d.mu.Lock()
+		revalidating := d.entries[issuer].revalidating
+		d.mu.Unlock()
+		if !revalidating {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("metadata is still being revalidated")
+}
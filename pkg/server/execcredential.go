@@ -0,0 +1,52 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+// credentialPluginKubelogin is the Config.CredentialPlugin that configures
+// kubectl to get tokens from kubelogin (https://github.com/int128/kubelogin)
+// rather than the oidc auth provider, which newer kubectl versions no longer
+// support.
+const credentialPluginKubelogin = "kubelogin"
+
+// execCredential is how kubectl runs an exec credential plugin.
+type execCredential struct {
+	APIVersion string
+	Command    string
+	Args       []string
+}
+
+// execCredential returns the credential plugin the commands and kubeconfig
+// set up, or nil if they use the oidc auth provider. kubelogin signs the
+// user in itself and keeps its own tokens; gangway only tells it which
+// provider and client to use. It discovers the endpoints from the issuer.
+func (a *app) execCredential() *execCredential {
+	if a.cfg.CredentialPlugin != credentialPluginKubelogin {
+		return nil
+	}
+	args := []string{"oidc-login", "get-token", "--oidc-issuer-url=" + a.cfg.IssuerURL, "--oidc-client-id=" + a.cfg.ClientID}
+	if a.cfg.ClientSecret != "" {
+		args = append(args, "--oidc-client-secret="+a.cfg.ClientSecret)
+	}
+	for _, scope := range a.cfg.scopes() {
+		if scope != "openid" {
+			args = append(args, "--oidc-extra-scope="+scope)
+		}
+	}
+	return &execCredential{
+		APIVersion: "client.authentication.k8s.io/v1beta1",
+		Command:    "kubectl",
+		Args:       args,
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExecCredential(t *testing.T) {
+	a := newTestApp(t)
+	if a.execCredential() != nil {
+		t.Fatalf("expected no credential plugin by default")
+	}
+
+	a.cfg.CredentialPlugin = credentialPluginKubelogin
+	a.cfg.IssuerURL = "https://idp.example.com"
+	a.cfg.ClientID = "gangway"
+	a.cfg.Scopes = []string{"openid", "email", "groups"}
+	want := []string{
+		"oidc-login", "get-token",
+		"--oidc-issuer-url=https://idp.example.com",
+		"--oidc-client-id=gangway",
+		"--oidc-extra-scope=email",
+		"--oidc-extra-scope=groups",
+	}
+	exec := a.execCredential()
+	if exec == nil || exec.Command != "kubectl" || !reflect.DeepEqual(exec.Args, want) {
+		t.Fatalf("got %+v, want kubectl %v", exec, want)
+	}
+
+	a.cfg.ClientSecret = "s3cret"
+	if args := a.execCredential().Args; args[4] != "--oidc-client-secret=s3cret" {
+		t.Errorf("got args %v, want the client secret after the client id", args)
+	}
+}
+
+func TestCommandlineExecCredential(t *testing.T) {
+	info := &userInfo{
+		ClusterName:  "prod",
+		Username:     "jane",
+		IDToken:      "the-id-token",
+		RefreshToken: "the-refresh-token",
+		Exec: &execCredential{
+			APIVersion: "client.authentication.k8s.io/v1beta1",
+			Command:    "kubectl",
+			Args:       []string{"oidc-login", "get-token"},
+		},
+	}
+	tmpl, err := loadTemplate("commandline.tmpl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var commands bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&commands, "commands", info); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"--exec-command=kubectl", "--exec-arg=oidc-login", "--exec-arg=get-token", "--exec-api-version=client.authentication.k8s.io/v1beta1"} {
+		if !strings.Contains(commands.String(), want) {
+			t.Errorf("commands are missing %q: %s", want, commands.String())
+		}
+	}
+	for _, unwanted := range []string{"--auth-provider", info.IDToken, info.RefreshToken} {
+		if strings.Contains(commands.String(), unwanted) {
+			t.Errorf("commands include %q: %s", unwanted, commands.String())
+		}
+	}
+
+	c := kubeConfigFor(info)
+	if u := c.Users[0].User; u.AuthProvider != nil || u.Exec == nil || u.Exec.Command != "kubectl" {
+		t.Errorf("got kubeconfig user %+v, want the exec credential plugin", u)
+	}
+}
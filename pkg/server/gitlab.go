@@ -0,0 +1,85 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/oauth2"
+)
+
+// gitLabMaxGroupPages bounds how many pages of groups are fetched for a user,
+// so that a very large membership can't stall the callback.
+const gitLabMaxGroupPages = 10
+
+// gitLabAPIURL returns the v4 API root of the GitLab instance c signs in
+// with. The authorize endpoint is /oauth/authorize under the instance root,
+// which may be a subpath for self-managed GitLab.
+func gitLabAPIURL(c *Config) (string, error) {
+	u, err := url.Parse(c.AuthorizeURL)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("cannot derive the GitLab API URL from authorizeURL %q", c.AuthorizeURL)
+	}
+	u.Path = strings.TrimSuffix(strings.TrimSuffix(u.Path, "/"), "/oauth/authorize") + "/api/v4"
+	u.RawQuery = ""
+	return u.String(), nil
+}
+
+// fetchGitLabGroups returns the full paths of the groups the user of token is
+// a member of. The token needs the read_api scope.
+func fetchGitLabGroups(ctx context.Context, client *http.Client, c *Config, token *oauth2.Token) ([]string, error) {
+	apiURL, err := gitLabAPIURL(c)
+	if err != nil {
+		return nil, err
+	}
+
+	var groups []string
+	page := "1"
+	for i := 0; i < gitLabMaxGroupPages && page != ""; i++ {
+		req, err := http.NewRequest("GET", apiURL+"/groups?min_access_level=10&per_page=100&page="+url.QueryEscape(page), nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+		resp, err := client.Do(req.WithContext(ctx))
+		if err != nil {
+			return nil, err
+		}
+
+		var body []struct {
+			FullPath string `json:"full_path"`
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("GitLab groups API returned %s", resp.Status)
+		}
+		err = json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("decoding GitLab groups: %v", err)
+		}
+
+		for _, g := range body {
+			groups = append(groups, g.FullPath)
+		}
+		page = resp.Header.Get("X-Next-Page")
+	}
+	return groups, nil
+}
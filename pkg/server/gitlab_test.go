@@ -0,0 +1,86 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"golang.org/x/oauth2"
+)
+
+func TestGitLabAPIURL(t *testing.T) {
+	tests := map[string]string{
+		"https://gitlab.com/oauth/authorize":             "https://gitlab.com/api/v4",
+		"https://git.example.com/gitlab/oauth/authorize": "https://git.example.com/gitlab/api/v4",
+	}
+	for authorizeURL, want := range tests {
+		got, err := gitLabAPIURL(&Config{AuthorizeURL: authorizeURL})
+		if err != nil || got != want {
+			t.Errorf("%s: got %q, %v; want %q", authorizeURL, got, err, want)
+		}
+	}
+}
+
+func TestFetchGitLabGroups(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/gitlab/api/v4/groups" || r.Header.Get("Authorization") != "Bearer access" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		switch r.URL.Query().Get("page") {
+		case "1":
+			w.Header().Set("X-Next-Page", "2")
+			w.Write([]byte(`[{"full_path":"platform"},{"full_path":"platform/sre"}]`))
+		case "2":
+			w.Write([]byte(`[{"full_path":"security"}]`))
+		}
+	}))
+	defer ts.Close()
+
+	a := newTestApp(t)
+	a.cfg.Provider = "gitlab"
+	a.cfg.AuthorizeURL = ts.URL + "/gitlab/oauth/authorize"
+	a.httpClient = ts.Client()
+
+	token := (&oauth2.Token{AccessToken: "access"}).WithExtra(map[string]interface{}{})
+	groups, err := a.fetchGroups(context.Background(), token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"platform", "platform/sre", "security"}; !reflect.DeepEqual(groups, want) {
+		t.Errorf("got groups %v, want %v", groups, want)
+	}
+
+	// groups in the ID token are used as they are
+	idToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"groups_direct": []string{"platform"}}).SignedString([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	token = token.WithExtra(map[string]interface{}{"id_token": idToken})
+	if groups, err := a.fetchGroups(context.Background(), token); groups != nil || err != nil {
+		t.Errorf("fetched groups %v (%v) although the ID token has them", groups, err)
+	}
+
+	// a token without read_api is refused
+	token = (&oauth2.Token{AccessToken: "read_user"}).WithExtra(map[string]interface{}{})
+	if groups, err := a.fetchGroups(context.Background(), token); groups != nil || err == nil {
+		t.Errorf("got groups %v and no error from a failed request", groups)
+	}
+}
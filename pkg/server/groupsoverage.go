@@ -0,0 +1,122 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/dgrijalva/jwt-go"
+	"golang.org/x/oauth2"
+)
+
+// Azure AD leaves the groups out of ID tokens of users in more than 200 of
+// them. The token then names a distributed claim source instead, as in
+//
+//	"_claim_names": {"groups": "src1"},
+//	"_claim_sources": {"src1": {"endpoint": "https://graph.windows.net/<tenant>/users/<oid>/getMemberObjects"}}
+//
+// and the groups have to be fetched from Microsoft Graph with the access
+// token.
+
+// graphHosts are the Microsoft Graph hosts the access token may be sent to
+// for groups. The Azure AD Graph API that Azure AD still points to has been
+// retired, so its endpoints are mapped to Microsoft Graph.
+var graphHosts = map[string]string{
+	"graph.windows.net":               "graph.microsoft.com",
+	"graph.microsoft.com":             "graph.microsoft.com",
+	"graph.microsoft.us":              "graph.microsoft.us",
+	"dod-graph.microsoft.us":          "dod-graph.microsoft.us",
+	"microsoftgraph.chinacloudapi.cn": "microsoftgraph.chinacloudapi.cn",
+}
+
+// groupsOverageEndpoint returns the endpoint claims point to for the groups
+// claim they leave out, or "" if they don't.
+func groupsOverageEndpoint(claims jwt.MapClaims, groupsClaim string) string {
+	names, _ := claims["_claim_names"].(map[string]interface{})
+	source, _ := names[groupsClaim].(string)
+	if source == "" {
+		return ""
+	}
+	sources, _ := claims["_claim_sources"].(map[string]interface{})
+	src, _ := sources[source].(map[string]interface{})
+	endpoint, _ := src["endpoint"].(string)
+	return endpoint
+}
+
+// graphMemberObjectsURL returns the Microsoft Graph getMemberObjects URL for
+// an overage endpoint.
+func graphMemberObjectsURL(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Scheme != "https" {
+		return "", fmt.Errorf("groups source %q is not an https URL", endpoint)
+	}
+	host, ok := graphHosts[u.Host]
+	if !ok {
+		return "", fmt.Errorf("groups source %s is not Microsoft Graph", u.Host)
+	}
+	// .../users/<oid>/getMemberObjects, after the tenant or API version
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) < 3 || parts[len(parts)-3] != "users" || parts[len(parts)-1] != "getMemberObjects" {
+		return "", fmt.Errorf("groups source %q is not a getMemberObjects endpoint", endpoint)
+	}
+	return (&url.URL{Scheme: "https", Host: host, Path: "/v1.0/users/" + parts[len(parts)-2] + "/getMemberObjects"}).String(), nil
+}
+
+// fetchMemberObjects returns the IDs of the groups the user of token is a
+// member of, from a Microsoft Graph getMemberObjects URL. These are what the
+// groups claim holds when it isn't left out.
+func fetchMemberObjects(ctx context.Context, client *http.Client, graphURL string, token *oauth2.Token) ([]string, error) {
+	req, err := http.NewRequest("POST", graphURL, bytes.NewBufferString(`{"securityEnabledOnly":false}`))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Microsoft Graph returned %s", resp.Status)
+	}
+	var body struct {
+		Value []string `json:"value"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("decoding Microsoft Graph groups: %v", err)
+	}
+	return body.Value, nil
+}
+
+// fetchOverageGroups returns the groups an ID token with claims left out, or
+// nil if it didn't.
+func fetchOverageGroups(ctx context.Context, client *http.Client, claims jwt.MapClaims, groupsClaim string, token *oauth2.Token) ([]string, error) {
+	endpoint := groupsOverageEndpoint(claims, groupsClaim)
+	if endpoint == "" {
+		return nil, nil
+	}
+	graphURL, err := graphMemberObjectsURL(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	return fetchMemberObjects(ctx, client, graphURL, token)
+}
@@ -0,0 +1,110 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"golang.org/x/oauth2"
+)
+
+// overageClaims are the claims of an Azure AD ID token without the groups.
+func overageClaims(endpoint string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"_claim_names":   map[string]interface{}{"groups": "src1"},
+		"_claim_sources": map[string]interface{}{"src1": map[string]interface{}{"endpoint": endpoint}},
+	}
+}
+
+func TestGroupsOverageEndpoint(t *testing.T) {
+	endpoint := "https://graph.windows.net/tenant/users/oid/getMemberObjects"
+	if got := groupsOverageEndpoint(overageClaims(endpoint), "groups"); got != endpoint {
+		t.Errorf("got %q, want %q", got, endpoint)
+	}
+	if got := groupsOverageEndpoint(overageClaims(endpoint), "roles"); got != "" {
+		t.Errorf("got %q for another claim", got)
+	}
+	if got := groupsOverageEndpoint(jwt.MapClaims{"groups": []interface{}{"dev"}}, "groups"); got != "" {
+		t.Errorf("got %q for a token with groups", got)
+	}
+}
+
+func TestGraphMemberObjectsURL(t *testing.T) {
+	tests := []struct {
+		endpoint, want string
+	}{
+		{"https://graph.windows.net/72f988bf/users/0f1e/getMemberObjects", "https://graph.microsoft.com/v1.0/users/0f1e/getMemberObjects"},
+		{"https://graph.microsoft.com/v1.0/users/0f1e/getMemberObjects", "https://graph.microsoft.com/v1.0/users/0f1e/getMemberObjects"},
+		{"https://graph.microsoft.us/v1.0/users/0f1e/getMemberObjects", "https://graph.microsoft.us/v1.0/users/0f1e/getMemberObjects"},
+		// the access token must not go anywhere else
+		{"https://evil.example.com/users/0f1e/getMemberObjects", ""},
+		{"http://graph.microsoft.com/v1.0/users/0f1e/getMemberObjects", ""},
+		{"https://graph.microsoft.com/v1.0/users/0f1e/memberOf", ""},
+	}
+	for _, tc := range tests {
+		got, err := graphMemberObjectsURL(tc.endpoint)
+		if got != tc.want || (err == nil) != (tc.want != "") {
+			t.Errorf("%s: got %q, %v, want %q", tc.endpoint, got, err, tc.want)
+		}
+	}
+}
+
+func TestFetchMemberObjects(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.Header.Get("Authorization") != "Bearer access" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"value": []string{"1d2f", "9a8b"}})
+	}))
+	defer ts.Close()
+
+	groups, err := fetchMemberObjects(context.Background(), ts.Client(), ts.URL, &oauth2.Token{AccessToken: "access"})
+	if err != nil || !reflect.DeepEqual(groups, []string{"1d2f", "9a8b"}) {
+		t.Errorf("got %v, %v", groups, err)
+	}
+	if _, err := fetchMemberObjects(context.Background(), ts.Client(), ts.URL, &oauth2.Token{AccessToken: "other"}); err == nil {
+		t.Errorf("no error when Graph refuses the access token")
+	}
+}
+
+func TestCommandlineGroupsOverage(t *testing.T) {
+	tests := []struct {
+		info *userInfo
+		want string
+	}{
+		{&userInfo{KubernetesUsername: "jane"}, ""},
+		{&userInfo{KubernetesUsername: "jane", GroupsOverage: true, Groups: []string{"1d2f"}}, "gangway looked them up"},
+		{&userInfo{KubernetesUsername: "jane", GroupsOverage: true}, "could not look them up"},
+	}
+	for _, tc := range tests {
+		rr := httptest.NewRecorder()
+		serveTemplate("commandline.tmpl", tc.info, rr)
+		body := rr.Body.String()
+		if got := strings.Contains(body, `id="groups-overage"`); got != (tc.want != "") {
+			t.Errorf("overage notice shown: %v, want %v", got, tc.want != "")
+		}
+		if !strings.Contains(body, tc.want) {
+			t.Errorf("commandline page does not contain %q", tc.want)
+		}
+	}
+}
@@ -0,0 +1,753 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gorilla/sessions"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/oauth2"
+)
+
+const (
+	templatesBase = "/templates"
+)
+
+type userInfo struct {
+	BasePath     string
+	ClusterName  string
+	Username     string
+	Email        string
+	IDToken      string
+	RefreshToken string
+	ClientID     string
+	ClientSecret string
+	IssuerURL    string
+	APIServerURL string
+	ClusterCA    string
+	Groups       []string
+	// KubernetesUsername and KubernetesGroups are the identity the API
+	// server sees, with its OIDC prefixes applied.
+	KubernetesUsername string
+	KubernetesGroups   []string
+	DisplayTTL         int
+	SilentRenew        int
+	Strict             bool
+	Branding           clusterBranding
+	RecentLogins       []loginRecord
+
+	// KubeconfigName names the user and the context in the kubeconfig.
+	KubeconfigName string
+
+	// IdentityMapping explains how the API server got to the Kubernetes
+	// identity. It is nil if that can't be shown.
+	IdentityMapping *identityMapping
+
+	// IDTokenExpires is when the ID token expires, zero if it doesn't say,
+	// and IDTokenExpired whether it has by gangway's clock.
+	IDTokenExpires time.Time
+	IDTokenExpired bool
+
+	// ClaimWarnings explain the optional claims the ID token lacks.
+	ClaimWarnings []string
+
+	// Exec is the credential plugin kubectl is set up with, if any, in
+	// place of the ID and refresh tokens.
+	Exec *execCredential
+
+	// Claims are the ID token's claims, and ClusterCAData the cluster CA
+	// base64 encoded, for kubeconfig templates.
+	Claims        map[string]interface{}
+	ClusterCAData string
+
+	// Commands replaces the kubectl commands on the commandline page when
+	// the kubeconfig template defines them.
+	Commands string
+
+	// GroupsOverage is set when the identity provider left the groups out
+	// of the ID token, as Azure AD does for users in many of them.
+	GroupsOverage bool
+
+	// Onboarding is set when the user followed an onboarding link.
+	Onboarding *onboarding
+}
+
+// basePathPattern limits the characters allowed in a base path. The value may
+// come from a request header and is written into pages unescaped.
+var basePathPattern = regexp.MustCompile(`^[A-Za-z0-9/._~-]*$`)
+
+// basePath returns the path prefix gangway is reachable under: httpPath, or,
+// for when a proxy strips it before forwarding requests, basePath. The
+// X-Forwarded-Prefix header of such a proxy, if it is one of trustedProxies,
+// takes precedence over basePath.
+func (a *app) basePath(r *http.Request) string {
+	if prefix := a.forwardedPrefix(r); prefix != "" && a.cfg.HTTPPath == "" && basePathPattern.MatchString(prefix) {
+		return cleanBasePath(prefix)
+	}
+	return a.cfg.pathPrefix()
+}
+
+// cleanBasePath normalizes a base path so that it is either empty or starts
+// with a slash and has no trailing slash.
+func cleanBasePath(prefix string) string {
+	if prefix == "" || !basePathPattern.MatchString(prefix) {
+		return ""
+	}
+	return strings.TrimSuffix(path.Clean("/"+prefix), "/")
+}
+
+// appURL returns the path of a gangway route as seen by the browser.
+func (a *app) appURL(r *http.Request, route string) string {
+	return a.basePath(r) + route
+}
+
+// Templates are embedded in the binary and never change at runtime, so each
+// one is parsed once and reused for every request.
+var (
+	templateCacheLock sync.Mutex
+	templateCache     = map[string]*template.Template{}
+	pageCache         = map[string][]byte{}
+)
+
+// partialsTemplate defines the snippets shared by the page templates.
+const partialsTemplate = "partials.tmpl"
+
+func loadTemplate(tmplFile string) (*template.Template, error) {
+	templateCacheLock.Lock()
+	defer templateCacheLock.Unlock()
+
+	if tmpl, ok := templateCache[tmplFile]; ok {
+		return tmpl, nil
+	}
+
+	templatePath := filepath.Join(templatesBase, tmplFile)
+	templateData, err := FSString(false, templatePath)
+	if err != nil {
+		log.Errorf("Failed to find template asset: %s at path: %s", tmplFile, templatePath)
+		return nil, err
+	}
+
+	tmpl, err := template.New(tmplFile).Funcs(templateFuncs).Parse(templateData)
+	if err != nil {
+		log.Errorf("Failed to parse template %s: %s", tmplFile, err)
+		return nil, err
+	}
+
+	// every page can use the snippets in the partials template
+	partialsPath := filepath.Join(templatesBase, partialsTemplate)
+	partialsData, err := FSString(false, partialsPath)
+	if err != nil {
+		log.Errorf("Failed to find template asset: %s at path: %s", partialsTemplate, partialsPath)
+		return nil, err
+	}
+	if _, err := tmpl.New(partialsTemplate).Parse(partialsData); err != nil {
+		log.Errorf("Failed to parse template %s: %s", partialsTemplate, err)
+		return nil, err
+	}
+	templateCache[tmplFile] = tmpl
+	return tmpl, nil
+}
+
+func serveTemplate(tmplFile string, data interface{}, w http.ResponseWriter) {
+	tmpl, err := loadTemplate(tmplFile)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	tmpl.ExecuteTemplate(w, tmplFile, data)
+}
+
+type pageInfo struct {
+	BasePath string
+}
+
+// serveStaticPage serves a template that only depends on the base path. It
+// is rendered on first use and the output is served from memory afterwards.
+// Only pages for the configured base path are kept, so arbitrary
+// X-Forwarded-Prefix values can't grow the cache.
+func (a *app) serveStaticPage(tmplFile string, w http.ResponseWriter, r *http.Request) {
+	prefix := a.basePath(r)
+	cacheKey := tmplFile + "\x00" + prefix
+	templateCacheLock.Lock()
+	page, ok := pageCache[cacheKey]
+	templateCacheLock.Unlock()
+
+	if !ok {
+		tmpl, err := loadTemplate(tmplFile)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		var buf bytes.Buffer
+		if err := tmpl.ExecuteTemplate(&buf, tmplFile, &pageInfo{BasePath: prefix}); err != nil {
+			log.Errorf("Failed to render template %s: %s", tmplFile, err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		page = buf.Bytes()
+
+		if prefix == a.cfg.pathPrefix() {
+			templateCacheLock.Lock()
+			pageCache[cacheKey] = page
+			templateCacheLock.Unlock()
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(page)
+}
+
+type errorInfo struct {
+	BasePath   string
+	Status     int
+	StatusText string
+	Message    string
+	Hint       string
+	RequestID  string
+}
+
+// serveError renders the error page with the given status code.
+func (a *app) serveError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	a.serveErrorPage(w, r, status, message, "")
+}
+
+// serveErrorPage renders the error page with a hint on what to do about the
+// error.
+func (a *app) serveErrorPage(w http.ResponseWriter, r *http.Request, status int, message, hint string) {
+	recordOutcome(r, status, message)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	serveTemplate("error.tmpl", &errorInfo{
+		BasePath:   a.basePath(r),
+		Status:     status,
+		StatusText: http.StatusText(status),
+		Message:    message,
+		Hint:       hint,
+		RequestID:  requestID(r),
+	}, w)
+}
+
+func (a *app) loginRequired(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session, err := a.sessionStore.Get(r, a.cfg.sessionCookieName())
+		if err != nil {
+			http.Redirect(w, r, a.appURL(r, "/"), http.StatusTemporaryRedirect)
+			return
+		}
+
+		idToken, ok := session.Values["id_token"].(string)
+		if !ok {
+			http.Redirect(w, r, a.appURL(r, "/"), http.StatusTemporaryRedirect)
+			return
+		}
+
+		// signed out at the identity provider since
+		revoked, err := a.idTokenRevoked(idToken, time.Now())
+		if err != nil {
+			requestLog(r).Errorf("Could not check for logouts at the identity provider: %s", err)
+		}
+		if revoked {
+			a.cleanupSession(w, r)
+			http.Redirect(w, r, a.appURL(r, "/"), http.StatusTemporaryRedirect)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (a *app) homeHandler(w http.ResponseWriter, r *http.Request) {
+	a.serveStaticPage("home.tmpl", w, r)
+}
+
+type clusterInfo struct {
+	BasePath     string
+	ClusterName  string
+	APIServerURL string
+	Branding     clusterBranding
+}
+
+// clusterInfoHandler shows what users need to verify the cluster before they
+// sign in. It is public, so it must never show anything secret.
+func (a *app) clusterInfoHandler(w http.ResponseWriter, r *http.Request) {
+	if !a.cfg.ClusterInfo {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	serveTemplate("clusterinfo.tmpl", &clusterInfo{
+		BasePath:     a.basePath(r),
+		ClusterName:  a.cfg.ClusterName,
+		APIServerURL: a.cfg.APIServerURL,
+		Branding:     brandingFor(a.cfg),
+	}, w)
+}
+
+func (a *app) loginHandler(w http.ResponseWriter, r *http.Request) {
+	if mismatch := a.checkLoginSelection(r); mismatch != "" {
+		a.serveErrorPage(w, r, http.StatusBadRequest, mismatch, "Check the link you followed; it was meant for another gangway.")
+		return
+	}
+	if r.URL.Query().Get("prompt") == "none" {
+		a.silentLoginHandler(w, r)
+		return
+	}
+	if !a.captchaPassed(w, r) {
+		return
+	}
+
+	session, err := a.sessionStore.Get(r, a.cfg.sessionCookieName())
+	if err != nil {
+		requestLog(r).Errorf("Got an error in login: %s", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	a.startLogin(w, r, session, false)
+}
+
+// startLogin sends the user to the identity provider, with opts added to the
+// authorization request.
+func (a *app) startLogin(w http.ResponseWriter, r *http.Request, session *sessions.Session, silent bool, opts ...oauth2.AuthCodeOption) {
+	// the state and nonce must be unguessable, or they don't protect
+	// against forged callbacks and replayed ID tokens
+	b := make([]byte, 64)
+	if _, err := rand.Read(b); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	state := base64.StdEncoding.EncodeToString(b[:32])
+
+	session.Values["state"] = state
+	if silent {
+		session.Values["silent"] = state
+	} else {
+		delete(session.Values, "silent")
+	}
+	ls := a.newLoginState(a.returnTo(r, ""))
+	ls.Nonce = base64.RawURLEncoding.EncodeToString(b[32:])
+	ls.Standby = a.useStandby(r.Context())
+	opts = append(a.cfg.authCodeOptions(), opts...)
+	opts = append(opts, oauth2.SetAuthURLParam("nonce", ls.Nonce))
+	if a.cfg.PKCE {
+		ls.CodeVerifier = newCodeVerifier()
+		opts = append(opts, codeChallengeOptions(ls.CodeVerifier)...)
+	}
+	url := a.oauth2For(ls.Standby).AuthCodeURL(state, opts...)
+	ls.Transcript = a.startTranscript(r, url)
+	a.loginStates.save(session, state, ls)
+	err := session.Save(r, w)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, url, http.StatusTemporaryRedirect)
+}
+
+func (a *app) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	var idToken string
+	if session, err := a.sessionStore.Get(r, a.cfg.sessionCookieName()); err == nil {
+		idToken, _ = session.Values["id_token"].(string)
+		a.audit(r, auditLogout, a.idTokenUser(idToken), "")
+	}
+	a.cleanupSession(w, r)
+	if logoutURL := a.cfg.logoutURL(idToken); logoutURL != "" {
+		http.Redirect(w, r, logoutURL, http.StatusTemporaryRedirect)
+		return
+	}
+	http.Redirect(w, r, a.returnTo(r, a.appURL(r, "/login")), http.StatusTemporaryRedirect)
+}
+
+func (a *app) callbackHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := context.WithValue(r.Context(), oauth2.HTTPClient, a.httpClient)
+
+	// the identity provider may send users back with an error instead of
+	// a code
+	q := r.URL.Query()
+	if code := q.Get("error"); code != "" {
+		if a.silentCallback(r) {
+			// the user has to sign in again interactively, e.g. with
+			// login_required once the single sign on session has ended
+			a.serveSilentResult(w, r, code)
+			return
+		}
+		a.serveCallbackError(w, r, classifyAuthError(code, q.Get("error_description")),
+			fmt.Errorf("identity provider returned %s: %s", code, q.Get("error_description")))
+		return
+	}
+
+	// verify the state string
+	state := q.Get("state")
+	session, err := a.sessionStore.Get(r, a.cfg.sessionCookieName())
+	if err != nil {
+		a.serveCallbackError(w, r, errSessionInvalid, err)
+		return
+	}
+
+	if _, started := session.Values["state"]; !started {
+		a.serveCallbackError(w, r, errCookieMissing, nil)
+		return
+	}
+	if state != session.Values["state"] {
+		a.serveCallbackError(w, r, errStateMismatch, nil)
+		return
+	}
+	silent := session.Values["silent"] == state
+	ls, ok := a.loginStates.take(session, state)
+	if !ok {
+		a.serveCallbackError(w, r, errLoginExpired, nil)
+		return
+	}
+	r = a.continueTranscript(r, ls.Transcript)
+	ctx = context.WithValue(r.Context(), oauth2.HTTPClient, a.httpClient)
+
+	// use the access code to retrieve a token
+	token, err := a.oauth2For(ls.Standby).Exchange(ctx, q.Get("code"), codeVerifierOptions(ls.CodeVerifier)...)
+	if err != nil {
+		if _, refused := err.(*oauth2.RetrieveError); !refused && !ls.Standby {
+			a.primaryFailed(err)
+		}
+		a.serveCallbackError(w, r, classifyExchangeError(err), err)
+		return
+	}
+	if e := a.checkClockSkew(token, time.Now()); e != nil {
+		a.serveCallbackError(w, r, e, nil)
+		return
+	}
+	// nothing in the token can be trusted before this
+	if err := a.verifyIDToken(token, ls.Nonce, time.Now()); err != nil {
+		a.serveCallbackError(w, r, errIDTokenInvalid, err)
+		return
+	}
+
+	// the API server would reject every token, so fail here where the
+	// reason can be explained
+	if iss, mismatch := a.checkIssuer(token); mismatch != "" {
+		requestLog(r).Errorf("ID token issuer %q does not match issuerURL %q: %s", iss, a.cfg.IssuerURL, mismatch)
+		a.audit(r, auditLoginFailed, a.tokenUser(token), "issuer_mismatch")
+		a.serveError(w, r, http.StatusBadGateway, fmt.Sprintf(
+			"The identity provider issued a token for %q, but this cluster trusts %q: %s. Please contact your administrator.",
+			iss, a.cfg.IssuerURL, mismatch))
+		return
+	}
+
+	if reason := a.checkClaimRules(token); reason != "" {
+		requestLog(r).Warnf("ID token breaks the API server's claim validation rules: %s", reason)
+		a.audit(r, auditLoginFailed, a.tokenUser(token), "claim_validation")
+		a.serveError(w, r, http.StatusForbidden, fmt.Sprintf(
+			"This cluster would not accept your token: %s. Please contact your administrator.", reason))
+		return
+	}
+
+	groups, groupsErr := a.fetchGroups(ctx, token)
+	if groupsErr != nil {
+		requestLog(r).Warnf("%s", groupsErr)
+	}
+	if reason := a.checkLoginPolicy(token, groups, groupsErr); reason != "" {
+		requestLog(r).Warnf("Login refused by policy: %s", reason)
+		a.audit(r, auditLoginFailed, a.tokenUser(token), "policy")
+		a.serveError(w, r, http.StatusForbidden, fmt.Sprintf(
+			"You may not get credentials for this cluster: %s. Please contact your administrator.", reason))
+		return
+	}
+
+	// the return_to target was validated at login, check it again in case
+	// the allowlist changed since
+	target := a.appURL(r, "/commandline")
+	if ls.ReturnTo != "" && a.safeRedirect(ls.ReturnTo) {
+		target = ls.ReturnTo
+	}
+
+	// start a new session rather than reusing the pre-login one, so nothing
+	// set before authentication carries over into the authenticated session
+	session = a.newSession()
+	refreshToken, err := a.sealRefreshToken(sessionID(session), token.RefreshToken)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	session.Values["id_token"] = token.Extra("id_token")
+	session.Values["refresh_token"] = refreshToken
+	if len(groups) > 0 {
+		session.Values["groups"] = groups
+	}
+
+	err = session.Save(r, w)
+	if err != nil {
+		if strings.Contains(err.Error(), "the value is too long") {
+			// large ID tokens, as from Azure AD or Keycloak, don't fit
+			requestLog(r).Errorf("Session is too large for the cookie store, use a server-side sessionStore: %s", err)
+			a.serveError(w, r, http.StatusInternalServerError,
+				"Your credentials are too large to keep in a browser cookie. Please contact your administrator.")
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	a.recordTokenSizes(w, r, token)
+	user, now := a.tokenUser(token), time.Now()
+	a.stats.recordLogin(user, a.cfg.ClusterName, now)
+	a.recordLogin(r, user, now)
+	a.audit(r, auditLogin, user, "")
+	recordOutcome(r, http.StatusSeeOther, "")
+	if silent {
+		a.serveSilentResult(w, r, "")
+		return
+	}
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
+
+func (a *app) parseToken(idToken string) (*jwt.Token, error) {
+	token, _ := jwt.Parse(idToken, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("There was an error")
+		}
+		return []byte(a.cfg.ClientSecret), nil
+	})
+	return token, nil
+}
+
+func (a *app) commandlineHandler(w http.ResponseWriter, r *http.Request) {
+	a.serveCommandline(w, r, nil)
+}
+
+// serveCommandline serves the commandline page, tailored to o when the user
+// came through an onboarding link.
+func (a *app) serveCommandline(w http.ResponseWriter, r *http.Request, o *onboarding) {
+	info := a.generateInfo(w, r)
+	if info == nil {
+		return
+	}
+	info.Onboarding = o
+	commands, err := a.customCommands(info)
+	if err != nil {
+		log.Errorf("Failed to render the commands template: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	info.Commands = commands
+	serveTemplate("commandline.tmpl", info, w)
+}
+
+// commandsHandler serves the kubectl commands from the commandline page as
+// plain text. In strict mode this is the only way to get them, so that the
+// credentials never become part of the page.
+func (a *app) commandsHandler(w http.ResponseWriter, r *http.Request) {
+	info := a.generateInfo(w, r)
+	if info == nil {
+		return
+	}
+
+	tmpl := a.customTemplate("commands")
+	if tmpl == nil {
+		commandline, err := loadTemplate("commandline.tmpl")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		tmpl = commandline.Lookup("commands")
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, info); err != nil {
+		log.Errorf("Failed to render the commands template: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if r.URL.Query().Get("download") != "" {
+		w.Header().Set("Content-Disposition", `attachment; filename="gangway-commands.sh"`)
+	}
+	w.Write(buf.Bytes())
+}
+
+// generateInfo collects what the commandline page shows for the logged in
+// user. It writes an error or redirect and returns nil if that isn't possible.
+func (a *app) generateInfo(w http.ResponseWriter, r *http.Request) *userInfo {
+	session, err := a.sessionStore.Get(r, a.cfg.sessionCookieName())
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return nil
+	}
+
+	idToken, ok := session.Values["id_token"].(string)
+	if !ok {
+		//http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		a.cleanupSession(w, r)
+		http.Redirect(w, r, a.appURL(r, "/"), http.StatusTemporaryRedirect)
+		return nil
+	}
+
+	refreshToken, ok := session.Values["refresh_token"].(string)
+	if !ok {
+		//http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		a.cleanupSession(w, r)
+		http.Redirect(w, r, a.appURL(r, "/"), http.StatusTemporaryRedirect)
+		return nil
+	}
+
+	// sessions from before refresh tokens were encrypted fail here and have
+	// to log in again
+	refreshToken, err = a.openRefreshToken(sessionID(session), refreshToken)
+	if err != nil {
+		requestLog(r).Warnf("Could not decrypt refresh token: %s", err)
+		a.stats.recordRefreshToken(false)
+		a.cleanupSession(w, r)
+		http.Redirect(w, r, a.appURL(r, "/"), http.StatusTemporaryRedirect)
+		return nil
+	}
+
+	// fetched from the provider at login
+	groups, _ := session.Values["groups"].([]string)
+	info := a.tokenInfo(w, r, idToken, refreshToken, groups)
+	if info == nil {
+		return nil
+	}
+
+	// kubectl refreshes the ID token once it expires. With rotation that
+	// replaces the refresh token, so ours is stale and must not be reused.
+	if a.cfg.RefreshTokenRotation && info.IDTokenExpired {
+		a.stats.recordRefreshToken(false)
+		a.cleanupSession(w, r)
+		http.Redirect(w, r, a.appURL(r, "/"), http.StatusTemporaryRedirect)
+		return nil
+	}
+	a.stats.recordRefreshToken(true)
+	return info
+}
+
+// tokenInfo describes the user idToken was issued to, with their credentials,
+// for the commandline page and commands. groups are shown if the ID token
+// has none. It serves an error and returns nil if a claim it needs is
+// missing.
+func (a *app) tokenInfo(w http.ResponseWriter, r *http.Request, idToken, refreshToken string, groups []string) *userInfo {
+
+	// read in public ca.crt to output in commandline copy/paste commands
+	caBytes, err := a.cfg.clusterCA()
+	if err != nil {
+		// let us know that we couldn't read the CA. This only causes missing
+		// output and does not impact the actual function of the program
+		log.Errorf("Failed to read the cluster CA. %s", err)
+	}
+
+	jwtToken, err := a.parseToken(idToken)
+	if err != nil {
+		http.Error(w, "Could not parse JWT", http.StatusInternalServerError)
+		return nil
+	}
+
+	claims := jwtToken.Claims.(jwt.MapClaims)
+	username, ok := claims[a.cfg.UsernameClaim].(string)
+	if !ok {
+		http.Error(w, "Could not parse Username claim", http.StatusInternalServerError)
+		return nil
+	}
+
+	var warnings []string
+	email, ok := claims[a.cfg.EmailClaim].(string)
+	if !ok {
+		if !a.cfg.claimOptional(a.cfg.EmailClaim) {
+			http.Error(w, "Could not parse Email claim", http.StatusInternalServerError)
+			log.Println("email Handler")
+			return nil
+		}
+		warnings = append(warnings, fmt.Sprintf("Your identity provider did not send the %s claim, so gangway does not know your email address.", a.cfg.EmailClaim))
+	}
+
+	issuerURL, ok := claims["iss"].(string)
+	if !ok {
+		http.Error(w, "Could not parse Issuer URL claim", http.StatusInternalServerError)
+		return nil
+	}
+
+	if claimGroups := claimStrings(claims, a.cfg.groupsClaim()); len(claimGroups) > 0 {
+		groups = claimGroups
+	}
+	if len(groups) == 0 && a.cfg.claimOptional(a.cfg.groupsClaim()) {
+		warnings = append(warnings, fmt.Sprintf("Your identity provider did not send the %s claim, so the cluster sees you without any groups and grants you only what is bound to your user.", a.cfg.groupsClaim()))
+	}
+
+	kubeUsername, kubeGroups := a.kubernetesIdentity(claims, username, groups)
+
+	info := &userInfo{
+		BasePath:           a.basePath(r),
+		ClusterName:        a.cfg.ClusterName,
+		Username:           username,
+		Email:              email,
+		IDToken:            idToken,
+		RefreshToken:       refreshToken,
+		ClientID:           a.cfg.ClientID,
+		ClientSecret:       a.cfg.ClientSecret,
+		IssuerURL:          issuerURL,
+		APIServerURL:       a.cfg.APIServerURL,
+		ClusterCA:          string(caBytes),
+		Groups:             groups,
+		KubernetesUsername: kubeUsername,
+		KubernetesGroups:   kubeGroups,
+		IdentityMapping:    a.identityMapping(),
+		DisplayTTL:         int(a.cfg.TokenDisplayTTL / time.Second),
+		SilentRenew:        int(a.cfg.SilentRenewInterval / time.Second),
+		Strict:             a.cfg.StrictTokenDisplay,
+		Branding:           brandingFor(a.cfg),
+		RecentLogins:       a.recentLogins(r, username),
+	}
+	if exp, ok := claims["exp"].(float64); ok {
+		info.IDTokenExpires = time.Unix(int64(exp), 0).UTC()
+	}
+	info.IDTokenExpired = !claims.VerifyExpiresAt(a.clock.Now().Unix(), true)
+	info.GroupsOverage = groupsOverageEndpoint(claims, a.cfg.groupsClaim()) != ""
+	info.Exec = a.execCredential()
+	info.ClaimWarnings = warnings
+	info.Claims = claims
+	info.KubeconfigName = kubeconfigName(username, kubeUsername, a.cfg.ClusterName)
+	if len(caBytes) > 0 {
+		info.ClusterCAData = base64.StdEncoding.EncodeToString(caBytes)
+	}
+	return info
+}
+
+// claimStrings returns the values of a claim that may hold a list of strings
+// or a single string, such as groups.
+func claimStrings(claims jwt.MapClaims, name string) []string {
+	switch v := claims[name].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
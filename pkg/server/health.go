@@ -0,0 +1,148 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// warmUpRetryInterval is how long to wait before retrying failed warm-up checks.
+const warmUpRetryInterval = 5 * time.Second
+
+// warmUpCheck is run at startup before gangway reports itself ready.
+type warmUpCheck struct {
+	name  string
+	check func(*app, context.Context) error
+}
+
+// warmUpChecks are the checks run at startup. Each one should make sure the
+// first user after a deploy doesn't pay for a cold dependency.
+var warmUpChecks = []warmUpCheck{
+	{"identity provider discovery", (*app).warmUpDiscovery},
+	{"signing keys", (*app).warmUpSigningKeys},
+	{"token endpoint", (*app).checkTokenEndpoint},
+}
+
+// WarmUp runs the warm-up checks until they all pass and then marks gangway
+// as ready.
+func (s *Server) WarmUp() {
+	for {
+		if err := s.warmUpOnce(); err != nil {
+			log.Warnf("Warm-up failed, retrying in %s: %s", warmUpRetryInterval, err)
+			time.Sleep(warmUpRetryInterval)
+			continue
+		}
+		log.Info("Warm-up complete, ready to serve")
+		return
+	}
+}
+
+// warmUpOnce runs the warm-up checks and marks gangway as ready if they all
+// pass.
+func (s *Server) warmUpOnce() error {
+	if err := s.runWarmUpChecks(); err != nil {
+		return err
+	}
+	atomic.StoreInt32(&s.ready, 1)
+	return nil
+}
+
+func (s *Server) runWarmUpChecks() error {
+	a := s.acquire()
+	defer a.mu.RUnlock()
+
+	for _, c := range warmUpChecks {
+		ctx, cancel := context.WithTimeout(context.Background(), a.cfg.RequestTimeout)
+		err := c.check(a, ctx)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("%s: %v", c.name, err)
+		}
+	}
+	return nil
+}
+
+// warmUpDiscovery fetches and caches the identity provider's metadata, if
+// IssuerURL is set, so that config reloads and readiness reports have it.
+func (a *app) warmUpDiscovery(ctx context.Context) error {
+	if a.cfg.IssuerURL == "" {
+		return nil
+	}
+	_, err := a.discovery.get(a.httpClient, a.cfg.IssuerURL)
+	return err
+}
+
+// warmUpSigningKeys fetches the identity provider's signing keys, if
+// JWKSURL is known, so that the first login doesn't wait for them.
+func (a *app) warmUpSigningKeys(ctx context.Context) error {
+	if a.keys == nil {
+		return nil
+	}
+	return a.keys.warmUp(ctx)
+}
+
+// checkTokenEndpoint makes sure the identity provider's token endpoint can be
+// reached. Any HTTP response will do; this also warms up DNS and the TLS
+// connection used by the first code exchange.
+func (a *app) checkTokenEndpoint(ctx context.Context) error {
+	req, err := http.NewRequest("GET", a.cfg.TokenURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := a.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Drain makes /readyz fail so that load balancers stop sending new users to
+// gangway before it shuts down.
+func (s *Server) Drain() {
+	atomic.StoreInt32(&s.draining, 1)
+}
+
+// healthzHandler reports that the process is up.
+func (s *Server) healthzHandler(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("ok"))
+}
+
+// readyzHandler reports whether gangway has finished warming up and is not
+// shutting down. With ?verbose=1 it reports each dependency as JSON, to
+// admins only: the report quotes the errors of the backends.
+func (s *Server) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("verbose") == "1" {
+		s.current().adminOnly(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			s.serveReadinessReport(w, time.Now())
+		})).ServeHTTP(w, r)
+		return
+	}
+	if atomic.LoadInt32(&s.draining) == 1 {
+		http.Error(w, "shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	if atomic.LoadInt32(&s.ready) == 0 {
+		http.Error(w, "warming up", http.StatusServiceUnavailable)
+		return
+	}
+	w.Write([]byte("ok"))
+}
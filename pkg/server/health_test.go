@@ -0,0 +1,290 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReadyzHandler(t *testing.T) {
+	s := newTestServer(t)
+
+	rr := httptest.NewRecorder()
+	s.readyzHandler(rr, httptest.NewRequest("GET", "/readyz", nil))
+	if status := rr.Code; status != http.StatusServiceUnavailable {
+		t.Errorf("handler returned wrong status code before warm-up: got %v want %v",
+			status, http.StatusServiceUnavailable)
+	}
+
+	atomic.StoreInt32(&s.ready, 1)
+
+	rr = httptest.NewRecorder()
+	s.readyzHandler(rr, httptest.NewRequest("GET", "/readyz", nil))
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code after warm-up: got %v want %v",
+			status, http.StatusOK)
+	}
+
+	s.Drain()
+
+	rr = httptest.NewRecorder()
+	s.readyzHandler(rr, httptest.NewRequest("GET", "/readyz", nil))
+	if status := rr.Code; status != http.StatusServiceUnavailable {
+		t.Errorf("handler returned wrong status code while draining: got %v want %v",
+			status, http.StatusServiceUnavailable)
+	}
+}
+
+// failingSessions is a session backend that can't be reached.
+type failingSessions struct{ fakeSessions }
+
+func (f *failingSessions) load(key string) (string, bool, error) {
+	return "", false, errors.New("connection refused")
+}
+
+// writeTestCert writes a self-signed certificate that expires at notAfter.
+func writeTestCert(t *testing.T, notAfter time.Time) string {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "gangway.example.com"},
+		NotBefore:    notAfter.Add(-365 * 24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := ioutil.TempFile("", "gangway-cert")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := pem.Encode(f, &pem.Block{Type: "CERTIFICATE", Bytes: der}); err != nil {
+		t.Fatal(err)
+	}
+	return f.Name()
+}
+
+func TestVerboseReadyz(t *testing.T) {
+	s := newTestServer(t)
+	atomic.StoreInt32(&s.ready, 1)
+	s.current().cfg.AdminToken = "the-admin-token"
+	verbose := func() *http.Request {
+		req := httptest.NewRequest("GET", "/readyz?verbose=1", nil)
+		req.Header.Set("Authorization", "Bearer the-admin-token")
+		return req
+	}
+
+	// the report is for admins only
+	rr := httptest.NewRecorder()
+	s.readyzHandler(rr, httptest.NewRequest("GET", "/readyz?verbose=1", nil))
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("got status %d without the admin token, want %d", rr.Code, http.StatusUnauthorized)
+	}
+
+	rr = httptest.NewRecorder()
+	s.readyzHandler(rr, verbose())
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d", rr.Code, http.StatusOK)
+	}
+	var report readinessReport
+	if err := json.Unmarshal(rr.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Status != checkOK {
+		t.Errorf("got overall status %q, want %q", report.Status, checkOK)
+	}
+	want := []string{"serving", "config", "session store", "identity provider discovery", "signing keys", "serving certificate"}
+	if len(report.Checks) != len(want) {
+		t.Fatalf("got %d checks, want %d", len(report.Checks), len(want))
+	}
+	for i, name := range want {
+		if report.Checks[i].Name != name {
+			t.Errorf("check %d is %q, want %q", i, report.Checks[i].Name, name)
+		}
+	}
+
+	// an unreachable session store is reported, but doesn't make gangway
+	// unready by itself
+	a := s.current()
+	hashKey, blockKey := deriveSessionKeys("test")
+	a.sessionStore = newServerSideStore(&failingSessions{}, "failing", hashKey, blockKey)
+	a.cfg.SessionStore = sessionStoreSQL
+	report = *s.readinessReport(time.Now())
+	if report.Status != checkDown || report.Checks[2].Status != checkDown {
+		t.Errorf("got %q and session store %q, want both %q", report.Status, report.Checks[2].Status, checkDown)
+	}
+
+	s.Drain()
+	rr = httptest.NewRecorder()
+	s.readyzHandler(rr, verbose())
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("got status %d while draining, want %d", rr.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestServingCertCheck(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name     string
+		expires  time.Duration
+		status   string
+		daysLeft int
+	}{
+		{"valid", 90*24*time.Hour + time.Hour, checkOK, 90},
+		{"expiring", 3*24*time.Hour + time.Hour, checkDegraded, 3},
+		{"expired", -time.Hour, checkDown, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeTestCert(t, now.Add(tt.expires))
+			defer os.Remove(path)
+			a := &app{cfg: &Config{ServeTLS: true, CertFile: path, CertExpiryWarning: defaultCertExpiryWarning}}
+			c := a.servingCertCheck(now)
+			if c.Status != tt.status {
+				t.Errorf("got status %q, want %q", c.Status, tt.status)
+			}
+			if c.DaysLeft == nil {
+				t.Fatal("days left not reported")
+			}
+			if *c.DaysLeft != tt.daysLeft {
+				t.Errorf("got %d days left, want %d", *c.DaysLeft, tt.daysLeft)
+			}
+		})
+	}
+
+	a := &app{cfg: &Config{ServeTLS: true, CertFile: "/nonexistent/cert.pem"}}
+	if c := a.servingCertCheck(now); c.Status != checkDown {
+		t.Errorf("got status %q for a missing certificate, want %q", c.Status, checkDown)
+	}
+}
+
+func TestCheckTokenEndpoint(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}))
+	defer ts.Close()
+
+	s := newTestServer(t)
+	a := s.current()
+	a.httpClient = ts.Client()
+	a.cfg.TokenURL = ts.URL
+	a.cfg.RequestTimeout = time.Second
+
+	if err := s.runWarmUpChecks(); err != nil {
+		t.Errorf("Expected a reachable token endpoint to pass warm-up, got: %s", err)
+	}
+
+	ts.Close()
+	if err := s.runWarmUpChecks(); err == nil {
+		t.Errorf("Expected an unreachable token endpoint to fail warm-up")
+	}
+}
+
+func TestWarmUpFetchesDiscoveryAndKeys(t *testing.T) {
+	var discoveryUp, keysUp int32
+	var issuer string
+	idp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			if atomic.LoadInt32(&discoveryUp) == 0 {
+				http.Error(w, "down", http.StatusServiceUnavailable)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]string{
+				"issuer":                 issuer,
+				"authorization_endpoint": issuer + "/auth",
+				"token_endpoint":         issuer + "/token",
+			})
+		case "/keys":
+			if atomic.LoadInt32(&keysUp) == 0 {
+				http.Error(w, "down", http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte(`{"keys": []}`))
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+	defer idp.Close()
+	issuer = idp.URL
+
+	// with the endpoints configured, nothing is discovered up front
+	s, err := New(&Config{
+		SessionSecurityKey: SessionKeys{"test"},
+		RequestTimeout:     time.Second,
+		IssuerURL:          issuer,
+		AuthorizeURL:       issuer + "/auth",
+		TokenURL:           issuer + "/token",
+		JWKSURL:            issuer + "/keys",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	readyz := func() int {
+		rr := httptest.NewRecorder()
+		s.readyzHandler(rr, httptest.NewRequest("GET", "/readyz", nil))
+		return rr.Code
+	}
+
+	if err := s.warmUpOnce(); err == nil || !strings.Contains(err.Error(), "discovery") {
+		t.Errorf("warm-up with discovery down: got %v", err)
+	}
+	if code := readyz(); code != http.StatusServiceUnavailable {
+		t.Errorf("/readyz returned %d with discovery down, want 503", code)
+	}
+
+	atomic.StoreInt32(&discoveryUp, 1)
+	if err := s.warmUpOnce(); err == nil || !strings.Contains(err.Error(), "signing keys") {
+		t.Errorf("warm-up with the keys down: got %v", err)
+	}
+	if code := readyz(); code != http.StatusServiceUnavailable {
+		t.Errorf("/readyz returned %d with the keys down, want 503", code)
+	}
+
+	atomic.StoreInt32(&keysUp, 1)
+	if err := s.warmUpOnce(); err != nil {
+		t.Errorf("warm-up failed: %v", err)
+	}
+	if code := readyz(); code != http.StatusOK {
+		t.Errorf("/readyz returned %d after warm-up, want 200", code)
+	}
+	if _, ok := s.discovery.fetched(issuer); !ok {
+		t.Errorf("provider metadata was not cached")
+	}
+	if s.current().keys.lastFetched().IsZero() {
+		t.Errorf("signing keys were not fetched")
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// idpCheckInterval is how long the result of checking the primary
+	// identity provider is trusted before logins check it again.
+	idpCheckInterval = 10 * time.Second
+
+	// idpCheckTimeout bounds the check, which holds up the login that
+	// makes it.
+	idpCheckTimeout = 3 * time.Second
+)
+
+// idpFailover tracks whether the primary identity provider is up, when a
+// standby is configured. Logins go to the primary while it answers and to the
+// standby, such as a second Keycloak, while it doesn't.
+type idpFailover struct {
+	mu          sync.Mutex
+	primaryDown bool
+	checked     time.Time
+}
+
+// useStandby reports whether logins should go to the standby identity
+// provider. The primary's token endpoint is checked at most once every
+// idpCheckInterval; any HTTP response other than a server error means it is
+// up.
+func (a *app) useStandby(ctx context.Context) bool {
+	if a.cfg.StandbyTokenURL == "" {
+		return false
+	}
+	f := a.failover
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := a.clock.Now()
+	if now.Sub(f.checked) < idpCheckInterval {
+		return f.primaryDown
+	}
+	ctx, cancel := context.WithTimeout(ctx, idpCheckTimeout)
+	defer cancel()
+	err := a.checkPrimaryIdP(ctx)
+	f.checked = now
+	a.setPrimaryDown(err != nil, err)
+	return f.primaryDown
+}
+
+// primaryFailed records that a request to the primary identity provider
+// could not be made, so that the next logins go to the standby without
+// waiting for the next check.
+func (a *app) primaryFailed(err error) {
+	if a.cfg.StandbyTokenURL == "" {
+		return
+	}
+	a.failover.mu.Lock()
+	defer a.failover.mu.Unlock()
+	a.failover.checked = a.clock.Now()
+	a.setPrimaryDown(true, err)
+}
+
+// setPrimaryDown updates the primary's state and logs changes. The caller
+// holds the failover lock.
+func (a *app) setPrimaryDown(down bool, err error) {
+	f := a.failover
+	if down && !f.primaryDown {
+		log.Warnf("Identity provider at %s is down, sending logins to the standby at %s: %s", a.cfg.TokenURL, a.cfg.StandbyTokenURL, err)
+	} else if !down && f.primaryDown {
+		log.Infof("Identity provider at %s is back, sending logins to it again", a.cfg.TokenURL)
+	}
+	f.primaryDown = down
+}
+
+// checkPrimaryIdP returns an error unless the primary's token endpoint
+// answers with anything but a server error. A token endpoint that is up
+// refuses a GET with a client error.
+func (a *app) checkPrimaryIdP(ctx context.Context) error {
+	req, err := http.NewRequest("GET", a.cfg.TokenURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := a.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("token endpoint returned %s", resp.Status)
+	}
+	return nil
+}
+
+// oauth2For returns the OAuth2 config for the standby identity provider if
+// standby is set, and for the primary otherwise.
+func (a *app) oauth2For(standby bool) *oauth2.Config {
+	if !standby {
+		return a.oauth2Cfg
+	}
+	cfg := *a.oauth2Cfg
+	cfg.Endpoint = oauth2.Endpoint{AuthURL: a.cfg.StandbyAuthorizeURL, TokenURL: a.cfg.StandbyTokenURL}
+	return &cfg
+}
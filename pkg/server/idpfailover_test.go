@@ -0,0 +1,74 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIdPFailover(t *testing.T) {
+	status := http.StatusBadRequest
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer primary.Close()
+
+	a := newTestApp(t)
+	defer a.clock.reset()
+	a.cfg.AuthorizeURL = primary.URL + "/authorize"
+	a.cfg.TokenURL = primary.URL + "/token"
+	ctx := context.Background()
+	if a.useStandby(ctx) {
+		t.Fatalf("expected the primary without a standby")
+	}
+
+	a.cfg.StandbyAuthorizeURL = "https://standby.example.com/authorize"
+	a.cfg.StandbyTokenURL = "https://standby.example.com/token"
+	if a.useStandby(ctx) {
+		t.Errorf("expected the primary while its token endpoint answers")
+	}
+
+	// the check is not repeated for every login
+	status = http.StatusServiceUnavailable
+	if a.useStandby(ctx) {
+		t.Errorf("expected the last check to be used")
+	}
+	a.clock.advance(idpCheckInterval)
+	if !a.useStandby(ctx) {
+		t.Errorf("expected the standby while the primary returns server errors")
+	}
+	if cfg := a.oauth2For(true); cfg.Endpoint.TokenURL != a.cfg.StandbyTokenURL || cfg.Endpoint.AuthURL != a.cfg.StandbyAuthorizeURL {
+		t.Errorf("got endpoint %+v, want the standby", cfg.Endpoint)
+	}
+	if a.oauth2For(false) != a.oauth2Cfg {
+		t.Errorf("expected the primary's config")
+	}
+
+	status = http.StatusMethodNotAllowed
+	a.clock.advance(idpCheckInterval)
+	if a.useStandby(ctx) {
+		t.Errorf("expected the primary once it is back")
+	}
+
+	// a failed code exchange fails over without waiting for the next check
+	a.primaryFailed(errors.New("connection refused"))
+	if !a.useStandby(ctx) {
+		t.Errorf("expected the standby after the primary failed")
+	}
+}
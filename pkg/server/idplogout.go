@@ -0,0 +1,360 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// An identity provider that supports OpenID Connect front-channel or
+// back-channel logout tells gangway when a user signs out there, or is
+// signed out by an administrator. Gangway can't always reach the user's
+// cookie when told: back-channel requests come from the provider, not the
+// browser. So the ended sessions are recorded, by the provider's session ID
+// (sid) or the user's subject (sub), and loginRequired turns them away.
+
+// backchannelLogoutEvent is the event claim of a back-channel logout token.
+const backchannelLogoutEvent = "http://schemas.openid.net/event/backchannel-logout"
+
+// maxLogoutTokenAge is how long after it was issued a logout token is
+// accepted. Providers deliver them right away; anything older is more likely
+// a replay than a late delivery.
+const maxLogoutTokenAge = 10 * time.Minute
+
+// logoutRevocationTTL is how long an ended session is remembered. Sessions
+// don't outlive their max age, so neither need the records.
+const logoutRevocationTTL = 30 * 24 * time.Hour
+
+// maxLogoutRevocations is how many ended sessions logoutRevocations keeps at
+// most.
+const maxLogoutRevocations = 100000
+
+// logoutRevocations records ended sessions in process memory, for session
+// stores that have no backend to share them through. It lives in the Server,
+// so that config changes don't forget them. Expired records are removed by
+// the janitor; beyond max, the oldest are evicted.
+type logoutRevocations struct {
+	max int
+
+	mu      sync.Mutex
+	revoked map[string]time.Time
+}
+
+func newLogoutRevocations() *logoutRevocations {
+	return &logoutRevocations{max: maxLogoutRevocations, revoked: map[string]time.Time{}}
+}
+
+func (l *logoutRevocations) revoke(key string, at time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.revoked[key]; !ok && len(l.revoked) >= l.max {
+		var oldest string
+		for k, t := range l.revoked {
+			if oldest == "" || t.Before(l.revoked[oldest]) {
+				oldest = k
+			}
+		}
+		delete(l.revoked, oldest)
+	}
+	l.revoked[key] = at
+}
+
+func (l *logoutRevocations) revokedAt(key string, now time.Time) (time.Time, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	at, ok := l.revoked[key]
+	if !ok || now.Sub(at) > logoutRevocationTTL {
+		return time.Time{}, false
+	}
+	return at, true
+}
+
+func (l *logoutRevocations) purgeExpired(now time.Time) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n := 0
+	for key, at := range l.revoked {
+		if now.Sub(at) > logoutRevocationTTL {
+			delete(l.revoked, key)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// revocationKey returns the key an ended session is recorded under, by the
+// provider's session ID or the user's subject as kind.
+func revocationKey(iss, kind, id string) string {
+	return iss + "\x00" + kind + "\x00" + id
+}
+
+// revokeSession records that the session or sessions named by key ended at
+// at. With a server-side session store the record is kept in its backend,
+// where every replica sees it.
+func (a *app) revokeSession(key string, at time.Time) error {
+	if s, ok := a.sessionStore.(*serverSideStore); ok {
+		return s.backend.save(backendKey("logout/"+key), strconv.FormatInt(at.UnixNano(), 10), at.Add(logoutRevocationTTL))
+	}
+	a.revocations.revoke(key, at)
+	return nil
+}
+
+// sessionRevokedAt returns when the session or sessions named by key ended.
+func (a *app) sessionRevokedAt(key string, now time.Time) (time.Time, bool, error) {
+	s, ok := a.sessionStore.(*serverSideStore)
+	if !ok {
+		at, ok := a.revocations.revokedAt(key, now)
+		return at, ok, nil
+	}
+	data, ok, err := s.backend.load(backendKey("logout/" + key))
+	if err != nil || !ok {
+		return time.Time{}, false, err
+	}
+	nanos, err := strconv.ParseInt(data, 10, 64)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return time.Unix(0, nanos), true, nil
+}
+
+// idTokenClaims returns the claims of idToken, or nil if it can't be parsed.
+func (a *app) idTokenClaims(idToken string) jwt.MapClaims {
+	jwtToken, _ := a.parseToken(idToken)
+	if jwtToken == nil {
+		return nil
+	}
+	claims, _ := jwtToken.Claims.(jwt.MapClaims)
+	return claims
+}
+
+// idTokenRevoked reports whether the session idToken was issued for has
+// ended: its sid was logged out, or its sub was logged out or its user
+// deprovisioned after it was issued.
+func (a *app) idTokenRevoked(idToken string, now time.Time) (bool, error) {
+	claims := a.idTokenClaims(idToken)
+	if claims == nil {
+		return false, nil
+	}
+	iss, _ := claims["iss"].(string)
+	if sid, _ := claims["sid"].(string); sid != "" {
+		if _, revoked, err := a.sessionRevokedAt(revocationKey(iss, "sid", sid), now); err != nil || revoked {
+			return revoked, err
+		}
+	}
+	var keys []string
+	if sub, _ := claims["sub"].(string); sub != "" {
+		keys = append(keys, revocationKey(iss, "sub", sub))
+	}
+	if user := a.idTokenUser(idToken); user != "" {
+		keys = append(keys, revocationKey("", "user", user))
+	}
+	for _, key := range keys {
+		at, revoked, err := a.sessionRevokedAt(key, now)
+		if err != nil {
+			return false, err
+		}
+		iat, ok := claims["iat"].(float64)
+		// without an issue time, any token of the user may predate the logout
+		if revoked && (!ok || int64(iat) <= at.Unix()) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// frontchannelLogoutHandler is the front-channel logout URI. The identity
+// provider loads it in a hidden frame of its logout page, with its issuer
+// and session ID when it sends them. It ends the session of the browser's
+// cookie, if the frame got it.
+func (a *app) frontchannelLogoutHandler(w http.ResponseWriter, r *http.Request) {
+	// only the identity provider's page frames this
+	w.Header().Del("X-Frame-Options")
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	q := r.URL.Query()
+	iss, sid := q.Get("iss"), q.Get("sid")
+	if iss != "" && a.cfg.IssuerURL != "" && iss != a.cfg.IssuerURL {
+		requestLog(r).Warnf("Ignoring front-channel logout from issuer %q", iss)
+		return
+	}
+
+	session, err := a.sessionStore.Get(r, a.cfg.sessionCookieName())
+	if err != nil {
+		return
+	}
+	idToken, ok := session.Values["id_token"].(string)
+	if !ok {
+		return
+	}
+
+	// Anyone can load this URI, so a sid is only recorded when it is the
+	// cookie's session: otherwise a request could end any session, or fill
+	// the records with made-up ones.
+	if sid != "" {
+		claims := a.idTokenClaims(idToken)
+		tokenIss, _ := claims["iss"].(string)
+		if s, _ := claims["sid"].(string); s != sid || (iss != "" && tokenIss != iss) {
+			return
+		}
+		if err := a.revokeSession(revocationKey(tokenIss, "sid", sid), time.Now()); err != nil {
+			requestLog(r).Errorf("Could not record front-channel logout: %s", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+	}
+	a.audit(r, auditLogout, a.idTokenUser(idToken), "front-channel logout")
+	a.cleanupSession(w, r)
+}
+
+// backchannelLogoutHandler is the back-channel logout URI. The identity
+// provider posts a logout token to it, naming the session or the user whose
+// sessions ended.
+func (a *app) backchannelLogoutHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, err := a.verifyLogoutToken(r.PostFormValue("logout_token"))
+	if err != nil {
+		requestLog(r).Warnf("Rejected back-channel logout: %s", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error":             "invalid_request",
+			"error_description": err.Error(),
+		})
+		return
+	}
+
+	iss, _ := claims["iss"].(string)
+	sid, _ := claims["sid"].(string)
+	sub, _ := claims["sub"].(string)
+	jti, _ := claims["jti"].(string)
+	now := time.Now()
+
+	// each token is accepted once, so that a replayed one can't end the
+	// sessions a user started since. Used token IDs are recorded like ended
+	// sessions, so every replica knows them.
+	jtiKey := revocationKey(iss, "jti", jti)
+	_, used, err := a.sessionRevokedAt(jtiKey, now)
+	if err == nil && !used {
+		err = a.revokeSession(jtiKey, now)
+	}
+	if err != nil {
+		requestLog(r).Errorf("Could not record back-channel logout: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if used {
+		requestLog(r).Warnf("Rejected back-channel logout: logout_token %s was already used", jti)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error":             "invalid_request",
+			"error_description": "logout_token was already used",
+		})
+		return
+	}
+
+	// a token with a sid only ends that session, otherwise all of the user's
+	key := revocationKey(iss, "sid", sid)
+	if sid == "" {
+		key = revocationKey(iss, "sub", sub)
+	}
+	if err := a.revokeSession(key, now); err != nil {
+		requestLog(r).Errorf("Could not record back-channel logout: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	user, _ := claims[a.cfg.UsernameClaim].(string)
+	if user == "" {
+		user = sub
+	}
+	a.audit(r, auditLogout, user, "back-channel logout")
+	w.WriteHeader(http.StatusOK)
+}
+
+// verifyLogoutToken validates a back-channel logout token as OpenID Connect
+// Back-Channel Logout 1.0 requires, and returns its claims.
+func (a *app) verifyLogoutToken(logoutToken string) (jwt.MapClaims, error) {
+	if logoutToken == "" {
+		return nil, errors.New("missing logout_token")
+	}
+	claims, err := a.parseVerified(logoutToken)
+	if err != nil {
+		return nil, fmt.Errorf("logout_token is not signed by the identity provider: %v", err)
+	}
+	now := time.Now()
+	if !claims.VerifyExpiresAt(now.Add(-maxClockSkew).Unix(), false) {
+		return nil, errors.New("logout_token has expired")
+	}
+
+	iss, _ := claims["iss"].(string)
+	if a.cfg.IssuerURL != "" && iss != a.cfg.IssuerURL {
+		return nil, fmt.Errorf("logout_token was issued by %q", iss)
+	}
+	if !audienceContains(claims["aud"], a.cfg.ClientID) {
+		return nil, errors.New("logout_token is not meant for this client")
+	}
+	iat, ok := claims["iat"].(float64)
+	if !ok {
+		return nil, errors.New("logout_token has no iat claim")
+	}
+	if issued := time.Unix(int64(iat), 0); now.Sub(issued) > maxLogoutTokenAge+maxClockSkew || issued.Sub(now) > maxClockSkew {
+		return nil, fmt.Errorf("logout_token was issued at %s, too far from now", issued.UTC().Format(time.RFC3339))
+	}
+	if jti, _ := claims["jti"].(string); jti == "" {
+		return nil, errors.New("logout_token has no jti claim")
+	}
+	events, _ := claims["events"].(map[string]interface{})
+	if _, ok := events[backchannelLogoutEvent]; !ok {
+		return nil, errors.New("logout_token has no back-channel logout event")
+	}
+	if _, ok := claims["nonce"]; ok {
+		return nil, errors.New("logout_token must not have a nonce claim")
+	}
+	sid, _ := claims["sid"].(string)
+	sub, _ := claims["sub"].(string)
+	if sid == "" && sub == "" {
+		return nil, errors.New("logout_token names neither a session nor a subject")
+	}
+	return claims, nil
+}
+
+// audienceContains reports whether the aud claim aud, a string or a list of
+// them, contains clientID.
+func audienceContains(aud interface{}, clientID string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == clientID
+	case []interface{}:
+		for _, a := range aud {
+			if a == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,268 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+func newLogoutTestServer(t *testing.T) *Server {
+	s, err := New(&Config{
+		SessionSecurityKey: SessionKeys{"test"},
+		RequestTimeout:     time.Second,
+		ClientID:           "gangway",
+		ClientSecret:       "secret",
+		IssuerURL:          "https://idp.example.com",
+		AuthorizeURL:       "https://idp.example.com/authorize",
+		TokenURL:           "https://idp.example.com/token",
+		UsernameClaim:      "sub",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func signLogoutTestToken(t *testing.T, claims jwt.MapClaims, key string) string {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// signedInCookie returns the session cookie of a user signed in with an ID
+// token with claims.
+func signedInCookie(t *testing.T, a *app, claims jwt.MapClaims) *http.Cookie {
+	req := httptest.NewRequest("GET", "/", nil)
+	session, err := a.sessionStore.Get(req, "gangway")
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.Values["id_token"] = signLogoutTestToken(t, claims, "secret")
+	rr := httptest.NewRecorder()
+	if err := session.Save(req, rr); err != nil {
+		t.Fatal(err)
+	}
+	return rr.Result().Cookies()[0]
+}
+
+// signedIn reports whether loginRequired lets through a request with cookie.
+func signedIn(a *app, cookie *http.Cookie) bool {
+	req := httptest.NewRequest("GET", "/commandline", nil)
+	req.AddCookie(cookie)
+	rr := httptest.NewRecorder()
+	a.loginRequired(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(rr, req)
+	return rr.Code == http.StatusOK
+}
+
+func postLogoutToken(s *Server, logoutToken string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/logout/backchannel", strings.NewReader(url.Values{"logout_token": {logoutToken}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	s.ServeHTTP(rr, req)
+	return rr
+}
+
+func logoutTokenClaims(now time.Time) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":    "https://idp.example.com",
+		"aud":    []string{"gangway"},
+		"iat":    now.Unix(),
+		"jti":    "bWJq",
+		"sid":    "08a5019c",
+		"events": map[string]interface{}{backchannelLogoutEvent: map[string]interface{}{}},
+	}
+}
+
+func TestVerifyLogoutToken(t *testing.T) {
+	a := newLogoutTestServer(t).current()
+	now := time.Now()
+
+	tests := []struct {
+		name   string
+		modify func(jwt.MapClaims)
+		key    string
+		valid  bool
+	}{
+		{"valid", func(c jwt.MapClaims) {}, "secret", true},
+		{"subject only", func(c jwt.MapClaims) { delete(c, "sid"); c["sub"] = "jane" }, "secret", true},
+		{"audience string", func(c jwt.MapClaims) { c["aud"] = "gangway" }, "secret", true},
+		{"wrong key", func(c jwt.MapClaims) {}, "other", false},
+		{"other issuer", func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }, "secret", false},
+		{"other audience", func(c jwt.MapClaims) { c["aud"] = "kubectl" }, "secret", false},
+		{"no iat", func(c jwt.MapClaims) { delete(c, "iat") }, "secret", false},
+		{"issued long ago", func(c jwt.MapClaims) { c["iat"] = now.Add(-time.Hour).Unix() }, "secret", false},
+		{"issued in the future", func(c jwt.MapClaims) { c["iat"] = now.Add(time.Hour).Unix() }, "secret", false},
+		{"no jti", func(c jwt.MapClaims) { delete(c, "jti") }, "secret", false},
+		{"no event", func(c jwt.MapClaims) { delete(c, "events") }, "secret", false},
+		{"nonce", func(c jwt.MapClaims) { c["nonce"] = "n-0S6_WzA2Mj" }, "secret", false},
+		{"no sid or sub", func(c jwt.MapClaims) { delete(c, "sid") }, "secret", false},
+	}
+	for _, tt := range tests {
+		claims := logoutTokenClaims(now)
+		tt.modify(claims)
+		_, err := a.verifyLogoutToken(signLogoutTestToken(t, claims, tt.key))
+		if valid := err == nil; valid != tt.valid {
+			t.Errorf("%s: got error %v, want valid %v", tt.name, err, tt.valid)
+		}
+	}
+}
+
+func TestBackchannelLogout(t *testing.T) {
+	s := newLogoutTestServer(t)
+	a := s.current()
+	now := time.Now()
+
+	jane := signedInCookie(t, a, jwt.MapClaims{"iss": "https://idp.example.com", "sub": "jane", "sid": "08a5019c", "iat": now.Add(-time.Minute).Unix()})
+	joe := signedInCookie(t, a, jwt.MapClaims{"iss": "https://idp.example.com", "sub": "joe", "sid": "5c4e2d1f", "iat": now.Add(-time.Minute).Unix()})
+	if !signedIn(a, jane) || !signedIn(a, joe) {
+		t.Fatal("users aren't signed in to begin with")
+	}
+
+	if rr := postLogoutToken(s, "not a token"); rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "invalid_request") {
+		t.Errorf("invalid logout token: got status %d and %q", rr.Code, rr.Body.String())
+	}
+
+	if rr := postLogoutToken(s, signLogoutTestToken(t, logoutTokenClaims(now), "secret")); rr.Code != http.StatusOK {
+		t.Fatalf("got status %d, want 200: %s", rr.Code, rr.Body.String())
+	} else if cc := rr.Header().Get("Cache-Control"); !strings.Contains(cc, "no-store") {
+		t.Errorf("got Cache-Control %q, want no-store", cc)
+	}
+	if signedIn(a, jane) {
+		t.Error("the session logged out by sid is still signed in")
+	}
+	if !signedIn(a, joe) {
+		t.Error("another user's session was logged out")
+	}
+
+	// a logout token is only accepted once
+	if rr := postLogoutToken(s, signLogoutTestToken(t, logoutTokenClaims(now), "secret")); rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "already used") {
+		t.Errorf("replayed logout token: got status %d and %q", rr.Code, rr.Body.String())
+	}
+
+	// logging out a subject ends the sessions issued before, not after
+	claims := logoutTokenClaims(now)
+	claims["jti"] = "c2Vjb25k"
+	delete(claims, "sid")
+	claims["sub"] = "joe"
+	if rr := postLogoutToken(s, signLogoutTestToken(t, claims, "secret")); rr.Code != http.StatusOK {
+		t.Fatalf("got status %d, want 200: %s", rr.Code, rr.Body.String())
+	}
+	if signedIn(a, joe) {
+		t.Error("the session of the logged out subject is still signed in")
+	}
+	again := signedInCookie(t, a, jwt.MapClaims{"iss": "https://idp.example.com", "sub": "joe", "iat": now.Add(time.Minute).Unix()})
+	if !signedIn(a, again) {
+		t.Error("signing in again after the logout is turned away")
+	}
+}
+
+func TestFrontchannelLogout(t *testing.T) {
+	s := newLogoutTestServer(t)
+	a := s.current()
+	now := time.Now()
+	jane := signedInCookie(t, a, jwt.MapClaims{"iss": "https://idp.example.com", "sub": "jane", "sid": "08a5019c", "iat": now.Unix()})
+
+	// a foreign issuer is ignored
+	req := httptest.NewRequest("GET", "/logout/frontchannel?iss=https%3A%2F%2Fevil.example.com&sid=08a5019c", nil)
+	s.ServeHTTP(httptest.NewRecorder(), req)
+	if !signedIn(a, jane) {
+		t.Fatal("front-channel logout from another issuer logged out the session")
+	}
+
+	req = httptest.NewRequest("GET", "/logout/frontchannel?iss=https%3A%2F%2Fidp.example.com&sid=08a5019c", nil)
+	req.AddCookie(jane)
+	rr := httptest.NewRecorder()
+	s.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got status %d, want 200", rr.Code)
+	}
+	if xfo := rr.Header().Get("X-Frame-Options"); xfo != "" {
+		t.Errorf("got X-Frame-Options %q, the identity provider must be able to frame the page", xfo)
+	}
+	if cookies := rr.Result().Cookies(); len(cookies) != 1 || cookies[0].MaxAge >= 0 {
+		t.Errorf("the session cookie wasn't cleared: %v", cookies)
+	}
+	// copies of the cookie are turned away too
+	if signedIn(a, jane) {
+		t.Error("the logged out session is still signed in")
+	}
+}
+
+func TestFrontchannelLogoutNeedsTheSessionCookie(t *testing.T) {
+	s := newLogoutTestServer(t)
+	a := s.current()
+	jane := signedInCookie(t, a, jwt.MapClaims{"iss": "https://idp.example.com", "sub": "jane", "sid": "08a5019c", "iat": time.Now().Unix()})
+
+	for _, target := range []string{
+		"/logout/frontchannel?iss=https%3A%2F%2Fidp.example.com&sid=08a5019c",
+		"/logout/frontchannel?sid=made-up",
+	} {
+		s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", target, nil))
+	}
+	// another session's cookie doesn't help either
+	req := httptest.NewRequest("GET", "/logout/frontchannel?sid=08a5019c", nil)
+	req.AddCookie(signedInCookie(t, a, jwt.MapClaims{"iss": "https://idp.example.com", "sub": "joe", "sid": "77c1e2f0"}))
+	s.ServeHTTP(httptest.NewRecorder(), req)
+
+	if !signedIn(a, jane) {
+		t.Error("a front-channel logout without the session's cookie ended it")
+	}
+	if n := len(s.revocations.revoked); n != 0 {
+		t.Errorf("recorded %d ended sessions, want none", n)
+	}
+}
+
+func TestLogoutRevocationsExpire(t *testing.T) {
+	l := newLogoutRevocations()
+	now := time.Now()
+	l.revoke("old", now.Add(-logoutRevocationTTL-time.Minute))
+	l.revoke("new", now)
+	if _, ok := l.revokedAt("old", now); ok {
+		t.Error("an expired revocation is still in effect")
+	}
+	if n, _ := l.purgeExpired(now); n != 1 {
+		t.Errorf("purged %d revocations, want 1", n)
+	}
+	if _, ok := l.revokedAt("new", now); !ok {
+		t.Error("a recent revocation was purged")
+	}
+}
+
+func TestLogoutRevocationsAreCapped(t *testing.T) {
+	l := newLogoutRevocations()
+	l.max = 2
+	now := time.Now()
+	l.revoke("a", now.Add(-time.Minute))
+	l.revoke("b", now)
+	l.revoke("a", now.Add(time.Second))
+	l.revoke("c", now.Add(2*time.Second))
+	if len(l.revoked) != 2 {
+		t.Errorf("kept %d revocations, want 2", len(l.revoked))
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := l.revokedAt(key, now); !ok {
+			t.Errorf("revocation %q was evicted, want the oldest, b, evicted", key)
+		}
+	}
+}
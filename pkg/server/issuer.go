@@ -0,0 +1,74 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/dgrijalva/jwt-go"
+	"golang.org/x/oauth2"
+)
+
+// checkIssuer returns the issuer of token's ID token and, if Config.IssuerURL
+// is set and the issuer doesn't match it, why not.
+func (a *app) checkIssuer(token *oauth2.Token) (iss, mismatch string) {
+	if a.cfg.IssuerURL == "" {
+		return "", ""
+	}
+	if idToken, ok := token.Extra("id_token").(string); ok {
+		if jwtToken, _ := a.parseToken(idToken); jwtToken != nil {
+			if claims, ok := jwtToken.Claims.(jwt.MapClaims); ok {
+				iss, _ = claims["iss"].(string)
+			}
+		}
+	}
+	return iss, issuerMismatch(a.cfg.IssuerURL, iss)
+}
+
+// issuerMismatch explains how the issuer of an ID token, iss, differs from
+// the expected issuer, or returns "" if they are the same. The API server
+// compares them byte for byte, so near misses such as a trailing slash are
+// as fatal as a different host, and much harder to spot.
+func issuerMismatch(expected, iss string) string {
+	if iss == expected {
+		return ""
+	}
+	if iss == "" {
+		return "the ID token has no iss claim"
+	}
+	if strings.TrimSuffix(iss, "/") == strings.TrimSuffix(expected, "/") {
+		if strings.HasSuffix(iss, "/") {
+			return "the ID token's issuer has a trailing slash that issuerURL lacks"
+		}
+		return "issuerURL has a trailing slash that the ID token's issuer lacks"
+	}
+
+	e, err1 := url.Parse(expected)
+	i, err2 := url.Parse(iss)
+	if err1 != nil || err2 != nil {
+		return "the issuers differ"
+	}
+	switch {
+	case !strings.EqualFold(e.Scheme, i.Scheme) && strings.EqualFold(e.Host, i.Host) && e.Path == i.Path:
+		return fmt.Sprintf("the issuers differ in scheme (%s vs %s); check how the identity provider is told its external URL behind TLS-terminating proxies", i.Scheme, e.Scheme)
+	case !strings.EqualFold(e.Host, i.Host):
+		return fmt.Sprintf("the issuers differ in host (%s vs %s); the identity provider may be reached under an internal name", i.Host, e.Host)
+	case strings.TrimSuffix(e.Path, "/") != strings.TrimSuffix(i.Path, "/"):
+		return fmt.Sprintf("the issuers differ in path (%s vs %s); check the Keycloak realm or the Dex issuer path", i.Path, e.Path)
+	}
+	return "the issuers differ"
+}
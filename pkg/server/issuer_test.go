@@ -0,0 +1,41 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIssuerMismatch(t *testing.T) {
+	tests := []struct {
+		expected, iss string
+		want          string
+	}{
+		{"https://dex.example.com", "https://dex.example.com", ""},
+		{"https://dex.example.com", "https://dex.example.com/", "trailing slash that issuerURL lacks"},
+		{"https://dex.example.com/", "https://dex.example.com", "issuerURL has a trailing slash"},
+		{"https://dex.example.com", "http://dex.example.com", "differ in scheme"},
+		{"https://dex.example.com", "https://dex.internal:5556", "differ in host"},
+		{"https://kc.example.com/auth/realms/prod", "https://kc.example.com/auth/realms/master", "differ in path"},
+		{"https://dex.example.com", "", "no iss claim"},
+	}
+	for _, tc := range tests {
+		got := issuerMismatch(tc.expected, tc.iss)
+		if (tc.want == "") != (got == "") || !strings.Contains(got, tc.want) {
+			t.Errorf("issuerMismatch(%q, %q) = %q, want it to mention %q", tc.expected, tc.iss, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// purger is implemented by stores that keep entries on the server side which
+// expire, such as sessions, login states and rate limits. Expired entries are
+// never served, but only purging them keeps the store from growing without
+// bound.
+type purger interface {
+	purgeExpired(now time.Time) (int, error)
+}
+
+// janitorCounters counts the janitor's work.
+type janitorCounters struct {
+	runs   int64
+	purged int64
+	errors int64
+}
+
+// purgers returns the stores used by a that need purging.
+func (a *app) purgers() []purger {
+	var stores []purger
+	for _, store := range []interface{}{a.sessionStore, a.loginStates, a.limiter, a.revocations, a.transcripts} {
+		if p, ok := store.(purger); ok {
+			stores = append(stores, p)
+		}
+	}
+	return stores
+}
+
+// Janitor purges expired entries from the stores in use every interval.
+func (s *Server) Janitor(interval time.Duration) {
+	for range time.Tick(interval) {
+		s.purgeExpired(time.Now())
+	}
+}
+
+func (s *Server) purgeExpired(now time.Time) {
+	a := s.acquire()
+	defer a.mu.RUnlock()
+
+	atomic.AddInt64(&s.janitorMetrics.runs, 1)
+	for _, p := range a.purgers() {
+		n, err := p.purgeExpired(now)
+		atomic.AddInt64(&s.janitorMetrics.purged, int64(n))
+		if err != nil {
+			atomic.AddInt64(&s.janitorMetrics.errors, 1)
+			log.Errorf("Failed to purge expired entries from %T: %s", p, err)
+			continue
+		}
+		if n > 0 {
+			log.Debugf("Purged %d expired entries from %T (%d purged in total)", n, p, atomic.LoadInt64(&s.janitorMetrics.purged))
+		}
+	}
+}
@@ -0,0 +1,40 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestJanitorPurgesLoginStates(t *testing.T) {
+	s := newTestServer(t)
+	m := newMemoryLoginStates(&s.loginStateMetrics)
+	s.current().loginStates = m
+
+	now := time.Now()
+	m.save(nil, "expired", &loginState{Expires: now.Add(-time.Second)})
+	m.save(nil, "live", &loginState{Expires: now.Add(time.Minute)})
+
+	before := atomic.LoadInt64(&s.janitorMetrics.purged)
+	s.purgeExpired(now)
+	if purged := atomic.LoadInt64(&s.janitorMetrics.purged) - before; purged != 1 {
+		t.Errorf("janitor purged %d entries, want 1", purged)
+	}
+	if len(m.states) != 1 {
+		t.Errorf("expected 1 login state left, got %d", len(m.states))
+	}
+}
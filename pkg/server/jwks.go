@@ -0,0 +1,328 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/oauth2"
+)
+
+// jwksRefreshInterval is how often the key set is fetched again at most, when
+// a token is signed with a key it doesn't have. Providers publish new keys
+// ahead of using them, so this only delays logins right after a rotation
+// gangway missed, and keeps bogus key IDs from hammering the provider.
+const jwksRefreshInterval = time.Minute
+
+// keySet holds the identity provider's signing keys, as published at its
+// JWKS URL. Keys are fetched on first use and again when a token names a key
+// it doesn't know.
+type keySet struct {
+	url    string
+	client *http.Client
+	// pinned are the key IDs of Config.PinnedKeyIDs. When set, other keys
+	// are reported and not used.
+	pinned map[string]bool
+
+	mu      sync.Mutex
+	keys    map[string]interface{}
+	fetched time.Time
+}
+
+func newKeySet(url string, client *http.Client, pinnedKeyIDs []string) *keySet {
+	k := &keySet{url: url, client: client}
+	if len(pinnedKeyIDs) > 0 {
+		k.pinned = map[string]bool{}
+		for _, kid := range pinnedKeyIDs {
+			k.pinned[kid] = true
+		}
+	}
+	return k
+}
+
+// sameAs reports whether k is for the given settings, so that it can be kept.
+func (k *keySet) sameAs(url string, pinnedKeyIDs []string) bool {
+	if k.url != url || len(k.pinned) != len(pinnedKeyIDs) {
+		return false
+	}
+	for _, kid := range pinnedKeyIDs {
+		if !k.pinned[kid] {
+			return false
+		}
+	}
+	return true
+}
+
+// key returns the public key with ID kid. A token without a key ID may use
+// the only key of a set that has a single one.
+func (k *keySet) key(kid string) (interface{}, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if kid != "" && k.pinned != nil && !k.pinned[kid] {
+		return nil, fmt.Errorf("key %q is not in pinnedKeyIDs", kid)
+	}
+	if key, ok := k.lookup(kid); ok {
+		return key, nil
+	}
+	if time.Since(k.fetched) < jwksRefreshInterval {
+		return nil, fmt.Errorf("no key %q in %s", kid, k.url)
+	}
+	keys, err := fetchKeys(context.Background(), k.client, k.url)
+	k.fetched = time.Now()
+	if err != nil {
+		return nil, err
+	}
+	k.setKeys(keys)
+	if key, ok := k.lookup(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("no key %q in %s", kid, k.url)
+}
+
+// warmUp fetches the keys unless they have been already, so that the first
+// login doesn't wait for them.
+func (k *keySet) warmUp(ctx context.Context) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.keys != nil {
+		return nil
+	}
+	keys, err := fetchKeys(ctx, k.client, k.url)
+	if err != nil {
+		return err
+	}
+	k.fetched = time.Now()
+	k.setKeys(keys)
+	return nil
+}
+
+// setKeys replaces the keys with freshly fetched ones. The caller holds the
+// lock.
+func (k *keySet) setKeys(keys map[string]interface{}) {
+	k.keys = keys
+	if unpinned := k.unpinned(); len(unpinned) > 0 {
+		// the keys changed behind the operators' back
+		log.Errorf("Signing keys at %s include key IDs that are not in pinnedKeyIDs: %s", k.url, strings.Join(unpinned, ", "))
+	}
+}
+
+func (k *keySet) lookup(kid string) (interface{}, bool) {
+	if kid == "" && len(k.keys) == 1 {
+		for id := range k.keys {
+			kid = id
+		}
+	}
+	if k.pinned != nil && !k.pinned[kid] {
+		return nil, false
+	}
+	key, ok := k.keys[kid]
+	return key, ok
+}
+
+// lastFetched returns when the keys were last fetched, zero if they haven't
+// been yet.
+func (k *keySet) lastFetched() time.Time {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.fetched
+}
+
+// setClient makes k fetch keys with client from now on.
+func (k *keySet) setClient(client *http.Client) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.client = client
+}
+
+// unpinned returns the IDs of the fetched keys that aren't pinned, sorted.
+func (k *keySet) unpinned() []string {
+	var ids []string
+	for kid := range k.keys {
+		if k.pinned != nil && !k.pinned[kid] {
+			ids = append(ids, kid)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// jsonWebKey is a public key in a JWKS (RFC 7517). Only RSA and EC signing
+// keys are used.
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func fetchKeys(ctx context.Context, client *http.Client, url string) (map[string]interface{}, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("fetching signing keys: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching signing keys from %s: unexpected status %s", url, resp.Status)
+	}
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("decoding signing keys from %s: %v", url, err)
+	}
+
+	keys := map[string]interface{}{}
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			// a key of a kind we don't know doesn't stop us from using
+			// the others
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	return keys, nil
+}
+
+func (jwk *jsonWebKey) publicKey() (interface{}, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(key.X, key.Y) {
+			return nil, errors.New("point not on curve")
+		}
+		return key, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", jwk.Kty)
+}
+
+// verificationKey returns the key to check token's signature with: one of the
+// identity provider's published keys, or the client secret for providers
+// that sign with it, such as Auth0 with HS256.
+func (a *app) verificationKey(token *jwt.Token) (interface{}, error) {
+	switch token.Method.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodECDSA:
+		if a.keys == nil {
+			return nil, errors.New("the token is signed with a public key, but there is no jwksURL to get it from")
+		}
+		kid, _ := token.Header["kid"].(string)
+		return a.keys.key(kid)
+	case *jwt.SigningMethodHMAC:
+		if a.cfg.ClientSecret == "" {
+			return nil, errors.New("the token is signed with a client secret, but gangway has none")
+		}
+		return []byte(a.cfg.ClientSecret), nil
+	}
+	return nil, fmt.Errorf("unsupported signing algorithm %s", token.Method.Alg())
+}
+
+// parseVerified parses a token from the identity provider, checking only
+// its signature. The caller checks the claims it relies on.
+func (a *app) parseVerified(tokenString string) (jwt.MapClaims, error) {
+	parser := &jwt.Parser{SkipClaimsValidation: true}
+	token, err := parser.Parse(tokenString, a.verificationKey)
+	if err != nil {
+		return nil, err
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+	return claims, nil
+}
+
+// verifyIDToken checks the signature, audience, expiry and nonce of token's
+// ID token. The issuer is checked by checkIssuer, and how far the timestamps
+// may be off by checkClockSkew.
+func (a *app) verifyIDToken(token *oauth2.Token, nonce string, now time.Time) error {
+	idToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return errors.New("the token response has no ID token")
+	}
+	claims, err := a.parseVerified(idToken)
+	if err != nil {
+		return err
+	}
+	if !audienceContains(claims["aud"], a.cfg.ClientID) {
+		return fmt.Errorf("the ID token is not meant for clientID %q", a.cfg.ClientID)
+	}
+	if _, ok := claims["exp"].(float64); !ok {
+		return errors.New("the ID token has no expiry")
+	}
+	if !claims.VerifyExpiresAt(now.Add(-maxClockSkew).Unix(), true) {
+		return errors.New("the ID token has expired")
+	}
+	if got, _ := claims["nonce"].(string); nonce != "" && got != nonce {
+		return errors.New("the ID token's nonce doesn't match the login's")
+	}
+	return nil
+}
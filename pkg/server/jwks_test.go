@@ -0,0 +1,194 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"golang.org/x/oauth2"
+)
+
+// jwksTestServer publishes the public keys of keys as a JWKS, keyed by ID.
+func jwksTestServer(t *testing.T, keys map[string]interface{}) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		enc := base64.RawURLEncoding.EncodeToString
+		var set []map[string]string
+		for kid, key := range keys {
+			switch key := key.(type) {
+			case *rsa.PrivateKey:
+				set = append(set, map[string]string{"kty": "RSA", "kid": kid, "n": enc(key.N.Bytes()), "e": enc(big.NewInt(int64(key.E)).Bytes())})
+			case *ecdsa.PrivateKey:
+				set = append(set, map[string]string{"kty": "EC", "kid": kid, "crv": "P-256", "x": enc(key.X.Bytes()), "y": enc(key.Y.Bytes())})
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": set})
+	}))
+}
+
+func signIDTestToken(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims jwt.MapClaims) *oauth2.Token {
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	idToken, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return (&oauth2.Token{AccessToken: "access"}).WithExtra(map[string]interface{}{"id_token": idToken})
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := jwksTestServer(t, map[string]interface{}{"rsa": rsaKey, "ec": ecKey})
+	defer ts.Close()
+
+	a := newTestApp(t)
+	a.cfg.ClientID = "gangway"
+	a.cfg.ClientSecret = "secret"
+	a.keys = newKeySet(ts.URL, ts.Client(), nil)
+
+	now := time.Now()
+	claims := func(extra jwt.MapClaims) jwt.MapClaims {
+		c := jwt.MapClaims{"aud": "gangway", "exp": now.Add(time.Hour).Unix(), "nonce": "n"}
+		for k, v := range extra {
+			c[k] = v
+		}
+		return c
+	}
+	tests := []struct {
+		name  string
+		token *oauth2.Token
+		err   string
+	}{
+		{"rs256", signIDTestToken(t, jwt.SigningMethodRS256, "rsa", rsaKey, claims(nil)), ""},
+		{"es256", signIDTestToken(t, jwt.SigningMethodES256, "ec", ecKey, claims(nil)), ""},
+		{"hs256", signIDTestToken(t, jwt.SigningMethodHS256, "", []byte("secret"), claims(nil)), ""},
+		{"audience list", signIDTestToken(t, jwt.SigningMethodRS256, "rsa", rsaKey, claims(jwt.MapClaims{"aud": []string{"other", "gangway"}})), ""},
+		{"wrong key", signIDTestToken(t, jwt.SigningMethodRS256, "rsa", otherKey, claims(nil)), "verification error"},
+		{"unknown key", signIDTestToken(t, jwt.SigningMethodRS256, "other", otherKey, claims(nil)), `no key "other"`},
+		{"wrong secret", signIDTestToken(t, jwt.SigningMethodHS256, "", []byte("guess"), claims(nil)), "signature is invalid"},
+		{"wrong audience", signIDTestToken(t, jwt.SigningMethodRS256, "rsa", rsaKey, claims(jwt.MapClaims{"aud": "other"})), "not meant for"},
+		{"no expiry", signIDTestToken(t, jwt.SigningMethodRS256, "rsa", rsaKey, jwt.MapClaims{"aud": "gangway", "nonce": "n"}), "no expiry"},
+		{"expired", signIDTestToken(t, jwt.SigningMethodRS256, "rsa", rsaKey, claims(jwt.MapClaims{"exp": now.Add(-time.Hour).Unix()})), "expired"},
+		{"nonce mismatch", signIDTestToken(t, jwt.SigningMethodRS256, "rsa", rsaKey, claims(jwt.MapClaims{"nonce": "replayed"})), "nonce"},
+		{"no ID token", &oauth2.Token{AccessToken: "access"}, "no ID token"},
+	}
+	for _, test := range tests {
+		err := a.verifyIDToken(test.token, "n", now)
+		if test.err == "" && err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+		}
+		if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("%s: got error %v, want %q", test.name, err, test.err)
+		}
+	}
+}
+
+func TestVerifyIDTokenWithoutJWKS(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := newTestApp(t)
+	a.cfg.ClientID = "gangway"
+	token := signIDTestToken(t, jwt.SigningMethodRS256, "rsa", rsaKey, jwt.MapClaims{"aud": "gangway", "exp": time.Now().Add(time.Hour).Unix()})
+	if err := a.verifyIDToken(token, "", time.Now()); err == nil || !strings.Contains(err.Error(), "jwksURL") {
+		t.Errorf("got error %v, want one about jwksURL", err)
+	}
+}
+
+func TestKeySetRefetchesOnRotation(t *testing.T) {
+	oldKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := map[string]interface{}{"old": oldKey}
+	ts := jwksTestServer(t, keys)
+	defer ts.Close()
+	k := newKeySet(ts.URL, ts.Client(), nil)
+
+	if _, err := k.key("old"); err != nil {
+		t.Fatal(err)
+	}
+	keys["new"] = newKey
+	// a key is only looked for again after jwksRefreshInterval
+	if _, err := k.key("new"); err == nil {
+		t.Errorf("key set was fetched again right away")
+	}
+	k.fetched = time.Now().Add(-jwksRefreshInterval)
+	if key, err := k.key("new"); err != nil || key.(*rsa.PublicKey).N.Cmp(newKey.N) != 0 {
+		t.Errorf("got %v, %v after the key rotation", key, err)
+	}
+}
+
+func TestKeySetPinning(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := map[string]interface{}{"pinned": key, "rogue": key}
+	ts := jwksTestServer(t, keys)
+	defer ts.Close()
+	k := newKeySet(ts.URL, ts.Client(), []string{"pinned"})
+
+	if _, err := k.key("pinned"); err != nil {
+		t.Errorf("pinned key: %v", err)
+	}
+	if _, err := k.key("rogue"); err == nil || !strings.Contains(err.Error(), "pinnedKeyIDs") {
+		t.Errorf("got error %v for a key that isn't pinned", err)
+	}
+	if unpinned := k.unpinned(); !reflect.DeepEqual(unpinned, []string{"rogue"}) {
+		t.Errorf("got unpinned keys %v", unpinned)
+	}
+
+	// a sole key is only used without a key ID if it is pinned
+	delete(keys, "pinned")
+	k = newKeySet(ts.URL, ts.Client(), []string{"pinned"})
+	if _, err := k.key(""); err == nil {
+		t.Errorf("sole key used although it isn't pinned")
+	}
+
+	if !k.sameAs(ts.URL, []string{"pinned"}) || k.sameAs(ts.URL, []string{"pinned", "rogue"}) || k.sameAs(ts.URL, nil) {
+		t.Errorf("sameAs doesn't compare the pinned key IDs")
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// keyPairCache holds the serving key pairs, loading them again whenever the
+// config names other files or the files change, e.g. when cert-manager
+// renews the certificate in a mounted Secret.
+type keyPairCache struct {
+	mu      sync.Mutex
+	entries map[string]*keyPairEntry
+}
+
+type keyPairEntry struct {
+	certFile, keyFile string
+	certMod, keyMod   time.Time
+	cert              *tls.Certificate
+}
+
+func newKeyPairCache() *keyPairCache {
+	return &keyPairCache{entries: map[string]*keyPairEntry{}}
+}
+
+// get returns the key pair of certFile and keyFile, the one loaded before
+// unless either file changed since.
+func (k *keyPairCache) get(listener, certFile, keyFile string) (*tls.Certificate, error) {
+	certMod, err := modTime(certFile)
+	if err != nil {
+		return nil, err
+	}
+	keyMod, err := modTime(keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	e := k.entries[listener]
+	if e != nil && e.certFile == certFile && e.keyFile == keyFile && e.certMod.Equal(certMod) && e.keyMod.Equal(keyMod) {
+		return e.cert, nil
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading %s and %s: %v", certFile, keyFile, err)
+	}
+	k.entries[listener] = &keyPairEntry{certFile: certFile, keyFile: keyFile, certMod: certMod, keyMod: keyMod, cert: &cert}
+	return &cert, nil
+}
+
+func modTime(path string) (time.Time, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return fi.ModTime(), nil
+}
+
+// GetCertificate returns a tls.Config.GetCertificate for the UI listeners, or
+// the API listeners if api is set. It serves the key pair of the config in
+// effect, so certificates are rotated by a config reload, or by replacing the
+// files, without a restart.
+func (s *Server) GetCertificate(api bool) func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		c := s.Config()
+		if api {
+			return s.keyPairs.get("api", c.APICertFile, c.APIKeyFile)
+		}
+		return s.keyPairs.get("ui", c.CertFile, c.KeyFile)
+	}
+}
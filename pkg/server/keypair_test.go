@@ -0,0 +1,125 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestKeyPair writes a self-signed certificate for name and its key to
+// dir, dated mod.
+func writeTestKeyPair(t *testing.T, dir, name string, mod time.Time) (certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile, keyFile = filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	for path, block := range map[string]*pem.Block{
+		certFile: {Type: "CERTIFICATE", Bytes: der},
+		keyFile:  {Type: "EC PRIVATE KEY", Bytes: keyDER},
+	} {
+		if err := ioutil.WriteFile(path, pem.EncodeToMemory(block), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mod, mod); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return certFile, keyFile
+}
+
+func commonName(t *testing.T, s *Server, api bool) string {
+	cert, err := s.GetCertificate(api)(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed.Subject.CommonName
+}
+
+func TestGetCertificateReloads(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gangway-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	mod := time.Now().Add(-time.Hour).Truncate(time.Second)
+	certFile, keyFile := writeTestKeyPair(t, dir, "old.example.com", mod)
+	s := newTestServer(t)
+	s.Config().CertFile, s.Config().KeyFile = certFile, keyFile
+	if name := commonName(t, s, false); name != "old.example.com" {
+		t.Fatalf("got certificate for %q, want old.example.com", name)
+	}
+
+	// renewed in place
+	writeTestKeyPair(t, dir, "new.example.com", mod.Add(time.Minute))
+	if name := commonName(t, s, false); name != "new.example.com" {
+		t.Errorf("got certificate for %q after renewal, want new.example.com", name)
+	}
+
+	// moved by a config reload
+	apiDir := filepath.Join(dir, "api")
+	if err := os.Mkdir(apiDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	apiCertFile, apiKeyFile := writeTestKeyPair(t, apiDir, "api.example.com", mod)
+	c := *s.Config()
+	c.APICertFile, c.APIKeyFile = apiCertFile, apiKeyFile
+	c.CertFile, c.KeyFile = apiCertFile, apiKeyFile
+	if err := s.ApplyConfig(&c); err != nil {
+		t.Fatal(err)
+	}
+	if name := commonName(t, s, false); name != "api.example.com" {
+		t.Errorf("got certificate for %q after reload, want api.example.com", name)
+	}
+	if name := commonName(t, s, true); name != "api.example.com" {
+		t.Errorf("got API certificate for %q, want api.example.com", name)
+	}
+
+	os.Remove(apiKeyFile)
+	if _, err := s.GetCertificate(true)(nil); err == nil {
+		t.Error("expected an error for a missing key")
+	}
+}
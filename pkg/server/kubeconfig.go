@@ -0,0 +1,146 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// kubeConfig is a kubeconfig file, with the fields gangway fills in.
+type kubeConfig struct {
+	APIVersion     string             `yaml:"apiVersion"`
+	Kind           string             `yaml:"kind"`
+	Clusters       []kubeNamedCluster `yaml:"clusters"`
+	Users          []kubeNamedUser    `yaml:"users"`
+	Contexts       []kubeNamedContext `yaml:"contexts"`
+	CurrentContext string             `yaml:"current-context"`
+}
+
+type kubeNamedCluster struct {
+	Name    string      `yaml:"name"`
+	Cluster kubeCluster `yaml:"cluster"`
+}
+
+type kubeCluster struct {
+	Server                   string `yaml:"server"`
+	CertificateAuthorityData string `yaml:"certificate-authority-data,omitempty"`
+}
+
+type kubeNamedUser struct {
+	Name string   `yaml:"name"`
+	User kubeUser `yaml:"user"`
+}
+
+type kubeUser struct {
+	AuthProvider *kubeAuthProvider `yaml:"auth-provider,omitempty"`
+	Exec         *kubeExec         `yaml:"exec,omitempty"`
+}
+
+type kubeAuthProvider struct {
+	Name   string            `yaml:"name"`
+	Config map[string]string `yaml:"config"`
+}
+
+type kubeExec struct {
+	APIVersion string   `yaml:"apiVersion"`
+	Command    string   `yaml:"command"`
+	Args       []string `yaml:"args"`
+}
+
+type kubeNamedContext struct {
+	Name    string      `yaml:"name"`
+	Context kubeContext `yaml:"context"`
+}
+
+type kubeContext struct {
+	Cluster string `yaml:"cluster"`
+	User    string `yaml:"user"`
+}
+
+// kubeconfigName returns the name of the kubeconfig user and context for a
+// user with the given usernameClaim value: the username the API server sees,
+// with oidcUsernamePrefix applied, at the cluster. The claim value stands in
+// when that username is unknown.
+func kubeconfigName(username, kubeUsername, clusterName string) string {
+	if kubeUsername != "" {
+		username = kubeUsername
+	}
+	return username + "@" + clusterName
+}
+
+// kubeConfigFor returns the kubeconfig that the commands on the commandline
+// page would set up for info.
+func kubeConfigFor(info *userInfo) *kubeConfig {
+	name := info.KubeconfigName
+	var u kubeUser
+	if info.Exec != nil {
+		u.Exec = &kubeExec{APIVersion: info.Exec.APIVersion, Command: info.Exec.Command, Args: info.Exec.Args}
+	} else {
+		authConfig := map[string]string{
+			"idp-issuer-url": info.IssuerURL,
+			"client-id":      info.ClientID,
+			"refresh-token":  info.RefreshToken,
+			"id-token":       info.IDToken,
+		}
+		if info.ClientSecret != "" {
+			authConfig["client-secret"] = info.ClientSecret
+		}
+		u.AuthProvider = &kubeAuthProvider{Name: "oidc", Config: authConfig}
+	}
+	cluster := kubeCluster{Server: info.APIServerURL}
+	if info.ClusterCA != "" {
+		cluster.CertificateAuthorityData = base64.StdEncoding.EncodeToString([]byte(info.ClusterCA))
+	}
+	return &kubeConfig{
+		APIVersion:     "v1",
+		Kind:           "Config",
+		Clusters:       []kubeNamedCluster{{Name: info.ClusterName, Cluster: cluster}},
+		Users:          []kubeNamedUser{{Name: name, User: u}},
+		Contexts:       []kubeNamedContext{{Name: name, Context: kubeContext{Cluster: info.ClusterName, User: name}}},
+		CurrentContext: name,
+	}
+}
+
+// kubeconfigHandler serves the signed in user's kubeconfig as a download.
+func (a *app) kubeconfigHandler(w http.ResponseWriter, r *http.Request) {
+	info := a.generateInfo(w, r)
+	if info == nil {
+		return
+	}
+	var data []byte
+	if tmpl := a.customTemplate("kubeconfig"); tmpl != nil {
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, info); err != nil {
+			log.Errorf("Failed to render the kubeconfig template: %s", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		data = buf.Bytes()
+	} else {
+		var err error
+		if data, err = yaml.Marshal(kubeConfigFor(info)); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/yaml; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="kubeconfig"`)
+	w.Write(data)
+}
@@ -0,0 +1,109 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/base64"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestKubeConfigFor(t *testing.T) {
+	info := &userInfo{
+		ClusterName:    "prod",
+		Username:       "jane",
+		KubeconfigName: "jane@prod",
+		IDToken:        "the-id-token",
+		RefreshToken:   "the-refresh-token",
+		ClientID:       "gangway",
+		IssuerURL:      "https://idp.example.com",
+		APIServerURL:   "https://api.prod.example.com",
+		ClusterCA:      "-----BEGIN CERTIFICATE-----\n",
+	}
+	data, err := yaml.Marshal(kubeConfigFor(info))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var c kubeConfig
+	if err := yaml.Unmarshal(data, &c); err != nil {
+		t.Fatal(err)
+	}
+
+	if c.CurrentContext != "jane@prod" || len(c.Contexts) != 1 || c.Contexts[0].Name != "jane@prod" ||
+		c.Contexts[0].Context.Cluster != "prod" || c.Contexts[0].Context.User != "jane@prod" {
+		t.Errorf("got contexts %+v, current %q", c.Contexts, c.CurrentContext)
+	}
+	if len(c.Clusters) != 1 || c.Clusters[0].Cluster.Server != info.APIServerURL ||
+		c.Clusters[0].Cluster.CertificateAuthorityData != base64.StdEncoding.EncodeToString([]byte(info.ClusterCA)) {
+		t.Errorf("got clusters %+v", c.Clusters)
+	}
+	if len(c.Users) != 1 || c.Users[0].Name != "jane@prod" {
+		t.Fatalf("got users %+v", c.Users)
+	}
+	if c.Users[0].User.AuthProvider == nil || c.Users[0].User.Exec != nil {
+		t.Fatalf("got user %+v, want the oidc auth provider", c.Users[0].User)
+	}
+	config := c.Users[0].User.AuthProvider.Config
+	for key, want := range map[string]string{"id-token": "the-id-token", "refresh-token": "the-refresh-token", "idp-issuer-url": info.IssuerURL, "client-id": "gangway"} {
+		if config[key] != want {
+			t.Errorf("got %s %q, want %q", key, config[key], want)
+		}
+	}
+	// a public client has no secret to give kubectl
+	if _, ok := config["client-secret"]; ok {
+		t.Errorf("kubeconfig has a client secret for a public client")
+	}
+}
+
+func TestKubeConfigUsernamePrefix(t *testing.T) {
+	a := newTestApp(t)
+	a.cfg.ClientSecret = "secret"
+	a.cfg.ClusterName = "prod"
+	a.cfg.UsernameClaim = "preferred_username"
+	a.cfg.EmailClaim = "email"
+	idToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"preferred_username": "jane",
+		"email":              "jane@example.com",
+		"iss":                "https://idp.example.com",
+	}).SignedString([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		prefix, want string
+	}{
+		{"", "jane@prod"},
+		{"-", "jane@prod"},
+		{"oidc:", "oidc:jane@prod"},
+	} {
+		a.cfg.OIDCUsernamePrefix = tc.prefix
+		rr := httptest.NewRecorder()
+		info := a.tokenInfo(rr, httptest.NewRequest("GET", "/kubeconf", nil), idToken, "", nil)
+		if info == nil {
+			t.Fatalf("prefix %q: no user info: %d %s", tc.prefix, rr.Code, rr.Body)
+		}
+		c := kubeConfigFor(info)
+		if len(c.Users) != 1 || c.Users[0].Name != tc.want {
+			t.Errorf("prefix %q: got users %+v, want %q", tc.prefix, c.Users, tc.want)
+		}
+		if len(c.Contexts) != 1 || c.Contexts[0].Name != tc.want || c.Contexts[0].Context.User != tc.want || c.CurrentContext != tc.want {
+			t.Errorf("prefix %q: got contexts %+v, current %q, want %q", tc.prefix, c.Contexts, c.CurrentContext, tc.want)
+		}
+	}
+}
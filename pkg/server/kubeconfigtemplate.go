@@ -0,0 +1,64 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"text/template"
+)
+
+// loadKubeconfigTemplate parses an operator's template for the kubeconfig
+// download and the kubectl commands. It defines a "kubeconfig" template, a
+// "commands" template or both, which replace gangway's own and are executed
+// with the userInfo of the signed in user.
+func loadKubeconfigTemplate(path string) (*template.Template, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading kubeconfigTemplatePath: %v", err)
+	}
+	tmpl, err := template.New(path).Funcs(templateFuncs).Parse(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("parsing kubeconfigTemplatePath: %v", err)
+	}
+	if tmpl.Lookup("kubeconfig") == nil && tmpl.Lookup("commands") == nil {
+		return nil, fmt.Errorf("kubeconfigTemplatePath %s defines neither a kubeconfig nor a commands template", path)
+	}
+	return tmpl, nil
+}
+
+// customTemplate returns the operator's template called name, or nil to use
+// gangway's own.
+func (a *app) customTemplate(name string) *template.Template {
+	if a.kubeconfigTmpl == nil {
+		return nil
+	}
+	return a.kubeconfigTmpl.Lookup(name)
+}
+
+// customCommands renders the operator's kubectl commands for info, or
+// returns "" if there is no commands template.
+func (a *app) customCommands(info *userInfo) (string, error) {
+	tmpl := a.customTemplate("commands")
+	if tmpl == nil {
+		return "", nil
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, info); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,94 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestKubeconfigTemplate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gangway")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "kubeconfig.tmpl")
+
+	if _, err := loadKubeconfigTemplate(path); err == nil {
+		t.Errorf("expected an error for a missing template")
+	}
+	if err := ioutil.WriteFile(path, []byte("apiVersion: v1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadKubeconfigTemplate(path); err == nil {
+		t.Errorf("expected an error for a template that defines neither kubeconfig nor commands")
+	}
+
+	const custom = `{{ define "kubeconfig" }}clusters:
+- name: {{ .ClusterName }}
+  cluster:
+    certificate-authority-data: {{ .ClusterCAData }}
+contexts:
+- name: {{ .ClusterName }}
+  context:
+    namespace: {{ index .Claims "team" }}
+{{ end }}`
+	if err := ioutil.WriteFile(path, []byte(custom), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tmpl, err := loadKubeconfigTemplate(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := newTestApp(t)
+	a.kubeconfigTmpl = tmpl
+	info := &userInfo{
+		ClusterName:   "prod",
+		ClusterCAData: "Q0EK",
+		Claims:        map[string]interface{}{"team": "payments"},
+	}
+
+	var buf bytes.Buffer
+	if err := a.customTemplate("kubeconfig").Execute(&buf, info); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"name: prod", "certificate-authority-data: Q0EK", "namespace: payments"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("kubeconfig is missing %q:\n%s", want, buf.String())
+		}
+	}
+
+	// without a commands template, the page keeps gangway's own commands
+	if commands, err := a.customCommands(info); err != nil || commands != "" {
+		t.Errorf("got commands %q, %v, want none", commands, err)
+	}
+	if err := ioutil.WriteFile(path, []byte(`{{ define "commands" }}kubectl config use-context {{ .ClusterName }}-{{ index .Claims "team" }}{{ end }}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if a.kubeconfigTmpl, err = loadKubeconfigTemplate(path); err != nil {
+		t.Fatal(err)
+	}
+	if commands, err := a.customCommands(info); err != nil || commands != "kubectl config use-context prod-payments" {
+		t.Errorf("got commands %q, %v", commands, err)
+	}
+	if a.customTemplate("kubeconfig") != nil {
+		t.Errorf("expected the generated kubeconfig without a kubeconfig template")
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// noOIDCPrefix is how --oidc-username-prefix turns off prefixing.
+const noOIDCPrefix = "-"
+
+// kubernetesUsername returns the username the API server sees for a user
+// with the given usernameClaim value, with Config.OIDCUsernamePrefix
+// applied.
+func (c *Config) kubernetesUsername(username string) string {
+	if c.OIDCUsernamePrefix == noOIDCPrefix {
+		return username
+	}
+	return c.OIDCUsernamePrefix + username
+}
+
+// kubernetesGroups returns the groups the API server sees, with
+// Config.OIDCGroupsPrefix applied.
+func (c *Config) kubernetesGroups(groups []string) []string {
+	if c.OIDCGroupsPrefix == "" || len(groups) == 0 {
+		return groups
+	}
+	prefixed := make([]string, len(groups))
+	for i, group := range groups {
+		prefixed[i] = c.OIDCGroupsPrefix + group
+	}
+	return prefixed
+}
+
+// checkOIDCPrefixes warns about prefix settings that are unlikely to match
+// the API server's, as identities shown then won't match RBAC subjects.
+func (c *Config) checkOIDCPrefixes() {
+	// the API server prefixes usernames from any claim but email with the
+	// issuer unless told otherwise
+	if c.OIDCUsernamePrefix == "" && c.UsernameClaim != "email" && c.IssuerURL != "" {
+		log.Warnf("oidcUsernamePrefix is unset, but unless the API server runs with --oidc-username-prefix, it sees users as %s#<%s>; set oidcUsernamePrefix to the flag's value, or to %q if it is %q",
+			c.IssuerURL, c.UsernameClaim, noOIDCPrefix, noOIDCPrefix)
+	}
+	if strings.HasPrefix(c.OIDCUsernamePrefix, "system:") || strings.HasPrefix(c.OIDCGroupsPrefix, "system:") {
+		log.Warnf("OIDC prefixes starting with system: make users and groups look like Kubernetes' own, which RBAC treats specially")
+	}
+}
+
+// identityMapping describes how the API server derives usernames and groups
+// from ID token claims, so that users can see how theirs come about.
+type identityMapping struct {
+	// Source says where the API server's mapping is configured.
+	Source         string
+	UsernameClaim  string
+	UsernamePrefix string
+	// GroupsClaim is empty if the API server doesn't map groups.
+	GroupsClaim  string
+	GroupsPrefix string
+}
+
+// identityMapping returns how the API server maps claims to identities, or
+// nil if its authentication config uses expressions gangway can't evaluate.
+func (a *app) identityMapping() *identityMapping {
+	if a.authn != nil {
+		return a.authn.identityMapping()
+	}
+	m := &identityMapping{
+		Source:         "the API server's --oidc flags",
+		UsernameClaim:  a.cfg.UsernameClaim,
+		UsernamePrefix: a.cfg.OIDCUsernamePrefix,
+		GroupsClaim:    a.cfg.groupsClaim(),
+		GroupsPrefix:   a.cfg.OIDCGroupsPrefix,
+	}
+	if m.UsernamePrefix == noOIDCPrefix {
+		m.UsernamePrefix = ""
+	}
+	return m
+}
@@ -0,0 +1,110 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestOIDCPrefixes(t *testing.T) {
+	tests := []struct {
+		usernamePrefix string
+		groupsPrefix   string
+		username       string
+		groups         []string
+	}{
+		{"", "", "jane", []string{"dev"}},
+		{"-", "", "jane", []string{"dev"}},
+		{"oidc:", "oidc:", "oidc:jane", []string{"oidc:dev"}},
+		{"https://idp.example.com#", "", "https://idp.example.com#jane", []string{"dev"}},
+	}
+	for _, tt := range tests {
+		c := &Config{OIDCUsernamePrefix: tt.usernamePrefix, OIDCGroupsPrefix: tt.groupsPrefix}
+		if got := c.kubernetesUsername("jane"); got != tt.username {
+			t.Errorf("prefix %q: got username %q, want %q", tt.usernamePrefix, got, tt.username)
+		}
+		if got := c.kubernetesGroups([]string{"dev"}); !reflect.DeepEqual(got, tt.groups) {
+			t.Errorf("prefix %q: got groups %v, want %v", tt.groupsPrefix, got, tt.groups)
+		}
+	}
+}
+
+func TestCommandlinePrefixedIdentity(t *testing.T) {
+	rr := httptest.NewRecorder()
+	serveTemplate("commandline.tmpl", &userInfo{
+		Username:           "jane",
+		Groups:             []string{"dev"},
+		KubernetesUsername: "oidc:jane",
+		KubernetesGroups:   []string{"oidc:dev"},
+		IdentityMapping: &identityMapping{
+			Source:         "the API server's --oidc flags",
+			UsernameClaim:  "email",
+			UsernamePrefix: "oidc:",
+			GroupsClaim:    "groups",
+			GroupsPrefix:   "oidc:",
+		},
+	}, rr)
+	body := rr.Body.String()
+	for _, want := range []string{
+		"<code>oidc:jane</code>",
+		"<code>oidc:dev</code>",
+		"the email claim, prefixed with <code>oidc:</code>",
+		"the groups claim, prefixed with <code>oidc:</code>",
+		"As mapped by the API server&#39;s --oidc flags.",
+		"--user='oidc:jane'",
+		"--group='oidc:dev'",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("commandline page does not contain %q", want)
+		}
+	}
+}
+
+func TestIdentityMapping(t *testing.T) {
+	a := &app{cfg: &Config{UsernameClaim: "email", OIDCUsernamePrefix: "-", OIDCGroupsPrefix: "oidc:"}}
+	want := &identityMapping{
+		Source:        "the API server's --oidc flags",
+		UsernameClaim: "email",
+		GroupsClaim:   defaultGroupsClaim,
+		GroupsPrefix:  "oidc:",
+	}
+	if got := a.identityMapping(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got mapping %+v, want %+v", got, want)
+	}
+
+	prefix := "sso:"
+	a.authn = &jwtAuthenticator{ClaimMappings: claimMappings{
+		Username: prefixedClaimOrExpression{Claim: "sub", Prefix: &prefix},
+		Groups:   prefixedClaimOrExpression{Expression: `"team:" + claims.teams`},
+	}}
+	want = &identityMapping{
+		Source:         "the API server's authentication config",
+		UsernameClaim:  "sub",
+		UsernamePrefix: "sso:",
+		GroupsClaim:    "teams",
+		GroupsPrefix:   "team:",
+	}
+	if got := a.identityMapping(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got mapping %+v, want %+v", got, want)
+	}
+
+	a.authn.ClaimMappings.Groups = prefixedClaimOrExpression{Expression: "claims.teams.map(t, t.name)"}
+	if got := a.identityMapping(); got != nil {
+		t.Errorf("got mapping %+v for an expression", got)
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/securecookie"
+)
+
+// loginHistoryTTL is how long a user's login history is kept after their
+// last login. It matches the session max age, as the session codecs reject
+// anything older.
+const loginHistoryTTL = 30 * 24 * time.Hour
+
+// loginHistoryName is used in place of a cookie name when encoding login
+// histories with the session codecs.
+const loginHistoryName = "gangway-login-history"
+
+// loginRecord is one login shown in a user's login history.
+type loginRecord struct {
+	Time      time.Time
+	IP        string
+	UserAgent string
+}
+
+// loginHistoryKey returns the backend key of user's login history. It can't
+// collide with session keys, which are hashes of random IDs.
+func loginHistoryKey(user string) string {
+	return backendKey("login-history/" + user)
+}
+
+// loginHistory returns user's most recent logins, latest first.
+func (s *serverSideStore) loginHistory(user string) ([]loginRecord, error) {
+	data, ok, err := s.backend.load(loginHistoryKey(user))
+	if err != nil || !ok {
+		return nil, err
+	}
+	var records []loginRecord
+	if err := securecookie.DecodeMulti(loginHistoryName, data, &records, s.Codecs...); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// recordLogin adds rec to user's login history, keeping the latest keep
+// records. Concurrent logins of the same user may lose one of the records.
+func (s *serverSideStore) recordLogin(user string, rec loginRecord, keep int) error {
+	records, err := s.loginHistory(user)
+	if err != nil {
+		// unreadable after a key rotation; start over
+		records = nil
+	}
+	records = append([]loginRecord{rec}, records...)
+	if len(records) > keep {
+		records = records[:keep]
+	}
+	data, err := securecookie.EncodeMulti(loginHistoryName, records, s.Codecs...)
+	if err != nil {
+		return err
+	}
+	return s.backend.save(loginHistoryKey(user), data, rec.Time.Add(loginHistoryTTL))
+}
+
+// loginHistoryStore returns where login histories are kept, or nil if they
+// aren't. They need a server-side session store and Config.LoginHistory.
+func (a *app) loginHistoryStore() *serverSideStore {
+	if a.cfg.LoginHistory <= 0 {
+		return nil
+	}
+	s, _ := a.sessionStore.(*serverSideStore)
+	return s
+}
+
+// recordLogin adds the login r completes to user's login history.
+func (a *app) recordLogin(r *http.Request, user string, now time.Time) {
+	s := a.loginHistoryStore()
+	if s == nil || user == "" {
+		return
+	}
+	rec := loginRecord{Time: now.UTC(), IP: clientAddr(r), UserAgent: r.UserAgent()}
+	if err := s.recordLogin(user, rec, a.cfg.LoginHistory); err != nil {
+		requestLog(r).Warnf("Could not record login: %s", err)
+	}
+}
+
+// recentLogins returns user's login history, for the commandline page.
+func (a *app) recentLogins(r *http.Request, user string) []loginRecord {
+	s := a.loginHistoryStore()
+	if s == nil {
+		return nil
+	}
+	records, err := s.loginHistory(user)
+	if err != nil {
+		requestLog(r).Warnf("Could not read login history: %s", err)
+	}
+	return records
+}
@@ -0,0 +1,65 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoginHistory(t *testing.T) {
+	a := newTestApp(t)
+	req := httptest.NewRequest("GET", "/callback", nil)
+	req.Header.Set("User-Agent", "<curl>")
+
+	// cookie sessions have nowhere to keep the history
+	a.cfg.LoginHistory = 2
+	a.recordLogin(req, "jane", time.Now())
+	if got := a.recentLogins(req, "jane"); got != nil {
+		t.Errorf("got login history %v without a server-side store", got)
+	}
+
+	hashKey, blockKey := deriveSessionKeys("test")
+	backend := newFakeSessions()
+	a.sessionStore = newServerSideStore(backend, "fake", hashKey, blockKey)
+	start := time.Now().UTC().Add(-3 * time.Hour)
+	for i := 0; i < 3; i++ {
+		a.recordLogin(req, "jane", start.Add(time.Duration(i)*time.Hour))
+	}
+	a.recordLogin(req, "joe", start)
+
+	got := a.recentLogins(req, "jane")
+	if len(got) != 2 || !got[0].Time.Equal(start.Add(2*time.Hour)) || !got[1].Time.Equal(start.Add(time.Hour)) {
+		t.Fatalf("got login history %v, want the latest 2 logins latest first", got)
+	}
+	if got[0].IP != "192.0.2.1" || got[0].UserAgent != "<curl>" {
+		t.Errorf("got login record %+v", got[0])
+	}
+	for key := range backend.data {
+		if strings.Contains(key, "jane") {
+			t.Errorf("login history is stored under the plain user name")
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	serveTemplate("commandline.tmpl", &userInfo{RecentLogins: got}, rr)
+	for _, want := range []string{start.Add(2 * time.Hour).Format("2006-01-02 15:04:05"), "192.0.2.1", "&lt;curl&gt;"} {
+		if !strings.Contains(rr.Body.String(), want) {
+			t.Errorf("commandline page does not contain %q", want)
+		}
+	}
+}
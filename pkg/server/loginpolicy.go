@@ -0,0 +1,94 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/oauth2"
+)
+
+// checkLoginPolicy returns why the user of token may not get credentials
+// from gangway, or "" if they may. It applies AllowedEmailDomains,
+// RequireEmailVerified and AllowedGroups on top of whatever the identity
+// provider lets sign in. groups are those fetched from the provider for an
+// ID token without any, and groupsErr why fetching them failed, if it did.
+func (a *app) checkLoginPolicy(token *oauth2.Token, groups []string, groupsErr error) string {
+	c := a.cfg
+	if len(c.AllowedEmailDomains) == 0 && !c.RequireEmailVerified && len(c.AllowedGroups) == 0 {
+		return ""
+	}
+	idToken, _ := token.Extra("id_token").(string)
+	claims := a.idTokenClaims(idToken)
+	if claims == nil {
+		return "the ID token could not be read"
+	}
+
+	email, _ := claims[c.EmailClaim].(string)
+	if len(c.AllowedEmailDomains) > 0 {
+		domain := ""
+		if at := strings.LastIndex(email, "@"); at >= 0 {
+			domain = email[at+1:]
+		}
+		if !containsFold(c.AllowedEmailDomains, domain) {
+			return fmt.Sprintf("email addresses at %q are not allowed", domain)
+		}
+	}
+	if c.RequireEmailVerified {
+		// some providers send the claim as a string
+		switch verified := claims["email_verified"]; verified {
+		case true, "true":
+		default:
+			return fmt.Sprintf("the email address %q is not verified", email)
+		}
+	}
+	if len(c.AllowedGroups) > 0 {
+		if claimGroups := claimStrings(claims, c.groupsClaim()); len(claimGroups) > 0 {
+			groups = claimGroups
+		} else if groupsErr != nil {
+			// not knowing the groups mustn't let anyone in, even when
+			// the claim is optional
+			return "your groups could not be fetched from the identity provider"
+		}
+		// without the claim they get a kubeconfig the cluster grants little
+		allowed := len(groups) == 0 && c.claimOptional(c.groupsClaim())
+		for _, group := range groups {
+			if containsString(c.AllowedGroups, group) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return "you are not in any of the groups allowed to use this cluster"
+		}
+	}
+	return ""
+}
+
+// claimOptional reports whether users may get credentials without the claim
+// name, per OptionalClaims.
+func (c *Config) claimOptional(name string) bool {
+	return containsString(c.OptionalClaims, name)
+}
+
+func containsFold(values []string, s string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
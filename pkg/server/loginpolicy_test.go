@@ -0,0 +1,121 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"golang.org/x/oauth2"
+)
+
+func TestLoginPolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		domains  []string
+		verified bool
+		groups   []string
+		claims   jwt.MapClaims
+		fetched  []string
+		allowed  bool
+		optional []string
+	}{
+		{"no policy", nil, false, nil, jwt.MapClaims{"email": "jane@contractor.example"}, nil, true, nil},
+		{"allowed domain", []string{"example.com"}, false, nil, jwt.MapClaims{"email": "jane@Example.com"}, nil, true, nil},
+		{"other domain", []string{"example.com"}, false, nil, jwt.MapClaims{"email": "jane@contractor.example"}, nil, false, nil},
+		{"subdomain", []string{"example.com"}, false, nil, jwt.MapClaims{"email": "jane@evil.example.com"}, nil, false, nil},
+		{"no email", []string{"example.com"}, false, nil, jwt.MapClaims{}, nil, false, nil},
+		{"verified", nil, true, nil, jwt.MapClaims{"email": "jane@example.com", "email_verified": true}, nil, true, nil},
+		{"verified as a string", nil, true, nil, jwt.MapClaims{"email": "jane@example.com", "email_verified": "true"}, nil, true, nil},
+		{"unverified", nil, true, nil, jwt.MapClaims{"email": "jane@example.com", "email_verified": false}, nil, false, nil},
+		{"allowed group", nil, false, []string{"platform"}, jwt.MapClaims{"groups": []string{"dev", "platform"}}, nil, true, nil},
+		{"other groups", nil, false, []string{"platform"}, jwt.MapClaims{"groups": []string{"dev"}}, nil, false, nil},
+		{"fetched group", nil, false, []string{"platform"}, jwt.MapClaims{}, []string{"platform"}, true, nil},
+		{"no groups", nil, false, []string{"platform"}, jwt.MapClaims{}, nil, false, nil},
+		{"optional groups", nil, false, []string{"platform"}, jwt.MapClaims{}, nil, true, []string{"groups"}},
+		{"optional groups, other groups", nil, false, []string{"platform"}, jwt.MapClaims{"groups": []string{"dev"}}, nil, false, []string{"groups"}},
+	}
+	for _, tc := range tests {
+		a := newTestApp(t)
+		a.cfg.ClientSecret = "secret"
+		a.cfg.EmailClaim = "email"
+		a.cfg.AllowedEmailDomains = tc.domains
+		a.cfg.RequireEmailVerified = tc.verified
+		a.cfg.AllowedGroups = tc.groups
+		a.cfg.OptionalClaims = tc.optional
+		idToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, tc.claims).SignedString([]byte("secret"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		token := (&oauth2.Token{}).WithExtra(map[string]interface{}{"id_token": idToken})
+		if reason := a.checkLoginPolicy(token, tc.fetched, nil); (reason == "") != tc.allowed {
+			t.Errorf("%s: got reason %q, want allowed %v", tc.name, reason, tc.allowed)
+		}
+	}
+}
+
+func TestLoginPolicyGroupsFetchFailed(t *testing.T) {
+	a := newTestApp(t)
+	a.cfg.ClientSecret = "secret"
+	a.cfg.OptionalClaims = []string{"groups"}
+	idToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{}).SignedString([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := (&oauth2.Token{}).WithExtra(map[string]interface{}{"id_token": idToken})
+	fetchErr := errors.New("connection refused")
+
+	if reason := a.checkLoginPolicy(token, nil, fetchErr); reason != "" {
+		t.Errorf("got reason %q without allowedGroups", reason)
+	}
+	a.cfg.AllowedGroups = []string{"platform"}
+	if reason := a.checkLoginPolicy(token, nil, fetchErr); !strings.Contains(reason, "could not be fetched") {
+		t.Errorf("got reason %q, want the login refused for the failed group fetch", reason)
+	}
+}
+
+func TestOptionalClaims(t *testing.T) {
+	a := newTestApp(t)
+	a.cfg.ClientSecret = "secret"
+	a.cfg.UsernameClaim = "sub"
+	a.cfg.EmailClaim = "email"
+	idToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "jane", "iss": "https://idp.example.com"}).SignedString([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	if info := a.tokenInfo(rr, httptest.NewRequest("GET", "/commandline", nil), idToken, "", nil); info != nil {
+		t.Fatalf("expected a missing email claim to fail by default")
+	}
+
+	a.cfg.OptionalClaims = []string{"email", "groups"}
+	info := a.tokenInfo(httptest.NewRecorder(), httptest.NewRequest("GET", "/commandline", nil), idToken, "", nil)
+	if info == nil {
+		t.Fatalf("expected credentials without the optional claims")
+	}
+	if len(info.ClaimWarnings) != 2 || !strings.Contains(info.ClaimWarnings[0], "email") || !strings.Contains(info.ClaimWarnings[1], "groups") {
+		t.Errorf("got warnings %q", info.ClaimWarnings)
+	}
+
+	rr = httptest.NewRecorder()
+	serveTemplate("commandline.tmpl", info, rr)
+	if !strings.Contains(rr.Body.String(), `id="claim-warnings"`) {
+		t.Errorf("commandline page does not show the warnings")
+	}
+}
@@ -0,0 +1,39 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// checkLoginSelection checks the cluster and provider query parameters of
+// /login, which deep links from runbooks use to say which credentials they
+// expect, against what this gangway issues. It returns why they don't match,
+// or "" if they do or weren't given. Each gangway serves one cluster through
+// one identity provider, so a mismatch means the link points at the wrong
+// gangway.
+func (a *app) checkLoginSelection(r *http.Request) string {
+	query := r.URL.Query()
+	if cluster := query.Get("cluster"); cluster != "" && cluster != a.cfg.ClusterName {
+		return fmt.Sprintf("This gangway issues credentials for cluster %q, not %q.", a.cfg.ClusterName, cluster)
+	}
+	// without a provider in the config there is nothing to compare with
+	if provider := query.Get("provider"); provider != "" && a.cfg.Provider != "" && !strings.EqualFold(provider, a.cfg.Provider) {
+		return fmt.Sprintf("This gangway signs in through %s, not %s.", a.cfg.Provider, provider)
+	}
+	return ""
+}
@@ -0,0 +1,58 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLoginSelection(t *testing.T) {
+	a := newTestApp(t)
+	a.cfg.ClusterName = "prod-eu"
+	a.cfg.Provider = "okta"
+
+	tests := []struct {
+		query  string
+		status int
+		want   string
+	}{
+		{"", http.StatusTemporaryRedirect, ""},
+		{"?cluster=prod-eu&provider=okta", http.StatusTemporaryRedirect, ""},
+		{"?provider=Okta", http.StatusTemporaryRedirect, ""},
+		{"?cluster=prod-us", http.StatusBadRequest, `cluster &#34;prod-eu&#34;, not &#34;prod-us&#34;`},
+		{"?cluster=prod-eu&provider=google", http.StatusBadRequest, "through okta, not google"},
+	}
+	for _, tc := range tests {
+		rr := httptest.NewRecorder()
+		a.loginHandler(rr, httptest.NewRequest("GET", "/login"+tc.query, nil))
+		if rr.Code != tc.status {
+			t.Errorf("/login%s: got status %d, want %d", tc.query, rr.Code, tc.status)
+		}
+		if tc.want != "" && !strings.Contains(rr.Body.String(), tc.want) {
+			t.Errorf("/login%s: page does not explain %q", tc.query, tc.want)
+		}
+	}
+
+	// any provider goes when the config names none
+	a.cfg.Provider = ""
+	rr := httptest.NewRecorder()
+	a.loginHandler(rr, httptest.NewRequest("GET", "/login?provider=google", nil))
+	if rr.Code != http.StatusTemporaryRedirect {
+		t.Errorf("got status %d without a configured provider, want %d", rr.Code, http.StatusTemporaryRedirect)
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/gob"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+const (
+	defaultLoginStateTTL = 10 * time.Minute
+
+	loginStateStoreSession = "session"
+	loginStateStoreMemory  = "memory"
+)
+
+// loginState holds the artifacts of a single login attempt, from /login until
+// the identity provider redirects back to /callback.
+type loginState struct {
+	ReturnTo string
+	Expires  time.Time
+	// CodeVerifier is the PKCE code verifier, if PKCE is used.
+	CodeVerifier string
+	// Nonce is sent with the authorization request and has to come back in
+	// the ID token.
+	Nonce string
+	// Standby is set when the login went to the standby identity provider,
+	// which then has to redeem the code.
+	Standby bool
+	// Transcript is the ID of the login's transcript, if one is recorded.
+	Transcript string
+}
+
+func init() {
+	gob.Register(&loginState{})
+}
+
+// loginStateStore keeps login states keyed by the OAuth2 state parameter. The
+// state itself is always kept in the user's session, which binds the login to
+// the browser that started it; the store only holds what goes with it.
+type loginStateStore interface {
+	// save stores ls for state. Session-backed stores write it into session,
+	// which the caller saves.
+	save(session *sessions.Session, state string, ls *loginState)
+	// take removes and returns the login state for state, if there is one
+	// that has not expired.
+	take(session *sessions.Session, state string) (*loginState, bool)
+}
+
+// loginStateCounters counts what happens to login states, across stores.
+type loginStateCounters struct {
+	saved   int64
+	taken   int64
+	expired int64
+}
+
+func (a *app) newLoginState(returnTo string) *loginState {
+	ttl := a.cfg.LoginStateTTL
+	if ttl <= 0 {
+		ttl = defaultLoginStateTTL
+	}
+	return &loginState{ReturnTo: returnTo, Expires: time.Now().Add(ttl)}
+}
+
+// newLoginStateStore returns the login state store for c. An in-memory store
+// in previous is kept so that config reloads don't drop logins in flight.
+func newLoginStateStore(c *Config, previous loginStateStore, metrics *loginStateCounters) loginStateStore {
+	switch c.LoginStateStore {
+	case loginStateStoreMemory:
+		if m, ok := previous.(*memoryLoginStates); ok {
+			return m
+		}
+		return newMemoryLoginStates(metrics)
+	default:
+		return sessionLoginStates{metrics: metrics}
+	}
+}
+
+// sessionLoginStates keeps the login state in the session cookie. It needs no
+// shared storage between replicas, at the cost of a larger cookie.
+type sessionLoginStates struct {
+	metrics *loginStateCounters
+}
+
+func (s sessionLoginStates) save(session *sessions.Session, state string, ls *loginState) {
+	session.Values["login_state"] = ls
+	atomic.AddInt64(&s.metrics.saved, 1)
+}
+
+func (s sessionLoginStates) take(session *sessions.Session, state string) (*loginState, bool) {
+	ls, ok := session.Values["login_state"].(*loginState)
+	delete(session.Values, "login_state")
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(ls.Expires) {
+		atomic.AddInt64(&s.metrics.expired, 1)
+		return nil, false
+	}
+	atomic.AddInt64(&s.metrics.taken, 1)
+	return ls, true
+}
+
+// memoryLoginStates keeps login states in process memory, so only the state
+// parameter travels in the cookie. Logins must finish on the replica that
+// started them. Expired states are removed by the janitor.
+type memoryLoginStates struct {
+	mu      sync.Mutex
+	states  map[string]*loginState
+	metrics *loginStateCounters
+}
+
+func newMemoryLoginStates(metrics *loginStateCounters) *memoryLoginStates {
+	return &memoryLoginStates{states: map[string]*loginState{}, metrics: metrics}
+}
+
+func (m *memoryLoginStates) save(session *sessions.Session, state string, ls *loginState) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.states[state] = ls
+	atomic.AddInt64(&m.metrics.saved, 1)
+}
+
+func (m *memoryLoginStates) take(session *sessions.Session, state string) (*loginState, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ls, ok := m.states[state]
+	delete(m.states, state)
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(ls.Expires) {
+		atomic.AddInt64(&m.metrics.expired, 1)
+		return nil, false
+	}
+	atomic.AddInt64(&m.metrics.taken, 1)
+	return ls, true
+}
+
+// purgeExpired removes the login states that expired before now.
+func (m *memoryLoginStates) purgeExpired(now time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var n int
+	for state, ls := range m.states {
+		if now.After(ls.Expires) {
+			delete(m.states, state)
+			n++
+		}
+	}
+	atomic.AddInt64(&m.metrics.expired, int64(n))
+	return n, nil
+}
@@ -0,0 +1,65 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+func TestLoginStateStores(t *testing.T) {
+	a := newTestApp(t)
+
+	stores := map[string]loginStateStore{
+		"session": sessionLoginStates{metrics: &loginStateCounters{}},
+		"memory":  newMemoryLoginStates(&loginStateCounters{}),
+	}
+	for name, store := range stores {
+		session := sessions.NewSession(a.sessionStore, "gangway")
+
+		store.save(session, "fresh", &loginState{ReturnTo: "/x", Expires: time.Now().Add(time.Minute)})
+		ls, ok := store.take(session, "fresh")
+		if !ok || ls.ReturnTo != "/x" {
+			t.Errorf("%s: expected to take the saved login state, got %v, %v", name, ls, ok)
+		}
+		if _, ok := store.take(session, "fresh"); ok {
+			t.Errorf("%s: a login state could be taken twice", name)
+		}
+
+		store.save(session, "stale", &loginState{Expires: time.Now().Add(-time.Second)})
+		if _, ok := store.take(session, "stale"); ok {
+			t.Errorf("%s: an expired login state was returned", name)
+		}
+	}
+}
+
+func TestMemoryLoginStatesPurge(t *testing.T) {
+	m := newMemoryLoginStates(&loginStateCounters{})
+	now := time.Now()
+	m.save(nil, "old", &loginState{Expires: now.Add(-time.Minute)})
+	m.save(nil, "new", &loginState{Expires: now.Add(time.Minute)})
+
+	if n, err := m.purgeExpired(now); n != 1 || err != nil {
+		t.Errorf("purgeExpired = %d, %v; want 1, nil", n, err)
+	}
+	if _, ok := m.states["old"]; ok {
+		t.Errorf("expired login state was not collected")
+	}
+	if _, ok := m.states["new"]; !ok {
+		t.Errorf("live login state was collected")
+	}
+}
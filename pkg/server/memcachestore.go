@@ -0,0 +1,82 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+// memcachedRelativeExpiryLimit is the longest expiry memcached accepts in
+// seconds from now. Longer ones must be given as a unix timestamp.
+const memcachedRelativeExpiryLimit = 30 * 24 * 60 * 60
+
+// memcachedSessions is a session backend for memcached. Memcached expires
+// entries by itself, so it needs no purging.
+type memcachedSessions struct {
+	client *memcache.Client
+}
+
+func newMemcachedSessions(servers ...string) *memcachedSessions {
+	return &memcachedSessions{client: memcache.New(servers...)}
+}
+
+func memcachedKey(key string) string {
+	return "gangway_session_" + key
+}
+
+// memcachedExpiration converts expires to memcached's expiration format.
+func memcachedExpiration(expires, now time.Time) int32 {
+	seconds := int64(expires.Sub(now) / time.Second)
+	if seconds > memcachedRelativeExpiryLimit {
+		return int32(expires.Unix())
+	}
+	if seconds < 1 {
+		seconds = 1
+	}
+	return int32(seconds)
+}
+
+func (m *memcachedSessions) load(key string) (string, bool, error) {
+	item, err := m.client.Get(memcachedKey(key))
+	if err == memcache.ErrCacheMiss {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return string(item.Value), true, nil
+}
+
+func (m *memcachedSessions) save(key, data string, expires time.Time) error {
+	return m.client.Set(&memcache.Item{
+		Key:        memcachedKey(key),
+		Value:      []byte(data),
+		Expiration: memcachedExpiration(expires, time.Now()),
+	})
+}
+
+func (m *memcachedSessions) delete(key string) error {
+	err := m.client.Delete(memcachedKey(key))
+	if err == memcache.ErrCacheMiss {
+		return nil
+	}
+	return err
+}
+
+func (m *memcachedSessions) close() error {
+	return nil
+}
@@ -0,0 +1,79 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"sync"
+	"time"
+)
+
+// memorySessions is a session backend that keeps sessions in this process,
+// for single replica installs whose ID tokens are too large for the cookie
+// store. Sessions are lost on restart.
+type memorySessions struct {
+	mu       sync.Mutex
+	sessions map[string]memorySession
+}
+
+type memorySession struct {
+	data    string
+	expires time.Time
+}
+
+func newMemorySessions() *memorySessions {
+	return &memorySessions{sessions: map[string]memorySession{}}
+}
+
+func (m *memorySessions) load(key string) (string, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[key]
+	if !ok || !time.Now().Before(s.expires) {
+		return "", false, nil
+	}
+	return s.data, true, nil
+}
+
+func (m *memorySessions) save(key, data string, expires time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sessions[key] = memorySession{data: data, expires: expires}
+	return nil
+}
+
+func (m *memorySessions) delete(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, key)
+	return nil
+}
+
+func (m *memorySessions) close() error {
+	return nil
+}
+
+// purgeExpired deletes the sessions that expired before now.
+func (m *memorySessions) purgeExpired(now time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for key, s := range m.sessions {
+		if !now.Before(s.expires) {
+			delete(m.sessions, key)
+			n++
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,130 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// metric is a metric family in the Prometheus text exposition format.
+type metric struct {
+	name    string
+	help    string
+	kind    string
+	samples []sample
+}
+
+// sample is a value of a metric, with its labels formatted as in
+// `listener="ui"`. The samples of histograms have a suffix to the name, such
+// as _bucket.
+type sample struct {
+	suffix string
+	labels string
+	value  float64
+}
+
+// writeMetrics writes metrics in the Prometheus text exposition format.
+func writeMetrics(w io.Writer, metrics []metric) {
+	for _, m := range metrics {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+		for _, s := range m.samples {
+			if s.labels == "" {
+				fmt.Fprintf(w, "%s%s %v\n", m.name, s.suffix, s.value)
+				continue
+			}
+			fmt.Fprintf(w, "%s%s{%s} %v\n", m.name, s.suffix, s.labels, s.value)
+		}
+	}
+}
+
+// histogram counts observations into buckets with the given upper bounds, for
+// a Prometheus histogram.
+type histogram struct {
+	mu     sync.Mutex
+	bounds []float64
+	// counts has a count per bucket, not cumulative, and one for the
+	// observations above every bound
+	counts []uint64
+	sum    float64
+}
+
+func newHistogram(bounds ...float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds)+1)}
+}
+
+func (h *histogram) observe(v float64) {
+	i := sort.SearchFloat64s(h.bounds, v)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.counts[i]++
+	h.sum += v
+}
+
+// samples returns the histogram's samples, with labels added to the le label
+// of each bucket.
+func (h *histogram) samples(labels string) []sample {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	prefix := labels
+	if prefix != "" {
+		prefix += ","
+	}
+	var samples []sample
+	var cumulative uint64
+	for i, count := range h.counts {
+		cumulative += count
+		le := "+Inf"
+		if i < len(h.bounds) {
+			le = strconv.FormatFloat(h.bounds[i], 'g', -1, 64)
+		}
+		samples = append(samples, sample{suffix: "_bucket", labels: fmt.Sprintf("%sle=%q", prefix, le), value: float64(cumulative)})
+	}
+	return append(samples,
+		sample{suffix: "_sum", labels: labels, value: h.sum},
+		sample{suffix: "_count", labels: labels, value: float64(cumulative)})
+}
+
+// metrics collects gangway's metrics.
+func (s *Server) metrics() []metric {
+	certExpiry := metric{
+		name: "gangway_serving_certificate_expiry_timestamp_seconds",
+		help: "When the certificate served on a listener expires, in seconds since the epoch.",
+		kind: "gauge",
+	}
+	for _, cert := range s.Config().servingCerts() {
+		// unreadable certificates are logged by WatchCertificates
+		if notAfter, err := certificateExpiry(cert.path); err == nil {
+			certExpiry.samples = append(certExpiry.samples, sample{
+				labels: fmt.Sprintf("listener=%q", cert.listener),
+				value:  float64(notAfter.Unix()),
+			})
+		}
+	}
+	metrics := append([]metric{certExpiry}, s.sessionMetrics.metrics()...)
+	return append(metrics, s.tokenSizes.metrics()...)
+}
+
+// metricsHandler serves gangway's metrics for Prometheus to scrape.
+func (s *Server) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Header().Set("Cache-Control", "no-store")
+	writeMetrics(w, s.metrics())
+}
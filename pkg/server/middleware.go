@@ -0,0 +1,438 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/justinas/alice"
+)
+
+// timeoutHandler returns middleware that runs the next handler with a context
+// deadline of timeout and serves a 504 page if it hasn't finished by then.
+// Like http.TimeoutHandler, the response is buffered so that a handler which
+// finishes late can't write over the error page.
+func (a *app) timeoutHandler(timeout time.Duration) alice.Constructor {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+
+			tw := &timeoutWriter{header: make(http.Header)}
+			done := make(chan struct{})
+			panicChan := make(chan interface{}, 1)
+			go func() {
+				defer func() {
+					if p := recover(); p != nil {
+						panicChan <- p
+					}
+				}()
+				next.ServeHTTP(tw, r.WithContext(ctx))
+				close(done)
+			}()
+
+			select {
+			case p := <-panicChan:
+				panic(p)
+			case <-done:
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+				dst := w.Header()
+				for k, v := range tw.header {
+					dst[k] = v
+				}
+				if tw.code == 0 {
+					tw.code = http.StatusOK
+				}
+				w.WriteHeader(tw.code)
+				w.Write(tw.buf.Bytes())
+			case <-ctx.Done():
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+				tw.timedOut = true
+				requestLog(r).Errorf("%s %s timed out after %s", r.Method, r.URL.Path, timeout)
+				a.serveError(w, r, http.StatusGatewayTimeout, "The request took too long to complete. Please try again.")
+			}
+		})
+	}
+}
+
+type timeoutWriter struct {
+	mu       sync.Mutex
+	header   http.Header
+	buf      bytes.Buffer
+	code     int
+	timedOut bool
+}
+
+func (tw *timeoutWriter) Header() http.Header { return tw.header }
+
+func (tw *timeoutWriter) Write(p []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if tw.code == 0 {
+		tw.code = http.StatusOK
+	}
+	return tw.buf.Write(p)
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut || tw.code != 0 {
+		return
+	}
+	tw.code = code
+}
+
+// loadShedding rejects requests with a 503 once more than
+// Config.MaxInFlightRequests are already being served, so that a login storm
+// can't pile up unbounded work on gangway and the identity provider.
+func (a *app) loadShedding(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit := int64(a.cfg.MaxInFlightRequests)
+		if limit <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		n := atomic.AddInt64(a.inFlight, 1)
+		defer atomic.AddInt64(a.inFlight, -1)
+		if n > limit {
+			retryAfter := int(a.cfg.RetryAfter / time.Second)
+			if retryAfter < 1 {
+				retryAfter = 1
+			}
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			a.serveError(w, r, http.StatusServiceUnavailable, "gangway is handling too many requests right now. Please try again shortly.")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Names of the middleware that can be listed in Config.Middleware.
+const (
+	middlewareLogging         = "logging"
+	middlewareRateLimit       = "rateLimit"
+	middlewareSecurityHeaders = "securityHeaders"
+	middlewareIPFilter        = "ipFilter"
+	middlewareCompression     = "compression"
+)
+
+// middlewares are the middleware that operators can enable and order through
+// the config.
+var middlewares = map[string]func(*app, http.Handler) http.Handler{
+	middlewareLogging:         (*app).requestLogger,
+	middlewareRateLimit:       (*app).rateLimit,
+	middlewareSecurityHeaders: (*app).securityHeaders,
+	middlewareIPFilter:        (*app).ipFilter,
+	middlewareCompression:     (*app).compression,
+}
+
+// configuredMiddleware returns the middleware listed in Config.Middleware,
+// the first one outermost.
+func (a *app) configuredMiddleware() alice.Chain {
+	constructors := make([]alice.Constructor, 0, len(a.cfg.Middleware))
+	for _, name := range a.cfg.Middleware {
+		m := middlewares[name]
+		constructors = append(constructors, func(next http.Handler) http.Handler { return m(a, next) })
+	}
+	return alice.New(constructors...)
+}
+
+// clientAddr returns the IP address of the client that sent r.
+func clientAddr(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func (a *app) requestLogger(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer requestLog(r).Printf("%s %s %s", r.Method, redactURL(r.URL), r.RemoteAddr)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// securityHeaders sets response headers that keep browsers from framing,
+// sniffing or leaking gangway's pages.
+func (a *app) securityHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("X-Frame-Options", "DENY")
+		h.Set("Referrer-Policy", "no-referrer")
+		if a.cfg.ServeTLS || forwardedHTTPS(r) {
+			h.Set("Strict-Transport-Security", "max-age=31536000")
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// noStore keeps browsers and proxies from keeping copies of responses that
+// carry credentials. It also drops validators, so that a cache can't answer
+// a conditional request with a stored copy either.
+func noStore(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Set("Cache-Control", "no-store, no-cache, must-revalidate, private")
+		h.Set("Pragma", "no-cache")
+		h.Set("Expires", "0")
+		// a copy, as the header is shared with the caller, e.g. the
+		// timeoutHandler serving its error page
+		r = r.Clone(r.Context())
+		r.Header.Del("If-None-Match")
+		r.Header.Del("If-Modified-Since")
+		next.ServeHTTP(&noStoreWriter{ResponseWriter: w}, r)
+	})
+}
+
+// noStoreWriter removes validators set by the handler.
+type noStoreWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (nw *noStoreWriter) WriteHeader(code int) {
+	if nw.wroteHeader {
+		return
+	}
+	nw.wroteHeader = true
+	nw.Header().Del("ETag")
+	nw.Header().Del("Last-Modified")
+	nw.ResponseWriter.WriteHeader(code)
+}
+
+func (nw *noStoreWriter) Write(p []byte) (int, error) {
+	if !nw.wroteHeader {
+		nw.WriteHeader(http.StatusOK)
+	}
+	return nw.ResponseWriter.Write(p)
+}
+
+// Unwrap returns the wrapped writer, for http.ResponseController.
+func (nw *noStoreWriter) Unwrap() http.ResponseWriter {
+	return nw.ResponseWriter
+}
+
+// Flush sends what was written so far, for streamed responses.
+func (nw *noStoreWriter) Flush() {
+	if f, ok := nw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func parseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("bad CIDR %q: %v", cidr, err)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// ipFilter only lets clients from Config.AllowedClientCIDRs through.
+func (a *app) ipFilter(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ip := net.ParseIP(clientAddr(r)); ip != nil {
+			for _, n := range a.allowedClientNets {
+				if n.Contains(ip) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+		}
+		a.serveError(w, r, http.StatusForbidden, "gangway is not available from your network.")
+	})
+}
+
+// rateLimit limits every client to Config.RateLimit requests per second, with
+// bursts of up to Config.RateLimitBurst requests.
+func (a *app) rateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.limiter.allow(clientAddr(r), a.cfg.RateLimit, a.cfg.RateLimitBurst, time.Now()) {
+			retryAfter := int(math.Ceil(1 / a.cfg.RateLimit))
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			a.serveError(w, r, http.StatusTooManyRequests, "You have made too many requests. Please try again shortly.")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rateLimiter is a token bucket per client.
+type rateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	// the rate and burst last used, for purging
+	rate  float64
+	burst int
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{buckets: map[string]*tokenBucket{}}
+}
+
+// allow takes a token from the bucket for key, which refills at rate tokens
+// per second and holds at most burst tokens.
+func (l *rateLimiter) allow(key string, rate float64, burst int, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rate, l.burst = rate, burst
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: float64(burst), last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(burst), b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// purgeExpired forgets the clients whose buckets have filled up again, as
+// they are no different from clients never seen before.
+func (l *rateLimiter) purgeExpired(now time.Time) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var n int
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= float64(l.burst) {
+			delete(l.buckets, key)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// compression gzips responses for clients that accept it.
+func (a *app) compression(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !acceptsGzip(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Accept-Encoding")
+		cw := &gzipWriter{ResponseWriter: w}
+		defer cw.close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+func acceptsGzip(r *http.Request) bool {
+	for _, enc := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		parts := strings.Split(enc, ";")
+		if strings.TrimSpace(parts[0]) != "gzip" {
+			continue
+		}
+		for _, param := range parts[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil && q == 0 {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// gzipWriter compresses the response body unless the handler already encoded
+// it or the response has no body.
+type gzipWriter struct {
+	http.ResponseWriter
+	gz          *gzip.Writer
+	wroteHeader bool
+}
+
+func (cw *gzipWriter) WriteHeader(code int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader = true
+	h := cw.Header()
+	if h.Get("Content-Encoding") == "" && code != http.StatusNoContent && code != http.StatusNotModified {
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+		cw.gz = gzip.NewWriter(cw.ResponseWriter)
+	}
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+func (cw *gzipWriter) Write(p []byte) (int, error) {
+	if !cw.wroteHeader {
+		// sniff the content type from the plain body, not the gzipped one
+		if cw.Header().Get("Content-Type") == "" {
+			cw.Header().Set("Content-Type", http.DetectContentType(p))
+		}
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.gz != nil {
+		return cw.gz.Write(p)
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+// Unwrap lets setWriteDeadline reach the writer underneath.
+func (cw *gzipWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// Flush sends what was compressed so far, for streamed responses.
+func (cw *gzipWriter) Flush() {
+	if cw.gz != nil {
+		cw.gz.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (cw *gzipWriter) close() error {
+	if cw.gz == nil {
+		return nil
+	}
+	return cw.gz.Close()
+}
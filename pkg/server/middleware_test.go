@@ -0,0 +1,259 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadShedding(t *testing.T) {
+	a := newTestApp(t)
+	a.cfg.MaxInFlightRequests = 1
+	a.cfg.RetryAfter = 30 * time.Second
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	blocking := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})
+	handler := a.loadShedding(blocking)
+
+	go handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	<-started
+	defer close(release)
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	if status := rr.Code; status != http.StatusServiceUnavailable {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusServiceUnavailable)
+	}
+	if retryAfter := rr.Header().Get("Retry-After"); retryAfter != "30" {
+		t.Errorf("Expected Retry-After of 30, got %q", retryAfter)
+	}
+}
+
+func TestConfiguredMiddlewareOrder(t *testing.T) {
+	a := newTestApp(t)
+	var order []string
+	for _, name := range []string{"first", "second"} {
+		name := name
+		middlewares[name] = func(a *app, next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+		defer delete(middlewares, name)
+	}
+
+	a.cfg.Middleware = []string{"second", "first"}
+	handler := a.configuredMiddleware().ThenFunc(func(w http.ResponseWriter, r *http.Request) {})
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if got := strings.Join(order, ","); got != "second,first" {
+		t.Errorf("middleware ran in order %q, want second,first", got)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	a := newTestApp(t)
+	a.cfg.RateLimit = 1
+	a.cfg.RateLimitBurst = 2
+	handler := a.rateLimit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+		if rr.Code != want {
+			t.Errorf("request %d: got status %d, want %d", i+1, rr.Code, want)
+		}
+	}
+
+	// another client has its own bucket
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "192.0.2.99:1234"
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("second client was limited: status %d", rr.Code)
+	}
+
+	if n, _ := a.limiter.purgeExpired(time.Now().Add(time.Minute)); n != 2 {
+		t.Errorf("purged %d clients, want 2", n)
+	}
+}
+
+func TestIPFilter(t *testing.T) {
+	a := newTestApp(t)
+	var err error
+	a.allowedClientNets, err = parseCIDRs([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := a.ipFilter(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		remoteAddr string
+		want       int
+	}{
+		{"10.1.2.3:5000", http.StatusOK},
+		{"192.0.2.1:5000", http.StatusForbidden},
+		{"garbage", http.StatusForbidden},
+	}
+	for _, tc := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = tc.remoteAddr
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != tc.want {
+			t.Errorf("%s: got status %d, want %d", tc.remoteAddr, rr.Code, tc.want)
+		}
+	}
+}
+
+func TestCompression(t *testing.T) {
+	a := newTestApp(t)
+	page := strings.Repeat("<p>gangway</p>", 100)
+	handler := a.compression(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(page))
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip, deflate")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("response was not compressed")
+	}
+	if ct := rr.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("got content type %q for the compressed page", ct)
+	}
+	zr, err := gzip.NewReader(rr.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != page {
+		t.Errorf("decompressed body does not match the page")
+	}
+
+	req.Header.Set("Accept-Encoding", "gzip;q=0")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Header().Get("Content-Encoding") != "" || rr.Body.String() != page {
+		t.Errorf("response was compressed for a client that refuses gzip")
+	}
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	a := newTestApp(t)
+	rr := httptest.NewRecorder()
+	a.securityHeaders(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	for _, header := range []string{"X-Content-Type-Options", "X-Frame-Options", "Referrer-Policy"} {
+		if rr.Header().Get(header) == "" {
+			t.Errorf("%s is not set", header)
+		}
+	}
+	if rr.Header().Get("Strict-Transport-Security") != "" {
+		t.Errorf("HSTS is set without TLS")
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	s := newTestServer(t)
+
+	rr := httptest.NewRecorder()
+	s.ServeHTTP(rr, httptest.NewRequest("GET", "/callback?state=xyz&code=abc", nil))
+	id := rr.Header().Get(requestIDHeader)
+	if len(id) != len("ABCD-EFGH") {
+		t.Fatalf("got request ID %q", id)
+	}
+	if !strings.Contains(rr.Body.String(), id) {
+		t.Errorf("error page does not show the request ID %s", id)
+	}
+
+	// clients can't choose their request ID
+	req := httptest.NewRequest("GET", "/nope", nil)
+	req.Header.Set(requestIDHeader, "proxy-assigned.1")
+	rr = httptest.NewRecorder()
+	s.ServeHTTP(rr, req)
+	if got := rr.Header().Get(requestIDHeader); got == "proxy-assigned.1" || got == "" {
+		t.Errorf("got request ID %q from a client that isn't a trusted proxy", got)
+	}
+
+	a := s.current()
+	a.cfg.TrustedProxies = []string{"10.0.0.0/8"}
+	a.trustedProxyNets, _ = parseCIDRs(a.cfg.TrustedProxies)
+	req = httptest.NewRequest("GET", "/nope", nil)
+	req.RemoteAddr = "10.0.0.2:41000"
+	req.Header.Set(requestIDHeader, "proxy-assigned.1")
+	rr = httptest.NewRecorder()
+	s.ServeHTTP(rr, req)
+	if got := rr.Header().Get(requestIDHeader); got != "proxy-assigned.1" {
+		t.Errorf("got request ID %q, want the one set by the proxy", got)
+	}
+
+	req = httptest.NewRequest("GET", "/nope", nil)
+	req.RemoteAddr = "10.0.0.2:41000"
+	req.Header.Set(requestIDHeader, "<script>")
+	rr = httptest.NewRecorder()
+	s.ServeHTTP(rr, req)
+	if got := rr.Header().Get(requestIDHeader); got == "<script>" || got == "" {
+		t.Errorf("got request ID %q for an unsafe incoming ID", got)
+	}
+}
+
+func TestNoStore(t *testing.T) {
+	h := noStore(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") != "" {
+			t.Errorf("conditional request header was passed on")
+		}
+		w.Header().Set("ETag", `"abc"`)
+		w.Write([]byte("token"))
+	}))
+	req := httptest.NewRequest("GET", "/commandline", nil)
+	req.Header.Set("If-None-Match", `"abc"`)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Header().Get("ETag") != "" {
+		t.Errorf("ETag was kept")
+	}
+	if !strings.Contains(rr.Header().Get("Cache-Control"), "no-store") || rr.Header().Get("Pragma") != "no-cache" {
+		t.Errorf("got Cache-Control %q and Pragma %q", rr.Header().Get("Cache-Control"), rr.Header().Get("Pragma"))
+	}
+
+	// every route that may carry credentials is covered
+	s, err := New(&Config{SessionSecurityKey: SessionKeys{"test"}, RequestTimeout: time.Second, CallbackTimeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"/commandline", "/commandline/commands", "/logout", "/callback", "/api/v1/stats"} {
+		rr := httptest.NewRecorder()
+		s.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		if !strings.Contains(rr.Header().Get("Cache-Control"), "no-store") {
+			t.Errorf("%s got Cache-Control %q", path, rr.Header().Get("Cache-Control"))
+		}
+	}
+}
@@ -0,0 +1,221 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// Onboarding links are signed URLs an admin hands to a new team member. They
+// name the cluster, the namespace to work in and a variant of the
+// instructions from Config.OnboardingInstructions. Whoever follows one signs
+// in as usual and then sees the commandline page with those filled in.
+
+const (
+	// defaultOnboardingLinkTTL is how long onboarding links stay valid
+	// unless the request for one says otherwise, and maxOnboardingLinkTTL
+	// the longest they may.
+	defaultOnboardingLinkTTL = 7 * 24 * time.Hour
+	maxOnboardingLinkTTL     = 30 * 24 * time.Hour
+
+	// onboardingKeyInfo is the HKDF info for the key onboarding links are
+	// signed with, derived from the session security key.
+	onboardingKeyInfo = "gangway onboarding link"
+)
+
+// namespacePattern matches Kubernetes namespace names.
+var namespacePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]{0,61}[a-z0-9])?$`)
+
+// onboarding is what an onboarding link selects.
+type onboarding struct {
+	Cluster   string
+	Namespace string
+	Variant   string
+	Expires   time.Time
+	// Instructions are the instructions for Variant from the config.
+	Instructions string
+}
+
+// onboardingLinkRequest is the body of a request for an onboarding link.
+type onboardingLinkRequest struct {
+	Namespace string `json:"namespace"`
+	Variant   string `json:"variant"`
+	// TTL is how long the link stays valid, as a duration such as 72h.
+	TTL string `json:"ttl"`
+}
+
+type onboardingLinkResponse struct {
+	URL     string    `json:"url"`
+	Expires time.Time `json:"expires"`
+}
+
+// onboardingSignature returns the signature of o's link with the key derived
+// from securityKey.
+func onboardingSignature(securityKey string, o *onboarding) (string, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, []byte(securityKey), []byte(salt), []byte(onboardingKeyInfo)), key); err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, key)
+	io.WriteString(mac, strings.Join([]string{o.Cluster, o.Namespace, o.Variant, strconv.FormatInt(o.Expires.Unix(), 10)}, "\n"))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// onboardingLink returns the query of the signed link for o.
+func (a *app) onboardingLink(o *onboarding) (url.Values, error) {
+	sig, err := onboardingSignature(a.cfg.SessionSecurityKey.current(), o)
+	if err != nil {
+		return nil, err
+	}
+	q := url.Values{
+		"cluster": {o.Cluster},
+		"expires": {strconv.FormatInt(o.Expires.Unix(), 10)},
+		"sig":     {sig},
+	}
+	if o.Namespace != "" {
+		q.Set("namespace", o.Namespace)
+	}
+	if o.Variant != "" {
+		q.Set("variant", o.Variant)
+	}
+	return q, nil
+}
+
+// verifyOnboardingLink returns what the onboarding link with query q selects,
+// or why it can't be used. Links signed with any of the session security keys
+// are accepted, so rotating the key doesn't break the ones already sent.
+func (a *app) verifyOnboardingLink(q url.Values) (*onboarding, string) {
+	expires, err := strconv.ParseInt(q.Get("expires"), 10, 64)
+	if err != nil {
+		return nil, "This onboarding link is incomplete."
+	}
+	o := &onboarding{
+		Cluster:   q.Get("cluster"),
+		Namespace: q.Get("namespace"),
+		Variant:   q.Get("variant"),
+		Expires:   time.Unix(expires, 0),
+	}
+	valid := false
+	for _, key := range a.cfg.SessionSecurityKey {
+		if sig, err := onboardingSignature(key, o); err == nil && hmac.Equal([]byte(sig), []byte(q.Get("sig"))) {
+			valid = true
+			break
+		}
+	}
+	switch {
+	case !valid:
+		return nil, "This onboarding link is not valid. It may have been changed or cut short."
+	case a.clock.Now().After(o.Expires):
+		return nil, fmt.Sprintf("This onboarding link expired at %s UTC.", o.Expires.UTC().Format("2006-01-02 15:04"))
+	case o.Cluster != a.cfg.ClusterName:
+		return nil, fmt.Sprintf("This onboarding link is for cluster %q, but this gangway issues credentials for %q.", o.Cluster, a.cfg.ClusterName)
+	}
+	if o.Variant != "" {
+		instructions, ok := a.cfg.OnboardingInstructions[o.Variant]
+		if !ok {
+			return nil, fmt.Sprintf("The %q instructions this onboarding link asks for are no longer offered.", o.Variant)
+		}
+		o.Instructions = instructions
+	}
+	return o, ""
+}
+
+// onboardingLinksHandler creates onboarding links for admins.
+func (a *app) onboardingLinksHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	var req onboardingLinkRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&req); err != nil {
+		http.Error(w, "the body must be a JSON object with the namespace and variant of the link", http.StatusBadRequest)
+		return
+	}
+	ttl := defaultOnboardingLinkTTL
+	if req.TTL != "" {
+		var err error
+		if ttl, err = time.ParseDuration(req.TTL); err != nil || ttl <= 0 || ttl > maxOnboardingLinkTTL {
+			http.Error(w, fmt.Sprintf("ttl must be a positive duration of at most %s", maxOnboardingLinkTTL), http.StatusBadRequest)
+			return
+		}
+	}
+	switch {
+	case req.Namespace == "" && req.Variant == "":
+		http.Error(w, "an onboarding link needs a namespace, a variant or both", http.StatusBadRequest)
+		return
+	case req.Namespace != "" && !namespacePattern.MatchString(req.Namespace):
+		http.Error(w, fmt.Sprintf("%q is not a valid namespace name", req.Namespace), http.StatusBadRequest)
+		return
+	}
+	if _, ok := a.cfg.OnboardingInstructions[req.Variant]; req.Variant != "" && !ok {
+		http.Error(w, fmt.Sprintf("no onboardingInstructions for variant %q", req.Variant), http.StatusBadRequest)
+		return
+	}
+
+	o := &onboarding{
+		Cluster:   a.cfg.ClusterName,
+		Namespace: req.Namespace,
+		Variant:   req.Variant,
+		Expires:   a.clock.Now().Add(ttl).Truncate(time.Second),
+	}
+	q, err := a.onboardingLink(o)
+	if err != nil {
+		requestLog(r).Errorf("Could not sign onboarding link: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	link := a.appURL(r, "/onboard?"+q.Encode())
+	if public := a.cfg.publicURL(); public != "" {
+		link = strings.TrimSuffix(public, "/") + "/onboard?" + q.Encode()
+	}
+	requestLog(r).Infof("Created onboarding link for namespace %q, variant %q, valid until %s", o.Namespace, o.Variant, o.Expires.UTC())
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&onboardingLinkResponse{URL: link, Expires: o.Expires.UTC()})
+}
+
+// onboardHandler serves onboarding links. Users who aren't signed in are
+// sent to sign in first and come back to the link afterwards.
+func (a *app) onboardHandler(w http.ResponseWriter, r *http.Request) {
+	o, problem := a.verifyOnboardingLink(r.URL.Query())
+	if problem != "" {
+		a.serveErrorPage(w, r, http.StatusBadRequest, problem, "Ask whoever sent you the link for a new one.")
+		return
+	}
+
+	if session, err := a.sessionStore.Get(r, a.cfg.sessionCookieName()); err == nil {
+		if _, ok := session.Values["id_token"].(string); ok {
+			a.loginRequired(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				a.serveCommandline(w, r, o)
+			})).ServeHTTP(w, r)
+			return
+		}
+	}
+	login := url.Values{returnToParam: {a.appURL(r, "/onboard?"+r.URL.RawQuery)}}
+	http.Redirect(w, r, a.appURL(r, "/login?"+login.Encode()), http.StatusFound)
+}
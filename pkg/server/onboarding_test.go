@@ -0,0 +1,99 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOnboardingLinks(t *testing.T) {
+	a := newTestApp(t)
+	a.cfg.ClusterName = "prod"
+	a.cfg.RedirectURL = "https://gangway.example.com/callback"
+	a.cfg.OnboardingInstructions = map[string]string{"macos": "brew install kubectl"}
+
+	create := func(body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		a.onboardingLinksHandler(rr, httptest.NewRequest("POST", "/api/v1/onboarding-links", strings.NewReader(body)))
+		return rr
+	}
+	for _, body := range []string{`{}`, `{"namespace": "Team A"}`, `{"variant": "windows"}`, `{"namespace": "team-a", "ttl": "2000h"}`} {
+		if rr := create(body); rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: got status %d, want %d", body, rr.Code, http.StatusBadRequest)
+		}
+	}
+
+	rr := create(`{"namespace": "team-a", "variant": "macos", "ttl": "1h"}`)
+	var resp onboardingLinkResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	link, err := url.Parse(resp.URL)
+	if err != nil || link.Host != "gangway.example.com" || link.Path != "/onboard" {
+		t.Fatalf("got link %q", resp.URL)
+	}
+
+	o, problem := a.verifyOnboardingLink(link.Query())
+	if problem != "" || o.Namespace != "team-a" || o.Instructions != "brew install kubectl" {
+		t.Fatalf("got %+v, %q", o, problem)
+	}
+
+	// signed out users sign in first and come back
+	rr = httptest.NewRecorder()
+	a.onboardHandler(rr, httptest.NewRequest("GET", link.RequestURI(), nil))
+	location, _ := url.Parse(rr.Header().Get("Location"))
+	if rr.Code != http.StatusFound || location.Path != "/login" || location.Query().Get(returnToParam) != link.RequestURI() {
+		t.Errorf("got %d to %q, want a redirect to sign in", rr.Code, rr.Header().Get("Location"))
+	}
+
+	tampered := link.Query()
+	tampered.Set("namespace", "kube-system")
+	if _, problem := a.verifyOnboardingLink(tampered); !strings.Contains(problem, "not valid") {
+		t.Errorf("tampered link: got %q", problem)
+	}
+
+	// still valid after the key was rotated, but not on another cluster
+	a.cfg.SessionSecurityKey = SessionKeys{"rotated", a.cfg.SessionSecurityKey.current()}
+	if _, problem := a.verifyOnboardingLink(link.Query()); problem != "" {
+		t.Errorf("after key rotation: got %q", problem)
+	}
+	a.cfg.ClusterName = "staging"
+	if _, problem := a.verifyOnboardingLink(link.Query()); !strings.Contains(problem, `for cluster "prod"`) {
+		t.Errorf("other cluster: got %q", problem)
+	}
+	a.cfg.ClusterName = "prod"
+
+	a.clock.advance(2 * time.Hour)
+	defer a.clock.reset()
+	rr = httptest.NewRecorder()
+	a.onboardHandler(rr, httptest.NewRequest("GET", link.RequestURI(), nil))
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "expired") {
+		t.Errorf("expired link: got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	serveTemplate("commandline.tmpl", &userInfo{ClusterName: "prod", KubeconfigName: "jane@prod", Onboarding: o}, rr)
+	for _, want := range []string{`id="onboarding"`, "kubectl config set-context jane@prod --namespace=team-a", "brew install kubectl"} {
+		if !strings.Contains(rr.Body.String(), want) {
+			t.Errorf("commandline page does not contain %q", want)
+		}
+	}
+}
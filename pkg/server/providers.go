@@ -0,0 +1,238 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+
+	"github.com/dgrijalva/jwt-go"
+	"golang.org/x/oauth2"
+)
+
+// defaultGroupsClaim is the ID token claim groups are read from unless the
+// config or provider preset names another.
+const defaultGroupsClaim = "groups"
+
+// providerPreset is what it takes to get an ID token with groups and a
+// refresh token out of a type of identity provider, and to sign out of it.
+type providerPreset struct {
+	scopes      []string
+	authParams  map[string]string
+	groupsClaim string
+
+	// logoutURL returns the provider's logout endpoint for c, for when it
+	// isn't configured.
+	logoutURL func(c *Config) string
+	// logoutParams returns the query parameters for the logout endpoint,
+	// to send users back to postLogout afterwards.
+	logoutParams func(c *Config, postLogout string) url.Values
+
+	// fetchGroups looks up the user's groups with the provider's API, for
+	// when the ID token doesn't carry them.
+	fetchGroups func(ctx context.Context, client *http.Client, c *Config, token *oauth2.Token) ([]string, error)
+}
+
+// providerPresets are selected by Config.Provider. The empty name is used when
+// no provider is set.
+var providerPresets = map[string]providerPreset{
+	"": {
+		scopes: []string{"openid", "profile", "email", "offline_access"},
+	},
+	"dex": {
+		scopes: []string{"openid", "profile", "email", "offline_access", "groups"},
+	},
+	"keycloak": {
+		// groups come from a mapper on the client, not a scope
+		scopes: []string{"openid", "profile", "email", "offline_access"},
+	},
+	"okta": {
+		scopes: []string{"openid", "profile", "email", "offline_access", "groups"},
+	},
+	"azuread": {
+		scopes: []string{"openid", "profile", "email", "offline_access"},
+	},
+	"google": {
+		// Google rejects offline_access and only issues a refresh token on
+		// consent for offline access
+		scopes:     []string{"openid", "profile", "email"},
+		authParams: map[string]string{"access_type": "offline", "prompt": "consent"},
+	},
+	"auth0": {
+		scopes: []string{"openid", "profile", "email", "offline_access"},
+	},
+	"gitlab": {
+		// groups_direct only lists direct memberships, and is missing from
+		// older GitLab versions. Add the read_api scope to fetch all of
+		// them from the API instead.
+		scopes:      []string{"openid", "profile", "email"},
+		groupsClaim: "groups_direct",
+		fetchGroups: fetchGitLabGroups,
+	},
+	"cognito": {
+		// Cognito issues refresh tokens without offline_access, and rejects
+		// scopes it doesn't know
+		scopes:      []string{"openid", "profile", "email"},
+		groupsClaim: "cognito:groups",
+		// Cognito has no end_session_endpoint. Its hosted UI logs out at
+		// /logout on the same domain as /oauth2/authorize.
+		logoutURL: func(c *Config) string {
+			u, err := url.Parse(c.AuthorizeURL)
+			if err != nil || u.Host == "" {
+				return ""
+			}
+			return (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/logout"}).String()
+		},
+		logoutParams: func(c *Config, postLogout string) url.Values {
+			return url.Values{"client_id": {c.ClientID}, "logout_uri": {postLogout}}
+		},
+	},
+}
+
+// providerNames returns the names of the provider presets, for error
+// messages.
+func providerNames() []string {
+	var names []string
+	for name := range providerPresets {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// scopes returns the scopes to request: Config.Scopes if set, otherwise those
+// of the provider preset.
+func (c *Config) scopes() []string {
+	if len(c.Scopes) > 0 {
+		return c.Scopes
+	}
+	return providerPresets[c.Provider].scopes
+}
+
+// authCodeOptions returns the extra authorization request parameters: the
+// audience and connection, and those of the provider preset, overridden by
+// Config.ExtraAuthParams.
+func (c *Config) authCodeOptions() []oauth2.AuthCodeOption {
+	params := map[string]string{}
+	if c.Audience != "" {
+		params["audience"] = c.Audience
+	}
+	if c.Connection != "" {
+		params["connection"] = c.Connection
+	}
+	for k, v := range providerPresets[c.Provider].authParams {
+		params[k] = v
+	}
+	for k, v := range c.ExtraAuthParams {
+		params[k] = v
+	}
+
+	var opts []oauth2.AuthCodeOption
+	for k, v := range params {
+		opts = append(opts, oauth2.SetAuthURLParam(k, v))
+	}
+	return opts
+}
+
+// groupsClaim returns the ID token claim that holds the user's groups.
+func (c *Config) groupsClaim() string {
+	if c.GroupsClaim != "" {
+		return c.GroupsClaim
+	}
+	if claim := providerPresets[c.Provider].groupsClaim; claim != "" {
+		return claim
+	}
+	return defaultGroupsClaim
+}
+
+// logoutURL returns where to send users to also sign out of the identity
+// provider, or "" to only end their gangway session. idToken is the user's ID
+// token, passed to an OpenID end_session_endpoint as a hint of who is
+// signing out.
+func (c *Config) logoutURL(idToken string) string {
+	preset := providerPresets[c.Provider]
+	logoutURL := c.LogoutURL
+	if logoutURL == "" && preset.logoutURL != nil {
+		logoutURL = preset.logoutURL(c)
+	}
+
+	// the provider sends users back to gangway's public root
+	postLogout := c.publicURL()
+	var params url.Values
+	switch {
+	case logoutURL == "" && c.EndSessionEndpoint != "":
+		// RP-initiated logout, as in OpenID Connect RP-Initiated Logout 1.0
+		logoutURL = c.EndSessionEndpoint
+		params = url.Values{"client_id": {c.ClientID}, "post_logout_redirect_uri": {postLogout}}
+		if idToken != "" {
+			params.Set("id_token_hint", idToken)
+		}
+	case preset.logoutParams != nil:
+		params = preset.logoutParams(c, postLogout)
+	}
+	if logoutURL == "" || params == nil {
+		return logoutURL
+	}
+
+	u, err := url.Parse(logoutURL)
+	if err != nil {
+		return ""
+	}
+	q := u.Query()
+	for k, v := range params {
+		q[k] = v
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// fetchGroups returns the user's groups from the provider's API if the ID
+// token has none and either points to where they are, as Azure AD does for
+// users in many groups, or the provider supports it. Otherwise it returns
+// nil. The error matters when allowedGroups decides who may sign in; beyond
+// that, groups are only shown to the user.
+func (a *app) fetchGroups(ctx context.Context, token *oauth2.Token) ([]string, error) {
+	claims := jwt.MapClaims{}
+	if idToken, ok := token.Extra("id_token").(string); ok {
+		if jwtToken, _ := a.parseToken(idToken); jwtToken != nil {
+			claims, _ = jwtToken.Claims.(jwt.MapClaims)
+		}
+	}
+	if len(claimStrings(claims, a.cfg.groupsClaim())) > 0 {
+		return nil, nil
+	}
+	if groupsOverageEndpoint(claims, a.cfg.groupsClaim()) != "" {
+		groups, err := fetchOverageGroups(ctx, a.httpClient, claims, a.cfg.groupsClaim(), token)
+		if err != nil {
+			return nil, fmt.Errorf("could not fetch the groups left out of the ID token: %v", err)
+		}
+		return groups, nil
+	}
+
+	fetch := providerPresets[a.cfg.Provider].fetchGroups
+	if fetch == nil {
+		return nil, nil
+	}
+	groups, err := fetch(ctx, a.httpClient, a.cfg, token)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch groups from %s: %v", a.cfg.Provider, err)
+	}
+	return groups, nil
+}
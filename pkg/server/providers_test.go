@@ -0,0 +1,142 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+func TestProviderPresets(t *testing.T) {
+	c := &Config{Provider: "google", Audience: "aud"}
+	if scopes := c.scopes(); !reflect.DeepEqual(scopes, []string{"openid", "profile", "email"}) {
+		t.Errorf("google preset requested scopes %v", scopes)
+	}
+
+	authURL := func(c *Config) url.Values {
+		u, err := url.Parse((&oauth2.Config{Endpoint: oauth2.Endpoint{AuthURL: "https://idp.example.com/authorize"}}).AuthCodeURL("state", c.authCodeOptions()...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return u.Query()
+	}
+	q := authURL(c)
+	if q.Get("access_type") != "offline" || q.Get("prompt") != "consent" || q.Get("audience") != "aud" {
+		t.Errorf("google preset sent parameters %v", q)
+	}
+
+	c.Scopes = []string{"openid"}
+	c.ExtraAuthParams = map[string]string{"prompt": "select_account", "hd": "example.com"}
+	if scopes := c.scopes(); !reflect.DeepEqual(scopes, c.Scopes) {
+		t.Errorf("configured scopes were replaced by %v", scopes)
+	}
+	q = authURL(c)
+	if q.Get("prompt") != "select_account" || q.Get("hd") != "example.com" || q.Get("access_type") != "offline" {
+		t.Errorf("extraAuthParams were not merged over the preset: %v", q)
+	}
+
+	if scopes := (&Config{}).scopes(); len(scopes) == 0 {
+		t.Errorf("no scopes requested without a provider")
+	}
+
+	q = authURL(&Config{Provider: "auth0", Connection: "github"})
+	if q.Get("connection") != "github" {
+		t.Errorf("connection was not sent: %v", q)
+	}
+	if _, ok := q["audience"]; ok {
+		t.Errorf("an empty audience was sent: %v", q)
+	}
+}
+
+func TestCognitoPreset(t *testing.T) {
+	c := &Config{
+		Provider:     "cognito",
+		AuthorizeURL: "https://auth.example.com/oauth2/authorize",
+		ClientID:     "client",
+		RedirectURL:  "https://gangway.example.com/callback",
+	}
+	if claim := c.groupsClaim(); claim != "cognito:groups" {
+		t.Errorf("cognito groups claim is %q", claim)
+	}
+	want := "https://auth.example.com/logout?client_id=client&logout_uri=https%3A%2F%2Fgangway.example.com%2F"
+	if logoutURL := c.logoutURL(""); logoutURL != want {
+		t.Errorf("cognito logout URL is %q, want %q", logoutURL, want)
+	}
+
+	c.GroupsClaim = "custom:groups"
+	if claim := c.groupsClaim(); claim != "custom:groups" {
+		t.Errorf("configured groups claim was replaced by %q", claim)
+	}
+
+	if logoutURL := (&Config{}).logoutURL(""); logoutURL != "" {
+		t.Errorf("logout URL %q without a provider or logoutURL", logoutURL)
+	}
+}
+
+func TestEndSessionLogout(t *testing.T) {
+	c := &Config{
+		ClientID:           "client",
+		RedirectURL:        "https://gangway.example.com/callback",
+		EndSessionEndpoint: "https://idp.example.com/realms/dev/logout?ui_locales=en",
+	}
+	u, err := url.Parse(c.logoutURL("the-id-token"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := url.Values{
+		"ui_locales":               {"en"},
+		"client_id":                {"client"},
+		"id_token_hint":            {"the-id-token"},
+		"post_logout_redirect_uri": {"https://gangway.example.com/"},
+	}
+	if u.Host != "idp.example.com" || u.Path != "/realms/dev/logout" || !reflect.DeepEqual(u.Query(), want) {
+		t.Errorf("got logout URL %s", u)
+	}
+
+	// without a session there is no hint
+	if u, _ := url.Parse(c.logoutURL("")); u.Query().Get("id_token_hint") != "" {
+		t.Errorf("got an id_token_hint without an ID token: %s", u)
+	}
+
+	// a configured logout URL wins
+	c.LogoutURL = "https://idp.example.com/custom-logout"
+	if logoutURL := c.logoutURL("the-id-token"); logoutURL != c.LogoutURL {
+		t.Errorf("got logout URL %q, want the configured one", logoutURL)
+	}
+}
+
+func TestProviderConfig(t *testing.T) {
+	for provider, valid := range map[string]bool{"": true, "okta": true, "azuread": true, "ping": false} {
+		c, err := LoadConfig()
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.AuthorizeURL = "https://foo.bar/authorize"
+		c.TokenURL = "https://foo.bar/token"
+		c.ClientID = "foo"
+		c.ClientSecret = "bar"
+		c.RedirectURL = "https://foo.baz/callback"
+		c.SessionSecurityKey = SessionKeys{"testing"}
+		c.APIServerURL = "https://k8s-api.foo.baz"
+		c.Provider = provider
+
+		if err := validateConfig(c); (err == nil) != valid {
+			t.Errorf("provider %q: got error %v, want valid %v", provider, err, valid)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// The X-Forwarded-* headers that can be listed in Config.ProxyHeaders.
+// X-Forwarded-Host isn't among them: gangway builds its absolute URLs from
+// redirectURL, never from the Host of a request.
+const (
+	headerForwardedProto  = "X-Forwarded-Proto"
+	headerForwardedPrefix = "X-Forwarded-Prefix"
+	headerForwardedFor    = "X-Forwarded-For"
+)
+
+var proxyHeaders = []string{headerForwardedProto, headerForwardedPrefix, headerForwardedFor}
+
+// knownProxyHeader reports whether header is one of proxyHeaders, in any case.
+func knownProxyHeader(header string) bool {
+	for _, h := range proxyHeaders {
+		if http.CanonicalHeaderKey(header) == h {
+			return true
+		}
+	}
+	return false
+}
+
+// honorsProxyHeader reports whether header is believed from trusted proxies:
+// every header in proxyHeaders if Config.ProxyHeaders is empty, and the ones
+// it lists otherwise.
+func (c *Config) honorsProxyHeader(header string) bool {
+	if len(c.TrustedProxies) == 0 {
+		return false
+	}
+	if len(c.ProxyHeaders) == 0 {
+		return true
+	}
+	for _, h := range c.ProxyHeaders {
+		if http.CanonicalHeaderKey(h) == header {
+			return true
+		}
+	}
+	return false
+}
+
+type (
+	trustedProxyKey   struct{}
+	forwardedHTTPSKey struct{}
+)
+
+// viaTrustedProxy reports whether r came from one of Config.TrustedProxies.
+// Unlike r.RemoteAddr, it still holds once X-Forwarded-For has replaced the
+// address with the client's.
+func viaTrustedProxy(r *http.Request) bool {
+	trusted, _ := r.Context().Value(trustedProxyKey{}).(bool)
+	return trusted
+}
+
+// forwardedHTTPS reports whether a trusted proxy received r over HTTPS.
+func forwardedHTTPS(r *http.Request) bool {
+	https, _ := r.Context().Value(forwardedHTTPSKey{}).(bool)
+	return https
+}
+
+// forwardedPrefix returns the X-Forwarded-Prefix header of r if a trusted
+// proxy sent it, and "" otherwise.
+func (a *app) forwardedPrefix(r *http.Request) string {
+	header := r.Header.Get(headerForwardedPrefix)
+	if header == "" || !viaTrustedProxy(r) || !a.cfg.honorsProxyHeader(headerForwardedPrefix) {
+		return ""
+	}
+	return lastValue(header)
+}
+
+// trustedProxy reports whether addr, an IP address with or without a port,
+// is in Config.TrustedProxies.
+func (a *app) trustedProxy(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	ip := net.ParseIP(strings.TrimSpace(host))
+	if ip == nil {
+		return false
+	}
+	for _, n := range a.trustedProxyNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// lastValue returns the last entry of a comma separated header, the one the
+// nearest proxy added.
+func lastValue(header string) string {
+	values := strings.Split(header, ",")
+	return strings.TrimSpace(values[len(values)-1])
+}
+
+// forwardedHeaders applies the X-Forwarded-* headers of requests from
+// Config.TrustedProxies, so that gangway sees requests as the proxy
+// received them when TLS terminates at an ingress: X-Forwarded-Proto https
+// marks cookies Secure and sends HSTS, X-Forwarded-Prefix is the base path
+// of links and redirects (see basePath), and X-Forwarded-For replaces the
+// client address that is logged, audited, rate limited and filtered by
+// ipFilter. The headers of other clients are ignored, as anyone can send
+// them.
+func (a *app) forwardedHeaders(next http.Handler) http.Handler {
+	if len(a.trustedProxyNets) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.trustedProxy(r.RemoteAddr) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		https := false
+		if header := r.Header.Get(headerForwardedProto); header != "" && a.cfg.honorsProxyHeader(headerForwardedProto) {
+			https = strings.EqualFold(lastValue(header), "https")
+		}
+		ctx := context.WithValue(r.Context(), trustedProxyKey{}, true)
+		r = r.WithContext(context.WithValue(ctx, forwardedHTTPSKey{}, https))
+
+		if header := r.Header.Get(headerForwardedFor); header != "" && a.cfg.honorsProxyHeader(headerForwardedFor) {
+			// the client is the nearest address that isn't another
+			// trusted proxy
+			addrs := strings.Split(header, ",")
+			for i := len(addrs) - 1; i >= 0; i-- {
+				ip := net.ParseIP(strings.TrimSpace(addrs[i]))
+				if ip == nil {
+					break
+				}
+				r.RemoteAddr = ip.String()
+				if !a.trustedProxy(r.RemoteAddr) {
+					break
+				}
+			}
+		}
+
+		if !https || a.cfg.CookieSecure {
+			next.ServeHTTP(w, r)
+			return
+		}
+		sw := &secureCookieWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r)
+		if !sw.wroteHeader {
+			// the server sends the headers once the handler returns
+			sw.markSecure()
+		}
+	})
+}
+
+// secureCookieWriter marks the cookies set by the handler Secure, for
+// requests that reached the proxy in front of gangway over HTTPS.
+type secureCookieWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (sw *secureCookieWriter) WriteHeader(code int) {
+	if sw.wroteHeader {
+		return
+	}
+	sw.wroteHeader = true
+	sw.markSecure()
+	sw.ResponseWriter.WriteHeader(code)
+}
+
+// markSecure adds the Secure attribute to the cookies set so far.
+func (sw *secureCookieWriter) markSecure() {
+	cookies := sw.Header()["Set-Cookie"]
+	for i, cookie := range cookies {
+		if !hasCookieAttribute(cookie, "Secure") {
+			cookies[i] = cookie + "; Secure"
+		}
+	}
+}
+
+func (sw *secureCookieWriter) Write(p []byte) (int, error) {
+	if !sw.wroteHeader {
+		sw.WriteHeader(http.StatusOK)
+	}
+	return sw.ResponseWriter.Write(p)
+}
+
+// Unwrap returns the writer underneath, see setWriteDeadline.
+func (sw *secureCookieWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
+
+// Flush sends what was written so far, for streamed responses.
+func (sw *secureCookieWriter) Flush() {
+	if !sw.wroteHeader {
+		sw.WriteHeader(http.StatusOK)
+	}
+	if f, ok := sw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// hasCookieAttribute reports whether the Set-Cookie header value has the
+// attribute name.
+func hasCookieAttribute(cookie, name string) bool {
+	for _, attr := range strings.Split(cookie, ";")[1:] {
+		if strings.EqualFold(strings.TrimSpace(attr), name) {
+			return true
+		}
+	}
+	return false
+}
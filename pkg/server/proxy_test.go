@@ -0,0 +1,134 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestForwardedHeaders(t *testing.T) {
+	tests := []struct {
+		name         string
+		proxyHeaders []string
+		remoteAddr   string
+		headers      map[string]string
+		wantAddr     string
+		wantBasePath string
+		wantHTTPS    bool
+	}{
+		{
+			name:       "trusted proxy",
+			remoteAddr: "10.0.0.2:41000",
+			headers: map[string]string{
+				"X-Forwarded-Proto":  "https",
+				"X-Forwarded-Prefix": "/gangway",
+				"X-Forwarded-For":    "203.0.113.7",
+			},
+			wantAddr: "203.0.113.7", wantBasePath: "/gangway", wantHTTPS: true,
+		},
+		{
+			name:       "untrusted client",
+			remoteAddr: "192.0.2.1:41000",
+			headers: map[string]string{
+				"X-Forwarded-Proto":  "https",
+				"X-Forwarded-Prefix": "/evil",
+				"X-Forwarded-For":    "203.0.113.7",
+			},
+			wantAddr: "192.0.2.1:41000",
+		},
+		{
+			name:       "chain of proxies",
+			remoteAddr: "10.0.0.2:41000",
+			headers: map[string]string{
+				"X-Forwarded-Proto": "http, https",
+				"X-Forwarded-For":   "198.51.100.1, 203.0.113.7, 10.0.0.3",
+			},
+			wantAddr: "203.0.113.7", wantHTTPS: true,
+		},
+		{
+			name:       "bad prefix",
+			remoteAddr: "10.0.0.2:41000",
+			headers:    map[string]string{"X-Forwarded-Prefix": `/"><script>`},
+			wantAddr:   "10.0.0.2:41000",
+		},
+		{
+			name:         "only listed headers",
+			proxyHeaders: []string{"x-forwarded-for"},
+			remoteAddr:   "10.0.0.2:41000",
+			headers: map[string]string{
+				"X-Forwarded-Proto":  "https",
+				"X-Forwarded-Prefix": "/gangway",
+				"X-Forwarded-For":    "203.0.113.7",
+			},
+			wantAddr: "203.0.113.7",
+		},
+	}
+	for _, tc := range tests {
+		a := newTestApp(t)
+		a.cfg.TrustedProxies = []string{"10.0.0.0/8"}
+		a.cfg.ProxyHeaders = tc.proxyHeaders
+		nets, err := parseCIDRs(a.cfg.TrustedProxies)
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.trustedProxyNets = nets
+
+		var got *http.Request
+		h := a.forwardedHeaders(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = r
+			http.SetCookie(w, &http.Cookie{Name: "gangway_session", Value: "x", HttpOnly: true})
+		}))
+		req := httptest.NewRequest("GET", "http://example.com/", nil)
+		req.RemoteAddr = tc.remoteAddr
+		for k, v := range tc.headers {
+			req.Header.Set(k, v)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+
+		if got.RemoteAddr != tc.wantAddr {
+			t.Errorf("%s: client address %q, want %q", tc.name, got.RemoteAddr, tc.wantAddr)
+		}
+		if basePath := a.basePath(got); basePath != tc.wantBasePath {
+			t.Errorf("%s: base path %q, want %q", tc.name, basePath, tc.wantBasePath)
+		}
+		if https := forwardedHTTPS(got); https != tc.wantHTTPS {
+			t.Errorf("%s: forwarded HTTPS %v, want %v", tc.name, https, tc.wantHTTPS)
+		}
+		if secure := strings.HasSuffix(rr.Header().Get("Set-Cookie"), "; Secure"); secure != tc.wantHTTPS {
+			t.Errorf("%s: cookie %q, want Secure %v", tc.name, rr.Header().Get("Set-Cookie"), tc.wantHTTPS)
+		}
+	}
+}
+
+func TestHasCookieAttribute(t *testing.T) {
+	tests := []struct {
+		cookie string
+		want   bool
+	}{
+		{"a=b; Path=/; Secure", true},
+		{"a=b; secure; HttpOnly", true},
+		{"Secure=b; Path=/", false},
+		{"a=b; SameSite=Lax", false},
+	}
+	for _, tc := range tests {
+		if got := hasCookieAttribute(tc.cookie, "Secure"); got != tc.want {
+			t.Errorf("hasCookieAttribute(%q) = %v, want %v", tc.cookie, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// The statuses of readiness checks, from best to worst.
+const (
+	checkSkipped  = "skipped"
+	checkOK       = "ok"
+	checkDegraded = "degraded"
+	checkDown     = "down"
+)
+
+// readinessCheck is the state of one dependency in the verbose /readyz
+// report. AgeSeconds and DaysLeft are set for the checks they apply to, so
+// that dashboards can graph them.
+type readinessCheck struct {
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	Detail     string `json:"detail,omitempty"`
+	AgeSeconds *int64 `json:"ageSeconds,omitempty"`
+	DaysLeft   *int   `json:"daysLeft,omitempty"`
+}
+
+type readinessReport struct {
+	// Status is the worst status of the checks.
+	Status string           `json:"status"`
+	Checks []readinessCheck `json:"checks"`
+}
+
+// checkSeverity orders the check statuses.
+var checkSeverity = map[string]int{checkSkipped: 0, checkOK: 0, checkDegraded: 1, checkDown: 2}
+
+// readinessReport checks gangway's dependencies for /readyz?verbose=1.
+func (s *Server) readinessReport(now time.Time) *readinessReport {
+	a := s.acquire()
+	defer a.mu.RUnlock()
+
+	checks := []readinessCheck{s.servingCheck(), {Name: "config", Status: checkOK, Detail: fmt.Sprintf("applied for cluster %q", a.cfg.ClusterName)}}
+	checks = append(checks, a.sessionStoreCheck(), a.discoveryCheck(s.discovery, now), a.signingKeysCheck(now), a.servingCertCheck(now))
+
+	report := &readinessReport{Status: checkOK, Checks: checks}
+	for _, c := range checks {
+		if checkSeverity[c.Status] > checkSeverity[report.Status] {
+			report.Status = c.Status
+		}
+	}
+	return report
+}
+
+func (s *Server) servingCheck() readinessCheck {
+	c := readinessCheck{Name: "serving", Status: checkOK}
+	switch {
+	case atomic.LoadInt32(&s.draining) == 1:
+		c.Status, c.Detail = checkDown, "shutting down"
+	case atomic.LoadInt32(&s.ready) == 0:
+		c.Status, c.Detail = checkDown, "warming up"
+	}
+	return c
+}
+
+// sessionStoreCheck looks up a session that doesn't exist, which any working
+// backend answers.
+func (a *app) sessionStoreCheck() readinessCheck {
+	c := readinessCheck{Name: "session store", Status: checkOK, Detail: a.cfg.SessionStore}
+	store, ok := a.sessionStore.(*serverSideStore)
+	if !ok {
+		return c
+	}
+	if _, _, err := store.backend.load(backendKey("readyz")); err != nil {
+		c.Status, c.Detail = checkDown, fmt.Sprintf("%s: %v", a.cfg.SessionStore, err)
+	}
+	return c
+}
+
+// discoveryCheck reports how old the identity provider's metadata is. It is
+// refetched once it is older than discoveryMaxAge, so metadata much older
+// than that means the provider can't be reached.
+func (a *app) discoveryCheck(discovery *discoveryCache, now time.Time) readinessCheck {
+	c := readinessCheck{Name: "identity provider discovery", Status: checkSkipped}
+	if a.cfg.IssuerURL == "" {
+		return c
+	}
+	fetched, ok := discovery.fetched(a.cfg.IssuerURL)
+	if !ok {
+		c.Status, c.Detail = checkDegraded, "not fetched yet"
+		return c
+	}
+	age := now.Sub(fetched)
+	c.Status, c.AgeSeconds = checkOK, ageSeconds(age)
+	if age > 2*discoveryMaxAge {
+		c.Status, c.Detail = checkDegraded, "could not be refetched; using older metadata"
+	}
+	return c
+}
+
+// signingKeysCheck reports how old the identity provider's signing keys are.
+// They are fetched with the first ID token to verify and again whenever one
+// is signed with a key that isn't known yet.
+func (a *app) signingKeysCheck(now time.Time) readinessCheck {
+	c := readinessCheck{Name: "signing keys", Status: checkSkipped}
+	if a.keys == nil {
+		return c
+	}
+	c.Status = checkOK
+	fetched := a.keys.lastFetched()
+	if fetched.IsZero() {
+		c.Detail = "not fetched yet"
+		return c
+	}
+	c.AgeSeconds = ageSeconds(now.Sub(fetched))
+	return c
+}
+
+// servingCertCheck reports how many days the serving certificate has left.
+func (a *app) servingCertCheck(now time.Time) readinessCheck {
+	c := readinessCheck{Name: "serving certificate", Status: checkSkipped}
+	if !a.cfg.ServeTLS {
+		return c
+	}
+	notAfter, err := certificateExpiry(a.cfg.CertFile)
+	if err != nil {
+		c.Status, c.Detail = checkDown, err.Error()
+		return c
+	}
+	left := notAfter.Sub(now)
+	days := int(left / (24 * time.Hour))
+	c.Status, c.DaysLeft = checkOK, &days
+	switch {
+	case left <= 0:
+		c.Status, c.Detail = checkDown, "expired"
+	case left < a.cfg.CertExpiryWarning:
+		c.Status, c.Detail = checkDegraded, "expires soon"
+	}
+	return c
+}
+
+func ageSeconds(age time.Duration) *int64 {
+	seconds := int64(age / time.Second)
+	return &seconds
+}
+
+// serveReadinessReport writes the verbose /readyz report. Degraded
+// dependencies don't make gangway unready, so the status code is the same as
+// for the plain probe.
+func (s *Server) serveReadinessReport(w http.ResponseWriter, now time.Time) {
+	report := s.readinessReport(now)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if report.Checks[0].Status == checkDown {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,203 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// redacted replaces credentials in logs.
+const redacted = "REDACTED"
+
+// sensitiveParams are the query and form parameters that carry credentials,
+// such as the authorization code on the callback URL.
+var sensitiveParams = []string{
+	"access_token", "client_secret", "code", "code_verifier", "device_code",
+	"id_token", "id_token_hint", "logout_token", "refresh_token", "state", "token",
+}
+
+var (
+	// jwtPattern matches JSON Web Tokens, such as ID tokens.
+	jwtPattern = regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+	// sensitiveParamPattern matches sensitiveParams in URLs and forms
+	// written into log messages.
+	sensitiveParamPattern = regexp.MustCompile(`\b(` + strings.Join(sensitiveParams, "|") + `)=[^&\s"'<>]+`)
+	// bearerPattern matches bearer tokens in Authorization headers.
+	bearerPattern = regexp.MustCompile(`(?i)\b(bearer\s+)[A-Za-z0-9._~+/=-]+`)
+	// cookiePattern matches gangway's cookies, such as the session.
+	cookiePattern = regexp.MustCompile(`\b(gangway[A-Za-z0-9_-]*)=[^;\s"']+`)
+)
+
+// logRedactor scrubs credentials from every log entry, whatever its level,
+// so that no code path can log them by accident. It is hooked into the
+// standard logger, which gangway logs to, when the first Server is created
+// rather than when the package is imported.
+var (
+	logRedactor     = &redactor{}
+	hookLogRedactor sync.Once
+)
+
+// redactor is a logrus hook that redacts credentials from messages and
+// fields. On top of the patterns it knows, it removes the secrets of the
+// config applied by each of its sources, the Servers, wherever they appear:
+// the Servers of a process share the standard logger, so none of them may
+// log another's secrets either.
+type redactor struct {
+	mu      sync.RWMutex
+	sources map[interface{}]*redactSource
+	// secrets and cookies are those of all sources.
+	secrets []string
+	cookies []*regexp.Regexp
+}
+
+type redactSource struct {
+	secrets []string
+	// cookie matches the session cookie when its name isn't covered by
+	// cookiePattern.
+	cookie *regexp.Regexp
+}
+
+// setSecrets replaces the config secrets of source to remove. Secrets
+// shorter than four characters are ignored rather than redacting every
+// occurrence of them.
+func (r *redactor) setSecrets(source interface{}, secrets ...string) {
+	var keep []string
+	for _, s := range secrets {
+		if len(s) >= 4 {
+			keep = append(keep, s)
+		}
+	}
+	r.mu.Lock()
+	r.source(source).secrets = keep
+	r.merge()
+	r.mu.Unlock()
+}
+
+// setCookieName makes the redactor also remove the values of cookies called
+// name, the session cookie name configured for source.
+func (r *redactor) setCookieName(source interface{}, name string) {
+	var cookie *regexp.Regexp
+	if !cookiePattern.MatchString(name + "=value") {
+		cookie = regexp.MustCompile(`\b(` + regexp.QuoteMeta(name) + `)=[^;\s"']+`)
+	}
+	r.mu.Lock()
+	r.source(source).cookie = cookie
+	r.merge()
+	r.mu.Unlock()
+}
+
+// source returns the redactions of source. r.mu must be held.
+func (r *redactor) source(source interface{}) *redactSource {
+	if r.sources == nil {
+		r.sources = map[interface{}]*redactSource{}
+	}
+	if r.sources[source] == nil {
+		r.sources[source] = &redactSource{}
+	}
+	return r.sources[source]
+}
+
+// merge collects the secrets and cookies of all sources. r.mu must be held.
+func (r *redactor) merge() {
+	seen := map[string]bool{}
+	r.secrets, r.cookies = nil, nil
+	for _, src := range r.sources {
+		for _, s := range src.secrets {
+			if !seen[s] {
+				seen[s] = true
+				r.secrets = append(r.secrets, s)
+			}
+		}
+		if src.cookie != nil {
+			r.cookies = append(r.cookies, src.cookie)
+		}
+	}
+	// longest first, so that a secret containing another is removed whole
+	sort.Slice(r.secrets, func(i, j int) bool { return len(r.secrets[i]) > len(r.secrets[j]) })
+}
+
+// redact returns s with credentials replaced.
+func (r *redactor) redact(s string) string {
+	r.mu.RLock()
+	for _, secret := range r.secrets {
+		s = strings.Replace(s, secret, redacted, -1)
+	}
+	for _, cookie := range r.cookies {
+		s = cookie.ReplaceAllString(s, "${1}="+redacted)
+	}
+	r.mu.RUnlock()
+	s = jwtPattern.ReplaceAllString(s, redacted)
+	s = sensitiveParamPattern.ReplaceAllString(s, "${1}="+redacted)
+	s = bearerPattern.ReplaceAllString(s, "${1}"+redacted)
+	return cookiePattern.ReplaceAllString(s, "${1}="+redacted)
+}
+
+func (r *redactor) Levels() []log.Level {
+	return log.AllLevels
+}
+
+// Fire redacts the message and fields of entry. The fields are copied, as the
+// map may be shared with other entries.
+func (r *redactor) Fire(entry *log.Entry) error {
+	entry.Message = r.redact(entry.Message)
+	data := make(log.Fields, len(entry.Data))
+	for k, v := range entry.Data {
+		switch v := v.(type) {
+		case string:
+			data[k] = r.redact(v)
+		case error:
+			data[k] = r.redact(v.Error())
+		default:
+			data[k] = v
+		}
+	}
+	entry.Data = data
+	return nil
+}
+
+// redactURL returns u for logging, with the values of sensitiveParams and any
+// password replaced.
+func redactURL(u *url.URL) string {
+	clean := *u
+	if clean.User != nil {
+		if _, ok := clean.User.Password(); ok {
+			clean.User = url.UserPassword(clean.User.Username(), redacted)
+		}
+	}
+	q := clean.Query()
+	for _, param := range sensitiveParams {
+		if _, ok := q[param]; ok {
+			q.Set(param, redacted)
+		}
+	}
+	if len(q) > 0 {
+		clean.RawQuery = q.Encode()
+	}
+	return clean.String()
+}
+
+// secrets returns the secrets in c, which must never be logged.
+func (c *Config) secrets() []string {
+	return append([]string{c.ClientSecret, c.AdminToken, c.DeprovisionToken,
+		c.CaptchaSecretKey, c.AuditSASLPassword, c.AuditSigningKey, c.SessionRedisPassword,
+		c.SessionSQLDSN},
+		c.SessionSecurityKey...)
+}
@@ -0,0 +1,93 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// returnToParam is the query parameter carrying where to send the user after
+// login or logout.
+const returnToParam = "return_to"
+
+// safeRedirect reports whether target may be used as a redirect destination.
+// Paths on gangway's own origin are always allowed. Absolute URLs must use
+// http(s) and match an entry in Config.AllowedRedirects. Every user-influenced
+// redirect must go through this check so gangway can't be used as an open
+// redirector.
+func (a *app) safeRedirect(target string) bool {
+	if target == "" || strings.ContainsAny(target, "\\\r\n\t") {
+		return false
+	}
+
+	u, err := url.Parse(target)
+	if err != nil || u.Opaque != "" || u.User != nil {
+		return false
+	}
+
+	if u.Scheme == "" && u.Host == "" {
+		// "//host" would be protocol-relative, so require a single slash
+		return strings.HasPrefix(target, "/") && !strings.HasPrefix(target, "//")
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return false
+	}
+	for _, allowed := range a.cfg.AllowedRedirects {
+		if redirectAllowed(allowed, u) {
+			return true
+		}
+	}
+	return false
+}
+
+// redirectAllowed matches u against an allowlist entry of the form host or
+// host/path. A host of *.example.com matches any subdomain of example.com,
+// and a path matches itself and anything below it.
+func redirectAllowed(allowed string, u *url.URL) bool {
+	host, prefix := allowed, ""
+	if i := strings.Index(allowed, "/"); i >= 0 {
+		host, prefix = allowed[:i], path.Clean(allowed[i:])
+	}
+
+	target := strings.ToLower(u.Host)
+	host = strings.ToLower(host)
+	if strings.HasPrefix(host, "*.") {
+		if !strings.HasSuffix(target, host[1:]) {
+			return false
+		}
+	} else if target != host {
+		return false
+	}
+
+	if prefix == "" || prefix == "/" {
+		return true
+	}
+	p := path.Clean("/" + u.Path)
+	return p == prefix || strings.HasPrefix(p, prefix+"/")
+}
+
+// returnTo returns the validated return_to parameter of r, or fallback if it
+// is missing or not allowed.
+func (a *app) returnTo(r *http.Request, fallback string) string {
+	target := r.URL.Query().Get(returnToParam)
+	if !a.safeRedirect(target) {
+		return fallback
+	}
+	return target
+}
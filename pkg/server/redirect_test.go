@@ -0,0 +1,82 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestSafeRedirect(t *testing.T) {
+	a := newTestApp(t)
+	a.cfg.AllowedRedirects = []string{"portal.example.com", "*.docs.example.com", "wiki.example.com/kubernetes"}
+
+	tests := []struct {
+		target string
+		want   bool
+	}{
+		{"", false},
+		{"/commandline", true},
+		{"/gangway/commandline?cluster=prod", true},
+		{"//evil.example.org/", false},
+		{"/\\evil.example.org/", false},
+		{"commandline", false},
+		{"https://portal.example.com/", true},
+		{"https://PORTAL.example.com/teams", true},
+		{"http://portal.example.com", true},
+		{"https://portal.example.com.evil.org/", false},
+		{"https://portal.example.com@evil.org/", false},
+		{"https://user@portal.example.com/", false},
+		{"https://portal.example.com:8443/", false},
+		{"https://a.docs.example.com/x", true},
+		{"https://docs.example.com/x", false},
+		{"https://evildocs.example.com/x", false},
+		{"https://wiki.example.com/kubernetes", true},
+		{"https://wiki.example.com/kubernetes/onboarding", true},
+		{"https://wiki.example.com/kubernetes-evil", false},
+		{"https://wiki.example.com/kubernetes/../admin", false},
+		{"https://wiki.example.com/", false},
+		{"javascript:alert(1)", false},
+		{"ftp://portal.example.com/", false},
+		{"https://evil.org/\r\nLocation: x", false},
+	}
+	for _, tc := range tests {
+		if got := a.safeRedirect(tc.target); got != tc.want {
+			t.Errorf("a.safeRedirect(%q) = %v, want %v", tc.target, got, tc.want)
+		}
+	}
+}
+
+func TestLogoutReturnTo(t *testing.T) {
+	a := newTestApp(t)
+	a.cfg.AllowedRedirects = []string{"portal.example.com"}
+
+	tests := []struct {
+		returnTo string
+		want     string
+	}{
+		{"", "/login"},
+		{"https://portal.example.com/", "https://portal.example.com/"},
+		{"https://evil.org/", "/login"},
+	}
+	for _, tc := range tests {
+		rr := httptest.NewRecorder()
+		a.logoutHandler(rr, httptest.NewRequest("GET", "/logout?return_to="+url.QueryEscape(tc.returnTo), nil))
+		if location := rr.Header().Get("Location"); location != tc.want {
+			t.Errorf("logout with return_to=%q redirected to %q, want %q", tc.returnTo, location, tc.want)
+		}
+	}
+}
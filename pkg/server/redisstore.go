@@ -0,0 +1,96 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// redisDialTimeout bounds connecting to Redis, so that an unreachable server
+// fails requests instead of hanging them.
+const redisDialTimeout = 5 * time.Second
+
+// redisSessions is a session backend for Redis, which replicas behind a load
+// balancer can share. Redis expires entries by itself, so it needs no purging.
+type redisSessions struct {
+	pool   *redis.Pool
+	prefix string
+}
+
+func newRedisSessions(address, password string, useTLS bool, prefix string) *redisSessions {
+	options := []redis.DialOption{
+		redis.DialConnectTimeout(redisDialTimeout),
+		redis.DialUseTLS(useTLS),
+	}
+	if password != "" {
+		options = append(options, redis.DialPassword(password))
+	}
+	return &redisSessions{
+		pool: &redis.Pool{
+			Dial: func() (redis.Conn, error) {
+				return redis.Dial("tcp", address, options...)
+			},
+			MaxIdle:     10,
+			IdleTimeout: 5 * time.Minute,
+		},
+		prefix: prefix,
+	}
+}
+
+// redisExpiration converts expires to the milliseconds from now that Redis's
+// PX option takes. Redis refuses anything below 1.
+func redisExpiration(expires, now time.Time) int64 {
+	ms := int64(expires.Sub(now) / time.Millisecond)
+	if ms < 1 {
+		ms = 1
+	}
+	return ms
+}
+
+func (s *redisSessions) load(key string) (string, bool, error) {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	data, err := redis.String(conn.Do("GET", s.prefix+key))
+	if err == redis.ErrNil {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return data, true, nil
+}
+
+func (s *redisSessions) save(key, data string, expires time.Time) error {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("SET", s.prefix+key, data, "PX", redisExpiration(expires, time.Now()))
+	return err
+}
+
+func (s *redisSessions) delete(key string) error {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("DEL", s.prefix+key)
+	return err
+}
+
+func (s *redisSessions) close() error {
+	return s.pool.Close()
+}
@@ -0,0 +1,98 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// refreshHandler renews the signed in user's ID token with the refresh token
+// kept in their session, so that kubectl commands with fresh credentials can
+// be had without going through the identity provider's sign in again.
+func (a *app) refreshHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	session, err := a.sessionStore.Get(r, a.cfg.sessionCookieName())
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	idToken, _ := session.Values["id_token"].(string)
+	sealed, _ := session.Values["refresh_token"].(string)
+	refreshToken, err := a.openRefreshToken(sessionID(session), sealed)
+	if err != nil || refreshToken == "" {
+		// nothing to refresh with, the user has to sign in again
+		a.cleanupSession(w, r)
+		http.Redirect(w, r, a.appURL(r, "/login"), http.StatusSeeOther)
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), oauth2.HTTPClient, a.httpClient)
+	token, err := a.oauth2For(a.useStandby(ctx)).TokenSource(ctx, &oauth2.Token{RefreshToken: refreshToken}).Token()
+	if err != nil {
+		if _, ok := err.(*oauth2.RetrieveError); ok {
+			// revoked, expired or already used; the provider decided
+			requestLog(r).Infof("Identity provider refused the refresh token: %s", err)
+			a.audit(r, auditLoginFailed, a.idTokenUser(idToken), "refresh_refused")
+			a.cleanupSession(w, r)
+			http.Redirect(w, r, a.appURL(r, "/login"), http.StatusSeeOther)
+			return
+		}
+		requestLog(r).Errorf("Could not refresh the ID token: %s", err)
+		a.serveErrorPage(w, r, http.StatusBadGateway, "gangway could not reach your identity provider to renew your credentials.", "Please try again. If this keeps happening, contact your administrator.")
+		return
+	}
+	// a refreshed ID token has no nonce, as no authorization request was made
+	if err := a.verifyIDToken(token, "", time.Now()); err != nil {
+		a.serveCallbackError(w, r, errIDTokenInvalid, err)
+		return
+	}
+	if iss, mismatch := a.checkIssuer(token); mismatch != "" {
+		requestLog(r).Errorf("ID token issuer %q does not match issuerURL %q: %s", iss, a.cfg.IssuerURL, mismatch)
+		a.serveError(w, r, http.StatusBadGateway, "The identity provider issued a token this cluster does not trust. Please contact your administrator.")
+		return
+	}
+
+	// providers that don't rotate refresh tokens may not send one back
+	if token.RefreshToken == "" {
+		token.RefreshToken = refreshToken
+	}
+	sealed, err = a.sealRefreshToken(sessionID(session), token.RefreshToken)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	session.Values["id_token"] = token.Extra("id_token")
+	session.Values["refresh_token"] = sealed
+	if groups, err := a.fetchGroups(ctx, token); err != nil {
+		requestLog(r).Warnf("%s", err)
+	} else if len(groups) > 0 {
+		session.Values["groups"] = groups
+	}
+	if err := session.Save(r, w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	a.recordTokenSizes(w, r, token)
+	a.audit(r, auditRefresh, a.tokenUser(token), "")
+	http.Redirect(w, r, a.appURL(r, "/commandline"), http.StatusSeeOther)
+}
@@ -0,0 +1,74 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"net/http"
+	"regexp"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// requestIDHeader carries the request ID, both from proxies that already
+// assigned one and back to the client.
+const requestIDHeader = "X-Request-ID"
+
+// requestIDPattern limits the request IDs accepted from proxies to ones that
+// are safe to log and show on pages.
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// requestIDEncoding leaves out letters that are easily confused when read out
+// or typed into a support ticket.
+var requestIDEncoding = base32.NewEncoding("ABCDEFGHJKLMNPQRSTUVWXYZ23456789").WithPadding(base32.NoPadding)
+
+type requestIDKey struct{}
+
+// newRequestID returns a short code such as "K7QM-2XWD".
+func newRequestID() string {
+	b := make([]byte, 5)
+	rand.Read(b)
+	id := requestIDEncoding.EncodeToString(b)
+	return id[:4] + "-" + id[4:]
+}
+
+// withRequestID gives every request an ID, taken from the X-Request-ID header
+// if a trusted proxy set one. The ID is returned in the same header, logged
+// with the request, and shown on error pages so users can quote it to
+// operators. Clients can't choose their own: the ID also names the login's
+// transcript, which another login could otherwise take over.
+func (a *app) withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !requestIDPattern.MatchString(id) || !a.trustedProxy(r.RemoteAddr) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// requestID returns the ID of r, or "" if it has none.
+func requestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey{}).(string)
+	return id
+}
+
+// requestLog returns a logger that tags entries with the ID of r.
+func requestLog(r *http.Request) *log.Entry {
+	return log.WithField("request_id", requestID(r))
+}
@@ -0,0 +1,109 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// secretFile pairs a secret of the config with the option naming a file to
+// read it from.
+type secretFile struct {
+	name   string
+	path   *string
+	secret *string
+}
+
+func (c *Config) secretFiles() []secretFile {
+	return []secretFile{
+		{"clientSecret", &c.ClientSecretFile, &c.ClientSecret},
+		{"adminToken", &c.AdminTokenFile, &c.AdminToken},
+		{"deprovisionToken", &c.DeprovisionTokenFile, &c.DeprovisionToken},
+		{"captchaSecretKey", &c.CaptchaSecretKeyFile, &c.CaptchaSecretKey},
+		{"sessionSQLDSN", &c.SessionSQLDSNFile, &c.SessionSQLDSN},
+		{"sessionRedisPassword", &c.SessionRedisPasswordFile, &c.SessionRedisPassword},
+		{"auditSASLPassword", &c.AuditSASLPasswordFile, &c.AuditSASLPassword},
+		{"auditSigningKey", &c.AuditSigningKeyFile, &c.AuditSigningKey},
+	}
+}
+
+// MoveSecretsToFiles takes the secrets set in c out of it, pointing their
+// *File options at dir/<option> instead, and returns them keyed by option.
+// `gangway manifests` uses it to put the secrets into a Kubernetes Secret
+// rather than the ConfigMap. The session security key is left alone.
+func (c *Config) MoveSecretsToFiles(dir string) map[string]string {
+	secrets := map[string]string{}
+	for _, f := range c.secretFiles() {
+		if *f.secret == "" {
+			continue
+		}
+		secrets[f.name] = *f.secret
+		*f.secret = ""
+		*f.path = dir + "/" + f.name
+	}
+	return secrets
+}
+
+// readSecretFile returns the contents of the secret file of option name,
+// without the trailing newline editors and `echo` leave behind.
+func readSecretFile(name, path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("%sFile: %v", name, err)
+	}
+	secret := strings.TrimRight(string(data), "\r\n")
+	if secret == "" {
+		return "", fmt.Errorf("%sFile: %s is empty", name, path)
+	}
+	return secret, nil
+}
+
+// loadSecretFiles reads the secrets of the *File options into c. A secret
+// that is also set in the config or environment is refused, since it isn't
+// clear which one is meant. The session security key file holds one key per
+// line, the current one first, like a sessionSecurityKey list.
+func (c *Config) loadSecretFiles() error {
+	for _, f := range c.secretFiles() {
+		if *f.path == "" {
+			continue
+		}
+		if *f.secret != "" {
+			return fmt.Errorf("%s is set both inline (or through the environment) and through %sFile; use one", f.name, f.name)
+		}
+		secret, err := readSecretFile(f.name, *f.path)
+		if err != nil {
+			return err
+		}
+		*f.secret = secret
+	}
+
+	if c.SessionSecurityKeyFile != "" {
+		if len(c.SessionSecurityKey) > 0 {
+			return fmt.Errorf("sessionSecurityKey is set both inline (or through the environment) and through sessionSecurityKeyFile; use one")
+		}
+		keys, err := readSecretFile("sessionSecurityKey", c.SessionSecurityKeyFile)
+		if err != nil {
+			return err
+		}
+		for _, key := range strings.Split(keys, "\n") {
+			if key = strings.TrimSpace(key); key != "" {
+				c.SessionSecurityKey = append(c.SessionSecurityKey, key)
+			}
+		}
+	}
+	return nil
+}
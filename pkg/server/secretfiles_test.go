@@ -0,0 +1,83 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSecretFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gangway")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// set by other tests
+	for _, env := range []string{"GANGWAY_CLIENT_SECRET", "GANGWAY_SESSION_SECURITY_KEY"} {
+		if value, ok := os.LookupEnv(env); ok {
+			os.Unsetenv(env)
+			defer os.Setenv(env, value)
+		}
+	}
+
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	clientSecret := write("client-secret", "s3cret\n")
+	sessionKeys := write("session-keys", "new-key\nold-key\n\n")
+	empty := write("empty", "\n")
+
+	config := write("gangway.yaml", "clientSecretFile: "+clientSecret+"\nsessionSecurityKeyFile: "+sessionKeys+"\n")
+	c, err := LoadConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.ClientSecret != "s3cret" {
+		t.Errorf("got client secret %q", c.ClientSecret)
+	}
+	if !reflect.DeepEqual(c.SessionSecurityKey, SessionKeys{"new-key", "old-key"}) {
+		t.Errorf("got session keys %q", c.SessionSecurityKey)
+	}
+
+	// tools without the secrets leave the files alone
+	missing := write("missing.yaml", "clientSecretFile: "+filepath.Join(dir, "nope")+"\n")
+	if c, err := LoadConfigWithoutSecretFiles(missing); err != nil || c.ClientSecret != "" {
+		t.Errorf("got %q, %v without reading secret files", c.ClientSecret, err)
+	}
+
+	tests := []struct {
+		yaml, want string
+	}{
+		{"clientSecret: inline\nclientSecretFile: " + clientSecret, "clientSecret is set both inline"},
+		{"sessionSecurityKey: inline\nsessionSecurityKeyFile: " + sessionKeys, "sessionSecurityKey is set both inline"},
+		{"adminTokenFile: " + empty, "adminTokenFile: " + empty + " is empty"},
+		{"auditSigningKeyFile: " + filepath.Join(dir, "nope"), "auditSigningKeyFile: open"},
+	}
+	for _, tc := range tests {
+		_, err := LoadConfig(write("bad.yaml", tc.yaml+"\n"))
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%q: got error %v, want %q", tc.yaml, err, tc.want)
+		}
+	}
+}
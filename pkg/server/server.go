@@ -0,0 +1,493 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package server implements gangway's web application, so that it can be
+// embedded in other Go programs as well as run by cmd/gangway.
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
+
+	"github.com/gorilla/sessions"
+	"github.com/justinas/alice"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/oauth2"
+)
+
+// Server serves gangway for a Config. It is an http.Handler, and several can
+// run side by side in one process.
+type Server struct {
+	// 64-bit atomics come first so they stay aligned on 32-bit platforms.
+	inFlight          int64
+	loginStateMetrics loginStateCounters
+	janitorMetrics    janitorCounters
+	ready             int32
+	draining          int32
+
+	// app holds the *app for the config in effect.
+	app     atomic.Value
+	applyMu sync.Mutex
+
+	limiter     *rateLimiter
+	stats       *usageStats
+	revocations *logoutRevocations
+	transcripts *transcriptStore
+	clock       *clock
+	chaos       *idpChaos
+	discovery   *discoveryCache
+	keyPairs    *keyPairCache
+	// sessionMetrics measures the server-side session stores
+	sessionMetrics *sessionStoreMetrics
+	tokenSizes     *tokenSizeMetrics
+	handler        http.Handler
+}
+
+// app serves requests for one applied config. Everything in it is derived
+// from that config and is never modified, so handlers use it without locking;
+// ApplyConfig builds a new app rather than changing the current one.
+type app struct {
+	cfg               *Config
+	oauth2Cfg         *oauth2.Config
+	sessionStore      sessions.Store
+	httpClient        *http.Client
+	loginStates       loginStateStore
+	auditSink         *auditSink
+	allowedClientNets []*net.IPNet
+	trustedProxyNets  []*net.IPNet
+	// authn is the API server's authenticator for the issuer, if known.
+	authn *jwtAuthenticator
+	// keys are the identity provider's signing keys, if JWKSURL is known.
+	keys *keySet
+	// kubeconfigTmpl is the operator's kubeconfig template, if any.
+	kubeconfigTmpl *template.Template
+	// failover tracks the primary identity provider if there is a standby.
+	failover *idpFailover
+
+	// shared by every app of the same Server
+	limiter     *rateLimiter
+	stats       *usageStats
+	revocations *logoutRevocations
+	transcripts *transcriptStore
+	clock       *clock
+	chaos       *idpChaos
+	discovery   *discoveryCache
+	tokenSizes  *tokenSizeMetrics
+	inFlight    *int64
+
+	handler http.Handler
+
+	// mu is read-locked while the app serves a request and write-locked once
+	// it has been replaced, to release what the next app doesn't reuse.
+	mu      sync.RWMutex
+	retired bool
+}
+
+// New returns a Server for c, which must have been validated, e.g. by
+// NewConfig.
+func New(c *Config) (*Server, error) {
+	s := &Server{
+		limiter:     newRateLimiter(),
+		stats:       newUsageStats(),
+		revocations: newLogoutRevocations(),
+		transcripts: newTranscriptStore(),
+		clock:       &clock{},
+		chaos:       newIdPChaos(),
+		discovery:   newDiscoveryCache(),
+		keyPairs:    newKeyPairCache(),
+
+		sessionMetrics: newSessionStoreMetrics(),
+		tokenSizes:     newTokenSizeMetrics(),
+	}
+	hookLogRedactor.Do(func() { log.AddHook(logRedactor) })
+	if err := s.ApplyConfig(c); err != nil {
+		return nil, err
+	}
+
+	// Health probes and metrics are served outside the app so they keep
+	// answering while gangway is busy.
+	s.handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if probe := s.probe(r.URL.Path); probe != nil {
+			probe(w, r)
+			return
+		}
+		a := s.acquire()
+		defer a.mu.RUnlock()
+		a.handler.ServeHTTP(w, r)
+	})
+	return s, nil
+}
+
+// probe returns the handler of the health probe or metrics at path, or nil if
+// path is none of them. They are served both at the root and under httpPath.
+func (s *Server) probe(path string) http.HandlerFunc {
+	if route, ok := s.Config().routePath(path); ok {
+		path = route
+	}
+	switch path {
+	case "/healthz":
+		return s.healthzHandler
+	case "/readyz":
+		return s.readyzHandler
+	case "/metrics":
+		return s.metricsHandler
+	}
+	return nil
+}
+
+// Config returns the config in effect.
+func (s *Server) Config() *Config {
+	return s.current().cfg
+}
+
+func (s *Server) current() *app {
+	return s.app.Load().(*app)
+}
+
+// acquire returns the app in effect, read-locked so that it isn't released
+// while in use. Callers must call a.mu.RUnlock when done with it.
+func (s *Server) acquire() *app {
+	for {
+		a := s.current()
+		a.mu.RLock()
+		if !a.retired {
+			return a
+		}
+		// replaced before we got hold of it
+		a.mu.RUnlock()
+	}
+}
+
+// unlocked runs f without the read lock that the request being served holds
+// on a, so that a long wait in f doesn't keep a from being released once its
+// config is replaced. f may only use what outlives a release, such as a.cfg
+// and a.httpClient. unlocked reports whether a is still in effect after f.
+func (a *app) unlocked(f func()) bool {
+	a.mu.RUnlock()
+	f()
+	a.mu.RLock()
+	return !a.retired
+}
+
+// ApplyConfig makes c the config in effect. Requests in flight finish with
+// the previous config, and what only it used is released once they are done.
+func (s *Server) ApplyConfig(c *Config) error {
+	s.applyMu.Lock()
+	defer s.applyMu.Unlock()
+
+	previous, _ := s.app.Load().(*app)
+	a, err := s.newApp(c, previous)
+	if err != nil {
+		return err
+	}
+	s.app.Store(a)
+	logRedactor.setSecrets(s, c.secrets()...)
+	logRedactor.setCookieName(s, c.sessionCookieName())
+	if c.DevMode {
+		log.Warn("Dev mode is on, which must not be used in production")
+	} else {
+		// whatever was fast-forwarded no longer applies
+		s.clock.reset()
+		s.chaos.reset()
+	}
+
+	if previous != nil {
+		go func() {
+			previous.mu.Lock()
+			defer previous.mu.Unlock()
+			previous.retired = true
+			releaseSessionStore(previous.sessionStore, a.sessionStore)
+			releaseAuditSink(previous.auditSink, a.auditSink)
+		}()
+	}
+	return nil
+}
+
+// idpTLSConfig returns the TLS settings for talking to the identity provider:
+// the system's CAs and TrustedCAPath, and the certificate pins, if any.
+func idpTLSConfig(c *Config) (*tls.Config, *certPins, error) {
+	rootCAs, _ := x509.SystemCertPool()
+	if rootCAs == nil {
+		rootCAs = x509.NewCertPool()
+	}
+
+	if c.TrustedCAPath != "" {
+		// Read in the cert file
+		certs, err := ioutil.ReadFile(c.TrustedCAPath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to append %q to RootCAs: %v", c.TrustedCAPath, err)
+		}
+
+		// Append our cert to the system pool
+		if ok := rootCAs.AppendCertsFromPEM(certs); !ok {
+			log.Println("No certs appended, using system certs only")
+		}
+	}
+
+	// Trust the augmented cert pool in our client
+	config := &tls.Config{
+		RootCAs: rootCAs,
+	}
+	pins, err := newCertPins(c)
+	if err != nil {
+		return nil, nil, err
+	}
+	if pins != nil {
+		config.VerifyConnection = pins.verifyConnection
+	}
+	return config, pins, nil
+}
+
+// newApp builds the app for c, carrying over from previous the stores that
+// must outlive a config change.
+func (s *Server) newApp(c *Config, previous *app) (*app, error) {
+	allowedClientNets, err := parseCIDRs(c.AllowedClientCIDRs)
+	if err != nil {
+		return nil, err
+	}
+	trustedProxyNets, err := parseCIDRs(c.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
+	config, pins, err := idpTLSConfig(c)
+	if err != nil {
+		return nil, err
+	}
+	var tr http.RoundTripper = &http.Transport{TLSClientConfig: config}
+	var chaos *chaosTransport
+	if c.DevMode {
+		chaos = &chaosTransport{next: tr, chaos: s.chaos}
+		tr = chaos
+	}
+	httpClient := &http.Client{Transport: &transcriptTransport{next: tr}}
+
+	c.checkOIDCPrefixes()
+
+	if c.needsDiscovery() {
+		m, err := s.discovery.get(httpClient, c.IssuerURL)
+		if err != nil {
+			return nil, err
+		}
+		c = c.withDiscovery(m)
+		if pins != nil {
+			if err := pins.addHosts(c); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if chaos != nil {
+		chaos.tokenURLs = []string{c.TokenURL, c.StandbyTokenURL}
+	}
+	if c.DeviceFlow && c.DeviceAuthorizationURL == "" {
+		return nil, fmt.Errorf("the identity provider does not advertise a device authorization endpoint; set deviceAuthorizationURL for deviceFlow")
+	}
+
+	var previousStore sessions.Store
+	var previousLoginStates loginStateStore
+	var previousAuditSink *auditSink
+	if previous != nil {
+		previousStore = previous.sessionStore
+		previousLoginStates = previous.loginStates
+		previousAuditSink = previous.auditSink
+	}
+	var authn *jwtAuthenticator
+	if c.AuthenticationConfigPath != "" {
+		if authn, err = loadJWTAuthenticator(c.AuthenticationConfigPath, c); err != nil {
+			return nil, err
+		}
+	}
+
+	var kubeconfigTmpl *template.Template
+	if c.KubeconfigTemplatePath != "" {
+		if kubeconfigTmpl, err = loadKubeconfigTemplate(c.KubeconfigTemplatePath); err != nil {
+			return nil, err
+		}
+	}
+
+	var keys *keySet
+	if c.JWKSURL != "" {
+		// keep the fetched keys across reloads
+		if previous != nil && previous.keys != nil && previous.keys.sameAs(c.JWKSURL, c.PinnedKeyIDs) {
+			keys = previous.keys
+			// with the current TLS settings, such as pinned certificates
+			keys.setClient(httpClient)
+		} else {
+			keys = newKeySet(c.JWKSURL, httpClient, c.PinnedKeyIDs)
+		}
+	}
+
+	sessionStore, err := newSessionStore(c, previousStore)
+	if err != nil {
+		return nil, err
+	}
+	if store, ok := sessionStore.(*serverSideStore); ok {
+		store.metrics = s.sessionMetrics
+	}
+	auditSink, err := newAuditSink(c, previousAuditSink)
+	if err != nil {
+		releaseSessionStore(sessionStore, previousStore)
+		return nil, err
+	}
+
+	a := &app{
+		cfg: c,
+		oauth2Cfg: &oauth2.Config{
+			ClientID:     c.ClientID,
+			ClientSecret: c.ClientSecret,
+			RedirectURL:  c.RedirectURL,
+			Scopes:       c.scopes(),
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  c.AuthorizeURL,
+				TokenURL: c.TokenURL,
+			},
+		},
+		sessionStore:      sessionStore,
+		httpClient:        httpClient,
+		loginStates:       newLoginStateStore(c, previousLoginStates, &s.loginStateMetrics),
+		auditSink:         auditSink,
+		allowedClientNets: allowedClientNets,
+		trustedProxyNets:  trustedProxyNets,
+		authn:             authn,
+		keys:              keys,
+		kubeconfigTmpl:    kubeconfigTmpl,
+		failover:          &idpFailover{},
+		limiter:           s.limiter,
+		stats:             s.stats,
+		revocations:       s.revocations,
+		transcripts:       s.transcripts,
+		clock:             s.clock,
+		chaos:             s.chaos,
+		discovery:         s.discovery,
+		tokenSizes:        s.tokenSizes,
+		inFlight:          &s.inFlight,
+	}
+	if a.handler, err = a.routes(); err != nil {
+		releaseSessionStore(sessionStore, previousStore)
+		releaseAuditSink(auditSink, previousAuditSink)
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *app) routes() (http.Handler, error) {
+	pageHandlers := alice.New(a.timeoutHandler(a.cfg.RequestTimeout))
+	// everything behind a login may show credentials
+	loginRequiredHandlers := pageHandlers.Append(noStore, a.loginRequired)
+
+	mux := http.NewServeMux()
+	mux.Handle("/", pageHandlers.ThenFunc(a.homeHandler))
+	mux.Handle("/login", pageHandlers.ThenFunc(a.loginHandler))
+	mux.Handle("/cluster-info", pageHandlers.ThenFunc(a.clusterInfoHandler))
+	mux.Handle("/onboard", pageHandlers.Append(noStore).ThenFunc(a.onboardHandler))
+	mux.Handle("/static/", pageHandlers.ThenFunc(staticHandler))
+	mux.Handle("/callback", alice.New(a.timeoutHandler(a.cfg.CallbackTimeout), noStore).ThenFunc(a.callbackHandler))
+	// streamed for as long as the user takes to sign in
+	mux.Handle("/device", alice.New(noStore).ThenFunc(a.deviceHandler))
+
+	// middleware'd routes
+	mux.Handle("/logout", loginRequiredHandlers.ThenFunc(a.logoutHandler))
+	mux.Handle("/commandline", loginRequiredHandlers.ThenFunc(a.commandlineHandler))
+	mux.Handle("/commandline/commands", loginRequiredHandlers.ThenFunc(a.commandsHandler))
+	mux.Handle("/kubeconf", loginRequiredHandlers.ThenFunc(a.kubeconfigHandler))
+	mux.Handle("/refresh", loginRequiredHandlers.ThenFunc(a.refreshHandler))
+	mux.Handle("/logout/frontchannel", pageHandlers.Append(noStore).ThenFunc(a.frontchannelLogoutHandler))
+	mux.Handle("/logout/backchannel", pageHandlers.Append(noStore).ThenFunc(a.backchannelLogoutHandler))
+	mux.Handle("/api/v1/stats", pageHandlers.Append(noStore, a.adminOnly).ThenFunc(a.statsHandler))
+	mux.Handle("/api/v1/audit", pageHandlers.Append(noStore, a.adminOnly).ThenFunc(a.auditHandler))
+	mux.Handle("/api/v1/transcripts/", pageHandlers.Append(noStore, a.adminOnly).ThenFunc(a.transcriptHandler))
+	mux.Handle("/api/v1/onboarding-links", pageHandlers.Append(noStore, a.adminOnly).ThenFunc(a.onboardingLinksHandler))
+	mux.Handle("/dev/clock", pageHandlers.Append(noStore).ThenFunc(a.devClockHandler))
+	mux.Handle("/dev/idp-chaos", pageHandlers.Append(noStore).ThenFunc(a.devIdPChaosHandler))
+	mux.Handle("/api/v1/deprovision", pageHandlers.Append(noStore, a.deprovisionAuth).ThenFunc(a.deprovisionHandler))
+
+	if err := a.addVanityRedirects(mux); err != nil {
+		return nil, err
+	}
+
+	return a.withRequestID(a.forwardedHeaders(a.loadShedding(a.configuredMiddleware().Then(a.stripHTTPPath(mux))))), nil
+}
+
+// stripHTTPPath serves the requests under Config.HTTPPath with next, with the
+// prefix removed, so that routes match as if gangway were served at the root.
+// Other requests are not found, except for the prefix itself, which
+// redirects to the home page.
+func (a *app) stripHTTPPath(next http.Handler) http.Handler {
+	prefix := cleanBasePath(a.cfg.HTTPPath)
+	if prefix == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route, ok := a.cfg.routePath(r.URL.Path)
+		if !ok {
+			if r.URL.Path == prefix {
+				http.Redirect(w, r, prefix+"/", http.StatusMovedPermanently)
+				return
+			}
+			http.NotFound(w, r)
+			return
+		}
+		r2 := new(http.Request)
+		*r2 = *r
+		r2.URL = new(url.URL)
+		*r2.URL = *r.URL
+		r2.URL.Path = route
+		r2.URL.RawPath = ""
+		next.ServeHTTP(w, r2)
+	})
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.handler.ServeHTTP(w, r)
+}
+
+// apiPathPrefix is where the API is served, as opposed to the browser UI.
+const apiPathPrefix = "/api/"
+
+// UI returns the handler for the UI listeners. It serves everything but the
+// API when Config.APIListenAddresses moves that to listeners of its own, and
+// everything otherwise.
+func (s *Server) UI() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c := s.Config()
+		route, _ := c.routePath(r.URL.Path)
+		if len(c.APIListenAddresses) > 0 && strings.HasPrefix(route, apiPathPrefix) {
+			http.NotFound(w, r)
+			return
+		}
+		s.ServeHTTP(w, r)
+	})
+}
+
+// API returns the handler for the API listeners of Config.APIListenAddresses.
+// It serves the API, the health probes and the metrics.
+func (s *Server) API() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route, _ := s.Config().routePath(r.URL.Path)
+		if !strings.HasPrefix(route, apiPathPrefix) && s.probe(r.URL.Path) == nil {
+			http.NotFound(w, r)
+			return
+		}
+		s.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,129 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServersAreIndependent(t *testing.T) {
+	var servers []*Server
+	for _, name := range []string{"east", "west"} {
+		s, err := New(&Config{SessionSecurityKey: SessionKeys{"test"}, ClusterName: name, ClusterInfo: true, RequestTimeout: time.Second})
+		if err != nil {
+			t.Fatal(err)
+		}
+		servers = append(servers, s)
+	}
+
+	for i, want := range []string{"east", "west"} {
+		rr := httptest.NewRecorder()
+		servers[i].ServeHTTP(rr, httptest.NewRequest("GET", "/cluster-info", nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("server %d: got status %d, want %d", i, rr.Code, http.StatusOK)
+		}
+		if !strings.Contains(rr.Body.String(), want) {
+			t.Errorf("server %d: cluster info page does not show cluster %q", i, want)
+		}
+	}
+}
+
+func TestApplyConfigDuringRequest(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	served := make(chan string, 1)
+	middlewares["block"] = func(a *app, next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/slow" {
+				close(started)
+				<-release
+				served <- a.cfg.ClusterName
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+	defer delete(middlewares, "block")
+
+	s, err := New(&Config{SessionSecurityKey: SessionKeys{"test"}, ClusterName: "old", Middleware: []string{"block"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/slow", nil))
+	<-started
+
+	applied := make(chan error, 1)
+	go func() {
+		applied <- s.ApplyConfig(&Config{SessionSecurityKey: SessionKeys{"test"}, ClusterName: "new", Middleware: []string{"block"}})
+	}()
+	select {
+	case err := <-applied:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ApplyConfig waited for the request in flight")
+	}
+	if name := s.Config().ClusterName; name != "new" {
+		t.Errorf("config in effect is for cluster %q, want new", name)
+	}
+
+	close(release)
+	if name := <-served; name != "old" {
+		t.Errorf("request in flight saw the config for cluster %q, want old", name)
+	}
+}
+
+func TestDualListenerHandlers(t *testing.T) {
+	s, err := New(&Config{SessionSecurityKey: SessionKeys{"test"}, RequestTimeout: time.Second, AdminToken: "s3cret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	get := func(h http.Handler, path string) int {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Authorization", "Bearer s3cret")
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	// without API listeners the UI listeners serve everything
+	if code := get(s.UI(), "/api/v1/stats"); code != http.StatusOK {
+		t.Errorf("UI got status %d for the API without API listeners", code)
+	}
+
+	s.Config().APIListenAddresses = []string{":8443"}
+	tests := []struct {
+		name    string
+		handler http.Handler
+		path    string
+		status  int
+	}{
+		{"UI", s.UI(), "/", http.StatusOK},
+		{"UI", s.UI(), "/api/v1/stats", http.StatusNotFound},
+		{"API", s.API(), "/api/v1/stats", http.StatusOK},
+		{"API", s.API(), "/healthz", http.StatusOK},
+		{"API", s.API(), "/", http.StatusNotFound},
+		{"API", s.API(), "/commandline", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if code := get(tt.handler, tt.path); code != tt.status {
+			t.Errorf("%s got status %d for %s, want %d", tt.name, code, tt.path, tt.status)
+		}
+	}
+}
@@ -0,0 +1,323 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package servertest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// IdP is an in-memory OAuth2 identity provider that signs in anyone who asks.
+// ID tokens carry the claims set with SetClaims, plus iss, aud, iat, exp and
+// the nonce of the login, and are signed with HS256 using the client secret.
+type IdP struct {
+	*httptest.Server
+
+	ClientID     string
+	ClientSecret string
+	// RequirePKCE makes the IdP refuse logins without a PKCE code challenge.
+	RequirePKCE bool
+	// SignRS256 makes the IdP sign ID tokens with an RSA key published at
+	// KeysURL instead.
+	SignRS256 bool
+
+	key *rsa.PrivateKey
+
+	mu         sync.Mutex
+	claims     map[string]interface{}
+	codes      map[string]*grant
+	refresh    map[string]*grant
+	devices    map[string]*deviceGrant
+	sessionEnd bool
+}
+
+// deviceGrant is a device flow, which the user approves or denies by its
+// user code.
+type deviceGrant struct {
+	userCode string
+	// decided is nil while the user hasn't approved or denied the flow.
+	decided *bool
+	grant   *grant
+}
+
+// grant is what a code was issued for.
+type grant struct {
+	claims map[string]interface{}
+	nonce  string
+	// codeChallenge is the S256 PKCE code challenge of the login, if any.
+	codeChallenge string
+}
+
+// NewIdP starts an IdP for the given client. Callers should Close it when
+// done.
+func NewIdP(clientID, clientSecret string) *IdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	idp := &IdP{
+		key:          key,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		claims:       map[string]interface{}{},
+		codes:        map[string]*grant{},
+		refresh:      map[string]*grant{},
+		devices:      map[string]*deviceGrant{},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/authorize", idp.authorizeHandler)
+	mux.HandleFunc("/token", idp.tokenHandler)
+	mux.HandleFunc("/keys", idp.keysHandler)
+	mux.HandleFunc("/device/code", idp.deviceCodeHandler)
+	idp.Server = httptest.NewServer(mux)
+	return idp
+}
+
+// AuthorizeURL is the IdP's authorization endpoint.
+func (idp *IdP) AuthorizeURL() string {
+	return idp.URL + "/authorize"
+}
+
+// TokenURL is the IdP's token endpoint.
+func (idp *IdP) TokenURL() string {
+	return idp.URL + "/token"
+}
+
+// KeysURL is where the IdP publishes its RSA signing key as a JWKS.
+func (idp *IdP) KeysURL() string {
+	return idp.URL + "/keys"
+}
+
+// DeviceAuthorizationURL is the IdP's device authorization endpoint.
+func (idp *IdP) DeviceAuthorizationURL() string {
+	return idp.URL + "/device/code"
+}
+
+// SetClaims sets the claims of the users signed in from now on.
+func (idp *IdP) SetClaims(claims map[string]interface{}) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.claims = claims
+}
+
+// EndSession ends the single sign on session, so that requests with
+// prompt=none fail with login_required from now on.
+func (idp *IdP) EndSession() {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.sessionEnd = true
+}
+
+// DecideDevice approves or denies the device flow with userCode for a user
+// with the current claims. It returns false if there is no such flow.
+func (idp *IdP) DecideDevice(userCode string, approve bool) bool {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	for _, d := range idp.devices {
+		if d.userCode == userCode && d.decided == nil {
+			d.decided = &approve
+			d.grant = &grant{claims: idp.claims}
+			return true
+		}
+	}
+	return false
+}
+
+// deviceCodeHandler starts a device flow, which is polled every second.
+func (idp *IdP) deviceCodeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.PostFormValue("client_id") != idp.ClientID {
+		http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+		return
+	}
+	deviceCode, userCode := randomString(), randomString()[:8]
+	idp.mu.Lock()
+	idp.devices[deviceCode] = &deviceGrant{userCode: userCode}
+	idp.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"device_code":      deviceCode,
+		"user_code":        userCode,
+		"verification_uri": idp.URL + "/device",
+		"expires_in":       60,
+		"interval":         1,
+	})
+}
+
+// authorizeHandler signs the user in right away and sends them back to the
+// client with a code for the current claims.
+func (idp *IdP) authorizeHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("client_id") != idp.ClientID {
+		http.Error(w, "unknown client", http.StatusBadRequest)
+		return
+	}
+	redirect, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || redirect.Host == "" {
+		http.Error(w, "bad redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	params := redirect.Query()
+	idp.mu.Lock()
+	switch {
+	case q.Get("prompt") == "none" && idp.sessionEnd:
+		params.Set("error", "login_required")
+	case q.Get("code_challenge") != "" && q.Get("code_challenge_method") != "S256",
+		idp.RequirePKCE && q.Get("code_challenge") == "":
+		params.Set("error", "invalid_request")
+	default:
+		code := randomString()
+		idp.codes[code] = &grant{claims: idp.claims, nonce: q.Get("nonce"), codeChallenge: q.Get("code_challenge")}
+		params.Set("code", code)
+	}
+	idp.mu.Unlock()
+	params.Set("state", q.Get("state"))
+	redirect.RawQuery = params.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+// tokenHandler exchanges a code or a refresh token for tokens. Each code and
+// refresh token can be used once.
+func (idp *IdP) tokenHandler(w http.ResponseWriter, r *http.Request) {
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID, clientSecret = r.PostFormValue("client_id"), r.PostFormValue("client_secret")
+	}
+	if clientID != idp.ClientID || clientSecret != idp.ClientSecret {
+		http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+		return
+	}
+
+	var g *grant
+	idp.mu.Lock()
+	if r.PostFormValue("grant_type") == "urn:ietf:params:oauth:grant-type:device_code" {
+		deviceCode := r.PostFormValue("device_code")
+		d, found := idp.devices[deviceCode]
+		var pending string
+		switch {
+		case !found:
+			pending = "invalid_grant"
+		case d.decided == nil:
+			pending = "authorization_pending"
+		case !*d.decided:
+			pending = "access_denied"
+		}
+		if pending != "authorization_pending" {
+			delete(idp.devices, deviceCode)
+		}
+		if pending != "" {
+			idp.mu.Unlock()
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": pending})
+			return
+		}
+		g, ok = d.grant, true
+	} else if r.PostFormValue("grant_type") == "refresh_token" {
+		refreshToken := r.PostFormValue("refresh_token")
+		if g, ok = idp.refresh[refreshToken]; ok {
+			// refreshed ID tokens have the current claims and no nonce
+			g = &grant{claims: idp.claims}
+		}
+		delete(idp.refresh, refreshToken)
+	} else {
+		code := r.PostFormValue("code")
+		g, ok = idp.codes[code]
+		delete(idp.codes, code)
+		ok = ok && (g.codeChallenge == "" || g.codeChallenge == s256(r.PostFormValue("code_verifier")))
+	}
+	idp.mu.Unlock()
+	if !ok {
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+		return
+	}
+
+	idToken, err := idp.idToken(g)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	refreshToken := randomString()
+	idp.mu.Lock()
+	idp.refresh[refreshToken] = g
+	idp.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token":  randomString(),
+		"token_type":    "bearer",
+		"expires_in":    3600,
+		"refresh_token": refreshToken,
+		"id_token":      idToken,
+	})
+}
+
+// keysHandler publishes the IdP's RSA signing key.
+func (idp *IdP) keysHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test",
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(idp.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(idp.key.E)).Bytes()),
+		}},
+	})
+}
+
+func (idp *IdP) idToken(g *grant) (string, error) {
+	now := time.Now()
+	mc := jwt.MapClaims{
+		"iss": idp.URL,
+		"aud": idp.ClientID,
+		"iat": now.Unix(),
+		"exp": now.Add(time.Hour).Unix(),
+	}
+	if g.nonce != "" {
+		mc["nonce"] = g.nonce
+	}
+	for k, v := range g.claims {
+		mc[k] = v
+	}
+	if idp.SignRS256 {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, mc)
+		token.Header["kid"] = "test"
+		return token.SignedString(idp.key)
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, mc).SignedString([]byte(idp.ClientSecret))
+}
+
+func s256(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func randomString() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,135 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package servertest runs gangway against an in-memory identity provider, so
+// that customized configs, templates and claims can be tested end to end.
+//
+//	h := servertest.New(t, c)
+//	defer h.Close()
+//	client := h.Client()
+//	resp, err := h.Login(client, map[string]interface{}{"nickname": "jane", "email": "jane@example.com"})
+package servertest
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/heptiolabs/gangway/pkg/server"
+)
+
+// Client credentials gangway uses with the IdP.
+const (
+	ClientID     = "gangway"
+	ClientSecret = "servertest-secret"
+)
+
+// Harness is a gangway server and the IdP it signs users in with.
+type Harness struct {
+	// Server is the gangway server under test.
+	Server *server.Server
+	// HTTP serves Server.
+	HTTP *httptest.Server
+	IdP  *IdP
+}
+
+// New starts gangway with c, or the default config if c is nil, pointed at
+// a new IdP. It overrides c's client credentials, IdP endpoints and redirect
+// URL, and sets a session key if c has none. Callers should Close the harness
+// when done.
+func New(t testing.TB, c *server.Config) *Harness {
+	if c == nil {
+		var err error
+		if c, err = server.LoadConfig(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h := &Harness{IdP: NewIdP(ClientID, ClientSecret)}
+	h.HTTP = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.Server.ServeHTTP(w, r)
+	}))
+
+	c.ClientID = ClientID
+	c.ClientSecret = ClientSecret
+	c.AuthorizeURL = h.IdP.AuthorizeURL()
+	c.TokenURL = h.IdP.TokenURL()
+	c.JWKSURL = h.IdP.KeysURL()
+	c.DeviceAuthorizationURL = h.IdP.DeviceAuthorizationURL()
+	c.RedirectURL = h.HTTP.URL + "/callback"
+	if len(c.SessionSecurityKey) == 0 {
+		c.SessionSecurityKey = server.SessionKeys{"servertest"}
+	}
+
+	srv, err := server.New(c)
+	if err != nil {
+		h.Close()
+		t.Fatal(err)
+	}
+	h.Server = srv
+	return h
+}
+
+// Close shuts down gangway and the IdP.
+func (h *Harness) Close() {
+	h.HTTP.Close()
+	h.IdP.Close()
+}
+
+// Client returns a client with its own cookie jar, like a new browser.
+func (h *Harness) Client() *http.Client {
+	jar, _ := cookiejar.New(nil)
+	return &http.Client{Jar: jar}
+}
+
+// URL returns the URL of path on gangway.
+func (h *Harness) URL(path string) string {
+	return h.HTTP.URL + path
+}
+
+// Get requests path from gangway with client.
+func (h *Harness) Get(client *http.Client, path string) (*http.Response, error) {
+	return client.Get(h.URL(path))
+}
+
+// Login signs client in as a user with the given ID token claims and returns
+// the response to the last request of the login, normally the commandline
+// page.
+func (h *Harness) Login(client *http.Client, claims map[string]interface{}) (*http.Response, error) {
+	h.IdP.SetClaims(claims)
+	return h.Get(client, "/login")
+}
+
+// Cookie returns the cookie named name that client would send to gangway, or
+// nil if it has none.
+func (h *Harness) Cookie(client *http.Client, name string) *http.Cookie {
+	if client.Jar == nil {
+		return nil
+	}
+	u, _ := url.Parse(h.HTTP.URL)
+	for _, c := range client.Jar.Cookies(u) {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// SessionCookie returns client's gangway session cookie, or nil if it has
+// none.
+func (h *Harness) SessionCookie(client *http.Client) *http.Cookie {
+	return h.Cookie(client, "gangway")
+}
@@ -0,0 +1,479 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package servertest
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/heptiolabs/gangway/pkg/server"
+)
+
+func TestLogin(t *testing.T) {
+	c, err := server.LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.ClusterName = "test-cluster"
+	c.UsernameClaim = "preferred_username"
+	h := New(t, c)
+	defer h.Close()
+
+	client := h.Client()
+	resp, err := h.Get(client, "/commandline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.Request.URL.Path != "/" {
+		t.Errorf("commandline page was served before logging in")
+	}
+
+	resp, err = h.Login(client, map[string]interface{}{
+		"preferred_username": "jane",
+		"email":              "jane@example.com",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Request.URL.Path != "/commandline" {
+		t.Fatalf("login ended at %s with status %d", resp.Request.URL, resp.StatusCode)
+	}
+	for _, want := range []string{"jane", "test-cluster", h.IdP.URL} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("commandline page does not contain %q", want)
+		}
+	}
+	if h.SessionCookie(client) == nil {
+		t.Errorf("no session cookie after logging in")
+	}
+
+	// another browser isn't signed in
+	if h.SessionCookie(h.Client()) != nil {
+		t.Errorf("new client already has a session cookie")
+	}
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	c, err := server.LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.RefreshTokenRotation = true
+	h := New(t, c)
+	defer h.Close()
+
+	claims := map[string]interface{}{"nickname": "jane", "email": "jane@example.com"}
+	resp, err := h.Login(h.Client(), claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.Request.URL.Path != "/commandline" {
+		t.Errorf("login with a current ID token ended at %s", resp.Request.URL)
+	}
+
+	// kubectl has refreshed an expired ID token, so the refresh token in
+	// the session has been rotated out
+	claims["exp"] = time.Now().Add(-time.Minute).Unix()
+	client := h.Client()
+	resp, err = h.Login(client, claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.Request.URL.Path != "/" {
+		t.Errorf("login with an expired ID token ended at %s, want /", resp.Request.URL)
+	}
+	if h.SessionCookie(client) != nil {
+		t.Errorf("session with a stale refresh token was kept")
+	}
+}
+
+func TestIssuerMismatch(t *testing.T) {
+	c, err := server.LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := New(t, c)
+	defer h.Close()
+	c.IssuerURL = h.IdP.URL + "/"
+
+	resp, err := h.Login(h.Client(), map[string]interface{}{"nickname": "jane", "email": "jane@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway || !strings.Contains(string(body), "trailing slash") {
+		t.Errorf("login with a mismatched issuer got status %d and page:\n%s", resp.StatusCode, body)
+	}
+}
+
+func TestSilentRenew(t *testing.T) {
+	c, err := server.LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SilentRenewInterval = time.Minute
+	h := New(t, c)
+	defer h.Close()
+
+	silentResult := func(client *http.Client) string {
+		resp, err := h.Get(client, "/login?prompt=none")
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.Header.Get("X-Frame-Options") != "SAMEORIGIN" {
+			t.Errorf("silent login result can't be framed by the commandline page")
+		}
+		return string(body)
+	}
+
+	client := h.Client()
+	if body := silentResult(client); !strings.Contains(body, `data-error="login_required"`) {
+		t.Errorf("silent login without a session got:\n%s", body)
+	}
+
+	resp, err := h.Login(client, map[string]interface{}{"nickname": "jane", "email": "jane@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	before := h.SessionCookie(client).Value
+	if body := silentResult(client); !strings.Contains(body, `data-error=""`) {
+		t.Errorf("silent login got:\n%s", body)
+	}
+	if h.SessionCookie(client).Value == before {
+		t.Errorf("silent login did not renew the session")
+	}
+
+	h.IdP.EndSession()
+	if body := silentResult(client); !strings.Contains(body, `data-error="login_required"`) {
+		t.Errorf("silent login after the single sign on session ended got:\n%s", body)
+	}
+}
+
+func TestTokenRequiresClientSecret(t *testing.T) {
+	idp := NewIdP("client", "secret")
+	defer idp.Close()
+
+	resp, err := http.PostForm(idp.TokenURL(), map[string][]string{
+		"client_id":     {"client"},
+		"client_secret": {"wrong"},
+		"code":          {"abc"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("got status %d, want %d", resp.StatusCode, http.StatusUnauthorized)
+	}
+}
+
+func TestPKCE(t *testing.T) {
+	for _, pkce := range []bool{true, false} {
+		c, err := server.LoadConfig()
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.PKCE = pkce
+		h := New(t, c)
+		h.IdP.RequirePKCE = true
+
+		resp, err := h.Login(h.Client(), map[string]interface{}{"nickname": "jane"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if signedIn := resp.Request.URL.Path == "/commandline"; signedIn != pkce {
+			t.Errorf("pkce %v: login ended at %s with status %d", pkce, resp.Request.URL, resp.StatusCode)
+		}
+		h.Close()
+	}
+}
+
+func TestRS256(t *testing.T) {
+	h := New(t, nil)
+	defer h.Close()
+	h.IdP.SignRS256 = true
+
+	resp, err := h.Login(h.Client(), map[string]interface{}{"nickname": "jane", "email": "jane@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Request.URL.Path != "/commandline" {
+		t.Errorf("login ended at %s with status %d", resp.Request.URL, resp.StatusCode)
+	}
+}
+
+func TestPKCEVerifierRequired(t *testing.T) {
+	idp := NewIdP("client", "secret")
+	defer idp.Close()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+
+	resp, err := client.Get(idp.AuthorizeURL() + "?client_id=client&redirect_uri=https://gangway.example.com/callback&code_challenge=" + s256("verifier") + "&code_challenge_method=S256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	location, err := resp.Location()
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := location.Query().Get("code")
+
+	resp, err = http.PostForm(idp.TokenURL(), map[string][]string{
+		"client_id":     {"client"},
+		"client_secret": {"secret"},
+		"code":          {code},
+		"code_verifier": {"wrong"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("got status %d for the wrong code verifier, want %d", resp.StatusCode, http.StatusBadRequest)
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	h := New(t, nil)
+	defer h.Close()
+	client := h.Client()
+
+	resp, err := h.Login(client, map[string]interface{}{"nickname": "jane", "email": "jane@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	// the IdP issues new refresh tokens each time, so refreshing twice
+	// shows the new one was kept
+	for _, nickname := range []string{"jane.doe", "jdoe"} {
+		h.IdP.SetClaims(map[string]interface{}{"nickname": nickname, "email": "jane@example.com"})
+		resp, err = client.PostForm(h.URL("/refresh"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || resp.Request.URL.Path != "/commandline" {
+			t.Fatalf("refresh ended at %s with status %d", resp.Request.URL, resp.StatusCode)
+		}
+		if !strings.Contains(string(body), "Welcome "+nickname) {
+			t.Errorf("commandline page was not regenerated for %s after refreshing", nickname)
+		}
+	}
+
+	resp, err = h.Get(client, "/refresh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET /refresh returned status %d, want %d", resp.StatusCode, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestDeviceFlow(t *testing.T) {
+	c, err := server.LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.DeviceFlow = true
+	h := New(t, c)
+	defer h.Close()
+	h.IdP.SetClaims(map[string]interface{}{"nickname": "jane", "email": "jane@example.com"})
+
+	for _, approve := range []bool{true, false} {
+		resp, err := http.Get(h.URL("/device"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the code is shown before the sign in completes
+		br := bufio.NewReader(resp.Body)
+		var userCode string
+		for userCode == "" {
+			line, err := br.ReadString('\n')
+			if err != nil {
+				t.Fatalf("no user code in the response: %v", err)
+			}
+			if strings.HasPrefix(line, "in a browser and enter the code") {
+				br.ReadString('\n')
+				code, _ := br.ReadString('\n')
+				userCode = strings.TrimSpace(code)
+			}
+		}
+		if !h.IdP.DecideDevice(userCode, approve) {
+			t.Fatalf("IdP has no device flow with user code %q", userCode)
+		}
+		rest, _ := ioutil.ReadAll(br)
+		resp.Body.Close()
+
+		want := "Signed in as jane"
+		if !approve {
+			want = "The sign in was denied."
+		}
+		if !strings.Contains(string(rest), want) {
+			t.Errorf("approved %v: response does not contain %q:\n%s", approve, want, rest)
+		}
+		if approve && !strings.Contains(string(rest), "kubectl config set-credentials") {
+			t.Errorf("device flow did not print the commands:\n%s", rest)
+		}
+	}
+}
+
+func TestKubeconfigDownload(t *testing.T) {
+	h := New(t, nil)
+	defer h.Close()
+	client := h.Client()
+
+	resp, err := h.Login(client, map[string]interface{}{"nickname": "jane", "email": "jane@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	resp, err = h.Get(client, "/kubeconf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Disposition"), "attachment") {
+		t.Fatalf("got status %d, Content-Disposition %q", resp.StatusCode, resp.Header.Get("Content-Disposition"))
+	}
+	for _, want := range []string{"current-context:", "name: jane@", "id-token: ", "client-secret: " + ClientSecret} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("kubeconfig does not contain %q:\n%s", want, body)
+		}
+	}
+
+	// only for signed in users
+	resp, err = h.Get(h.Client(), "/kubeconf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.Request.URL.Path != "/" {
+		t.Errorf("kubeconfig download without a session ended at %s", resp.Request.URL)
+	}
+}
+
+func TestDeviceFlowConfigReload(t *testing.T) {
+	c, err := server.LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.DeviceFlow = true
+	h := New(t, c)
+	defer h.Close()
+	h.IdP.SetClaims(map[string]interface{}{"nickname": "jane", "email": "jane@example.com"})
+
+	resp, err := http.Get(h.URL("/device"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	br := bufio.NewReader(resp.Body)
+	var userCode string
+	for userCode == "" {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			t.Fatalf("no user code in the response: %v", err)
+		}
+		if strings.HasPrefix(line, "in a browser and enter the code") {
+			br.ReadString('\n')
+			code, _ := br.ReadString('\n')
+			userCode = strings.TrimSpace(code)
+		}
+	}
+
+	// the waiting device flow must not hold up the reload
+	if err := h.Server.ApplyConfig(h.Server.Config()); err != nil {
+		t.Fatal(err)
+	}
+	if !h.IdP.DecideDevice(userCode, true) {
+		t.Fatalf("IdP has no device flow with user code %q", userCode)
+	}
+	rest, _ := ioutil.ReadAll(br)
+	if !strings.Contains(string(rest), "configuration changed while you were signing in") {
+		t.Errorf("expected the device flow to be restarted after a reload:\n%s", rest)
+	}
+}
+
+func TestDeviceFlowOutlastsWriteTimeout(t *testing.T) {
+	c, err := server.LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.DeviceFlow = true
+	h := New(t, c)
+	defer h.Close()
+	h.IdP.SetClaims(map[string]interface{}{"nickname": "jane", "email": "jane@example.com"})
+
+	// like gangway's own server, whose WriteTimeout only allows for the
+	// routes' request timeouts
+	ts := httptest.NewUnstartedServer(h.HTTP.Config.Handler)
+	ts.Config.WriteTimeout = 500 * time.Millisecond
+	ts.Config.ConnContext = server.ConnContext
+	ts.Start()
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/device")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	br := bufio.NewReader(resp.Body)
+	var userCode string
+	for userCode == "" {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			t.Fatalf("no user code in the response: %v", err)
+		}
+		if strings.HasPrefix(line, "in a browser and enter the code") {
+			br.ReadString('\n')
+			code, _ := br.ReadString('\n')
+			userCode = strings.TrimSpace(code)
+		}
+	}
+
+	// sign in after the write timeout has passed
+	time.Sleep(time.Second)
+	if !h.IdP.DecideDevice(userCode, true) {
+		t.Fatalf("IdP has no device flow with user code %q", userCode)
+	}
+	rest, err := ioutil.ReadAll(br)
+	if err != nil {
+		t.Fatalf("the response was cut off: %v", err)
+	}
+	if !strings.Contains(string(rest), "Signed in as jane") {
+		t.Errorf("device flow did not finish:\n%s", rest)
+	}
+}
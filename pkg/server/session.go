@@ -0,0 +1,335 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const salt = "MkmfuPNHnZBBivy0L0aW"
+
+const (
+	sessionStoreCookie    = "cookie"
+	sessionStoreSQL       = "sql"
+	sessionStoreMemcached = "memcached"
+	sessionStoreMemory    = "memory"
+	sessionStoreRedis     = "redis"
+)
+
+// defaultSessionCookieName is the name of the session cookie unless
+// Config.SessionCookieName sets another.
+const defaultSessionCookieName = "gangway"
+
+// defaultSessionLifetime is how long sessions last unless
+// Config.SessionLifetime says otherwise.
+const defaultSessionLifetime = 30 * 24 * time.Hour
+
+// cookieNamePattern matches the session cookie names gangway accepts.
+var cookieNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// sameSiteModes maps Config.CookieSameSite to cookie SameSite modes. Without a
+// setting the attribute is left out.
+var sameSiteModes = map[string]http.SameSite{
+	"lax":    http.SameSiteLaxMode,
+	"strict": http.SameSiteStrictMode,
+	"none":   http.SameSiteNoneMode,
+}
+
+// sessionCookieName returns the name of the session cookie.
+func (c *Config) sessionCookieName() string {
+	if c.SessionCookieName == "" {
+		return defaultSessionCookieName
+	}
+	return c.SessionCookieName
+}
+
+// sessionCookieOptions returns the cookie options for sessions.
+func (c *Config) sessionCookieOptions() sessions.Options {
+	lifetime := c.SessionLifetime
+	if lifetime == 0 {
+		lifetime = defaultSessionLifetime
+	}
+	return sessions.Options{
+		Path:     c.cookiePath(),
+		Domain:   c.CookieDomain,
+		MaxAge:   int(lifetime / time.Second),
+		Secure:   c.CookieSecure,
+		SameSite: sameSiteModes[c.CookieSameSite],
+	}
+}
+
+// refreshTokenKeyInfo is the HKDF info prefix for per-session refresh token
+// keys. The session ID is appended to it.
+const refreshTokenKeyInfo = "gangway refresh token "
+
+// SessionKeys are the session security keys. In the config they may be given
+// as a single key or as a list.
+type SessionKeys []string
+
+// UnmarshalYAML accepts a single key as well as a list of them.
+func (k *SessionKeys) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var key string
+	if err := unmarshal(&key); err == nil {
+		*k = SessionKeys{key}
+		return nil
+	}
+	var keys []string
+	if err := unmarshal(&keys); err != nil {
+		return err
+	}
+	*k = keys
+	return nil
+}
+
+// current returns the key new sessions are signed with, or "" if there is
+// none.
+func (k SessionKeys) current() string {
+	if len(k) == 0 {
+		return ""
+	}
+	return k[0]
+}
+
+func (a *app) generateSessionKeys() ([]byte, []byte) {
+	return deriveSessionKeys(a.cfg.SessionSecurityKey.current())
+}
+
+// sessionKeyPairs returns the hash and block key pairs for the session store.
+// The first pair encodes sessions and all of them decode.
+func sessionKeyPairs(keys SessionKeys) [][]byte {
+	var pairs [][]byte
+	for _, key := range keys {
+		hashKey, blockKey := deriveSessionKeys(key)
+		pairs = append(pairs, hashKey, blockKey)
+	}
+	return pairs
+}
+
+func deriveSessionKeys(securityKey string) ([]byte, []byte) {
+	// Take the configured security key and generate 96 bytes of data. This is
+	// used as the signing and encryption keys for the cookie store.  For details
+	// on the PBKDF2 function: https://en.wikipedia.org/wiki/PBKDF2
+	b := pbkdf2.Key(
+		[]byte(securityKey),
+		[]byte(salt),
+		4096, 96, sha256.New)
+
+	return b[0:64], b[64:96]
+}
+
+// newSessionStore returns the session store configured in c. The open session
+// backend of previous is reused as long as its settings don't change.
+func newSessionStore(c *Config, previous sessions.Store) (sessions.Store, error) {
+	keyPairs := sessionKeyPairs(c.SessionSecurityKey)
+
+	var backendID string
+	switch c.SessionStore {
+	case sessionStoreSQL:
+		backendID = strings.Join([]string{sessionStoreSQL, c.SessionSQLDriver, c.SessionSQLDSN}, "|")
+	case sessionStoreMemcached:
+		backendID = strings.Join(append([]string{sessionStoreMemcached}, c.SessionMemcachedServers...), "|")
+	case sessionStoreMemory:
+		backendID = sessionStoreMemory
+	case sessionStoreRedis:
+		backendID = strings.Join([]string{sessionStoreRedis, c.SessionRedisAddress, c.SessionRedisPassword, strconv.FormatBool(c.SessionRedisTLS), c.SessionRedisKeyPrefix}, "|")
+	default:
+		store := sessions.NewCookieStore(keyPairs...)
+		*store.Options = c.sessionCookieOptions()
+		store.MaxAge(store.Options.MaxAge)
+		return store, nil
+	}
+
+	if current, ok := previous.(*serverSideStore); ok && current.backendID == backendID {
+		store := newServerSideStore(current.backend, backendID, keyPairs...)
+		*store.Options = c.sessionCookieOptions()
+		store.MaxAge(store.Options.MaxAge)
+		store.cache = c.sessionCache()
+		return store, nil
+	}
+
+	var backend sessionBackend
+	switch c.SessionStore {
+	case sessionStoreSQL:
+		b, err := newSQLSessions(c.SessionSQLDriver, c.SessionSQLDSN)
+		if err != nil {
+			return nil, err
+		}
+		backend = b
+	case sessionStoreMemcached:
+		backend = newMemcachedSessions(c.SessionMemcachedServers...)
+	case sessionStoreMemory:
+		backend = newMemorySessions()
+	case sessionStoreRedis:
+		backend = newRedisSessions(c.SessionRedisAddress, c.SessionRedisPassword, c.SessionRedisTLS, c.SessionRedisKeyPrefix)
+	}
+	store := newServerSideStore(backend, backendID, keyPairs...)
+	*store.Options = c.sessionCookieOptions()
+	store.MaxAge(store.Options.MaxAge)
+	store.cache = c.sessionCache()
+	return store, nil
+}
+
+// sessionCache returns the cache for a server-side session store, or nil if
+// SessionCacheTTL doesn't ask for one.
+func (c *Config) sessionCache() *sessionCache {
+	if c.SessionCacheTTL <= 0 {
+		return nil
+	}
+	return newSessionCache(c.SessionCacheTTL, sessionCacheSize)
+}
+
+// releaseSessionStore closes the backend of old unless current still uses it.
+func releaseSessionStore(old, current sessions.Store) {
+	if o, ok := old.(*serverSideStore); ok {
+		if c, ok := current.(*serverSideStore); !ok || c.backend != o.backend {
+			o.backend.close()
+		}
+	}
+}
+
+// sessionOptions returns the cookie options of the session store in use.
+func (a *app) sessionOptions() sessions.Options {
+	switch store := a.sessionStore.(type) {
+	case *sessions.CookieStore:
+		return *store.Options
+	case *serverSideStore:
+		return *store.Options
+	}
+	return a.cfg.sessionCookieOptions()
+}
+
+// newSession returns an empty session that replaces the one the request came
+// with once it is saved.
+func (a *app) newSession() *sessions.Session {
+	session := sessions.NewSession(a.sessionStore, a.cfg.sessionCookieName())
+	options := a.sessionOptions()
+	session.Options = &options
+	session.IsNew = true
+	session.ID = newSessionID()
+	if _, ok := a.sessionStore.(*sessions.CookieStore); ok {
+		// the cookie store doesn't keep session IDs, so carry it in the
+		// values. Server-side stores must not, or the stored refresh tokens
+		// could be decrypted from the store alone.
+		session.Values["sid"] = session.ID
+	}
+	return session
+}
+
+func newSessionID() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// sessionID returns the ID refresh token keys are derived from.
+func sessionID(session *sessions.Session) string {
+	if id, ok := session.Values["sid"].(string); ok {
+		return id
+	}
+	return session.ID
+}
+
+// refreshTokenKey derives the key for the refresh token of a single session
+// from a session security key, so that the stored refresh tokens can't all be
+// decrypted with one key.
+func refreshTokenKey(securityKey, sid string) ([]byte, error) {
+	key := make([]byte, 32)
+	kdf := hkdf.New(sha256.New, []byte(securityKey), []byte(salt), []byte(refreshTokenKeyInfo+sid))
+	if _, err := io.ReadFull(kdf, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func refreshTokenCipher(securityKey, sid string) (cipher.AEAD, error) {
+	if sid == "" {
+		return nil, errors.New("session has no ID")
+	}
+	key, err := refreshTokenKey(securityKey, sid)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealRefreshToken encrypts a refresh token with the key for session sid.
+func (a *app) sealRefreshToken(sid, token string) (string, error) {
+	aead, err := refreshTokenCipher(a.cfg.SessionSecurityKey.current(), sid)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(token), []byte(sid))
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// openRefreshToken decrypts a refresh token sealed by sealRefreshToken. It
+// tries every session security key, so tokens sealed before the key was
+// rotated still open.
+func (a *app) openRefreshToken(sid, sealed string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return "", err
+	}
+	err = errors.New("no session security key")
+	for _, securityKey := range a.cfg.SessionSecurityKey {
+		var aead cipher.AEAD
+		if aead, err = refreshTokenCipher(securityKey, sid); err != nil {
+			return "", err
+		}
+		if len(data) < aead.NonceSize() {
+			return "", errors.New("sealed refresh token is too short")
+		}
+		nonce, ciphertext := data[:aead.NonceSize()], data[aead.NonceSize():]
+		var token []byte
+		if token, err = aead.Open(nil, nonce, ciphertext, []byte(sid)); err == nil {
+			return string(token), nil
+		}
+	}
+	return "", err
+}
+
+func (a *app) cleanupSession(w http.ResponseWriter, r *http.Request) {
+
+	session, err := a.sessionStore.Get(r, a.cfg.sessionCookieName())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	session.Options.MaxAge = -1
+	session.Save(r, w)
+}
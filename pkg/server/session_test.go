@@ -0,0 +1,216 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"gopkg.in/yaml.v2"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestGenerateSessionKeys(t *testing.T) {
+	a := newTestApp(t)
+	a.cfg.SessionSecurityKey = SessionKeys{"testing"}
+
+	b1, b2 := a.generateSessionKeys()
+
+	if len(b1) != 64 || len(b2) != 32 {
+		t.Errorf("Wrong byte length's returned")
+		return
+	}
+}
+
+func TestNewSessionStore(t *testing.T) {
+	a := newTestApp(t)
+	if a.sessionStore == nil {
+		t.Errorf("Session Store is nil. Did not get initialized")
+		return
+	}
+
+}
+
+func TestSessionCookiePath(t *testing.T) {
+	for basePath, want := range map[string]string{"": "/", "/k8s/prod/": "/k8s/prod/"} {
+		for _, store := range []string{sessionStoreCookie, sessionStoreMemcached} {
+			c := &Config{SessionSecurityKey: SessionKeys{"test"}, BasePath: basePath, SessionStore: store, SessionMemcachedServers: []string{"127.0.0.1:11211"}}
+			s, err := newSessionStore(c, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			session, _ := s.New(httptest.NewRequest("GET", "/", nil), "gangway")
+			if session.Options.Path != want {
+				t.Errorf("%s store with basePath %q got cookie path %q, want %q", store, basePath, session.Options.Path, want)
+			}
+		}
+	}
+}
+
+func TestSessionCookieOptions(t *testing.T) {
+	for _, store := range []string{sessionStoreCookie, sessionStoreMemory} {
+		c := &Config{
+			SessionSecurityKey: SessionKeys{"test"},
+			SessionStore:       store,
+			SessionCookieName:  "k8s_session",
+			SessionLifetime:    8 * time.Hour,
+			CookieDomain:       "example.com",
+			CookieSecure:       true,
+			CookieSameSite:     "none",
+		}
+		s, err := newSessionStore(c, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest("GET", "/", nil)
+		session, _ := s.New(req, c.sessionCookieName())
+		session.Values["sub"] = "jane"
+		rr := httptest.NewRecorder()
+		if err := session.Save(req, rr); err != nil {
+			t.Fatal(err)
+		}
+		cookies := rr.Result().Cookies()
+		if len(cookies) != 1 {
+			t.Fatalf("%s store set %d cookies, want 1", store, len(cookies))
+		}
+		got := cookies[0]
+		if got.Name != "k8s_session" || got.Domain != "example.com" || got.MaxAge != 8*3600 || !got.Secure || got.SameSite != http.SameSiteNoneMode {
+			t.Errorf("%s store set cookie %s", store, got)
+		}
+	}
+
+	// the defaults leave the cookie as it was
+	options := (&Config{}).sessionCookieOptions()
+	if options.MaxAge != 86400*30 || options.Secure || options.Domain != "" || options.SameSite != 0 {
+		t.Errorf("got default options %+v", options)
+	}
+}
+
+func TestCleanupSession(t *testing.T) {
+	a := newTestApp(t)
+	session := &sessions.Session{}
+	// create a test http server
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session, _ = a.sessionStore.Get(r, "gangway")
+		a.cleanupSession(w, r)
+
+	}))
+	defer ts.Close()
+	_, err := http.Get(ts.URL)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if session.Options.MaxAge != -1 {
+		t.Errorf("Session was not reset. Have max age of %d. Should have -1", session.Options.MaxAge)
+	}
+}
+
+func TestRefreshTokenEncryption(t *testing.T) {
+	a := newTestApp(t)
+
+	sealed, err := a.sealRefreshToken("session-a", "refresh-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sealed == "refresh-token" {
+		t.Fatalf("refresh token was not encrypted")
+	}
+
+	token, err := a.openRefreshToken("session-a", sealed)
+	if err != nil || token != "refresh-token" {
+		t.Errorf("openRefreshToken = %q, %v; want %q", token, err, "refresh-token")
+	}
+	if _, err := a.openRefreshToken("session-b", sealed); err == nil {
+		t.Errorf("refresh token could be decrypted with another session's key")
+	}
+	if _, err := a.openRefreshToken("", sealed); err == nil {
+		t.Errorf("refresh token could be decrypted without a session ID")
+	}
+
+	keyA, _ := refreshTokenKey("test", "session-a")
+	keyB, _ := refreshTokenKey("test", "session-b")
+	if bytes.Equal(keyA, keyB) {
+		t.Errorf("sessions share a refresh token key")
+	}
+}
+
+func TestSessionKeyRotation(t *testing.T) {
+	var c Config
+	if err := yaml.Unmarshal([]byte("sessionSecurityKey: old"), &c); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(c.SessionSecurityKey, SessionKeys{"old"}) {
+		t.Errorf("single key parsed as %q", c.SessionSecurityKey)
+	}
+	old, err := newSessionStore(&c, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &app{cfg: &c}
+	sealed, err := a.sealRefreshToken("sid", "refresh-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// an old session cookie
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+	session, _ := old.New(req, "gangway")
+	session.Values["sub"] = "jane"
+	if err := session.Save(req, rr); err != nil {
+		t.Fatal(err)
+	}
+	cookie := rr.Result().Cookies()[0]
+
+	if err := yaml.Unmarshal([]byte("sessionSecurityKey: [new, old]"), &c); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(c.SessionSecurityKey, SessionKeys{"new", "old"}) {
+		t.Errorf("key list parsed as %q", c.SessionSecurityKey)
+	}
+	rotated, err := newSessionStore(&c, old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req = httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(cookie)
+	if session, err := rotated.New(req, "gangway"); err != nil || session.Values["sub"] != "jane" {
+		t.Errorf("session signed with the previous key was not accepted: %v", err)
+	}
+	if token, err := a.openRefreshToken("sid", sealed); err != nil || token != "refresh-token" {
+		t.Errorf("refresh token sealed with the previous key: got %q, %v", token, err)
+	}
+
+	// new sessions are signed with the new key only
+	rr = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/", nil)
+	session, _ = rotated.New(req, "gangway")
+	if err := session.Save(req, rr); err != nil {
+		t.Fatal(err)
+	}
+	c.SessionSecurityKey = SessionKeys{"old"}
+	old, _ = newSessionStore(&c, nil)
+	req = httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(rr.Result().Cookies()[0])
+	if _, err := old.New(req, "gangway"); err == nil {
+		t.Errorf("new session was signed with the previous key")
+	}
+}
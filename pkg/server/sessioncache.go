@@ -0,0 +1,105 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// sessionCacheSize is how many sessions a sessionCache keeps at most.
+const sessionCacheSize = 10000
+
+// sessionCache keeps the session values a serverSideStore loaded or saved
+// recently for Config.SessionCacheTTL, so that page loads such as
+// /commandline don't each need a round trip to a remote backend. Saves and
+// deletes through the store update it; writes by other replicas are only
+// seen once the entry expires. The least recently used sessions are evicted
+// beyond sessionCacheSize.
+type sessionCache struct {
+	ttl time.Duration
+	max int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	// order has the most recently used entries first.
+	order *list.List
+}
+
+type sessionCacheEntry struct {
+	key     string
+	data    string
+	expires time.Time
+}
+
+func newSessionCache(ttl time.Duration, max int) *sessionCache {
+	return &sessionCache{ttl: ttl, max: max, entries: map[string]*list.Element{}, order: list.New()}
+}
+
+// get returns the cached values stored under key. c may be nil.
+func (c *sessionCache) get(key string, now time.Time) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return "", false
+	}
+	entry := e.Value.(*sessionCacheEntry)
+	if !now.Before(entry.expires) {
+		c.order.Remove(e)
+		delete(c.entries, key)
+		return "", false
+	}
+	c.order.MoveToFront(e)
+	return entry.data, true
+}
+
+// put caches the values stored under key. c may be nil.
+func (c *sessionCache) put(key, data string, now time.Time) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok {
+		entry := e.Value.(*sessionCacheEntry)
+		entry.data, entry.expires = data, now.Add(c.ttl)
+		c.order.MoveToFront(e)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&sessionCacheEntry{key: key, data: data, expires: now.Add(c.ttl)})
+	for c.order.Len() > c.max {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*sessionCacheEntry).key)
+	}
+}
+
+// remove drops the values stored under key. c may be nil.
+func (c *sessionCache) remove(key string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok {
+		c.order.Remove(e)
+		delete(c.entries, key)
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// countingSessions counts the loads that reach a fakeSessions backend.
+type countingSessions struct {
+	*fakeSessions
+	loads int
+}
+
+func (c *countingSessions) load(key string) (string, bool, error) {
+	c.loads++
+	return c.fakeSessions.load(key)
+}
+
+func TestSessionCache(t *testing.T) {
+	now := time.Now()
+	c := newSessionCache(time.Second, 2)
+	c.put("a", "1", now)
+	c.put("b", "2", now)
+	if data, ok := c.get("a", now); !ok || data != "1" {
+		t.Errorf("get(a) = %q, %v", data, ok)
+	}
+	// b is now the least recently used
+	c.put("c", "3", now)
+	if _, ok := c.get("b", now); ok {
+		t.Errorf("least recently used entry was not evicted")
+	}
+	if _, ok := c.get("a", now.Add(time.Second)); ok {
+		t.Errorf("expired entry was returned")
+	}
+	c.remove("c")
+	if _, ok := c.get("c", now); ok {
+		t.Errorf("removed entry was returned")
+	}
+
+	var none *sessionCache
+	none.put("a", "1", now)
+	if _, ok := none.get("a", now); ok {
+		t.Errorf("nil cache returned an entry")
+	}
+}
+
+func TestServerSideStoreCache(t *testing.T) {
+	hashKey, blockKey := deriveSessionKeys("test")
+	backend := &countingSessions{fakeSessions: newFakeSessions()}
+	store := newServerSideStore(backend, "fake", hashKey, blockKey)
+	store.cache = newSessionCache(time.Minute, sessionCacheSize)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	session, err := store.New(req, "gangway")
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.Values["id_token"] = "id"
+	rr := httptest.NewRecorder()
+	if err := store.Save(req, rr, session); err != nil {
+		t.Fatal(err)
+	}
+	req = httptest.NewRequest("GET", "/", nil)
+	for _, c := range rr.Result().Cookies() {
+		req.AddCookie(c)
+	}
+
+	for i := 0; i < 3; i++ {
+		loaded, err := store.New(req, "gangway")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if loaded.IsNew || loaded.Values["id_token"] != "id" {
+			t.Fatalf("session was not loaded: %v", loaded.Values)
+		}
+	}
+	if backend.loads != 0 {
+		t.Errorf("%d loads reached the backend, want 0", backend.loads)
+	}
+
+	// writes replace the cached values
+	session.Values["id_token"] = "renewed"
+	if err := store.Save(req, httptest.NewRecorder(), session); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := store.New(req, "gangway")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Values["id_token"] != "renewed" {
+		t.Errorf("cache returned %v after a save", loaded.Values["id_token"])
+	}
+
+	// and deletes drop them
+	loaded.Options.MaxAge = -1
+	if err := store.Save(req, httptest.NewRecorder(), loaded); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err = store.New(req, "gangway")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.IsNew {
+		t.Errorf("deleted session was loaded from the cache")
+	}
+	if backend.loads != 1 {
+		t.Errorf("%d loads reached the backend, want 1", backend.loads)
+	}
+}
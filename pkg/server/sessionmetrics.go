@@ -0,0 +1,93 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// sessionStoreOps are the session backend operations that are measured.
+var sessionStoreOps = []string{"load", "save", "delete"}
+
+// sessionStoreMetrics measures the session backend of server-side session
+// stores, across config reloads: how long each operation takes, how often it
+// fails and how large the stored sessions are. A slow or failing backend, or
+// sessions growing, slow down every signed in page.
+type sessionStoreMetrics struct {
+	durations map[string]*histogram
+	errors    map[string]*int64
+	sizes     *histogram
+}
+
+func newSessionStoreMetrics() *sessionStoreMetrics {
+	m := &sessionStoreMetrics{
+		durations: map[string]*histogram{},
+		errors:    map[string]*int64{},
+		// in bytes; cookies are limited to 4KB, so sessions beyond that
+		// would not have fit in the cookie store
+		sizes: newHistogram(256, 512, 1024, 2048, 4096, 8192, 16384, 65536),
+	}
+	for _, op := range sessionStoreOps {
+		m.durations[op] = newHistogram(.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5)
+		m.errors[op] = new(int64)
+	}
+	return m
+}
+
+// observe records a backend operation that started at start. m may be nil.
+func (m *sessionStoreMetrics) observe(op string, start time.Time, err error) {
+	if m == nil {
+		return
+	}
+	m.durations[op].observe(time.Since(start).Seconds())
+	if err != nil {
+		atomic.AddInt64(m.errors[op], 1)
+	}
+}
+
+// observeSize records the size of a stored session. m may be nil.
+func (m *sessionStoreMetrics) observeSize(data string) {
+	if m == nil {
+		return
+	}
+	m.sizes.observe(float64(len(data)))
+}
+
+func (m *sessionStoreMetrics) metrics() []metric {
+	durations := metric{
+		name: "gangway_session_store_duration_seconds",
+		help: "How long session backend operations take.",
+		kind: "histogram",
+	}
+	errors := metric{
+		name: "gangway_session_store_errors_total",
+		help: "Session backend operations that failed.",
+		kind: "counter",
+	}
+	for _, op := range sessionStoreOps {
+		labels := fmt.Sprintf("op=%q", op)
+		durations.samples = append(durations.samples, m.durations[op].samples(labels)...)
+		errors.samples = append(errors.samples, sample{labels: labels, value: float64(atomic.LoadInt64(m.errors[op]))})
+	}
+	sizes := metric{
+		name:    "gangway_session_size_bytes",
+		help:    "The size of sessions saved to the session backend, encrypted.",
+		kind:    "histogram",
+		samples: m.sizes.samples(""),
+	}
+	return []metric{durations, errors, sizes}
+}
@@ -0,0 +1,84 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSessionStoreMetrics(t *testing.T) {
+	hashKey, blockKey := deriveSessionKeys("test")
+	metrics := newSessionStoreMetrics()
+	store := newServerSideStore(newFakeSessions(), "fake", hashKey, blockKey)
+	store.metrics = metrics
+
+	req := httptest.NewRequest("GET", "/", nil)
+	session, _ := store.New(req, "gangway")
+	session.Values["id_token"] = strings.Repeat("x", 3000)
+	rr := httptest.NewRecorder()
+	if err := store.Save(req, rr, session); err != nil {
+		t.Fatal(err)
+	}
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Cookie", rr.Header().Get("Set-Cookie"))
+	if _, err := store.New(req, "gangway"); err != nil {
+		t.Fatal(err)
+	}
+
+	// a backend that can't be reached
+	store = newServerSideStore(&failingSessions{}, "failing", hashKey, blockKey)
+	store.metrics = metrics
+	if _, err := store.New(req, "gangway"); err == nil {
+		t.Fatal("expected an error from the failing backend")
+	}
+
+	var buf bytes.Buffer
+	writeMetrics(&buf, metrics.metrics())
+	for _, want := range []string{
+		"# TYPE gangway_session_store_duration_seconds histogram\n",
+		`gangway_session_store_duration_seconds_count{op="load"} 2` + "\n",
+		`gangway_session_store_duration_seconds_bucket{op="save",le="+Inf"} 1` + "\n",
+		`gangway_session_store_errors_total{op="load"} 1` + "\n",
+		`gangway_session_store_errors_total{op="save"} 0` + "\n",
+		// 3000 bytes of token grow past 4KB once encrypted and encoded
+		`gangway_session_size_bytes_bucket{le="4096"} 0` + "\n",
+		`gangway_session_size_bytes_bucket{le="8192"} 1` + "\n",
+		"gangway_session_size_bytes_count 1\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("metrics don't contain %q:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestSessionStoreMetricsServed(t *testing.T) {
+	c := &Config{SessionSecurityKey: SessionKeys{"test"}, SessionStore: sessionStoreMemory}
+	s, err := New(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store := s.current().sessionStore.(*serverSideStore); store.metrics != s.sessionMetrics {
+		t.Error("server-side session store is not measured")
+	}
+
+	rr := httptest.NewRecorder()
+	s.ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	if !strings.Contains(rr.Body.String(), `gangway_session_store_errors_total{op="delete"} 0`) {
+		t.Errorf("session store metrics not served:\n%s", rr.Body)
+	}
+}
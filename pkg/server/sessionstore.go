@@ -0,0 +1,181 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+)
+
+// sessionBackend stores encoded session values for a serverSideStore. Keys
+// are hashes of session IDs.
+type sessionBackend interface {
+	// load returns the data stored for key, or false if there is none or
+	// it has expired.
+	load(key string) (string, bool, error)
+	save(key, data string, expires time.Time) error
+	delete(key string) error
+	close() error
+}
+
+// serverSideStore is a sessions.Store that keeps session values in a
+// sessionBackend. The cookie only carries the signed session ID. Entries are
+// keyed by a hash of the ID and the values are encrypted with the session
+// keys, so the backend alone gives away neither.
+type serverSideStore struct {
+	backend sessionBackend
+	// backendID identifies the backend settings, so that a config reload
+	// can tell whether the backend can be kept.
+	backendID string
+	// metrics, if set, measures the backend
+	metrics *sessionStoreMetrics
+	// cache, if set, saves loading recently used sessions from the backend
+	cache *sessionCache
+
+	Codecs  []securecookie.Codec
+	Options *sessions.Options
+}
+
+func newServerSideStore(backend sessionBackend, backendID string, keyPairs ...[]byte) *serverSideStore {
+	s := &serverSideStore{
+		backend:   backend,
+		backendID: backendID,
+		Codecs:    securecookie.CodecsFromPairs(keyPairs...),
+		Options: &sessions.Options{
+			Path:   "/",
+			MaxAge: 86400 * 30,
+		},
+	}
+	for _, codec := range s.Codecs {
+		if sc, ok := codec.(*securecookie.SecureCookie); ok {
+			// values are stored in the backend, not in a cookie
+			sc.MaxLength(0)
+		}
+	}
+	s.MaxAge(s.Options.MaxAge)
+	return s
+}
+
+// MaxAge sets how long sessions last, in the cookie and in the backend.
+func (s *serverSideStore) MaxAge(age int) {
+	s.Options.MaxAge = age
+	for _, codec := range s.Codecs {
+		if sc, ok := codec.(*securecookie.SecureCookie); ok {
+			sc.MaxAge(age)
+		}
+	}
+}
+
+// backendKey returns the key session values are stored under.
+func backendKey(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *serverSideStore) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(s, name)
+}
+
+func (s *serverSideStore) New(r *http.Request, name string) (*sessions.Session, error) {
+	session := sessions.NewSession(s, name)
+	options := *s.Options
+	session.Options = &options
+	session.IsNew = true
+
+	c, err := r.Cookie(name)
+	if err != nil {
+		return session, nil
+	}
+	if err := securecookie.DecodeMulti(name, c.Value, &session.ID, s.Codecs...); err != nil {
+		return session, err
+	}
+
+	key := backendKey(session.ID)
+	data, ok := s.cache.get(key, time.Now())
+	if !ok {
+		start := time.Now()
+		data, ok, err = s.backend.load(key)
+		s.metrics.observe("load", start, err)
+		if err != nil {
+			return session, err
+		}
+		if !ok {
+			// expired or logged out; start over with a new ID
+			session.ID = ""
+			return session, nil
+		}
+		s.cache.put(key, data, time.Now())
+	}
+	if err := securecookie.DecodeMulti(name, data, &session.Values, s.Codecs...); err != nil {
+		return session, err
+	}
+	session.IsNew = false
+	return session, nil
+}
+
+func (s *serverSideStore) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	if session.Options.MaxAge < 0 {
+		if session.ID != "" {
+			s.cache.remove(backendKey(session.ID))
+			start := time.Now()
+			err := s.backend.delete(backendKey(session.ID))
+			s.metrics.observe("delete", start, err)
+			if err != nil {
+				return err
+			}
+		}
+		http.SetCookie(w, sessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+
+	if session.ID == "" {
+		session.ID = newSessionID()
+	}
+	data, err := securecookie.EncodeMulti(session.Name(), session.Values, s.Codecs...)
+	if err != nil {
+		return err
+	}
+	s.metrics.observeSize(data)
+	start := time.Now()
+	expires := start.Add(time.Duration(session.Options.MaxAge) * time.Second)
+	key := backendKey(session.ID)
+	err = s.backend.save(key, data, expires)
+	s.metrics.observe("save", start, err)
+	if err != nil {
+		s.cache.remove(key)
+		return err
+	}
+	s.cache.put(key, data, time.Now())
+
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, s.Codecs...)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, sessions.NewCookie(session.Name(), encoded, session.Options))
+	return nil
+}
+
+// purgeExpired purges the backend if it needs it.
+func (s *serverSideStore) purgeExpired(now time.Time) (int, error) {
+	if p, ok := s.backend.(purger); ok {
+		return p.purgeExpired(now)
+	}
+	return 0, nil
+}
@@ -0,0 +1,240 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSessions is an in-memory session backend.
+type fakeSessions struct {
+	data    map[string]string
+	expires map[string]time.Time
+}
+
+func newFakeSessions() *fakeSessions {
+	return &fakeSessions{data: map[string]string{}, expires: map[string]time.Time{}}
+}
+
+func (f *fakeSessions) load(key string) (string, bool, error) {
+	data, ok := f.data[key]
+	if !ok || time.Now().After(f.expires[key]) {
+		return "", false, nil
+	}
+	return data, true, nil
+}
+
+func (f *fakeSessions) save(key, data string, expires time.Time) error {
+	f.data[key] = data
+	f.expires[key] = expires
+	return nil
+}
+
+func (f *fakeSessions) delete(key string) error {
+	delete(f.data, key)
+	delete(f.expires, key)
+	return nil
+}
+
+func (f *fakeSessions) close() error {
+	return nil
+}
+
+func TestServerSideStore(t *testing.T) {
+	hashKey, blockKey := deriveSessionKeys("test")
+	backend := newFakeSessions()
+	store := newServerSideStore(backend, "fake", hashKey, blockKey)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	session, err := store.New(req, "gangway")
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.Values["id_token"] = "id"
+	rr := httptest.NewRecorder()
+	if err := store.Save(req, rr, session); err != nil {
+		t.Fatal(err)
+	}
+	if len(backend.data) != 1 {
+		t.Fatalf("expected 1 stored session, got %d", len(backend.data))
+	}
+	if _, ok := backend.data[session.ID]; ok {
+		t.Errorf("session is stored under its plain ID")
+	}
+
+	req = httptest.NewRequest("GET", "/", nil)
+	for _, c := range rr.Result().Cookies() {
+		req.AddCookie(c)
+	}
+	loaded, err := store.New(req, "gangway")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.IsNew || loaded.Values["id_token"] != "id" {
+		t.Errorf("session was not loaded from the backend: %v", loaded.Values)
+	}
+
+	// sessions signed with other keys are rejected
+	otherHash, otherBlock := deriveSessionKeys("other")
+	if _, err := newServerSideStore(backend, "fake", otherHash, otherBlock).New(req, "gangway"); err == nil {
+		t.Errorf("session cookie was accepted with the wrong keys")
+	}
+
+	loaded.Options.MaxAge = -1
+	if err := store.Save(req, httptest.NewRecorder(), loaded); err != nil {
+		t.Fatal(err)
+	}
+	if len(backend.data) != 0 {
+		t.Errorf("deleted session is still stored")
+	}
+	loaded, err = store.New(req, "gangway")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.IsNew || loaded.ID != "" {
+		t.Errorf("deleted session was still loaded")
+	}
+}
+
+func TestNewSessionStoreReusesBackend(t *testing.T) {
+	c := Config{SessionSecurityKey: SessionKeys{"test"}}
+	c.SessionStore = sessionStoreMemcached
+	c.SessionMemcachedServers = []string{"localhost:11211"}
+	store, err := newSessionStore(&c, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := store.(*serverSideStore)
+
+	c.SessionSecurityKey = SessionKeys{"rotated"}
+	store, err = newSessionStore(&c, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store.(*serverSideStore).backend != first.backend {
+		t.Errorf("backend was not reused when only the keys changed")
+	}
+
+	c.SessionMemcachedServers = []string{"memcached:11211"}
+	store, err = newSessionStore(&c, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store.(*serverSideStore).backend == first.backend {
+		t.Errorf("backend was reused after its servers changed")
+	}
+}
+
+func TestMemcachedExpiration(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	tests := []struct {
+		expires time.Time
+		want    int32
+	}{
+		{now.Add(time.Hour), 3600},
+		{now.Add(30 * 24 * time.Hour), memcachedRelativeExpiryLimit},
+		{now.Add(31 * 24 * time.Hour), int32(now.Add(31 * 24 * time.Hour).Unix())},
+		{now.Add(-time.Hour), 1},
+	}
+	for _, tc := range tests {
+		if got := memcachedExpiration(tc.expires, now); got != tc.want {
+			t.Errorf("memcachedExpiration(now+%s) = %d, want %d", tc.expires.Sub(now), got, tc.want)
+		}
+	}
+}
+
+func TestRedisExpiration(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	tests := []struct {
+		expires time.Time
+		want    int64
+	}{
+		{now.Add(time.Hour), 3600000},
+		{now.Add(1500 * time.Microsecond), 1},
+		{now, 1},
+		{now.Add(-time.Minute), 1},
+	}
+	for _, tc := range tests {
+		if got := redisExpiration(tc.expires, now); got != tc.want {
+			t.Errorf("redisExpiration(now+%s) = %d, want %d", tc.expires.Sub(now), got, tc.want)
+		}
+	}
+}
+
+func TestNewRedisSessionStore(t *testing.T) {
+	c := Config{SessionSecurityKey: SessionKeys{"test"}, SessionStore: sessionStoreRedis}
+	c.SessionRedisAddress = "redis:6379"
+	c.SessionRedisKeyPrefix = "gangway_session_"
+	store, err := newSessionStore(&c, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := store.(*serverSideStore)
+	if b := first.backend.(*redisSessions); b.prefix != "gangway_session_" {
+		t.Errorf("got key prefix %q, want gangway_session_", b.prefix)
+	}
+
+	c.SessionRedisKeyPrefix = "prod_"
+	store, err = newSessionStore(&c, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store.(*serverSideStore).backend == first.backend {
+		t.Errorf("backend was reused after its key prefix changed")
+	}
+}
+
+func TestMemorySessionStore(t *testing.T) {
+	c := Config{SessionSecurityKey: SessionKeys{"test"}, SessionStore: sessionStoreMemory}
+	store, err := newSessionStore(&c, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// an ID token far larger than a cookie can hold
+	idToken := strings.Repeat("x", 8192)
+	req := httptest.NewRequest("GET", "/", nil)
+	session, err := store.New(req, "gangway")
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.Values["id_token"] = idToken
+	rr := httptest.NewRecorder()
+	if err := store.Save(req, rr, session); err != nil {
+		t.Fatal(err)
+	}
+	cookies := rr.Result().Cookies()
+	if len(cookies) != 1 || len(cookies[0].Value) > 512 {
+		t.Fatalf("expected a small session ID cookie, got %d cookies", len(cookies))
+	}
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(cookies[0])
+	loaded, err := store.New(req, "gangway")
+	if err != nil || loaded.Values["id_token"] != idToken {
+		t.Errorf("session was not loaded from memory: %v", err)
+	}
+
+	backend := store.(*serverSideStore).backend.(*memorySessions)
+	if n, _ := backend.purgeExpired(time.Now()); n != 0 {
+		t.Errorf("purged %d current sessions", n)
+	}
+	if n, _ := backend.purgeExpired(time.Now().Add(365 * 24 * time.Hour)); n != 1 {
+		t.Errorf("purged %d sessions, want the expired one", n)
+	}
+}
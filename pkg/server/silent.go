@@ -0,0 +1,74 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"net/http"
+
+	"golang.org/x/oauth2"
+)
+
+// Silent re-authentication renews the session of a user who keeps the
+// commandline page open. The page loads /login?prompt=none in a hidden frame
+// every Config.SilentRenewInterval. As long as the user's single sign on
+// session with the identity provider is valid, the provider sends them
+// straight back to the callback, which swaps in the new tokens and tells the
+// page through postMessage instead of redirecting.
+
+// silentLoginHandler starts a silent login for a signed in user.
+func (a *app) silentLoginHandler(w http.ResponseWriter, r *http.Request) {
+	if a.cfg.SilentRenewInterval <= 0 {
+		http.NotFound(w, r)
+		return
+	}
+	session, err := a.sessionStore.Get(r, a.cfg.sessionCookieName())
+	if err != nil {
+		a.serveSilentResult(w, r, "session_invalid")
+		return
+	}
+	// only renews sessions; signing in needs the user, and the CAPTCHA
+	if _, ok := session.Values["id_token"].(string); !ok {
+		a.serveSilentResult(w, r, "login_required")
+		return
+	}
+	w.Header().Set("X-Frame-Options", "SAMEORIGIN")
+	a.startLogin(w, r, session, true, oauth2.SetAuthURLParam("prompt", "none"))
+}
+
+// silentCallback reports whether the callback r completes a silent login.
+func (a *app) silentCallback(r *http.Request) bool {
+	session, err := a.sessionStore.Get(r, a.cfg.sessionCookieName())
+	if err != nil {
+		return false
+	}
+	state := r.URL.Query().Get("state")
+	return state != "" && session.Values["silent"] == state
+}
+
+type silentResultInfo struct {
+	BasePath string
+	Error    string
+}
+
+// serveSilentResult ends a silent login in the hidden frame, passing the
+// result, an OAuth error code or "" on success, to the page.
+func (a *app) serveSilentResult(w http.ResponseWriter, r *http.Request, errorCode string) {
+	w.Header().Set("X-Frame-Options", "SAMEORIGIN")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	serveTemplate("silent.tmpl", &silentResultInfo{
+		BasePath: a.basePath(r),
+		Error:    errorCode,
+	}, w)
+}
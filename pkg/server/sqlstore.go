@@ -0,0 +1,146 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql" // registers the mysql driver
+	_ "github.com/lib/pq"              // registers the postgres driver
+	log "github.com/sirupsen/logrus"
+)
+
+// sqlMigrations are applied in order on startup. Never edit an existing
+// entry; append a new one instead.
+var sqlMigrations = []string{
+	`CREATE TABLE IF NOT EXISTS gangway_sessions (
+		id VARCHAR(64) NOT NULL PRIMARY KEY,
+		data TEXT NOT NULL,
+		expires_at BIGINT NOT NULL
+	)`,
+	`CREATE INDEX gangway_sessions_expires_at ON gangway_sessions (expires_at)`,
+}
+
+// sqlSessions is a session backend for Postgres and MySQL.
+type sqlSessions struct {
+	db     *sql.DB
+	driver string
+}
+
+func newSQLSessions(driver, dsn string) (*sqlSessions, error) {
+	if driver != "postgres" && driver != "mysql" {
+		return nil, fmt.Errorf("unsupported session database driver %q", driver)
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &sqlSessions{db: db, driver: driver}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrating session database: %v", err)
+	}
+	return s, nil
+}
+
+// rebind rewrites ? placeholders for drivers that use numbered ones.
+func (s *sqlSessions) rebind(query string) string {
+	if s.driver != "postgres" {
+		return query
+	}
+	var b bytes.Buffer
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+func (s *sqlSessions) migrate() error {
+	_, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS gangway_schema_migrations (version INTEGER NOT NULL)`)
+	if err != nil {
+		return err
+	}
+
+	var version int
+	err = s.db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM gangway_schema_migrations`).Scan(&version)
+	if err != nil {
+		return err
+	}
+
+	for i := version; i < len(sqlMigrations); i++ {
+		if _, err := s.db.Exec(sqlMigrations[i]); err != nil {
+			return fmt.Errorf("migration %d: %v", i+1, err)
+		}
+		if _, err := s.db.Exec(s.rebind(`INSERT INTO gangway_schema_migrations (version) VALUES (?)`), i+1); err != nil {
+			return err
+		}
+		log.Infof("Applied session database migration %d", i+1)
+	}
+	return nil
+}
+
+func (s *sqlSessions) load(key string) (string, bool, error) {
+	var data string
+	err := s.db.QueryRow(s.rebind(`SELECT data FROM gangway_sessions WHERE id = ? AND expires_at > ?`),
+		key, time.Now().Unix()).Scan(&data)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return data, true, nil
+}
+
+func (s *sqlSessions) save(key, data string, expires time.Time) error {
+	upsert := `INSERT INTO gangway_sessions (id, data, expires_at) VALUES (?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET data = EXCLUDED.data, expires_at = EXCLUDED.expires_at`
+	if s.driver == "mysql" {
+		upsert = `INSERT INTO gangway_sessions (id, data, expires_at) VALUES (?, ?, ?)
+		ON DUPLICATE KEY UPDATE data = VALUES(data), expires_at = VALUES(expires_at)`
+	}
+	_, err := s.db.Exec(s.rebind(upsert), key, data, expires.Unix())
+	return err
+}
+
+func (s *sqlSessions) delete(key string) error {
+	_, err := s.db.Exec(s.rebind(`DELETE FROM gangway_sessions WHERE id = ?`), key)
+	return err
+}
+
+func (s *sqlSessions) close() error {
+	return s.db.Close()
+}
+
+// purgeExpired deletes the sessions that expired before now.
+func (s *sqlSessions) purgeExpired(now time.Time) (int, error) {
+	res, err := s.db.Exec(s.rebind(`DELETE FROM gangway_sessions WHERE expires_at <= ?`), now.Unix())
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
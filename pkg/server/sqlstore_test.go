@@ -0,0 +1,86 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestSQLStoreRebind(t *testing.T) {
+	query := `SELECT data FROM gangway_sessions WHERE id = ? AND expires_at > ?`
+
+	pg := &sqlSessions{driver: "postgres"}
+	if got, want := pg.rebind(query), `SELECT data FROM gangway_sessions WHERE id = $1 AND expires_at > $2`; got != want {
+		t.Errorf("postgres rebind = %q, want %q", got, want)
+	}
+	mysql := &sqlSessions{driver: "mysql"}
+	if got := mysql.rebind(query); got != query {
+		t.Errorf("mysql rebind changed the query to %q", got)
+	}
+}
+
+// TestSQLStore runs against a real database when GANGWAY_TEST_SQL_DRIVER and
+// GANGWAY_TEST_SQL_DSN are set.
+func TestSQLStore(t *testing.T) {
+	driver, dsn := os.Getenv("GANGWAY_TEST_SQL_DRIVER"), os.Getenv("GANGWAY_TEST_SQL_DSN")
+	if driver == "" || dsn == "" {
+		t.Skip("GANGWAY_TEST_SQL_DRIVER and GANGWAY_TEST_SQL_DSN not set")
+	}
+
+	hashKey, blockKey := deriveSessionKeys("test")
+	backend, err := newSQLSessions(driver, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.close()
+	store := newServerSideStore(backend, "", hashKey, blockKey)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	session, err := store.New(req, "gangway")
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.Values["id_token"] = "id"
+	rr := httptest.NewRecorder()
+	if err := store.Save(req, rr, session); err != nil {
+		t.Fatal(err)
+	}
+
+	req = httptest.NewRequest("GET", "/", nil)
+	for _, c := range rr.Result().Cookies() {
+		req.AddCookie(c)
+	}
+	loaded, err := store.New(req, "gangway")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.IsNew || loaded.Values["id_token"] != "id" {
+		t.Errorf("session was not loaded from the database: %v", loaded.Values)
+	}
+
+	if _, err := store.purgeExpired(time.Now().Add(31 * 24 * time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err = store.New(req, "gangway")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.IsNew {
+		t.Errorf("purged session was still loaded")
+	}
+}
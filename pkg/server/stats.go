@@ -0,0 +1,163 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"golang.org/x/oauth2"
+)
+
+// statsWindow is how long a user counts towards the unique user counts.
+const statsWindow = 7 * 24 * time.Hour
+
+// usageStats aggregates logins and refresh token use for /api/v1/stats. Users
+// are only kept as hashes of their names, to count them, and are forgotten
+// after statsWindow. It lives in the Server, so that config changes don't
+// reset it.
+type usageStats struct {
+	mu        sync.Mutex
+	lastLogin map[[sha256.Size]byte]time.Time
+	logins    map[string]int64
+
+	refreshServed int64
+	refreshFailed int64
+}
+
+func newUsageStats() *usageStats {
+	return &usageStats{
+		lastLogin: map[[sha256.Size]byte]time.Time{},
+		logins:    map[string]int64{},
+	}
+}
+
+// recordLogin counts a login of user to cluster.
+func (u *usageStats) recordLogin(user, cluster string, now time.Time) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.lastLogin[sha256.Sum256([]byte(user))] = now
+	u.logins[cluster]++
+	for k, t := range u.lastLogin {
+		if now.Sub(t) > statsWindow {
+			delete(u.lastLogin, k)
+		}
+	}
+}
+
+// recordRefreshToken counts a refresh token that was, or couldn't be, handed
+// out to a signed in user.
+func (u *usageStats) recordRefreshToken(ok bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if ok {
+		u.refreshServed++
+	} else {
+		u.refreshFailed++
+	}
+}
+
+type statsReport struct {
+	UniqueUsers24h      int              `json:"uniqueUsers24h"`
+	UniqueUsers7d       int              `json:"uniqueUsers7d"`
+	LoginsPerCluster    map[string]int64 `json:"loginsPerCluster"`
+	RefreshTokensServed int64            `json:"refreshTokensServed"`
+	RefreshTokensFailed int64            `json:"refreshTokensFailed"`
+	RefreshFailureRate  float64          `json:"refreshFailureRate"`
+}
+
+func (u *usageStats) report(now time.Time) *statsReport {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	r := &statsReport{
+		LoginsPerCluster:    make(map[string]int64, len(u.logins)),
+		RefreshTokensServed: u.refreshServed,
+		RefreshTokensFailed: u.refreshFailed,
+	}
+	for _, t := range u.lastLogin {
+		age := now.Sub(t)
+		if age <= 24*time.Hour {
+			r.UniqueUsers24h++
+		}
+		if age <= statsWindow {
+			r.UniqueUsers7d++
+		}
+	}
+	for cluster, n := range u.logins {
+		r.LoginsPerCluster[cluster] = n
+	}
+	if total := u.refreshServed + u.refreshFailed; total > 0 {
+		r.RefreshFailureRate = float64(u.refreshFailed) / float64(total)
+	}
+	return r
+}
+
+// tokenUser returns who token's ID token was issued to, by the username
+// claim or else the subject.
+func (a *app) tokenUser(token *oauth2.Token) string {
+	idToken, _ := token.Extra("id_token").(string)
+	return a.idTokenUser(idToken)
+}
+
+// idTokenUser returns who idToken was issued to, as tokenUser does.
+func (a *app) idTokenUser(idToken string) string {
+	if idToken == "" {
+		return ""
+	}
+	jwtToken, _ := a.parseToken(idToken)
+	if jwtToken == nil {
+		return ""
+	}
+	claims, ok := jwtToken.Claims.(jwt.MapClaims)
+	if !ok {
+		return ""
+	}
+	if user, ok := claims[a.cfg.UsernameClaim].(string); ok {
+		return user
+	}
+	sub, _ := claims["sub"].(string)
+	return sub
+}
+
+// adminOnly lets through requests with Config.AdminToken as their bearer
+// token. Without an admin token the admin API doesn't exist.
+func (a *app) adminOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.cfg.AdminToken == "" {
+			http.NotFound(w, r)
+			return
+		}
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "Bearer ") ||
+			subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(a.cfg.AdminToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="gangway"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// statsHandler reports aggregate usage, for platform teams tracking adoption.
+func (a *app) statsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(a.stats.report(time.Now()))
+}
@@ -0,0 +1,87 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestUsageStats(t *testing.T) {
+	now := time.Now()
+	u := newUsageStats()
+	u.recordLogin("old", "prod", now.Add(-8*24*time.Hour))
+	u.recordLogin("jane", "prod", now.Add(-48*time.Hour))
+	u.recordLogin("jane", "prod", now.Add(-time.Hour))
+	u.recordLogin("joe", "staging", now.Add(-72*time.Hour))
+	u.recordRefreshToken(true)
+	u.recordRefreshToken(true)
+	u.recordRefreshToken(true)
+	u.recordRefreshToken(false)
+
+	r := u.report(now)
+	if r.UniqueUsers24h != 1 || r.UniqueUsers7d != 2 {
+		t.Errorf("got %d users in 24h and %d in 7d, want 1 and 2", r.UniqueUsers24h, r.UniqueUsers7d)
+	}
+	if r.LoginsPerCluster["prod"] != 3 || r.LoginsPerCluster["staging"] != 1 {
+		t.Errorf("got logins per cluster %v", r.LoginsPerCluster)
+	}
+	if r.RefreshFailureRate != 0.25 {
+		t.Errorf("got refresh failure rate %v, want 0.25", r.RefreshFailureRate)
+	}
+	if len(u.lastLogin) != 2 {
+		t.Errorf("%d users are kept, want the 2 seen in the last 7 days", len(u.lastLogin))
+	}
+}
+
+func TestStatsHandler(t *testing.T) {
+	s, err := New(&Config{SessionSecurityKey: SessionKeys{"test"}, RequestTimeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		adminToken string
+		auth       string
+		status     int
+	}{
+		{"", "Bearer s3cret", http.StatusNotFound},
+		{"s3cret", "", http.StatusUnauthorized},
+		{"s3cret", "Bearer wrong", http.StatusUnauthorized},
+		{"s3cret", "Bearer s3cret", http.StatusOK},
+	}
+	for _, tt := range tests {
+		s.current().cfg.AdminToken = tt.adminToken
+		req := httptest.NewRequest("GET", "/api/v1/stats", nil)
+		if tt.auth != "" {
+			req.Header.Set("Authorization", tt.auth)
+		}
+		rr := httptest.NewRecorder()
+		s.ServeHTTP(rr, req)
+		if rr.Code != tt.status {
+			t.Errorf("admin token %q, authorization %q: got status %d, want %d", tt.adminToken, tt.auth, rr.Code, tt.status)
+			continue
+		}
+		if rr.Code == http.StatusOK {
+			var r statsReport
+			if err := json.NewDecoder(rr.Body).Decode(&r); err != nil {
+				t.Errorf("decoding stats: %v", err)
+			}
+		}
+	}
+}
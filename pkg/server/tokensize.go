@@ -0,0 +1,100 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"golang.org/x/oauth2"
+)
+
+// Browsers drop cookies whose name and value are longer than
+// cookieSizeLimit. Sessions past cookieSizeWarning are logged, so that
+// growing tokens, typically from users gaining groups, are noticed before
+// sign-ins start failing.
+const (
+	cookieSizeLimit   = 4096
+	cookieSizeWarning = cookieSizeLimit * 3 / 4
+)
+
+// tokenSizeMetrics measures the tokens gangway keeps in sessions and the
+// session cookies that carry them, across config reloads.
+type tokenSizeMetrics struct {
+	idTokens      *histogram
+	refreshTokens *histogram
+	cookies       *histogram
+}
+
+func newTokenSizeMetrics() *tokenSizeMetrics {
+	bounds := []float64{512, 1024, 1536, 2048, 2560, 3072, 3584, 4096, 8192, 16384}
+	return &tokenSizeMetrics{
+		idTokens:      newHistogram(bounds...),
+		refreshTokens: newHistogram(bounds...),
+		cookies:       newHistogram(bounds...),
+	}
+}
+
+func (m *tokenSizeMetrics) metrics() []metric {
+	tokens := metric{
+		name: "gangway_token_size_bytes",
+		help: "The size of the tokens issued to users.",
+		kind: "histogram",
+	}
+	tokens.samples = append(m.idTokens.samples(`token="id_token"`), m.refreshTokens.samples(`token="refresh_token"`)...)
+	cookies := metric{
+		name:    "gangway_session_cookie_size_bytes",
+		help:    "The size of the session cookies set at sign in and refresh, name and value.",
+		kind:    "histogram",
+		samples: m.cookies.samples(""),
+	}
+	return []metric{tokens, cookies}
+}
+
+// recordTokenSizes records the sizes of token and of the session cookie
+// written to w for it, and warns when the cookie comes close to the size
+// browsers accept.
+func (a *app) recordTokenSizes(w http.ResponseWriter, r *http.Request, token *oauth2.Token) {
+	idToken, _ := token.Extra("id_token").(string)
+	a.tokenSizes.idTokens.observe(float64(len(idToken)))
+	a.tokenSizes.refreshTokens.observe(float64(len(token.RefreshToken)))
+
+	size := sessionCookieSize(w.Header(), a.cfg.sessionCookieName())
+	if size == 0 {
+		return
+	}
+	a.tokenSizes.cookies.observe(float64(size))
+	if size > cookieSizeWarning {
+		requestLog(r).Warnf("Session cookie of %s is %d bytes, close to the %d bytes browsers accept (ID token: %d bytes); "+
+			"a server-side sessionStore keeps the tokens out of the cookie", a.tokenUser(token), size, cookieSizeLimit, len(idToken))
+	}
+}
+
+// sessionCookieSize returns the size of the name and value of the cookie
+// called name that header sets, or 0 if it sets none.
+func sessionCookieSize(header http.Header, name string) int {
+	size := 0
+	for _, c := range header["Set-Cookie"] {
+		if !strings.HasPrefix(c, name+"=") {
+			continue
+		}
+		if i := strings.IndexByte(c, ';'); i >= 0 {
+			c = c[:i]
+		}
+		// the last one set wins
+		size = len(c)
+	}
+	return size
+}
@@ -0,0 +1,63 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+func TestSessionCookieSize(t *testing.T) {
+	header := http.Header{}
+	header.Add("Set-Cookie", "other=abc; Path=/")
+	if size := sessionCookieSize(header, "gangway"); size != 0 {
+		t.Errorf("got size %d without a session cookie, want 0", size)
+	}
+
+	header.Add("Set-Cookie", "gangway=0123456789; Path=/; HttpOnly")
+	if size := sessionCookieSize(header, "gangway"); size != len("gangway=0123456789") {
+		t.Errorf("got size %d, want %d", size, len("gangway=0123456789"))
+	}
+}
+
+func TestRecordTokenSizes(t *testing.T) {
+	a := newTestApp(t)
+	token := (&oauth2.Token{RefreshToken: strings.Repeat("r", 100)}).WithExtra(map[string]interface{}{
+		"id_token": strings.Repeat("i", 3000),
+	})
+
+	rr := httptest.NewRecorder()
+	http.SetCookie(rr, &http.Cookie{Name: "gangway", Value: strings.Repeat("c", 3500)})
+	a.recordTokenSizes(rr, httptest.NewRequest("GET", "/callback", nil), token)
+
+	var buf bytes.Buffer
+	writeMetrics(&buf, a.tokenSizes.metrics())
+	for _, want := range []string{
+		`gangway_token_size_bytes_bucket{token="id_token",le="2560"} 0` + "\n",
+		`gangway_token_size_bytes_bucket{token="id_token",le="3072"} 1` + "\n",
+		`gangway_token_size_bytes_bucket{token="refresh_token",le="512"} 1` + "\n",
+		`gangway_session_cookie_size_bytes_bucket{le="3584"} 1` + "\n",
+		"gangway_session_cookie_size_bytes_sum 3508\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("metrics don't contain %q:\n%s", want, buf.String())
+		}
+	}
+}
@@ -0,0 +1,217 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// transcriptTTL is how long login transcripts are kept.
+	transcriptTTL = time.Hour
+
+	// maxTranscripts bounds the transcripts kept; the oldest go first.
+	maxTranscripts = 500
+)
+
+// transcriptLeg is one step of a login: a redirect, a request gangway got
+// or made, or the outcome.
+type transcriptLeg struct {
+	At       time.Time     `json:"at"`
+	Leg      string        `json:"leg"`
+	Method   string        `json:"method,omitempty"`
+	URL      string        `json:"url,omitempty"`
+	Status   int           `json:"status,omitempty"`
+	Duration time.Duration `json:"duration,omitempty"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// transcript is the sanitized record of one login, from the redirect to the
+// identity provider to the outcome of the callback. It is kept under the
+// request IDs of the login and of the callback, which users find on error
+// pages.
+type transcript struct {
+	mu      sync.Mutex
+	id      string
+	started time.Time
+	legs    []transcriptLeg
+}
+
+// add appends leg, with credentials in its URL and error redacted.
+func (t *transcript) add(leg transcriptLeg) {
+	if leg.At.IsZero() {
+		leg.At = time.Now()
+	}
+	leg.URL = logRedactor.redact(leg.URL)
+	leg.Error = logRedactor.redact(leg.Error)
+	t.mu.Lock()
+	t.legs = append(t.legs, leg)
+	t.mu.Unlock()
+}
+
+func (t *transcript) MarshalJSON() ([]byte, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return json.Marshal(struct {
+		ID      string          `json:"id"`
+		Started time.Time       `json:"started"`
+		Legs    []transcriptLeg `json:"legs"`
+	}{t.id, t.started, t.legs})
+}
+
+// transcriptStore keeps recent login transcripts in memory, for
+// Config.DebugTranscripts.
+type transcriptStore struct {
+	mu    sync.Mutex
+	byID  map[string]*transcript
+	order []string
+}
+
+func newTranscriptStore() *transcriptStore {
+	return &transcriptStore{byID: map[string]*transcript{}}
+}
+
+// start begins the transcript of the login with request ID id.
+func (s *transcriptStore) start(id string) *transcript {
+	t := &transcript{id: id, started: time.Now()}
+	s.index(id, t)
+	return t
+}
+
+// index makes t retrievable under id as well, evicting the oldest entries
+// beyond maxTranscripts.
+func (s *transcriptStore) index(id string, t *transcript) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.byID[id] = t
+	s.order = append(s.order, id)
+	for len(s.order) > maxTranscripts {
+		delete(s.byID, s.order[0])
+		s.order = s.order[1:]
+	}
+}
+
+func (s *transcriptStore) get(id string) *transcript {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.byID[id]
+}
+
+func (s *transcriptStore) purgeExpired(now time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for len(s.order) > 0 {
+		t, ok := s.byID[s.order[0]]
+		if ok && now.Sub(t.started) <= transcriptTTL {
+			break
+		}
+		delete(s.byID, s.order[0])
+		s.order = s.order[1:]
+		n++
+	}
+	return n, nil
+}
+
+type transcriptKey struct{}
+
+// withTranscript returns ctx with t, to which the requests gangway makes in
+// ctx are added.
+func withTranscript(ctx context.Context, t *transcript) context.Context {
+	return context.WithValue(ctx, transcriptKey{}, t)
+}
+
+// transcriptFrom returns the transcript of ctx, or nil if the request isn't
+// part of a recorded login.
+func transcriptFrom(ctx context.Context) *transcript {
+	t, _ := ctx.Value(transcriptKey{}).(*transcript)
+	return t
+}
+
+// transcriptTransport adds the requests made with a transcript in their
+// context, such as the code exchange, to it.
+type transcriptTransport struct {
+	next http.RoundTripper
+}
+
+func (tt *transcriptTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t := transcriptFrom(req.Context())
+	if t == nil {
+		return tt.next.RoundTrip(req)
+	}
+	start := time.Now()
+	resp, err := tt.next.RoundTrip(req)
+	leg := transcriptLeg{At: start, Leg: "request", Method: req.Method, URL: redactURL(req.URL), Duration: time.Since(start)}
+	if err != nil {
+		leg.Error = err.Error()
+	} else {
+		leg.Status = resp.StatusCode
+	}
+	t.add(leg)
+	return resp, err
+}
+
+// startTranscript begins the transcript of a login started by r, if
+// transcripts are recorded. It returns the ID to keep with the login state.
+func (a *app) startTranscript(r *http.Request, authURL string) string {
+	if !a.cfg.DebugTranscripts {
+		return ""
+	}
+	id := requestID(r)
+	a.transcripts.start(id).add(transcriptLeg{Leg: "authorize", Method: "GET", URL: authURL, Status: http.StatusTemporaryRedirect})
+	return id
+}
+
+// continueTranscript adds the callback r to the transcript id and returns r
+// with the transcript in its context, so that the rest of the login is
+// recorded too.
+func (a *app) continueTranscript(r *http.Request, id string) *http.Request {
+	if id == "" || !a.cfg.DebugTranscripts {
+		return r
+	}
+	t := a.transcripts.get(id)
+	if t == nil {
+		return r
+	}
+	// the time at the identity provider
+	t.add(transcriptLeg{Leg: "callback", Method: r.Method, URL: redactURL(r.URL), Duration: time.Since(t.started)})
+	a.transcripts.index(requestID(r), t)
+	return r.WithContext(withTranscript(r.Context(), t))
+}
+
+// recordOutcome adds how the login of r ended to its transcript, if it has
+// one.
+func recordOutcome(r *http.Request, status int, message string) {
+	if t := transcriptFrom(r.Context()); t != nil {
+		t.add(transcriptLeg{Leg: "outcome", Status: status, Error: message, Duration: time.Since(t.started)})
+	}
+}
+
+// transcriptHandler serves the transcript of a login by the request ID of
+// its login or callback, for /api/v1/transcripts/<id>.
+func (a *app) transcriptHandler(w http.ResponseWriter, r *http.Request) {
+	t := a.transcripts.get(strings.TrimPrefix(r.URL.Path, "/api/v1/transcripts/"))
+	if !a.cfg.DebugTranscripts || t == nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(t)
+}
@@ -0,0 +1,102 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoginTranscript(t *testing.T) {
+	idp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+	}))
+	defer idp.Close()
+
+	a := newTestApp(t)
+	a.cfg.DebugTranscripts = true
+	a.httpClient = &http.Client{Transport: &transcriptTransport{next: http.DefaultTransport}}
+	a.trustedProxyNets, _ = parseCIDRs([]string{"10.0.0.0/8"})
+
+	login := httptest.NewRequest("GET", "/login", nil)
+	login.RemoteAddr = "10.0.0.2:41000"
+	login.Header.Set(requestIDHeader, "LOGN-0001")
+	var id string
+	a.withRequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id = a.startTranscript(r, "https://idp.example.com/authorize?client_id=gangway&state=the-state")
+	})).ServeHTTP(httptest.NewRecorder(), login)
+	if id != "LOGN-0001" {
+		t.Fatalf("got transcript %q, want the login's request ID", id)
+	}
+
+	callback := httptest.NewRequest("GET", "/callback?code=the-code&state=the-state", nil)
+	callback.RemoteAddr = "10.0.0.2:41000"
+	callback.Header.Set(requestIDHeader, "CALL-0001")
+	a.withRequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = a.continueTranscript(r, id)
+		req, _ := http.NewRequest("POST", idp.URL+"/token?client_secret=the-secret", nil)
+		resp, err := a.httpClient.Do(req.WithContext(r.Context()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		a.serveError(w, r, http.StatusBadGateway, "The identity provider refused the code")
+	})).ServeHTTP(httptest.NewRecorder(), callback)
+
+	// by the request ID on the error page as well as the login's
+	for _, id := range []string{"LOGN-0001", "CALL-0001"} {
+		rr := httptest.NewRecorder()
+		a.transcriptHandler(rr, httptest.NewRequest("GET", "/api/v1/transcripts/"+id, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: got status %d", id, rr.Code)
+		}
+		for _, secret := range []string{"the-code", "the-state", "the-secret"} {
+			if strings.Contains(rr.Body.String(), secret) {
+				t.Errorf("transcript contains %q: %s", secret, rr.Body.String())
+			}
+		}
+		var got struct {
+			ID   string          `json:"id"`
+			Legs []transcriptLeg `json:"legs"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		var legs []string
+		for _, leg := range got.Legs {
+			legs = append(legs, leg.Leg)
+		}
+		if got.ID != "LOGN-0001" || strings.Join(legs, ",") != "authorize,callback,request,outcome" {
+			t.Errorf("%s: got transcript %s with legs %v", id, got.ID, legs)
+		}
+		if got.Legs[2].Status != http.StatusBadRequest || got.Legs[3].Status != http.StatusBadGateway {
+			t.Errorf("got legs %+v", got.Legs)
+		}
+	}
+
+	// requests outside a recorded login are not added anywhere
+	if transcriptFrom(context.Background()) != nil {
+		t.Errorf("expected no transcript")
+	}
+
+	if n, _ := a.transcripts.purgeExpired(time.Now().Add(transcriptTTL + time.Minute)); n != 2 || a.transcripts.get("CALL-0001") != nil {
+		t.Errorf("purged %d transcripts, want both IDs", n)
+	}
+}
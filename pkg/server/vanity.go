@@ -0,0 +1,47 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+)
+
+// addVanityRedirects registers the redirects of Config.Redirects on mux, which
+// must already hold gangway's own routes. A redirect may not take over one of
+// them.
+func (a *app) addVanityRedirects(mux *http.ServeMux) error {
+	paths := make([]string, 0, len(a.cfg.Redirects))
+	for path := range a.cfg.Redirects {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		if path == "/healthz" || path == "/readyz" || path == "/metrics" {
+			return fmt.Errorf("redirect %s would shadow gangway's own route", path)
+		}
+		if _, pattern := mux.Handler(&http.Request{Method: http.MethodGet, URL: &url.URL{Path: path}}); pattern == path {
+			return fmt.Errorf("redirect %s would shadow gangway's own route", path)
+		}
+		target := a.cfg.Redirects[path]
+		mux.Handle(path, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, target, http.StatusFound)
+		}))
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestVanityRedirects(t *testing.T) {
+	s, err := New(&Config{
+		SessionSecurityKey: SessionKeys{"test"},
+		Redirects: map[string]string{
+			"/docs":  "https://wiki.example.com/kubernetes",
+			"/slack": "https://example.slack.com/join",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for path, want := range s.Config().Redirects {
+		rr := httptest.NewRecorder()
+		s.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		if rr.Code != http.StatusFound || rr.Header().Get("Location") != want {
+			t.Errorf("%s: got %d to %q, want %d to %q", path, rr.Code, rr.Header().Get("Location"), http.StatusFound, want)
+		}
+	}
+
+	// gangway's own pages are untouched
+	rr := httptest.NewRecorder()
+	s.ServeHTTP(rr, httptest.NewRequest("GET", "/docs/more", nil))
+	if rr.Code == http.StatusFound {
+		t.Errorf("/docs/more was redirected, want only the exact path to be")
+	}
+
+	for _, path := range []string{"/login", "/commandline", "/healthz", "/api/v1/transcripts/"} {
+		_, err := New(&Config{
+			SessionSecurityKey: SessionKeys{"test"},
+			Redirects:          map[string]string{path: "https://wiki.example.com"},
+		})
+		if err == nil || !strings.Contains(err.Error(), "shadow") {
+			t.Errorf("redirect %s: got error %v, want it refused", path, err)
+		}
+	}
+}
+
+func TestVanityRedirectsConfig(t *testing.T) {
+	tests := []struct {
+		path, target string
+		valid        bool
+	}{
+		{"/docs", "https://wiki.example.com/kubernetes", true},
+		{"/slack", "http://slack.example.com", true},
+		{"docs", "https://wiki.example.com", false},
+		{"/docs/", "https://wiki.example.com", false},
+		{"/docs?x=1", "https://wiki.example.com", false},
+		{"/docs", "/elsewhere", false},
+		{"/docs", "javascript:alert(1)", false},
+	}
+	for _, tc := range tests {
+		c, err := LoadConfig()
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.AuthorizeURL = "https://foo.bar/authorize"
+		c.TokenURL = "https://foo.bar/token"
+		c.ClientID = "foo"
+		c.ClientSecret = "bar"
+		c.RedirectURL = "https://foo.baz/callback"
+		c.SessionSecurityKey = SessionKeys{"testing"}
+		c.APIServerURL = "https://k8s-api.foo.baz"
+		c.Redirects = map[string]string{tc.path: tc.target}
+
+		if err := validateConfig(c); (err == nil) != tc.valid {
+			t.Errorf("redirect %q to %q: got error %v, want valid %v", tc.path, tc.target, err, tc.valid)
+		}
+	}
+}
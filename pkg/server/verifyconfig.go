@@ -0,0 +1,170 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// verifyTimeout limits each request VerifyConfig makes.
+const verifyTimeout = 10 * time.Second
+
+// VerifyConfig checks c before it is rolled out, as `gangway verify-config`
+// does, more thoroughly than ValidateConfig: the CA bundles, certificates and
+// keys it names must parse, and, unless offline, the identity provider's
+// endpoints must answer. It returns every problem found rather than the
+// first.
+func VerifyConfig(c *Config, offline bool) []error {
+	var problems []error
+	if err := ValidateConfig(c); err != nil {
+		problems = append(problems, err)
+	}
+
+	clusterCAPath := c.ClusterCAPath
+	if c.ClusterCA != "" {
+		// the inline CA replaces the file, which need not exist
+		clusterCAPath = ""
+	}
+	for _, bundle := range []struct{ option, path string }{
+		{"clusterCAPath", clusterCAPath},
+		{"trustedCAPath", c.TrustedCAPath},
+		{"apiClientCAPath", c.APIClientCAPath},
+		{"auditTLSCAFile", c.AuditTLSCAFile},
+	} {
+		if bundle.path == "" {
+			continue
+		}
+		if err := checkCABundle(bundle.path); err != nil {
+			problems = append(problems, fmt.Errorf("%s: %v", bundle.option, err))
+		}
+	}
+
+	for _, pair := range []struct {
+		option            string
+		used              bool
+		certFile, keyFile string
+	}{
+		{"certFile and keyFile", c.ServeTLS, c.CertFile, c.KeyFile},
+		{"apiCertFile and apiKeyFile", c.APIServeTLS, c.APICertFile, c.APIKeyFile},
+		{"auditTLSCertFile and auditTLSKeyFile", c.AuditTLSCertFile != "", c.AuditTLSCertFile, c.AuditTLSKeyFile},
+	} {
+		if !pair.used {
+			continue
+		}
+		if err := checkKeyPair(pair.certFile, pair.keyFile, time.Now()); err != nil {
+			problems = append(problems, fmt.Errorf("%s: %v", pair.option, err))
+		}
+	}
+
+	if !offline {
+		problems = append(problems, verifyEndpoints(c)...)
+	}
+	return problems
+}
+
+// checkCABundle checks that path holds at least one PEM certificate.
+func checkCABundle(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if !x509.NewCertPool().AppendCertsFromPEM(data) {
+		return fmt.Errorf("no PEM certificates in %s", path)
+	}
+	return nil
+}
+
+// checkKeyPair checks that certFile and keyFile are a matching key pair whose
+// certificate hasn't expired at now.
+func checkKeyPair(certFile, keyFile string, now time.Time) error {
+	if _, err := tls.LoadX509KeyPair(certFile, keyFile); err != nil {
+		return err
+	}
+	notAfter, err := certificateExpiry(certFile)
+	if err != nil {
+		return err
+	}
+	if !now.Before(notAfter) {
+		return fmt.Errorf("the certificate in %s expired at %s", certFile, notAfter.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// verifyEndpoints checks that the identity provider's metadata can be
+// discovered and that its endpoints answer, with the TLS settings gangway
+// would use.
+func verifyEndpoints(c *Config) []error {
+	tlsConfig, pins, err := idpTLSConfig(c)
+	if err != nil {
+		return []error{err}
+	}
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+
+	var problems []error
+	if c.IssuerURL != "" {
+		m, err := discoverProvider(client, c.IssuerURL)
+		if err != nil {
+			problems = append(problems, fmt.Errorf("issuerURL: %v", err))
+		} else if c.needsDiscovery() {
+			c = c.withDiscovery(m)
+			if pins != nil {
+				if err := pins.addHosts(c); err != nil {
+					problems = append(problems, err)
+				}
+			}
+		}
+	}
+
+	for _, endpoint := range []struct{ option, url string }{
+		{"authorizeURL", c.AuthorizeURL},
+		{"tokenURL", c.TokenURL},
+		{"jwksURL", c.JWKSURL},
+	} {
+		if endpoint.url == "" {
+			continue
+		}
+		if err := checkReachable(client, endpoint.url); err != nil {
+			problems = append(problems, fmt.Errorf("%s: %v", endpoint.option, err))
+		}
+	}
+	return problems
+}
+
+// checkReachable checks that url answers a GET without a server error.
+// Endpoints such as the token endpoint refuse a bare GET, but a client error
+// still shows that they are there.
+func checkReachable(client *http.Client, url string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), verifyTimeout)
+	defer cancel()
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("%s answered %s", url, resp.Status)
+	}
+	return nil
+}
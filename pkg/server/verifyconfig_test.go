@@ -0,0 +1,115 @@
+// Copyright © 2017 Heptio
+// Copyright © 2017 Craig Tracey
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyConfig(t *testing.T) {
+	tokenStatus := http.StatusMethodNotAllowed
+	var issuer string
+	idp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			json.NewEncoder(w).Encode(map[string]string{
+				"issuer":                 issuer,
+				"authorization_endpoint": issuer + "/auth",
+				"token_endpoint":         issuer + "/token",
+				"jwks_uri":               issuer + "/keys",
+			})
+		case "/auth":
+			http.Error(w, "missing client_id", http.StatusBadRequest)
+		case "/token":
+			w.WriteHeader(tokenStatus)
+		case "/keys":
+			w.Write([]byte(`{"keys": []}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer idp.Close()
+	issuer = idp.URL
+
+	dir, err := ioutil.TempDir("", "gangway-verify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	caFile := writeTestCert(t, time.Now().Add(time.Hour))
+	defer os.Remove(caFile)
+
+	c, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.IssuerURL = issuer
+	c.AuthorizeURL, c.TokenURL = "", ""
+	c.ClientID = "gangway"
+	c.RedirectURL = "https://gangway.example.com/callback"
+	c.APIServerURL = "https://k8s.example.com"
+	c.ClusterCAPath = caFile
+	c.SessionSecurityKey = SessionKeys{"testing"}
+	if problems := VerifyConfig(c, false); len(problems) != 0 {
+		t.Fatalf("unexpected problems: %v", problems)
+	}
+
+	// an inline cluster CA replaces clusterCAPath
+	ca, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.ClusterCA, c.ClusterCAPath = string(ca), filepath.Join(dir, "missing.crt")
+	if problems := VerifyConfig(c, true); len(problems) != 0 {
+		t.Errorf("unexpected problems with an inline clusterCA: %v", problems)
+	}
+
+	// a certificate without its key, a CA bundle that isn't one, and a
+	// failing token endpoint are all reported
+	notCA := filepath.Join(dir, "ca.crt")
+	if err := ioutil.WriteFile(notCA, []byte("not a certificate"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c.TrustedCAPath = notCA
+	c.ServeTLS = true
+	c.CertFile, c.KeyFile = caFile, filepath.Join(dir, "missing.key")
+	tokenStatus = http.StatusBadGateway
+	problems := VerifyConfig(c, false)
+	var messages []string
+	for _, p := range problems {
+		messages = append(messages, p.Error())
+	}
+	got := strings.Join(messages, "\n")
+	for _, want := range []string{"trustedCAPath: no PEM certificates", "certFile and keyFile:", "tokenURL:"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("problems don't mention %q:\n%s", want, got)
+		}
+	}
+	if len(problems) != 3 {
+		t.Errorf("got %d problems, want 3:\n%s", len(problems), got)
+	}
+
+	if problems := VerifyConfig(c, true); len(problems) != 2 {
+		t.Errorf("got %d problems offline, want 2: %v", len(problems), problems)
+	}
+}
@@ -0,0 +1,16 @@
+// Hide the credentials on the commandline page once the page has been open
+// for data-display-ttl seconds. "Show again" fetches them from gangway anew.
+(function() {
+  var ttl = parseInt(document.body.getAttribute('data-display-ttl'), 10);
+  if (!ttl) {
+    return;
+  }
+
+  setTimeout(function() {
+    var blocks = document.querySelectorAll('.credentials');
+    for (var i = 0; i < blocks.length; i++) {
+      blocks[i].parentNode.removeChild(blocks[i]);
+    }
+    document.getElementById('credentials-hidden').style.display = 'block';
+  }, ttl * 1000);
+})();
@@ -0,0 +1,11 @@
+// Open and close the side navigation of small screens from its menu button.
+(function() {
+  var buttons = document.querySelectorAll('.button-collapse');
+  for (var i = 0; i < buttons.length; i++) {
+    buttons[i].addEventListener('click', function(e) {
+      e.preventDefault();
+      var nav = document.getElementById(this.getAttribute('data-activates'));
+      nav.style.transform = nav.style.transform ? '' : 'translateX(0)';
+    });
+  }
+})();
@@ -0,0 +1,11 @@
+// Runs in the hidden frame at the end of a silent login and tells the
+// commandline page how it went.
+(function() {
+  if (window.parent === window) {
+    return;
+  }
+  window.parent.postMessage({
+    type: 'gangway-silent-renew',
+    error: document.body.getAttribute('data-error')
+  }, window.location.origin);
+})();
@@ -0,0 +1,52 @@
+// Renews the session every data-silent-renew seconds, while the page is
+// visible, with a prompt=none login in a hidden frame. Once the identity
+// provider wants the user to sign in again, renewing stops.
+(function() {
+  var interval = parseInt(document.body.getAttribute('data-silent-renew'), 10);
+  var basePath = document.body.getAttribute('data-base-path');
+  if (!interval) {
+    return;
+  }
+
+  var last = Date.now();
+  var frame = null;
+  var stopped = false;
+
+  function done() {
+    if (frame) {
+      frame.parentNode.removeChild(frame);
+      frame = null;
+    }
+  }
+
+  function renewIfDue() {
+    if (stopped || frame || document.visibilityState === 'hidden' || Date.now() - last < interval * 1000) {
+      return;
+    }
+    last = Date.now();
+    frame = document.createElement('iframe');
+    frame.style.display = 'none';
+    frame.src = basePath + '/login?prompt=none';
+    document.body.appendChild(frame);
+    // give up on providers that never come back
+    setTimeout(done, 30000);
+  }
+
+  window.addEventListener('message', function(event) {
+    if (event.origin !== window.location.origin || !event.data || event.data.type !== 'gangway-silent-renew') {
+      return;
+    }
+    done();
+    if (event.data.error) {
+      stopped = true;
+      return;
+    }
+    var notice = document.getElementById('credentials-renewed');
+    if (notice) {
+      notice.style.display = 'block';
+    }
+  });
+
+  document.addEventListener('visibilitychange', renewIfDue);
+  setInterval(renewIfDue, 60000);
+})();
@@ -0,0 +1,24 @@
+// In strict mode the kubectl commands are not part of the page. Fetch them
+// only when the user asks to copy them, straight into the clipboard.
+(function() {
+  var button = document.getElementById('copy-commands');
+  var status = document.getElementById('copy-status');
+
+  button.addEventListener('click', function(e) {
+    e.preventDefault();
+    var xhr = new XMLHttpRequest();
+    xhr.open('GET', button.getAttribute('data-src'));
+    xhr.onload = function() {
+      if (xhr.status !== 200) {
+        status.textContent = 'Could not fetch the commands, please reload the page.';
+        return;
+      }
+      navigator.clipboard.writeText(xhr.responseText).then(function() {
+        status.textContent = 'Copied to clipboard.';
+      }, function() {
+        status.textContent = 'Could not copy to the clipboard, please use the download instead.';
+      });
+    };
+    xhr.send();
+  });
+})();